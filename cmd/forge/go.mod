@@ -0,0 +1,15 @@
+module github.com/forge-ai/forge/cmd/forge
+
+go 1.22
+
+require (
+	github.com/forge-ai/forge/shared v0.0.0
+	github.com/gorilla/websocket v1.5.1
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/net v0.17.0 // indirect
+)
+
+replace github.com/forge-ai/forge/shared => ../../shared
@@ -0,0 +1,146 @@
+// forge submits jobs to a Forge gateway and follows them from the
+// terminal, for CI and scripts:
+//
+//	forge submit --figma <url> --platforms react,kmp --threshold 90
+//	forge watch <job_id>
+//
+// submit prints the job id; watch tails the job's log and exits 0 when it
+// is done, 1 when it fails. The gateway is FORGE_GATEWAY, or --gateway.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exit codes besides 0: the job, or the command itself, failed.
+const (
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+const usage = `usage:
+  forge submit --figma <url> [--platforms react,kmp] [--threshold 90] [--watch]
+  forge watch <job_id>
+
+The gateway is $FORGE_GATEWAY, default http://localhost:8080; --gateway overrides it.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+	var code int
+	switch os.Args[1] {
+	case "submit":
+		code = submit(os.Args[2:])
+	case "watch":
+		code = watchCmd(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "forge: unknown command %q\n\n%s", os.Args[1], usage)
+		code = exitUsage
+	}
+	os.Exit(code)
+}
+
+func gatewayFlag(fs *flag.FlagSet) *string {
+	def := os.Getenv("FORGE_GATEWAY")
+	if def == "" {
+		def = "http://localhost:8080"
+	}
+	return fs.String("gateway", def, "gateway base URL")
+}
+
+func submit(args []string) int {
+	fs := flag.NewFlagSet("submit", flag.ContinueOnError)
+	gateway := gatewayFlag(fs)
+	figma := fs.String("figma", "", "Figma file or frame URL (required)")
+	platforms := fs.String("platforms", "", "comma-separated platforms; the gateway's default if empty")
+	threshold := fs.Int("threshold", 0, "similarity target, 0-100; the gateway's default if 0")
+	repo := fs.String("repo", "", "repository the generated code targets")
+	follow := fs.Bool("watch", false, "watch the job after submitting it")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *figma == "" {
+		fmt.Fprintln(os.Stderr, "forge submit: --figma is required")
+		return exitUsage
+	}
+
+	req := map[string]any{"figma_url": *figma}
+	if *platforms != "" {
+		req["platforms"] = strings.Split(*platforms, ",")
+	}
+	if *threshold != 0 {
+		req["threshold"] = *threshold
+	}
+	if *repo != "" {
+		req["repo_url"] = *repo
+	}
+	body, _ := json.Marshal(req)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(strings.TrimRight(*gateway, "/")+"/api/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "forge submit:", err)
+		return exitFailed
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var res struct {
+		JobID  string            `json:"job_id"`
+		Error  string            `json:"error"`
+		Errors map[string]string `json:"errors"`
+	}
+	_ = json.Unmarshal(raw, &res)
+	if resp.StatusCode != http.StatusCreated {
+		fmt.Fprintf(os.Stderr, "forge submit: gateway %d", resp.StatusCode)
+		switch {
+		case res.Error != "":
+			fmt.Fprintf(os.Stderr, ": %s", res.Error)
+		case len(res.Errors) > 0:
+			fields := make([]string, 0, len(res.Errors))
+			for f := range res.Errors {
+				fields = append(fields, f)
+			}
+			sort.Strings(fields)
+			for _, f := range fields {
+				fmt.Fprintf(os.Stderr, "\n  %s: %s", f, res.Errors[f])
+			}
+		default:
+			fmt.Fprintf(os.Stderr, ": %s", bytes.TrimSpace(raw))
+		}
+		fmt.Fprintln(os.Stderr)
+		return exitFailed
+	}
+
+	fmt.Println(res.JobID)
+	if *follow {
+		return watch(*gateway, res.JobID)
+	}
+	return 0
+}
+
+func watchCmd(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	gateway := gatewayFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "forge watch: want exactly one job id")
+		return exitUsage
+	}
+	return watch(*gateway, fs.Arg(0))
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/gorilla/websocket"
+)
+
+// replayLast is how much of the job's history the first connection asks
+// the gateway for, so a job watched after it started is shown from near
+// its beginning.
+const replayLast = 200
+
+// maxReconnects is how many connections in a row may fail before watch
+// gives up; one that delivers anything resets the count.
+const maxReconnects = 5
+
+// watch tails jobID's events until the job ends, returning the exit code.
+func watch(gateway, jobID string) int {
+	base, err := url.Parse(strings.TrimRight(gateway, "/"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "forge watch:", err)
+		return exitUsage
+	}
+	p := printer{color: colorOutput()}
+	var lastID string
+	for failures := 0; ; {
+		code, progressed, err := follow(base, jobID, &lastID, p)
+		if err == nil {
+			return code
+		}
+		if progressed {
+			failures = 0
+		}
+		if failures++; failures > maxReconnects {
+			fmt.Fprintln(os.Stderr, "forge watch:", err)
+			return exitFailed
+		}
+		fmt.Fprintf(os.Stderr, "forge watch: %v — reconnecting\n", err)
+		time.Sleep(time.Duration(failures) * time.Second)
+	}
+}
+
+// follow streams one connection's worth of jobID's events, picking up
+// after lastID, which it keeps current. It returns an exit code once the
+// job has ended, or an error when the connection does; progressed reports
+// whether it delivered anything before that.
+func follow(base *url.URL, jobID string, lastID *string, p printer) (code int, progressed bool, err error) {
+	ws := *base
+	ws.Scheme = map[string]string{"https": "wss"}[base.Scheme]
+	if ws.Scheme == "" {
+		ws.Scheme = "ws"
+	}
+	ws.Path += "/ws"
+	q := url.Values{"job": {jobID}}
+	if *lastID != "" {
+		q.Set("since", *lastID)
+	} else {
+		q.Set("last", fmt.Sprint(replayLast))
+	}
+	ws.RawQuery = q.Encode()
+
+	conn, _, err := websocket.DefaultDialer.Dial(ws.String(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	// A job that already ended sends nothing more: show what is replayed
+	// of it, then how it ended, as the gateway stored it.
+	var stored *jobStatus
+	if *lastID == "" {
+		if stored = jobEnded(base, jobID); stored != nil {
+			conn.SetReadDeadline(time.Now().Add(replayWait))
+		}
+	}
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil && stored != nil {
+			return stored.report(p), progressed, nil
+		}
+		if err != nil {
+			return 0, progressed, err
+		}
+		env, err := events.UnwrapEnvelope(msg)
+		if err != nil {
+			continue
+		}
+		var about struct {
+			JobID string `json:"job_id"`
+		}
+		if json.Unmarshal(env.Payload, &about) != nil || about.JobID != jobID {
+			continue
+		}
+		*lastID, progressed = env.ID, true
+		if code, ended := p.event(env); ended {
+			return code, true, nil
+		}
+	}
+}
+
+// replayWait is how long the replay of a job that already ended is given
+// to arrive.
+const replayWait = 2 * time.Second
+
+// jobStatus is the part of the gateway's job row watch reads.
+type jobStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// jobEnded returns the job's stored status if it is done or failed. A
+// gateway without a database, or an unknown job, counts as not ended.
+func jobEnded(base *url.URL, jobID string) *jobStatus {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(base.String() + "/api/jobs/" + url.PathEscape(jobID))
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	var job jobStatus
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&job) != nil {
+		return nil
+	}
+	if job.Status != "done" && job.Status != "failed" {
+		return nil
+	}
+	return &job
+}
+
+// report prints how the job ended and returns the exit code for it.
+func (j *jobStatus) report(p printer) int {
+	if j.Status == "failed" {
+		p.line(time.Now(), levelError, "job", "job failed: "+j.Error)
+		return exitFailed
+	}
+	p.line(time.Now(), levelInfo, "job", "job done")
+	return 0
+}
+
+// printer writes events as log lines, levels colored on a terminal.
+type printer struct{ color bool }
+
+const (
+	levelDebug = "debug"
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+var levelColor = map[string]string{
+	levelDebug: "\x1b[90m",
+	levelInfo:  "\x1b[36m",
+	levelWarn:  "\x1b[33m",
+	levelError: "\x1b[31m",
+}
+
+// colorOutput reports whether stdout is a terminal and NO_COLOR is unset.
+func colorOutput() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p printer) line(at time.Time, level, step, msg string) {
+	tag := fmt.Sprintf("%-5s", strings.ToUpper(level))
+	if c, ok := levelColor[level]; ok && p.color {
+		tag = c + tag + "\x1b[0m"
+	}
+	fmt.Printf("%s %s %-14s %s\n", at.Local().Format("15:04:05"), tag, step, msg)
+}
+
+// event prints env, reporting whether it ended the job and with what exit
+// code.
+func (p printer) event(env *events.Envelope) (code int, ended bool) {
+	switch {
+	case strings.HasPrefix(env.RoutingKey, "log."):
+		var l events.LogEventPayload
+		if json.Unmarshal(env.Payload, &l) == nil {
+			p.line(env.Timestamp, l.Level, l.Step, l.Message)
+		}
+	case env.RoutingKey == events.ScreenDone:
+		var s events.ScreenDonePayload
+		if json.Unmarshal(env.Payload, &s) == nil {
+			msg := fmt.Sprintf("%s [%s] %.1f%% after %d iterations", s.ScreenName, s.Platform, s.Score, s.Iterations)
+			if s.Status != "" {
+				msg += " — " + strings.ReplaceAll(s.Status, "_", " ")
+			}
+			p.line(env.Timestamp, levelInfo, "screen_done", msg)
+		}
+	case env.RoutingKey == events.JobDone:
+		var d events.JobDonePayload
+		_ = json.Unmarshal(env.Payload, &d)
+		msg := fmt.Sprintf("job done: %d screens, average %.1f%%, %d iterations", d.Screens, d.AvgScore, d.TotalIter)
+		if d.Cost.USD > 0 {
+			msg += fmt.Sprintf(", cost $%.2f", d.Cost.USD)
+		}
+		if d.ManifestURL != "" {
+			msg += " — " + d.ManifestURL
+		}
+		p.line(env.Timestamp, levelInfo, "job", msg)
+		return 0, true
+	case env.RoutingKey == events.JobFailed:
+		var f events.JobFailedPayload
+		_ = json.Unmarshal(env.Payload, &f)
+		p.line(env.Timestamp, levelError, "job", fmt.Sprintf("job failed at %s: %s", f.Step, f.Error))
+		return exitFailed, true
+	}
+	return 0, false
+}
@@ -21,7 +21,7 @@ trap cleanup EXIT INT TERM
 
 start_svc() {
   local name=$1
-  (cd "$ROOT/services/$name" && go run ./main.go 2>&1 | sed "s/^/[$name] /") &
+  (cd "$ROOT/services/$name" && go run . 2>&1 | sed "s/^/[$name] /") &
   PIDS+=($!)
   sleep 0.3
 }
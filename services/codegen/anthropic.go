@@ -7,46 +7,64 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 const anthropicURL = "https://api.anthropic.com/v1/messages"
 
 // AnthropicProvider implements the Provider interface for Anthropic's Claude API.
 type AnthropicProvider struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey    string
+	model     string
+	maxTokens int
+	timeout   time.Duration
+	client    *http.Client
 }
 
 // NewAnthropicProvider creates a new Anthropic provider instance.
-func NewAnthropicProvider(apiKey, model string) *AnthropicProvider {
+// maxTokens caps each response; see LLM_MAX_TOKENS. timeout bounds a
+// call, or a stream's silences; see LLM_HTTP_TIMEOUT.
+func NewAnthropicProvider(apiKey, model string, maxTokens int, timeout time.Duration) *AnthropicProvider {
 	return &AnthropicProvider{
-		apiKey: apiKey,
-		model:  model,
-		client: &http.Client{},
+		apiKey:    apiKey,
+		model:     model,
+		maxTokens: maxTokens,
+		timeout:   timeout,
+		client:    newLLMClient(timeout),
 	}
 }
 
-// Generate calls the Anthropic Claude API and returns generated code.
-func (ap *AnthropicProvider) Generate(ctx context.Context, prompt string) (string, error) {
+func (ap *AnthropicProvider) newRequest(ctx context.Context, system, prompt string, stream bool) (*http.Request, error) {
 	body, _ := json.Marshal(map[string]any{
 		"model":      ap.model,
-		"max_tokens": 8192,
-		"system":     "You are an expert UI engineer. Output only raw code, never markdown fences or explanations.",
+		"max_tokens": ap.maxTokens,
+		"system":     system,
 		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+		"stream":     stream,
 	})
 
 	req, err := http.NewRequestWithContext(ctx, "POST", anthropicURL, bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", ap.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
+	return req, nil
+}
+
+// Generate calls the Anthropic Claude API and returns generated code.
+func (ap *AnthropicProvider) Generate(ctx context.Context, system, prompt string) (string, Usage, error) {
+	ctx, cancel := context.WithTimeout(ctx, ap.timeout)
+	defer cancel()
+	req, err := ap.newRequest(ctx, system, prompt, false)
+	if err != nil {
+		return "", Usage{}, err
+	}
 
 	resp, err := ap.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("anthropic request: %w", err)
+		return "", Usage{}, fmt.Errorf("anthropic request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -56,19 +74,118 @@ func (ap *AnthropicProvider) Generate(ctx context.Context, prompt string) (strin
 		Content []struct {
 			Text string `json:"text"`
 		} `json:"content"`
-		Error *struct {
+		StopReason string         `json:"stop_reason"`
+		Usage      anthropicUsage `json:"usage"`
+		Error      *struct {
 			Message string `json:"message"`
 		} `json:"error"`
 	}
 	if err := json.Unmarshal(raw, &ar); err != nil {
-		return "", fmt.Errorf("decode: %w", err)
+		if resp.StatusCode != http.StatusOK {
+			return "", Usage{}, apiError("anthropic", resp.StatusCode, string(raw))
+		}
+		return "", Usage{}, fmt.Errorf("decode: %w", err)
 	}
 	if ar.Error != nil {
-		return "", fmt.Errorf("anthropic: %s", ar.Error.Message)
+		return "", Usage{}, apiError("anthropic", resp.StatusCode, ar.Error.Message)
+	}
+	if ar.StopReason == "max_tokens" {
+		return "", ar.Usage.usage(), &TruncatedError{Provider: "anthropic", MaxTokens: ap.maxTokens}
 	}
 	if len(ar.Content) == 0 {
-		return "", fmt.Errorf("empty response")
+		return "", ar.Usage.usage(), fmt.Errorf("empty response")
 	}
 
-	return stripFences(ar.Content[0].Text), nil
+	return stripFences(ar.Content[0].Text), ar.Usage.usage(), nil
+}
+
+// anthropicUsage is the usage the Messages API reports. Prompt caching
+// bills cached input apart from the rest; it all counts as input here.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+func (u anthropicUsage) usage() Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens: u.OutputTokens,
+	}
+}
+
+// GenerateStream calls the Anthropic Messages API with stream=true and
+// forwards text deltas as they arrive.
+func (ap *AnthropicProvider) GenerateStream(ctx context.Context, system, prompt string) (<-chan StreamChunk, error) {
+	reqCtx, cancel := context.WithCancel(ctx)
+	req, err := ap.newRequest(reqCtx, system, prompt, true)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := ap.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("anthropic request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, apiError("anthropic", resp.StatusCode, string(raw))
+	}
+
+	out := make(chan StreamChunk, 16)
+	// message_delta says why generation stopped; the usage it carries is
+	// sent on before a truncation fails the stream at message_stop.
+	truncated := false
+	go readSSE(ctx, newIdleBody(resp.Body, ap.timeout, cancel), out, func(data string) (StreamChunk, bool, error) {
+		var ev struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			// message_start carries the input tokens, message_delta the
+			// output so far.
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Usage *anthropicUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return StreamChunk{}, false, fmt.Errorf("decode stream event: %w", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			u := ev.Message.Usage.usage()
+			u.OutputTokens = 0
+			return StreamChunk{Usage: &u}, false, nil
+		case "message_delta":
+			truncated = truncated || ev.Delta.StopReason == "max_tokens"
+			if ev.Usage != nil {
+				u := Usage{OutputTokens: ev.Usage.OutputTokens}
+				return StreamChunk{Usage: &u}, false, nil
+			}
+		case "content_block_delta":
+			return StreamChunk{Text: ev.Delta.Text}, false, nil
+		case "message_stop":
+			if truncated {
+				return StreamChunk{}, true, &TruncatedError{Provider: "anthropic", MaxTokens: ap.maxTokens}
+			}
+			return StreamChunk{}, true, nil
+		case "error":
+			if ev.Error != nil {
+				return StreamChunk{}, false, apiError("anthropic", 0, ev.Error.Message)
+			}
+			return StreamChunk{}, false, apiError("anthropic", 0, "stream error")
+		}
+		return StreamChunk{}, false, nil
+	})
+	return out, nil
 }
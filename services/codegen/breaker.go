@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// breakerState is where a breaker is: closed lets generations through,
+// open turns them away, half-open lets one through to probe the providers.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// probeWait is how long a generation is turned away while a half-open
+// breaker's probe is out, at most.
+const probeWait = 5 * time.Second
+
+// breaker stops the service's generations while the providers are down,
+// rather than have every worker retry into an outage. After threshold
+// generations in a row fail on one, each having used up its retries and
+// fallbacks, it opens for cooldown. The first generation after that probes
+// the providers: it closes the breaker if it gets an answer and opens it
+// again if it doesn't. A threshold of 0 never opens.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // generations failed in a row, while closed
+	until    time.Time // end of the cooldown, while open
+	probing  bool      // a probe is out, while half-open
+}
+
+// acquire asks for a generation to call the providers at now. wait is how
+// long until one may, 0 if this one may now; probe marks it the half-open
+// breaker's probe, and changed that asking half-opened it.
+func (b *breaker) acquire(now time.Time) (wait time.Duration, probe, changed bool) {
+	if b.threshold <= 0 {
+		return 0, false, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Before(b.until) {
+			return b.until.Sub(now), false, false
+		}
+		b.state, b.probing = breakerHalfOpen, true
+		return 0, true, true
+	case breakerHalfOpen:
+		if b.probing {
+			return min(b.cooldown, probeWait), false, false
+		}
+		b.probing = true
+		return 0, true, false
+	}
+	return 0, false, false
+}
+
+// record counts how a generation acquire let through ended, err nil if it
+// succeeded, and returns the breaker's state and whether that changed it.
+// Only outages count against the providers; a cancelled generation counts
+// for nothing. Generations let through before the breaker opened no
+// longer count once it has.
+func (b *breaker) record(now time.Time, probe bool, err error) (breakerState, bool) {
+	if b.threshold <= 0 {
+		return breakerClosed, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		if probe {
+			b.probing = false
+		}
+		return b.state, false
+	}
+	switch {
+	case probe && outage(err):
+		b.open(now)
+		return b.state, true
+	case probe:
+		b.state, b.probing, b.failures = breakerClosed, false, 0
+		return b.state, true
+	case b.state != breakerClosed:
+		return b.state, false
+	case !outage(err):
+		b.failures = 0
+		return b.state, false
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return b.state, false
+	}
+	b.open(now)
+	return b.state, true
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state, b.probing, b.failures = breakerOpen, false, 0
+	b.until = now.Add(b.cooldown)
+}
+
+// outage reports whether err means the providers couldn't be had: an
+// overload, rate limit, server or transport error. A provider that
+// answered, however uselessly, is up.
+func outage(err error) bool {
+	if err == nil || !isRetryable(err) {
+		return false
+	}
+	var pe *ProviderError
+	return !errors.As(err, &pe) || !pe.Answered
+}
+
+// circuitOpenError turns a generation away while the breaker is open.
+type circuitOpenError struct {
+	wait time.Duration // until it may be tried again
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("LLM providers unavailable — generation paused for %s", e.wait.Round(time.Second))
+}
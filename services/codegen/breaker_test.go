@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var (
+	overloaded = apiError("anthropic", 529, "overloaded")
+	badRequest = apiError("anthropic", 400, "bad request")
+	// answered is a provider that replied with nothing usable: up, though
+	// the generation failed over.
+	answered = &ProviderError{Provider: "anthropic", Message: "no code in reply", Retryable: true, Answered: true}
+)
+
+// fail runs n generations through b at now, each ending in err.
+func fail(t *testing.T, b *breaker, now time.Time, n int, err error) (breakerState, bool) {
+	t.Helper()
+	var state breakerState
+	var changed bool
+	for i := 0; i < n; i++ {
+		if wait, probe, _ := b.acquire(now); wait != 0 || probe {
+			t.Fatalf("generation %d: wait %s, probe %v with the breaker %s", i, wait, probe, b.state)
+		}
+		state, changed = b.record(now, false, err)
+	}
+	return state, changed
+}
+
+func TestBreakerOpensAtThreshold(t *testing.T) {
+	b := &breaker{threshold: 3, cooldown: time.Minute}
+	now := time.Now()
+	if state, changed := fail(t, b, now, 2, overloaded); state != breakerClosed || changed {
+		t.Fatalf("after 2 outages: %s, changed %v", state, changed)
+	}
+	if state, changed := fail(t, b, now, 1, overloaded); state != breakerOpen || !changed {
+		t.Fatalf("after 3 outages: %s, changed %v", state, changed)
+	}
+	wait, probe, _ := b.acquire(now.Add(10 * time.Second))
+	if wait != 50*time.Second || probe {
+		t.Errorf("while open: wait %s, probe %v; want the rest of the cooldown", wait, probe)
+	}
+}
+
+func TestBreakerCountsOutagesInARow(t *testing.T) {
+	b := &breaker{threshold: 3, cooldown: time.Minute}
+	now := time.Now()
+	fail(t, b, now, 2, overloaded)
+	fail(t, b, now, 1, nil) // a success starts the count over
+	if state, _ := fail(t, b, now, 2, overloaded); state != breakerClosed {
+		t.Errorf("opened on outages not in a row")
+	}
+}
+
+func TestBreakerIgnoresAnsweredErrors(t *testing.T) {
+	for _, err := range []error{answered, badRequest, &TruncatedError{}, context.Canceled, fmt.Errorf("generate: %w", answered)} {
+		b := &breaker{threshold: 2, cooldown: time.Minute}
+		if state, _ := fail(t, b, time.Now(), 5, err); state != breakerClosed {
+			t.Errorf("%v opened the breaker", err)
+		}
+	}
+	// A useless answer still shows the provider is up: the count starts over.
+	b := &breaker{threshold: 2, cooldown: time.Minute}
+	fail(t, b, time.Now(), 1, overloaded)
+	fail(t, b, time.Now(), 1, answered)
+	if state, _ := fail(t, b, time.Now(), 1, overloaded); state != breakerClosed {
+		t.Error("an answered error did not start the count over")
+	}
+}
+
+// opened returns a breaker of threshold 1 opened at now.
+func opened(t *testing.T, now time.Time) *breaker {
+	t.Helper()
+	b := &breaker{threshold: 1, cooldown: time.Minute}
+	if state, _ := fail(t, b, now, 1, overloaded); state != breakerOpen {
+		t.Fatal("breaker did not open")
+	}
+	return b
+}
+
+func TestBreakerClosesOnProbeSuccess(t *testing.T) {
+	now := time.Now()
+	b := opened(t, now)
+	later := now.Add(time.Minute)
+	wait, probe, changed := b.acquire(later)
+	if wait != 0 || !probe || !changed {
+		t.Fatalf("after the cooldown: wait %s, probe %v, changed %v; want a probe", wait, probe, changed)
+	}
+	// Others wait for the probe, a while at most.
+	if wait, probe, _ := b.acquire(later); wait != probeWait || probe {
+		t.Errorf("during the probe: wait %s, probe %v", wait, probe)
+	}
+	// A generation let through before the breaker opened ends now.
+	if state, changed := b.record(later, false, nil); state != breakerHalfOpen || changed {
+		t.Errorf("a stale success moved the breaker to %s", state)
+	}
+	if state, changed := b.record(later, true, answered); state != breakerClosed || !changed {
+		t.Fatalf("probe answered: %s, changed %v", state, changed)
+	}
+	if wait, probe, _ := b.acquire(later); wait != 0 || probe {
+		t.Errorf("closed: wait %s, probe %v", wait, probe)
+	}
+	// And it counts from nothing again.
+	if state, _ := fail(t, b, later, 1, overloaded); state != breakerOpen {
+		t.Error("closed breaker didn't open at its threshold")
+	}
+}
+
+func TestBreakerReopensOnProbeFailure(t *testing.T) {
+	now := time.Now()
+	b := opened(t, now)
+	later := now.Add(time.Minute)
+	if _, probe, _ := b.acquire(later); !probe {
+		t.Fatal("no probe after the cooldown")
+	}
+	if state, changed := b.record(later, true, overloaded); state != breakerOpen || !changed {
+		t.Fatalf("probe failed: %s, changed %v", state, changed)
+	}
+	if wait, probe, _ := b.acquire(later.Add(time.Second)); wait != 59*time.Second || probe {
+		t.Errorf("reopened: wait %s, probe %v; want a fresh cooldown", wait, probe)
+	}
+}
+
+func TestBreakerReleasesCancelledProbe(t *testing.T) {
+	now := time.Now()
+	b := opened(t, now)
+	later := now.Add(time.Minute)
+	if _, probe, _ := b.acquire(later); !probe {
+		t.Fatal("no probe after the cooldown")
+	}
+	if state, changed := b.record(later, true, fmt.Errorf("stream: %w", context.Canceled)); state != breakerHalfOpen || changed {
+		t.Fatalf("cancelled probe: %s, changed %v", state, changed)
+	}
+	// The slot is free for the next generation to probe with.
+	wait, probe, changed := b.acquire(later)
+	if wait != 0 || !probe || changed {
+		t.Errorf("after a cancelled probe: wait %s, probe %v, changed %v; want the next to probe", wait, probe, changed)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := &breaker{cooldown: time.Minute}
+	if state, changed := fail(t, b, time.Now(), 100, overloaded); state != breakerClosed || changed {
+		t.Errorf("threshold 0: %s", state)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// fencedBlock matches a markdown code block anywhere in the response.
+var fencedBlock = regexp.MustCompile("(?s)(?:```|~~~)[\\w+-]*[ \\t]*\\n(.*?)\\n[ \\t]*(?:```|~~~)")
+
+// codeStarts are line prefixes that begin real code, per platform family.
+var (
+	tsxStarts = []string{"import ", "import{", "export ", "'use client'", `"use client"`, "const ", "function ", "type ", "interface ", "/**", "//"}
+	ktStarts  = []string{"package ", "import ", "@Composable", "@file:", "@OptIn", "@Preview", "fun ", "private fun ", "internal fun ", "val ", "private val ", "/**", "//"}
+)
+
+// topLevelFun matches a Kotlin function declaration at the start of a line,
+// optionally preceded by annotations and a visibility modifier.
+var topLevelFun = regexp.MustCompile(`(?m)^\s*(?:@\w+\s+)*(?:(?:public|internal|private)\s+)?fun\s`)
+
+// extractCode pulls the component source out of a model response that may
+// wrap it in prose or fences despite the instructions: the largest fenced
+// block if there is one, otherwise everything from the first line that
+// starts a code construct, minus any trailing explanation.
+func extractCode(raw, platform string) string {
+	raw = strings.TrimSpace(raw)
+	if blocks := fencedBlock.FindAllStringSubmatch(raw, -1); len(blocks) > 0 {
+		best := blocks[0][1]
+		for _, b := range blocks[1:] {
+			if len(b[1]) > len(best) {
+				best = b[1]
+			}
+		}
+		return strings.TrimSpace(best)
+	}
+	raw = stripFences(raw)
+
+	starts := tsxStarts
+	if platform == events.PlatformKMP {
+		starts = ktStarts
+	}
+	lines := strings.Split(raw, "\n")
+	first := 0
+	for i, l := range lines {
+		if hasAnyPrefix(strings.TrimSpace(l), starts) {
+			first = i
+			break
+		}
+	}
+	lines = lines[first:]
+
+	// Drop trailing prose: lines with no code punctuation that don't start
+	// a code construct either.
+	last := len(lines) - 1
+	for last > 0 {
+		l := strings.TrimSpace(lines[last])
+		if l == "" || !strings.ContainsAny(l, "{}();=<>") && !hasAnyPrefix(l, starts) {
+			last--
+			continue
+		}
+		break
+	}
+	return strings.TrimSpace(strings.Join(lines[:last+1], "\n"))
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCode is a cheap sanity check run before the code is sandboxed:
+// the component must be declared the way the scaffold imports it. It is not
+// a parser — anything it passes can still fail to compile — but it catches
+// prose-only responses.
+func validateCode(code, platform string) error {
+	if strings.TrimSpace(code) == "" {
+		return fmt.Errorf("empty code")
+	}
+	if platform == events.PlatformKMP {
+		if !strings.Contains(code, "@Composable") || !topLevelFun.MatchString(code) {
+			return fmt.Errorf("no top-level @Composable fun")
+		}
+		return nil
+	}
+	if !strings.Contains(code, "export default") {
+		return fmt.Errorf("no default export")
+	}
+	return nil
+}
+
+// lintCode returns what looks wrong with code that passed validateCode.
+// Its checks are heuristics that valid code can trip, so they don't reject
+// it: the sandbox build decides, and the warnings go into the next
+// iteration's prompt.
+func lintCode(code string) []string {
+	if err := checkBrackets(code); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// checkBrackets verifies {}, () and [] nest correctly outside comments,
+// string and template literals and regular expressions. A quote with no
+// closing one on its line is not a string, nor is one right after a letter
+// or digit: those are an apostrophe or a double quote in JSX text.
+func checkBrackets(code string) error {
+	var stack []byte
+	pairs := map[byte]byte{'}': '{', ')': '(', ']': '['}
+	line := 1
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == '/' && i+1 < len(code) && code[i+1] == '/':
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+			line++
+		case c == '/' && i+1 < len(code) && code[i+1] == '*':
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("unterminated comment at line %d", line)
+			}
+			line += strings.Count(code[i:i+2+end], "\n")
+			i += end + 3
+		case c == '/' && regexAllowed(code, i):
+			if j := regexEnd(code, i); j >= 0 {
+				i = j
+			}
+		case (c == '"' || c == '\'') && !(i > 0 && isWordByte(code[i-1])):
+			if j := stringEnd(code, i); j >= 0 {
+				line += strings.Count(code[i:j], "\n") // escaped line breaks
+				i = j
+			}
+		case c == '`':
+			if j := templateEnd(code, i); j >= 0 {
+				line += strings.Count(code[i:j], "\n")
+				i = j
+			}
+		case c == '{' || c == '(' || c == '[':
+			stack = append(stack, c)
+		case c == '}' || c == ')' || c == ']':
+			if len(stack) == 0 || stack[len(stack)-1] != pairs[c] {
+				return fmt.Errorf("unbalanced %q at line %d", c, line)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q at end of code", stack[len(stack)-1])
+	}
+	return nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// regexAllowed reports whether a slash at code[i] can start a regular
+// expression rather than divide: it follows an operator, an opening
+// bracket or return. After a closing tag's "<" it is neither.
+func regexAllowed(code string, i int) bool {
+	j := i - 1
+	for j >= 0 && (code[j] == ' ' || code[j] == '\t' || code[j] == '\n') {
+		j--
+	}
+	if j < 0 {
+		return true
+	}
+	if strings.IndexByte("(,=:[!&|?{;", code[j]) >= 0 {
+		return true
+	}
+	return strings.HasSuffix(code[:j+1], "return") && (j < 6 || !isWordByte(code[j-6]))
+}
+
+// regexEnd returns the index of the slash closing the regular expression
+// that starts at code[i], past escapes and character classes, or -1 if the
+// line ends first.
+func regexEnd(code string, i int) int {
+	class := false
+	for j := i + 1; j < len(code); j++ {
+		switch code[j] {
+		case '\\':
+			j++
+		case '\n':
+			return -1
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '/':
+			if !class {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// stringEnd returns the index of the quote closing the string that starts
+// at code[i], or -1 if the line ends first.
+func stringEnd(code string, i int) int {
+	for j := i + 1; j < len(code); j++ {
+		switch code[j] {
+		case '\\':
+			j++
+		case '\n':
+			return -1
+		case code[i]:
+			return j
+		}
+	}
+	return -1
+}
+
+// templateEnd returns the index of the backtick closing the template
+// literal that starts at code[i], past the strings and templates of its
+// ${} substitutions, or -1 if there is none.
+func templateEnd(code string, i int) int {
+	for j := i + 1; j < len(code); j++ {
+		switch {
+		case code[j] == '\\':
+			j++
+		case code[j] == '`':
+			return j
+		case code[j] == '$' && j+1 < len(code) && code[j+1] == '{':
+			depth := 0
+		subst:
+			for j += 2; j < len(code); j++ {
+				switch code[j] {
+				case '{':
+					depth++
+				case '}':
+					if depth == 0 {
+						break subst
+					}
+					depth--
+				case '"', '\'':
+					if k := stringEnd(code, j); k >= 0 {
+						j = k
+					}
+				case '`':
+					if j = templateEnd(code, j); j < 0 {
+						return -1
+					}
+				}
+			}
+		}
+	}
+	return -1
+}
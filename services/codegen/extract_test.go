@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckBrackets(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		code string
+		err  string // substring of the error; empty for none
+	}{
+		{"balanced", "function A() { return [1, (2)] }", ""},
+		{"unclosed", "function A() { return (1", `unclosed '('`},
+		{"mismatched", "function A() { return (1} )", `unbalanced '}' at line 1`},
+		{"line comment", "const a = 1 // }\nconst b = [2]", ""},
+		{"block comment", "/* ( { */\nconst a = 1", ""},
+		{"unterminated comment", "const a = 1\n/* {", "unterminated comment at line 2"},
+		{"brackets in double quotes", `const a = "({["`, ""},
+		{"brackets in single quotes", `const a = '({['`, ""},
+		{"url in single quotes", "fetch('https://x').then(r => {\n  return r.json()\n})", ""},
+		{"url in single quotes, unclosed", "fetch('https://x').then(r => {\n  return r.json()\n", `unclosed '{'`},
+		{"url in double quotes", `fetch("https://x").then(r => r.json())`, ""},
+		{"escaped quote", `const a = 'it\'s (' + "say \"{\""`, ""},
+		{"url in template", "const u = `https://x/${id}`; f(u)", ""},
+		{"multi-line template", "const s = `\n  {(\n`\nf(s", "unclosed '('"},
+		{"template substitution", "const s = `${a ? 'x)' : `y${b['}']}`}]`; f(s)", ""},
+		{"template substitution with object", "const s = `${JSON.stringify({a: 1})}`", ""},
+		{"apostrophe in JSX text", "export default function A() {\n  return <p>Don't {name}</p>\n}", ""},
+		{"apostrophes in JSX text", "export default function A() {\n  return (\n    <p>Don't worry, it's fine</p>\n  )\n}", ""},
+		{"double quote in JSX text", "export default function A() {\n  return <p>6\" tall</p>\n}", ""},
+		{"apostrophes around JSX braces", "export default function A() {\n  return <p>Don't {a}</p>{b && <i>it's</i>}\n}", ""},
+		{"quoted brace in JSX", "export default function A() {\n  return <p>{'{'}{a}{'}'}</p>\n}", ""},
+		{"closing tags after apostrophes", "export default function A() {\n  return <ul><li>We're</li><li>{n} items</li></ul>\n}", ""},
+		{"brackets in template text", "const s = `{ (` + `[` + `${a})`; f(s)", ""},
+		{"brackets in a regex", "const re = /[({]+/g; f(re)", ""},
+		{"escaped bracket in a regex", "s.replace(/\\)+$/, '').split(/[\\]/)", ""},
+		{"regex after return", "function f(s) {\n  return /^\\(\\d+$/.test(s)\n}", ""},
+		{"division is no regex", "const a = (b / c) / (d[0] / 2)", ""},
+		{"unbalanced after a regex", "const re = /[(]/; f(re))", `unbalanced ')' at line 1`},
+		{"line count after strings", "const a = 'x'\nconst b = \"y\"\nconst c = `\n`\n)", `unbalanced ')' at line 5`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkBrackets(tc.code)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.err != "" && err == nil:
+				t.Errorf("no error, want %q", tc.err)
+			case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+				t.Errorf("error %q, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestBracketsOnlyWarn(t *testing.T) {
+	code := "export default function A() {\n  return <p>{x</p>\n}"
+	if err := validateCode(code, "react"); err != nil {
+		t.Errorf("code rejected for its brackets: %v", err)
+	}
+	if w := lintCode(code); len(w) != 1 || !strings.Contains(w[0], "unclosed '{'") {
+		t.Errorf("warnings %q, want the unclosed brace", w)
+	}
+	if w := lintCode("export default function A() { return <p>Don't</p> }"); w != nil {
+		t.Errorf("balanced code warned: %q", w)
+	}
+	if err := validateCode("Here is your component.", "react"); err == nil {
+		t.Error("prose passed")
+	}
+}
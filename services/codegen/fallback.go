@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/forge-ai/forge/shared/svc"
+	"github.com/rs/zerolog/log"
+)
+
+// namedProvider is one link in the fallback chain, labelled "kind:model"
+// so the provider that served a request can be attributed downstream.
+type namedProvider struct {
+	Name string
+	Provider
+}
+
+// newProvider builds a provider of the given kind, reading its API key from env.
+func newProvider(kind, model string) (namedProvider, error) {
+	name := kind + ":" + model
+	// Bounds a whole call, or the silence between a stream's chunks, so a
+	// connection that stalls fails over rather than holding the worker.
+	timeout := svc.EnvDuration("LLM_HTTP_TIMEOUT", 120*time.Second)
+	maxTokens := svc.EnvInt("LLM_MAX_TOKENS", 8192)
+	switch kind {
+	case "anthropic":
+		return namedProvider{name, NewAnthropicProvider(svc.MustEnv("ANTHROPIC_API_KEY"), model, maxTokens, timeout)}, nil
+	case "openrouter":
+		return namedProvider{name, NewOpenRouterProvider(svc.MustEnv("OPENROUTER_API_KEY"), model, maxTokens, timeout)}, nil
+	}
+	return namedProvider{}, fmt.Errorf("unknown LLM provider %q", kind)
+}
+
+// parseChain builds the primary provider followed by the fallbacks listed in
+// spec, a comma-separated list of "kind:model" entries.
+func parseChain(primaryKind, primaryModel, spec string) ([]namedProvider, error) {
+	primary, err := newProvider(primaryKind, primaryModel)
+	if err != nil {
+		return nil, err
+	}
+	chain := []namedProvider{primary}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, model, ok := strings.Cut(entry, ":")
+		if !ok || model == "" {
+			return nil, fmt.Errorf("LLM_FALLBACKS entry %q: want kind:model", entry)
+		}
+		np, err := newProvider(kind, model)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, np)
+	}
+	return chain, nil
+}
+
+// withFallback runs attempt against each provider in the chain, retrying
+// each up to retries extra times with exponential backoff. Only retryable
+// errors move on; a non-retryable error is returned immediately.
+func withFallback(ctx context.Context, chain []namedProvider, retries int, backoff time.Duration,
+	attempt func(namedProvider) (string, error)) (string, string, error) {
+	var lastErr error
+	for _, np := range chain {
+		for try := 0; try <= retries; try++ {
+			if try > 0 {
+				select {
+				case <-ctx.Done():
+					return "", "", ctx.Err()
+				case <-time.After(retryDelay(backoff, try)):
+				}
+			}
+			code, err := attempt(np)
+			if err == nil {
+				return code, np.Name, nil
+			}
+			lastErr = err
+			if !isRetryable(err) {
+				return "", np.Name, err
+			}
+			log.Warn().Err(err).Str("provider", np.Name).Int("attempt", try+1).Msg("generation failed — retrying")
+		}
+		log.Warn().Str("provider", np.Name).Msg("retry budget exhausted — falling back")
+	}
+	return "", "", fmt.Errorf("all providers failed: %w", lastErr)
+}
+
+// retryDelay is the wait before retry try, from 1: backoff doubled for
+// each retry before it, jittered down by up to half so that workers failing
+// together don't retry together.
+func retryDelay(backoff time.Duration, try int) time.Duration {
+	d := backoff << (try - 1)
+	return d/2 + rand.N(d/2+1)
+}
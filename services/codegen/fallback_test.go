@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+)
+
+// scripted is a Provider answering each call with the next of its
+// replies, the last one again once they run out.
+type scripted struct {
+	replies []reply
+	calls   int
+}
+
+type reply struct {
+	code  string
+	usage Usage
+	err   error
+}
+
+func (s *scripted) next() reply {
+	r := s.replies[min(s.calls, len(s.replies)-1)]
+	s.calls++
+	return r
+}
+
+func (s *scripted) Generate(context.Context, string, string) (string, Usage, error) {
+	r := s.next()
+	return r.code, r.usage, r.err
+}
+
+func (s *scripted) GenerateStream(context.Context, string, string) (<-chan StreamChunk, error) {
+	r := s.next()
+	if r.err != nil {
+		return nil, r.err
+	}
+	out := make(chan StreamChunk, 3)
+	out <- StreamChunk{Text: r.code}
+	out <- StreamChunk{Usage: &r.usage}
+	out <- StreamChunk{Done: true}
+	close(out)
+	return out, nil
+}
+
+const validCode = "export default function Home() { return <div /> }"
+
+// generateWith runs attempt over chain as generate does, with no backoff.
+func generateWith(ctx context.Context, chain []namedProvider, retries int) (string, string, error) {
+	return withFallback(ctx, chain, retries, time.Millisecond, func(np namedProvider) (string, error) {
+		code, _, err := np.Generate(ctx, "system", "prompt")
+		return code, err
+	})
+}
+
+func TestWithFallbackFallsOver(t *testing.T) {
+	primary := &scripted{replies: []reply{{err: overloaded}}}
+	fallback := &scripted{replies: []reply{{code: validCode}}}
+	chain := []namedProvider{{"anthropic:a", primary}, {"openrouter:b", fallback}}
+
+	code, servedBy, err := generateWith(context.Background(), chain, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != validCode || servedBy != "openrouter:b" {
+		t.Errorf("served by %q: %q", servedBy, code)
+	}
+	if primary.calls != 3 || fallback.calls != 1 {
+		t.Errorf("%d primary and %d fallback calls, want 3 and 1", primary.calls, fallback.calls)
+	}
+}
+
+func TestWithFallbackRetriesBeforeFallingOver(t *testing.T) {
+	primary := &scripted{replies: []reply{{err: overloaded}, {code: validCode}}}
+	fallback := &scripted{replies: []reply{{code: validCode}}}
+	chain := []namedProvider{{"anthropic:a", primary}, {"openrouter:b", fallback}}
+
+	_, servedBy, err := generateWith(context.Background(), chain, 1)
+	if err != nil || servedBy != "anthropic:a" || fallback.calls != 0 {
+		t.Errorf("served by %q, %d fallback calls, err %v: want the primary's retry", servedBy, fallback.calls, err)
+	}
+}
+
+func TestWithFallbackStopsOnPermanentError(t *testing.T) {
+	for _, err := range []error{badRequest, &TruncatedError{Provider: "anthropic", MaxTokens: 100}} {
+		primary := &scripted{replies: []reply{{err: err}}}
+		fallback := &scripted{replies: []reply{{code: validCode}}}
+		chain := []namedProvider{{"anthropic:a", primary}, {"openrouter:b", fallback}}
+
+		_, servedBy, got := generateWith(context.Background(), chain, 2)
+		if !errors.Is(got, err) || servedBy != "anthropic:a" {
+			t.Errorf("%v: got %v from %q", err, got, servedBy)
+		}
+		if primary.calls != 1 || fallback.calls != 0 {
+			t.Errorf("%v: %d primary and %d fallback calls, want 1 and none", err, primary.calls, fallback.calls)
+		}
+	}
+}
+
+func TestWithFallbackAllFail(t *testing.T) {
+	last := apiError("openrouter", http.StatusServiceUnavailable, "down")
+	chain := []namedProvider{
+		{"anthropic:a", &scripted{replies: []reply{{err: overloaded}}}},
+		{"openrouter:b", &scripted{replies: []reply{{err: last}}}},
+	}
+	_, servedBy, err := generateWith(context.Background(), chain, 1)
+	if !errors.Is(err, last) || servedBy != "" || !strings.Contains(err.Error(), "all providers failed") {
+		t.Errorf("got %v from %q, want the last provider's error", err, servedBy)
+	}
+}
+
+func TestWithFallbackCancelledDuringBackoff(t *testing.T) {
+	primary := &scripted{replies: []reply{{err: overloaded}}}
+	chain := []namedProvider{{"anthropic:a", primary}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, err := withFallback(ctx, chain, 5, time.Hour, func(np namedProvider) (string, error) {
+		_, _, err := np.Generate(ctx, "system", "prompt")
+		return "", err
+	})
+	if !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Errorf("err %v after %s, want the cancellation", err, time.Since(start))
+	}
+	if primary.calls != 1 {
+		t.Errorf("%d calls", primary.calls)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for try, base := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if d := retryDelay(time.Second, try); d < base/2 || d > base {
+				t.Fatalf("try %d: %s, want %s to %s", try, d, base/2, base)
+			}
+		}
+	}
+}
+
+func TestParseChain(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "a")
+	t.Setenv("OPENROUTER_API_KEY", "o")
+	chain, err := parseChain("anthropic", "claude", " openrouter:meta/llama , ,anthropic:haiku")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, np := range chain {
+		names = append(names, np.Name)
+	}
+	if want := []string{"anthropic:claude", "openrouter:meta/llama", "anthropic:haiku"}; !slices.Equal(names, want) {
+		t.Errorf("chain %v, want %v", names, want)
+	}
+
+	for _, spec := range []string{"openrouter", "openrouter:", "gemini:pro"} {
+		if _, err := parseChain("anthropic", "claude", spec); err == nil {
+			t.Errorf("%q: no error", spec)
+		}
+	}
+}
+
+func TestGenerateAttributesEveryAttempt(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		// The primary answers with code that doesn't validate, billed all
+		// the same, and the fallback with code that does.
+		primary := &scripted{replies: []reply{{code: "<div>", usage: Usage{InputTokens: 100, OutputTokens: 10}}}}
+		fallback := &scripted{replies: []reply{{code: validCode, usage: Usage{InputTokens: 90, OutputTokens: 20}}}}
+		g := &generator{
+			chain:         []namedProvider{{"anthropic:a", primary}, {"openrouter:b", fallback}},
+			backoff:       time.Millisecond,
+			stream:        stream,
+			progressEvery: time.Minute,
+			breaker:       &breaker{threshold: 3, cooldown: time.Minute},
+		}
+		bus := mq.NewMemory()
+		code, servedBy, usage, err := g.generate(context.Background(), bus, events.CodegenRequestedPayload{
+			JobID: "job", Platform: events.PlatformReact, Iteration: 1,
+		})
+		bus.Close()
+		if err != nil {
+			t.Fatalf("stream %v: %v", stream, err)
+		}
+		if code != validCode || servedBy != "openrouter:b" {
+			t.Errorf("stream %v: served by %q: %q", stream, servedBy, code)
+		}
+		want := []events.TokenUsage{
+			{Provider: "anthropic:a", InputTokens: 100, OutputTokens: 10},
+			{Provider: "openrouter:b", InputTokens: 90, OutputTokens: 20},
+		}
+		if !slices.Equal(usage, want) {
+			t.Errorf("stream %v: usage %+v, want %+v", stream, usage, want)
+		}
+	}
+}
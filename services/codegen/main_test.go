@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+)
+
+func TestHandleRPCRoundTrip(t *testing.T) {
+	bus := mq.NewMemory()
+	defer bus.Close()
+	requests, err := bus.Subscribe("svc.codegen.rpc", events.CodegenRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generator{
+		chain:   []namedProvider{{"anthropic:a", &scripted{replies: []reply{{code: validCode, usage: Usage{InputTokens: 5}}}}}},
+		breaker: &breaker{threshold: 3, cooldown: time.Minute},
+	}
+	go func() {
+		for d := range requests {
+			if err := handleRPC(context.Background(), d, bus, g); err != nil {
+				t.Errorf("handleRPC: %v", err)
+			}
+			_ = d.Ack(false)
+		}
+	}()
+
+	body, _ := events.Wrap(events.CodegenRPC, events.CodegenRequestedPayload{
+		JobID: "rpc", Platform: events.PlatformReact, Iteration: 1,
+		Screen: events.FigmaScreen{Name: "Home", ComponentName: "Home"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	raw, err := bus.Call(ctx, events.CodegenRPC, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := events.UnwrapChecked[events.CodegenCompletePayload](raw, events.CodegenComplete)
+	if err != nil {
+		t.Fatalf("reply %s: %v", raw, err)
+	}
+	if p.Code != validCode || p.Filename != "Home.tsx" || p.Provider != "anthropic:a" {
+		t.Errorf("reply %+v", p)
+	}
+}
+
+func TestPaletteSectionKeepsAlpha(t *testing.T) {
+	palette := map[string]string{"primary": "#00000080", "secondary": "#FFFFFF"}
+	for platform, want := range map[string][]string{
+		events.PlatformReact: {"--color-primary: #00000080;", "--color-secondary: #FFFFFF;"},
+		events.PlatformKMP:   {"val Primary = Color(0x80000000)", "val Secondary = Color(0xFFFFFFFF)"},
+	} {
+		got := paletteSection(palette, platform)
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: no %q in\n%s", platform, w, got)
+			}
+		}
+	}
+}
+
+func TestPromptAdvertisesConfiguredTheme(t *testing.T) {
+	screen := events.FigmaScreen{
+		Name:        "Home",
+		Colors:      map[string]string{"primary": "#6750A4", "color-5": "#00000080"},
+		Spacing:     []float64{16},
+		BorderRadii: []float64{8},
+	}
+	// The classes the sandbox's config defines, by TailwindThemeFor.
+	theme := events.TailwindThemeFor(screen)
+	var classes []string
+	for name := range theme.Colors {
+		classes = append(classes, "bg-"+name, "text-"+name)
+	}
+	for name := range theme.Spacing {
+		classes = append(classes, "p-"+name, "gap-"+name)
+	}
+	for name := range theme.BorderRadius {
+		classes = append(classes, "rounded-"+name)
+	}
+
+	prompt := buildPrompt(events.CodegenRequestedPayload{Platform: events.PlatformReact, Styling: events.StylingTailwind, Screen: screen})
+	for _, c := range append(classes, "bg-primary", "p-fig-16", "rounded-fig-8") {
+		if !strings.Contains(prompt, c) {
+			t.Errorf("prompt doesn't mention %s", c)
+		}
+	}
+	kmp := buildPrompt(events.CodegenRequestedPayload{Platform: events.PlatformKMP, Screen: screen})
+	if strings.Contains(kmp, "TAILWIND THEME") {
+		t.Error("KMP prompt lists Tailwind classes")
+	}
+}
+
+func TestPromptRepeatsWarnings(t *testing.T) {
+	p := events.CodegenRequestedPayload{Platform: events.PlatformReact, Iteration: 2}
+	if prompt := buildPrompt(p); strings.Contains(prompt, "WARNINGS") {
+		t.Error("warnings section without warnings")
+	}
+	p.Warnings = []string{"unclosed '(' at end of code"}
+	if prompt := buildPrompt(p); !strings.Contains(prompt, "PREVIOUS ATTEMPT WARNINGS") || !strings.Contains(prompt, "• unclosed '(' at end of code\n") {
+		t.Errorf("warnings missing from the prompt:\n%s", prompt)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 const openrouterURL = "https://openrouter.ai/api/v1/chat/completions"
@@ -14,42 +15,61 @@ const openrouterURL = "https://openrouter.ai/api/v1/chat/completions"
 // OpenRouterProvider implements the Provider interface for OpenRouter's API.
 // OpenRouter provides a unified interface to multiple LLM providers including Anthropic.
 type OpenRouterProvider struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey    string
+	model     string
+	maxTokens int
+	timeout   time.Duration
+	client    *http.Client
 }
 
 // NewOpenRouterProvider creates a new OpenRouter provider instance.
-func NewOpenRouterProvider(apiKey, model string) *OpenRouterProvider {
+// maxTokens caps each response; see LLM_MAX_TOKENS. timeout bounds a
+// call, or a stream's silences; see LLM_HTTP_TIMEOUT.
+func NewOpenRouterProvider(apiKey, model string, maxTokens int, timeout time.Duration) *OpenRouterProvider {
 	return &OpenRouterProvider{
-		apiKey: apiKey,
-		model:  model,
-		client: &http.Client{},
+		apiKey:    apiKey,
+		model:     model,
+		maxTokens: maxTokens,
+		timeout:   timeout,
+		client:    newLLMClient(timeout),
 	}
 }
 
-// Generate calls the OpenRouter API and returns generated code.
-// OpenRouter uses OpenAI-compatible API format.
-func (or *OpenRouterProvider) Generate(ctx context.Context, prompt string) (string, error) {
+func (or *OpenRouterProvider) newRequest(ctx context.Context, system, prompt string, stream bool) (*http.Request, error) {
 	body, _ := json.Marshal(map[string]any{
 		"model": or.model,
 		"messages": []map[string]string{
-			{"role": "system", "content": "You are an expert UI engineer. Output only raw code, never markdown fences or explanations."},
+			{"role": "system", "content": system},
 			{"role": "user", "content": prompt},
 		},
-		"max_tokens": 8192,
+		"max_tokens": or.maxTokens,
+		"stream":     stream,
+		// Streams only report usage when asked, in a last chunk.
+		"usage": map[string]bool{"include": true},
 	})
 
 	req, err := http.NewRequestWithContext(ctx, "POST", openrouterURL, bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+or.apiKey)
+	return req, nil
+}
+
+// Generate calls the OpenRouter API and returns generated code.
+// OpenRouter uses OpenAI-compatible API format.
+func (or *OpenRouterProvider) Generate(ctx context.Context, system, prompt string) (string, Usage, error) {
+	ctx, cancel := context.WithTimeout(ctx, or.timeout)
+	defer cancel()
+	req, err := or.newRequest(ctx, system, prompt, false)
+	if err != nil {
+		return "", Usage{}, err
+	}
 
 	resp, err := or.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("openrouter request: %w", err)
+		return "", Usage{}, fmt.Errorf("openrouter request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -60,20 +80,103 @@ func (or *OpenRouterProvider) Generate(ctx context.Context, prompt string) (stri
 			Message struct {
 				Content string `json:"content"`
 			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
+		Usage openrouterUsage `json:"usage"`
 		Error *struct {
 			Message string `json:"message"`
 		} `json:"error"`
 	}
 	if err := json.Unmarshal(raw, &response); err != nil {
-		return "", fmt.Errorf("decode: %w", err)
+		if resp.StatusCode != http.StatusOK {
+			return "", Usage{}, apiError("openrouter", resp.StatusCode, string(raw))
+		}
+		return "", Usage{}, fmt.Errorf("decode: %w", err)
 	}
 	if response.Error != nil {
-		return "", fmt.Errorf("openrouter: %s", response.Error.Message)
+		return "", Usage{}, apiError("openrouter", resp.StatusCode, response.Error.Message)
 	}
 	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("empty response")
+		return "", response.Usage.usage(), fmt.Errorf("empty response")
+	}
+	if response.Choices[0].FinishReason == "length" {
+		return "", response.Usage.usage(), &TruncatedError{Provider: "openrouter", MaxTokens: or.maxTokens}
+	}
+
+	return stripFences(response.Choices[0].Message.Content), response.Usage.usage(), nil
+}
+
+// openrouterUsage is the OpenAI-style usage OpenRouter reports.
+type openrouterUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u openrouterUsage) usage() Usage {
+	return Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+}
+
+// GenerateStream calls OpenRouter with stream=true and forwards the
+// OpenAI-style delta content as it arrives.
+func (or *OpenRouterProvider) GenerateStream(ctx context.Context, system, prompt string) (<-chan StreamChunk, error) {
+	reqCtx, cancel := context.WithCancel(ctx)
+	req, err := or.newRequest(reqCtx, system, prompt, true)
+	if err != nil {
+		cancel()
+		return nil, err
 	}
 
-	return stripFences(response.Choices[0].Message.Content), nil
+	resp, err := or.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("openrouter request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, apiError("openrouter", resp.StatusCode, string(raw))
+	}
+
+	out := make(chan StreamChunk, 16)
+	// The usage comes after the chunk with the finish reason, so a
+	// truncation fails the stream at [DONE].
+	truncated := false
+	go readSSE(ctx, newIdleBody(resp.Body, or.timeout, cancel), out, func(data string) (StreamChunk, bool, error) {
+		if data == "[DONE]" {
+			if truncated {
+				return StreamChunk{}, true, &TruncatedError{Provider: "openrouter", MaxTokens: or.maxTokens}
+			}
+			return StreamChunk{}, true, nil
+		}
+		var ev struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openrouterUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return StreamChunk{}, false, fmt.Errorf("decode stream event: %w", err)
+		}
+		if ev.Error != nil {
+			return StreamChunk{}, false, apiError("openrouter", 0, ev.Error.Message)
+		}
+		var chunk StreamChunk
+		if ev.Usage != nil {
+			u := ev.Usage.usage()
+			chunk.Usage = &u
+		}
+		if len(ev.Choices) > 0 {
+			chunk.Text = ev.Choices[0].Delta.Content
+			truncated = truncated || ev.Choices[0].FinishReason == "length"
+		}
+		return chunk, false, nil
+	})
+	return out, nil
 }
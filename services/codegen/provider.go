@@ -1,11 +1,104 @@
 package main
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/forge-ai/forge/shared/httpx"
+)
 
 // Provider is an abstraction for different LLM API providers.
 // Each implementation handles provider-specific HTTP details, authentication,
 // request/response formatting, and error handling.
 type Provider interface {
-	// Generate calls the LLM API with the given prompt and returns generated code.
-	Generate(ctx context.Context, prompt string) (string, error)
+	// Generate calls the LLM API with the given system message and prompt and
+	// returns generated code and the tokens it was billed.
+	Generate(ctx context.Context, system, prompt string) (string, Usage, error)
+
+	// GenerateStream calls the LLM API in streaming mode and returns a channel
+	// of raw text chunks. The channel is closed when the response is complete;
+	// callers accumulate the chunks and strip fences themselves. Usage
+	// arrives on chunks of its own, as the provider reports it.
+	GenerateStream(ctx context.Context, system, prompt string) (<-chan StreamChunk, error)
+}
+
+// newLLMClient is the providers' HTTP client, waiting up to timeout for
+// response headers. It makes one attempt per call: withFallback retries,
+// behind the breaker and across the chain, and retries stacked under it
+// would multiply its attempts and its backoff.
+func newLLMClient(timeout time.Duration) *http.Client {
+	return httpx.NewClient(0, httpx.WithResponseHeaderTimeout(timeout), httpx.WithRetries(0))
+}
+
+// Usage is the tokens a provider billed for one call.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// merge takes the counts u reports over the ones already known: streams
+// report input and output at different points, each count final.
+func (u *Usage) merge(v Usage) {
+	if v.InputTokens > 0 {
+		u.InputTokens = v.InputTokens
+	}
+	if v.OutputTokens > 0 {
+		u.OutputTokens = v.OutputTokens
+	}
+}
+
+// ProviderError is an API-level failure reported by an LLM provider.
+// Retryable is true for overload/rate-limit/server errors, false for
+// problems that would fail the same way on any provider (bad request, auth).
+type ProviderError struct {
+	Provider  string
+	Status    int
+	Message   string
+	Retryable bool
+	// Answered is set when the provider did answer, with output that was
+	// no use: it is up, if not of help.
+	Answered bool
+}
+
+func (e *ProviderError) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+	}
+	return fmt.Sprintf("%s %d: %s", e.Provider, e.Status, e.Message)
+}
+
+func apiError(provider string, status int, msg string) *ProviderError {
+	retryable := status == http.StatusTooManyRequests || status == http.StatusRequestTimeout ||
+		status >= 500 || status == 0
+	return &ProviderError{Provider: provider, Status: status, Message: msg, Retryable: retryable}
+}
+
+// TruncatedError is a generation the provider cut off at max_tokens. Its
+// code is incomplete, and would be again on any provider, which all have
+// the same limit.
+type TruncatedError struct {
+	Provider  string
+	MaxTokens int
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%s: output truncated at max_tokens (%d) — increase LLM_MAX_TOKENS", e.Provider, e.MaxTokens)
+}
+
+// isRetryable reports whether err is worth another attempt on the same or a
+// fallback provider. Transport errors are retryable; cancellation and
+// truncation are not.
+func isRetryable(err error) bool {
+	var te *TruncatedError
+	if errors.Is(err, context.Canceled) || errors.As(err, &te) {
+		return false
+	}
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.Retryable
+	}
+	return true
 }
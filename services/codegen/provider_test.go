@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLLMClientDoesNotRetry(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, 529} {
+		var hits atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+		}))
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "k") // retried by the default policy
+		resp, err := newLLMClient(time.Second).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		srv.Close()
+
+		if resp.StatusCode != status || hits.Load() != 1 {
+			t.Errorf("%d: got %d after %d requests, want it once: withFallback retries", status, resp.StatusCode, hits.Load())
+		}
+	}
+}
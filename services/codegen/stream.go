@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StreamChunk is one incremental piece of a streamed generation: text, or
+// the usage so far. The last chunk on a complete stream has Done set; on a
+// failed one it carries Err instead.
+type StreamChunk struct {
+	Text  string
+	Usage *Usage
+	Err   error
+	Done  bool
+}
+
+// errStreamCut fails a stream that ended without the provider's terminal
+// event: the connection dropped, and what arrived is only part of the
+// answer. It is retryable.
+var errStreamCut = fmt.Errorf("stream ended before its terminal event: %w", io.ErrUnexpectedEOF)
+
+// readSSE reads a server-sent-events body and forwards the chunks parse
+// extracts to out, closing out when the stream ends. parse reports done=true
+// on the provider's terminal event, which readSSE follows with a Done chunk;
+// a body that ends before it fails the stream with errStreamCut.
+func readSSE(ctx context.Context, body io.ReadCloser, out chan<- StreamChunk,
+	parse func(data string) (chunk StreamChunk, done bool, err error)) {
+	defer close(out)
+	defer body.Close()
+
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		// Blank lines separate events; ':' lines are keep-alive comments.
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		chunk, done, err := parse(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		if err != nil {
+			send(ctx, out, StreamChunk{Err: err})
+			return
+		}
+		if (chunk.Text != "" || chunk.Usage != nil) && !send(ctx, out, chunk) {
+			return
+		}
+		if done {
+			send(ctx, out, StreamChunk{Done: true})
+			return
+		}
+	}
+	err := sc.Err()
+	if err == nil {
+		err = errStreamCut
+	}
+	send(ctx, out, StreamChunk{Err: err})
+}
+
+// errStreamIdle fails a stream that went silent.
+var errStreamIdle = errors.New("stream idle")
+
+// idleBody is a streamed response body that gives up on the stream once
+// nothing has arrived for timeout, by cancelling its request. The header
+// timeout only covers the wait for the first byte; without this, a stream
+// that stalls after it would hold the worker indefinitely. Providers send
+// keep-alives well within any sensible timeout while they generate.
+type idleBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	idle    atomic.Bool
+}
+
+// newIdleBody wraps body, whose request cancel cancels.
+func newIdleBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleBody {
+	b := &idleBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.idle.Store(true)
+		cancel()
+	})
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.idle.Load() {
+		return n, fmt.Errorf("%w: nothing received for %s", errStreamIdle, b.timeout)
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func send(ctx context.Context, out chan<- StreamChunk, c StreamChunk) bool {
+	select {
+	case out <- c:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// collectStream accumulates a streamed generation, calling progress with the
+// bytes received so far at most once per interval. The generation is only
+// complete at a Done chunk: chunks closing without one is errStreamCut. The
+// usage is what the stream reported, even if it then failed.
+func collectStream(ctx context.Context, chunks <-chan StreamChunk, interval time.Duration,
+	progress func(bytes int, elapsed time.Duration)) (string, Usage, error) {
+	var sb strings.Builder
+	var usage Usage
+	start := time.Now()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", usage, ctx.Err()
+		case <-tick.C:
+			progress(sb.Len(), time.Since(start))
+		case c, ok := <-chunks:
+			if !ok {
+				return "", usage, errStreamCut
+			}
+			if c.Err != nil {
+				return "", usage, c.Err
+			}
+			if c.Done {
+				return sb.String(), usage, nil
+			}
+			if c.Usage != nil {
+				usage.merge(*c.Usage)
+			}
+			sb.WriteString(c.Text)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// sseServer serves events, each after gap, then holds the stream open
+// until the client goes.
+func sseServer(t *testing.T, gap time.Duration, events ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for _, ev := range events {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(gap):
+			}
+			fmt.Fprintf(w, "data: %s\n\n", ev)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// cutServer serves events and then drops the connection, as if it broke
+// before the provider finished.
+func cutServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for _, ev := range events {
+			fmt.Fprintf(w, "data: %s\n\n", ev)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// streamFrom reads url as an SSE stream of plain text events, ended by
+// [DONE], through an idleBody of timeout.
+func streamFrom(t *testing.T, url string, timeout time.Duration) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+	reqCtx, cancel := context.WithCancel(ctx)
+	req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	resp, err := newLLMClient(time.Second).Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	out := make(chan StreamChunk, 16)
+	go readSSE(ctx, newIdleBody(resp.Body, timeout, cancel), out, func(data string) (StreamChunk, bool, error) {
+		if data == "[DONE]" {
+			return StreamChunk{}, true, nil
+		}
+		return StreamChunk{Text: data}, false, nil
+	})
+	text, _, err := collectStream(ctx, out, time.Minute, func(int, time.Duration) {})
+	return text, err
+}
+
+func TestIdleBodyFailsStalledStream(t *testing.T) {
+	srv := sseServer(t, 0, "a", "b") // and then nothing
+	start := time.Now()
+	_, err := streamFrom(t, srv.URL, 100*time.Millisecond)
+	if !errors.Is(err, errStreamIdle) {
+		t.Fatalf("err %v, want %v", err, errStreamIdle)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("gave up after %s", took)
+	}
+	if !isRetryable(err) {
+		t.Error("a stalled stream should fail over")
+	}
+}
+
+func TestIdleBodyKeepsSlowStream(t *testing.T) {
+	// 300ms in all, but never more than 30ms without a chunk.
+	events := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "[DONE]"}
+	srv := sseServer(t, 30*time.Millisecond, events...)
+	text, err := streamFrom(t, srv.URL, 150*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "abcdefghij" {
+		t.Errorf("text %q", text)
+	}
+}
+
+// toServer sends every request to srv instead of the provider's API.
+type toServer struct {
+	srv  *httptest.Server
+	next http.RoundTripper
+}
+
+func (t toServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(t.srv.URL)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return t.next.RoundTrip(req)
+}
+
+// through points client at srv.
+func through(client *http.Client, srv *httptest.Server) {
+	client.Transport = toServer{srv: srv, next: client.Transport}
+}
+
+// generateFrom streams a generation from p, as generateStream collects it.
+func generateFrom(t *testing.T, p Provider) (string, Usage, error) {
+	t.Helper()
+	chunks, err := p.GenerateStream(context.Background(), "system", "prompt")
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return collectStream(context.Background(), chunks, time.Minute, func(int, time.Duration) {})
+}
+
+func TestAnthropicStream(t *testing.T) {
+	srv := sseServer(t, 0,
+		`{"type":"message_start","message":{"usage":{"input_tokens":12,"cache_read_input_tokens":3,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0}`,
+		`{"type":"content_block_delta","delta":{"type":"text_delta","text":"export default "}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","delta":{"type":"text_delta","text":"function A() {}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":40}}`,
+		`{"type":"message_stop"}`,
+	)
+	p := NewAnthropicProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	text, usage, err := generateFrom(t, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "export default function A() {}" {
+		t.Errorf("text %q", text)
+	}
+	if usage != (Usage{InputTokens: 15, OutputTokens: 40}) {
+		t.Errorf("usage %+v, want 15 in (with the cache reads), 40 out", usage)
+	}
+}
+
+func TestAnthropicStreamTruncated(t *testing.T) {
+	srv := sseServer(t, 0,
+		`{"type":"message_start","message":{"usage":{"input_tokens":12}}}`,
+		`{"type":"content_block_delta","delta":{"text":"export default function A() {"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":100}}`,
+		`{"type":"message_stop"}`,
+	)
+	p := NewAnthropicProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	_, usage, err := generateFrom(t, p)
+	var te *TruncatedError
+	if !errors.As(err, &te) || te.MaxTokens != 100 {
+		t.Fatalf("err %v, want a truncation at 100 tokens", err)
+	}
+	if usage.OutputTokens != 100 {
+		t.Errorf("usage %+v: a truncated stream's tokens are still billed", usage)
+	}
+}
+
+func TestStreamCutIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		events []string
+		client func(*httptest.Server) Provider
+	}{
+		{"anthropic", []string{
+			`{"type":"message_start","message":{"usage":{"input_tokens":12}}}`,
+			`{"type":"content_block_delta","delta":{"text":"export default function A() {"}}`,
+		}, func(srv *httptest.Server) Provider {
+			p := NewAnthropicProvider("key", "model", 100, time.Second)
+			through(p.client, srv)
+			return p
+		}},
+		{"openrouter", []string{
+			`{"choices":[{"delta":{"content":"export default function A() {"}}]}`,
+		}, func(srv *httptest.Server) Provider {
+			p := NewOpenRouterProvider("key", "model", 100, time.Second)
+			through(p.client, srv)
+			return p
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			text, _, err := generateFrom(t, tc.client(cutServer(t, tc.events...)))
+			if !errors.Is(err, io.ErrUnexpectedEOF) || !isRetryable(err) {
+				t.Fatalf("err %v, want a retryable unexpected EOF", err)
+			}
+			if text != "" {
+				t.Errorf("the partial code %q was returned", text)
+			}
+		})
+	}
+}
+
+func TestCollectStreamNeedsDone(t *testing.T) {
+	chunks := make(chan StreamChunk, 1)
+	chunks <- StreamChunk{Text: "export default"}
+	close(chunks)
+	if _, _, err := collectStream(context.Background(), chunks, time.Minute, func(int, time.Duration) {}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("chunks closed without Done: err %v", err)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	srv := sseServer(t, 0,
+		`{"type":"content_block_delta","delta":{"text":"export"}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	)
+	p := NewAnthropicProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	_, _, err := generateFrom(t, p)
+	var pe *ProviderError
+	if !errors.As(err, &pe) || !strings.Contains(pe.Message, "Overloaded") {
+		t.Fatalf("err %v, want the stream's error", err)
+	}
+}
+
+func TestOpenRouterStream(t *testing.T) {
+	srv := sseServer(t, 0,
+		`{"choices":[{"delta":{"role":"assistant","content":""}}]}`,
+		`{"choices":[{"delta":{"content":"export default "}}]}`,
+		`{"choices":[{"delta":{"content":"function A() {}"},"finish_reason":"stop"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":30}}`,
+		`[DONE]`,
+	)
+	p := NewOpenRouterProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	text, usage, err := generateFrom(t, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "export default function A() {}" {
+		t.Errorf("text %q", text)
+	}
+	if usage != (Usage{InputTokens: 20, OutputTokens: 30}) {
+		t.Errorf("usage %+v", usage)
+	}
+}
+
+func TestOpenRouterStreamTruncated(t *testing.T) {
+	srv := sseServer(t, 0,
+		`{"choices":[{"delta":{"content":"export default function A() {"},"finish_reason":"length"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":100}}`,
+		`[DONE]`,
+	)
+	p := NewOpenRouterProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	_, usage, err := generateFrom(t, p)
+	var te *TruncatedError
+	if !errors.As(err, &te) {
+		t.Fatalf("err %v, want a truncation", err)
+	}
+	if usage.OutputTokens != 100 {
+		t.Errorf("usage %+v: the usage after the finish reason is kept", usage)
+	}
+}
+
+func TestStreamRejectedRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"error":{"message":"rate limited"}}`, http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+	p := NewAnthropicProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	_, err := p.GenerateStream(context.Background(), "system", "prompt")
+	var pe *ProviderError
+	if !errors.As(err, &pe) || pe.Status != http.StatusTooManyRequests || !isRetryable(err) {
+		t.Fatalf("err %v, want a retryable 429", err)
+	}
+}
+
+func TestGenerateStreamPublishesProgress(t *testing.T) {
+	delta := func(text string) string {
+		b, _ := json.Marshal(map[string]any{"type": "content_block_delta", "delta": map[string]string{"text": text}})
+		return string(b)
+	}
+	deltas := []string{delta("```tsx\n")}
+	for i := 0; i < 8; i++ {
+		deltas = append(deltas, delta(fmt.Sprintf("const a%d = %d;\n", i, i)))
+	}
+	deltas = append(deltas, delta("```"), `{"type":"message_stop"}`)
+	srv := sseServer(t, 20*time.Millisecond, deltas...)
+	p := NewAnthropicProvider("key", "model", 100, time.Second)
+	through(p.client, srv)
+
+	bus := mq.NewMemory()
+	t.Cleanup(bus.Close)
+	logs, err := bus.Subscribe("test.logs", events.LogEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generator{stream: true, progressEvery: 50 * time.Millisecond}
+	req := events.CodegenRequestedPayload{JobID: "job", Platform: events.PlatformReact, Iteration: 1}
+	code, _, err := g.generateStream(context.Background(), bus, p, req, "system", "prompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(code, "```") || !strings.HasPrefix(code, "const a0 = 0;") {
+		t.Errorf("code not stripped of its fences: %q", code)
+	}
+
+	// 200ms of chunks, reported every 50ms, with the bytes growing.
+	var progress []int
+	for {
+		var d amqp.Delivery
+		select {
+		case d = <-logs:
+			_ = d.Ack(false)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if d.Body == nil {
+			break
+		}
+		var env struct {
+			Payload events.LogEventPayload `json:"payload"`
+		}
+		if err := json.Unmarshal(d.Body, &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Payload.Step == "codegen_progress" {
+			progress = append(progress, int(env.Payload.Data["bytes"].(float64)))
+		}
+	}
+	if len(progress) < 2 {
+		t.Fatalf("%d progress events for a 200ms stream reported every 50ms", len(progress))
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Errorf("bytes went back: %v", progress)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// A page rendered pixel-perfect but a few pixels off, typically by the
+// browser's default 8px body margin, mismatches on every row and scores
+// as if it were wrong throughout. Before scoring, the capture's global
+// offset from the reference is estimated by normalized cross-correlation
+// of their luminance and undone, so the metrics see the layout itself; the
+// offset is reported on its own instead.
+const (
+	// alignRadius is how far, in Figma units, the offset is searched for
+	// in each direction.
+	alignRadius = 32
+	// alignCell is the size in Figma units of a pixel of the coarse search,
+	// which finds the offset to within a cell; a search at one Figma unit
+	// per pixel around it then pins it down.
+	alignCell = 4
+	// minAlignGain is how much the correlation must improve for the offset
+	// to be undone. Below it the capture either isn't shifted or differs in
+	// layout, which shifting the whole page would only mask.
+	minAlignGain = 0.1
+)
+
+// estimateOffset returns how far, in Figma units of a frame frameWidth
+// wide, gen's content sits right (dx) and down (dy) of ref's, which is the
+// same size. ok is false when there is no offset worth undoing.
+func estimateOffset(ctx context.Context, ref, gen *image.NRGBA, frameWidth float64) (dx, dy int, ok bool) {
+	perUnit := pixelsPerUnit(ref.Bounds(), frameWidth)
+
+	// Coarse: a pixel per alignCell units over the whole window.
+	cref, cgen := shrinkLuma(ctx, ref, gen, perUnit*alignCell)
+	r := alignRadius / alignCell
+	cx, cy, _ := bestOffset(cref, cgen, 0, 0, r)
+
+	// Fine: a pixel per unit around the coarse offset.
+	fref, fgen := shrinkLuma(ctx, ref, gen, perUnit)
+	if ctx.Err() != nil {
+		return 0, 0, false
+	}
+	dx, dy, best := bestOffset(fref, fgen, cx*alignCell, cy*alignCell, alignCell)
+	if dx == 0 && dy == 0 || best-correlation(fref, fgen, 0, 0) < minAlignGain {
+		return 0, 0, false
+	}
+	return dx, dy, true
+}
+
+// pixelsPerUnit is the reference's pixels per Figma unit; the export scale
+// if the frame width is unknown.
+func pixelsPerUnit(ref image.Rectangle, frameWidth float64) float64 {
+	if frameWidth > 0 {
+		return float64(ref.Dx()) / frameWidth
+	}
+	return deviceScale
+}
+
+// lumaGrid is an image's luminance, row-major.
+type lumaGrid struct {
+	px   []float64
+	w, h int
+}
+
+// shrinkLuma returns the luminance of ref and gen box-filtered down by
+// factor, or as they are if factor is at most 1.
+func shrinkLuma(ctx context.Context, ref, gen *image.NRGBA, factor float64) (lumaGrid, lumaGrid) {
+	b := ref.Bounds()
+	if factor > 1 {
+		w := max(1, int(math.Round(float64(b.Dx())/factor)))
+		h := max(1, int(math.Round(float64(b.Dy())/factor)))
+		ref, gen = imaging.Resize(ref, w, h, imaging.Box), imaging.Resize(gen, w, h, imaging.Box)
+	}
+	var a, g lumaGrid
+	a.px, a.w, a.h = luma(ctx, ref)
+	g.px, g.w, g.h = luma(ctx, gen)
+	return a, g
+}
+
+// bestOffset searches the offsets within r of (x0, y0) for the one where
+// gen correlates best with ref, returning it and its correlation.
+func bestOffset(ref, gen lumaGrid, x0, y0, r int) (dx, dy int, best float64) {
+	best = math.Inf(-1)
+	for y := y0 - r; y <= y0+r; y++ {
+		for x := x0 - r; x <= x0+r; x++ {
+			// Ties go to the smaller shift.
+			if c := correlation(ref, gen, x, y); c > best || c == best && abs(x)+abs(y) < abs(dx)+abs(dy) {
+				dx, dy, best = x, y, c
+			}
+		}
+	}
+	return dx, dy, best
+}
+
+// correlation is the normalized cross-correlation, -1 to 1, of ref with
+// gen shifted back by (dx, dy), over the area they then overlap. Flat
+// areas, and shifts that leave no overlap, correlate at 0.
+func correlation(ref, gen lumaGrid, dx, dy int) float64 {
+	x0, x1 := max(0, -dx), min(ref.w, ref.w-dx)
+	y0, y1 := max(0, -dy), min(ref.h, ref.h-dy)
+	if x0 >= x1 || y0 >= y1 {
+		return 0
+	}
+	var sa, sb, saa, sbb, sab float64
+	for y := y0; y < y1; y++ {
+		a := ref.px[y*ref.w+x0 : y*ref.w+x1]
+		b := gen.px[(y+dy)*gen.w+x0+dx : (y+dy)*gen.w+x1+dx]
+		for i, va := range a {
+			vb := b[i]
+			sa += va
+			sb += vb
+			saa += va * va
+			sbb += vb * vb
+			sab += va * vb
+		}
+	}
+	n := float64((x1 - x0) * (y1 - y0))
+	cov := sab - sa*sb/n
+	va, vb := saa-sa*sa/n, sbb-sb*sb/n
+	if va <= 0 || vb <= 0 {
+		return 0
+	}
+	return cov / math.Sqrt(va*vb)
+}
+
+// shiftBack moves gen's content by (-dx, -dy) pixels, filling what that
+// uncovers with bg.
+func shiftBack(gen *image.NRGBA, dx, dy int, bg color.NRGBA) *image.NRGBA {
+	out := image.NewNRGBA(gen.Bounds())
+	draw.Draw(out, out.Rect, &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	draw.Draw(out, out.Rect, gen, gen.Rect.Min.Add(image.Pt(dx, dy)), draw.Src)
+	return out
+}
+
+// offsetRegion describes a global offset of dx, dy Figma units over the
+// page bounds, for the refinement feedback.
+func offsetRegion(dx, dy int, bounds image.Rectangle) events.MismatchRegion {
+	return events.MismatchRegion{
+		Property: "page offset",
+		Actual:   fmt.Sprintf("the whole page is shifted %s from the design", describeOffset(dx, dy)),
+		Expected: "aligned with the design's top-left — reset the browser's default margins (body { margin: 0 }) or remove the extra outer spacing",
+		X:        bounds.Min.X, Y: bounds.Min.Y,
+		W: bounds.Dx(), H: bounds.Dy(),
+	}
+}
+
+// describeOffset phrases an offset as "12px down" or "8px right and 8px
+// down".
+func describeOffset(dx, dy int) string {
+	var parts []string
+	switch {
+	case dx > 0:
+		parts = append(parts, fmt.Sprintf("%dpx right", dx))
+	case dx < 0:
+		parts = append(parts, fmt.Sprintf("%dpx left", -dx))
+	}
+	switch {
+	case dy > 0:
+		parts = append(parts, fmt.Sprintf("%dpx down", dy))
+	case dy < 0:
+		parts = append(parts, fmt.Sprintf("%dpx up", -dy))
+	}
+	if len(parts) == 2 {
+		return parts[0] + " and " + parts[1]
+	}
+	return parts[0]
+}
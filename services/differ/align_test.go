@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// cardPage draws a 360×640 screen at scale pixels per unit: a header bar,
+// a title and two cards of text lines.
+func cardPage(scale int) *image.NRGBA {
+	img := photoPage(func(int, int) color.NRGBA { return white }, card{16, 90, 328, 3}, card{40, 300, 280, 2})
+	if scale == 1 {
+		return img
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, 360*scale, 640*scale))
+	for y := range out.Rect.Dy() {
+		for x := range out.Rect.Dx() {
+			out.SetNRGBA(x, y, img.NRGBAAt(x/scale, y/scale))
+		}
+	}
+	return out
+}
+
+func TestEstimateOffset(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		scale  int
+		dx, dy int // in Figma units
+		wantOK bool
+	}{
+		{"aligned", 1, 0, 0, false},
+		{"body margin", 1, 8, 8, true},
+		{"down only", 1, 0, 13, true},
+		{"up and left", 1, -5, -3, true},
+		{"2× export", 2, 8, 8, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ref := cardPage(tc.scale)
+			gen := shiftBack(ref, -tc.dx*tc.scale, -tc.dy*tc.scale, white)
+			dx, dy, ok := estimateOffset(context.Background(), ref, gen, 360)
+			if ok != tc.wantOK || dx != tc.dx || dy != tc.dy {
+				t.Errorf("offset %d,%d (%v), want %d,%d (%v)", dx, dy, ok, tc.dx, tc.dy, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestShiftedPageScoresAsAligned(t *testing.T) {
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := compareOpts{weights: weights, background: white, frameWidth: 360}
+	ref := cardPage(1)
+	compare := func(gen *image.NRGBA) *events.DiffResult {
+		r, _, err := pixelCompare(context.Background(), encodePNG(t, ref), encodePNG(t, gen), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	aligned := compare(ref)
+	shifted := compare(shiftBack(ref, -8, -8, white))
+	if shifted.OffsetX != 8 || shifted.OffsetY != 8 {
+		t.Errorf("offset %d,%d, want 8,8", shifted.OffsetX, shifted.OffsetY)
+	}
+	// All that differs once the shift is undone is the strip it uncovered.
+	if shifted.Score < aligned.Score-5 {
+		t.Errorf("shifted by 8px the page scores %.1f, want near the aligned %.1f", shifted.Score, aligned.Score)
+	}
+	var reported bool
+	for _, m := range shifted.Regions {
+		if m.Property == "page offset" {
+			reported = true
+			if !strings.Contains(m.Actual, "8px right and 8px down") {
+				t.Errorf("offset region says %q", m.Actual)
+			}
+		}
+	}
+	if !reported {
+		t.Errorf("no region reports the offset: %+v", shifted.Regions)
+	}
+	if aligned.OffsetX != 0 || aligned.OffsetY != 0 {
+		t.Errorf("an aligned page has offset %d,%d", aligned.OffsetX, aligned.OffsetY)
+	}
+}
+
+// stuckCapturer never finishes a capture until its context ends.
+type stuckCapturer struct{}
+
+func (stuckCapturer) capture(ctx context.Context, _ string, _, _ int, _ shotOpts) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (stuckCapturer) close() {}
+
+func TestCompareWithinBudget(t *testing.T) {
+	ref := encodePNG(t, cardPage(1))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/export.png" {
+			w.Write(ref)
+		}
+	}))
+	defer srv.Close()
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &differ{http: srv.Client(), download: srv.Client(), capture: stuckCapturer{}, attempts: 1, weights: weights, background: white}
+	p := events.DiffRequestedPayload{
+		JobID:          "job-1",
+		SandboxURL:     srv.URL,
+		FigmaExportURL: srv.URL + "/export.png",
+		Screen:         events.FigmaScreen{Width: 360, Height: 640},
+	}
+
+	start := time.Now()
+	_, err = d.compareWithin(context.Background(), p, 200*time.Millisecond)
+	if !errors.Is(err, errScreenshotTimeout) {
+		t.Errorf("err = %v, want errScreenshotTimeout", err)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("gave up after %v on a 200ms budget", took)
+	}
+
+	// Cancelled from outside, it is the caller's error instead.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := d.compareWithin(ctx, p, time.Minute); errors.Is(err, errScreenshotTimeout) || err == nil {
+		t.Errorf("cancelled by the caller: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/rs/zerolog/log"
+)
+
+// maxWorkers caps DIFFER_WORKERS, the diffs run at once. Each worker's
+// capture holds an incognito context open in the shared browser, and past
+// this many Chromium mostly competes with itself for the differ's CPU.
+// Each diff has a budget, so a capture that hangs holds up one worker
+// until it runs out rather than every job's diffs behind it.
+const maxWorkers = 8
+
+// errScreenshotTimeout fails a diff that ran past its budget; what hangs
+// is nearly always the capture.
+var errScreenshotTimeout = errors.New("screenshot timed out")
+
+// compareWithin runs compare within budget. Running out of it cancels the
+// capture and fails with errScreenshotTimeout; a panic fails this diff
+// alone instead of the worker and every diff in flight beside it.
+func (d *differ) compareWithin(ctx context.Context, p events.DiffRequestedPayload, budget time.Duration) (result *events.DiffResult, err error) {
+	dctx := ctx
+	if budget > 0 {
+		var cancel context.CancelFunc
+		dctx, cancel = context.WithTimeoutCause(ctx, budget, errScreenshotTimeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Str("job", p.JobID).Interface("panic", r).Bytes("stack", debug.Stack()).Msg("diff panicked")
+			result, err = nil, fmt.Errorf("differ panic: %v", r)
+		}
+	}()
+
+	result, err = d.compare(dctx, p)
+	if err != nil && ctx.Err() == nil && context.Cause(dctx) == errScreenshotTimeout {
+		err = fmt.Errorf("%w after %s", errScreenshotTimeout, budget)
+	}
+	return result, err
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/rs/zerolog/log"
+)
+
+// capturer screenshots a sandbox URL at a given viewport, returning PNG bytes.
+type capturer interface {
+	capture(ctx context.Context, url string, w, h int, o shotOpts) ([]byte, error)
+	close()
+}
+
+// shotOpts are the per-capture settings. Backends honor what they can of
+// the job's CaptureOptions and ignore the rest.
+type shotOpts struct {
+	viewportOnly bool // just the viewport rather than the full page
+	events.CaptureOptions
+}
+
+// waitLimit is o.WaitTimeoutMs, or def if unset.
+func (o shotOpts) waitLimit(def time.Duration) time.Duration {
+	if o.WaitTimeoutMs > 0 {
+		return time.Duration(o.WaitTimeoutMs) * time.Millisecond
+	}
+	return def
+}
+
+// Default waits: the fixed delay the CLI backend always used, and the cap
+// on waiting for a selector to show up.
+const (
+	defaultWaitTimeout  = 3 * time.Second
+	defaultSelectorWait = 10 * time.Second
+)
+
+// disableAnimations stops CSS animations and transitions, and hides the
+// text caret, so the page is captured as it ends up rather than midway.
+const disableAnimations = `(() => {
+	const s = document.createElement('style');
+	s.textContent = '*, *::before, *::after { animation: none !important; transition: none !important; caret-color: transparent !important; }';
+	document.head.appendChild(s);
+	return true;
+})()`
+
+// deviceScale matches the Figma parser's default export scale, so the
+// capture usually isn't resampled before it is compared. Jobs exporting at
+// another scale have the capture resized to the reference. Both backends
+// capture at it, so switching DIFFER_CAPTURE doesn't move scores.
+const deviceScale = 2
+
+// cliDevice is the Playwright device preset the CLI captures with: desktop
+// Chrome at a device scale factor of deviceScale. The CLI has no flag for
+// the scale alone; --viewport-size still overrides the preset's viewport.
+const cliDevice = "Desktop Chrome HiDPI"
+
+// browserCapturer drives one Chromium launched at startup. Every capture
+// gets its own incognito browser context, so nothing (cookies, storage,
+// service workers) leaks from one sandbox into the next, and the context is
+// torn down afterwards. A crashed browser is relaunched on the next capture.
+type browserCapturer struct {
+	opts        []chromedp.ExecAllocatorOption
+	idleTimeout time.Duration // cap on waiting for network idle; slow pages are captured anyway
+
+	mu      sync.Mutex
+	browser context.Context // cancelled by chromedp when the process dies
+	cancel  context.CancelFunc
+}
+
+func newBrowserCapturer(execPath string, idleTimeout time.Duration) (*browserCapturer, error) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.NoSandbox, // the differ container runs as root
+		chromedp.Flag("font-render-hinting", "none"),
+	)
+	if execPath != "" {
+		opts = append(opts, chromedp.ExecPath(execPath))
+	}
+	b := &browserCapturer{opts: opts, idleTimeout: idleTimeout}
+	if _, err := b.current(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// current returns the live browser, launching a new one if the last exited.
+func (b *browserCapturer) current() (context.Context, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.browser != nil && b.browser.Err() == nil {
+		return b.browser, nil
+	}
+	if b.cancel != nil {
+		b.cancel()
+		log.Warn().Msg("browser exited — relaunching")
+	}
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), b.opts...)
+	browser, browserCancel := chromedp.NewContext(allocCtx)
+	start := time.Now()
+	if err := chromedp.Run(browser); err != nil {
+		browserCancel()
+		allocCancel()
+		b.browser, b.cancel = nil, nil
+		return nil, fmt.Errorf("launch browser: %w", err)
+	}
+	b.browser = browser
+	b.cancel = func() {
+		browserCancel()
+		allocCancel()
+	}
+	log.Info().Dur("took", time.Since(start)).Msg("browser launched")
+	return browser, nil
+}
+
+func (b *browserCapturer) capture(ctx context.Context, url string, w, h int, o shotOpts) ([]byte, error) {
+	browser, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	data, err := b.captureOn(ctx, browser, url, w, h, o)
+	if err != nil && ctx.Err() == nil && browser.Err() != nil {
+		// The browser died under this capture rather than the page failing:
+		// relaunch and try once more.
+		if browser, err = b.current(); err != nil {
+			return nil, err
+		}
+		data, err = b.captureOn(ctx, browser, url, w, h, o)
+	}
+	return data, err
+}
+
+func (b *browserCapturer) captureOn(ctx context.Context, browser context.Context, url string, w, h int, o shotOpts) ([]byte, error) {
+	tab, cancel := chromedp.NewContext(browser, chromedp.WithNewBrowserContext())
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	// networkIdle also fires for the initial about:blank, so only count the
+	// one that follows the navigation's init.
+	idle := make(chan struct{})
+	var navigated atomic.Bool
+	var once sync.Once
+	chromedp.ListenTarget(tab, func(ev any) {
+		e, ok := ev.(*page.EventLifecycleEvent)
+		if !ok {
+			return
+		}
+		switch e.Name {
+		case "init":
+			navigated.Store(true)
+		case "networkIdle":
+			if navigated.Load() {
+				once.Do(func() { close(idle) })
+			}
+		}
+	})
+
+	var png []byte
+	shot := chromedp.FullScreenshot(&png, 100)
+	if o.viewportOnly {
+		shot = chromedp.CaptureScreenshot(&png)
+	}
+	actions := []chromedp.Action{
+		emulation.SetDeviceMetricsOverride(int64(w), int64(h), deviceScale, false),
+		page.SetLifecycleEventsEnabled(true),
+		chromedp.Navigate(url),
+		b.wait(url, o, idle),
+		chromedp.Evaluate(`document.fonts.ready.then(() => true)`, nil,
+			func(p *runtime.EvaluateParams) *runtime.EvaluateParams { return p.WithAwaitPromise(true) }),
+	}
+	if o.DisableAnimations {
+		actions = append(actions, chromedp.Evaluate(disableAnimations, nil))
+	}
+	if o.SettleMs > 0 {
+		actions = append(actions, chromedp.Sleep(time.Duration(o.SettleMs)*time.Millisecond))
+	}
+	err := chromedp.Run(tab, append(actions, shot)...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("browser: %w", err)
+	}
+	return png, nil
+}
+
+// wait holds the capture until the page is ready by o's strategy: network
+// idle by default, a fixed delay, or a selector becoming visible. Running
+// out of time is not an error; the page is captured as it is.
+func (b *browserCapturer) wait(url string, o shotOpts, idle <-chan struct{}) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		switch o.Wait {
+		case events.CaptureWaitTimeout:
+			select {
+			case <-time.After(o.waitLimit(defaultWaitTimeout)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case events.CaptureWaitSelector:
+			limit := o.waitLimit(defaultSelectorWait)
+			wctx, cancel := context.WithTimeout(ctx, limit)
+			err := chromedp.WaitVisible(o.WaitSelector, chromedp.ByQuery).Do(wctx)
+			cancel()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				log.Debug().Str("url", url).Str("selector", o.WaitSelector).Dur("waited", limit).Msg("selector never appeared — capturing anyway")
+			}
+		default:
+			limit := o.waitLimit(b.idleTimeout)
+			select {
+			case <-idle:
+			case <-time.After(limit):
+				log.Debug().Str("url", url).Dur("waited", limit).Msg("network never went idle — capturing anyway")
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
+
+func (b *browserCapturer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+		b.browser, b.cancel = nil, nil
+	}
+}
+
+// cliCapturer shells out to the Playwright CLI per capture. It is the
+// fallback for hosts where the long-lived browser misbehaves. The CLI can
+// only wait a fixed time or for a selector, and can't inject styles, so
+// networkidle falls back to the fixed wait and DisableAnimations is
+// ignored.
+type cliCapturer struct{}
+
+func (cliCapturer) capture(ctx context.Context, url string, w, h int, o shotOpts) ([]byte, error) {
+	outFile := fmt.Sprintf("/tmp/forge-cap-%d.png", time.Now().UnixNano())
+	defer os.Remove(outFile)
+
+	cmd := exec.CommandContext(ctx, "npx", cliArgs(url, outFile, w, h, o)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("playwright: %s: %w", string(out), err)
+	}
+
+	return os.ReadFile(outFile)
+}
+
+// cliArgs are the npx arguments capturing url into outFile.
+func cliArgs(url, outFile string, w, h int, o shotOpts) []string {
+	args := []string{
+		"playwright", "screenshot",
+		"--browser", "chromium",
+		"--device", cliDevice,
+		"--viewport-size", fmt.Sprintf("%dx%d", w, h),
+	}
+	settle := time.Duration(o.SettleMs) * time.Millisecond
+	if o.Wait == events.CaptureWaitSelector {
+		args = append(args, "--wait-for-selector", o.WaitSelector)
+	} else {
+		settle += o.waitLimit(defaultWaitTimeout)
+	}
+	if settle > 0 {
+		args = append(args, "--wait-for-timeout", strconv.FormatInt(settle.Milliseconds(), 10))
+	}
+	if !o.viewportOnly {
+		args = append(args, "--full-page")
+	}
+	return append(args, url, outFile)
+}
+
+func (cliCapturer) close() {}
+
+// newCapturer picks the capture backend from DIFFER_CAPTURE.
+func newCapturer(mode, execPath string, idleTimeout time.Duration) (capturer, error) {
+	switch mode {
+	case "browser":
+		return newBrowserCapturer(execPath, idleTimeout)
+	case "cli":
+		return cliCapturer{}, nil
+	}
+	return nil, errors.New(`DIFFER_CAPTURE must be "browser" or "cli"`)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func TestCLIArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		o    shotOpts
+		want string // the arguments after the viewport size
+	}{
+		{"full page, fixed wait", shotOpts{}, "--wait-for-timeout 3000 --full-page"},
+		{"viewport, settle", shotOpts{viewportOnly: true, CaptureOptions: events.CaptureOptions{SettleMs: 200, WaitTimeoutMs: 500}}, "--wait-for-timeout 700"},
+		{"selector", shotOpts{CaptureOptions: events.CaptureOptions{Wait: events.CaptureWaitSelector, WaitSelector: "#app"}}, "--wait-for-selector #app --full-page"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := cliArgs("http://sandbox.test:3000", "/tmp/out.png", 390, 844, tc.o)
+			got := strings.Join(args, " ")
+			want := "playwright screenshot --browser chromium --device " + cliDevice + " --viewport-size 390x844 " + tc.want + " http://sandbox.test:3000 /tmp/out.png"
+			if got != want {
+				t.Errorf("\n got %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+// testPage serves a 300px tall page, white but for a 120×80 red block in
+// its top left corner that a script draws after 100ms.
+func testPage(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<!doctype html>
+<html><body style="margin:0;background:#fff">
+<div style="height:300px"></div>
+<script>
+setTimeout(() => {
+	const d = document.createElement('div');
+	d.id = 'ready';
+	d.style.cssText = 'position:absolute;left:0;top:0;width:120px;height:80px;background:#f00';
+	document.body.appendChild(d);
+}, 100);
+</script>
+</body></html>`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testBrowser returns a browserCapturer on CHROME_PATH or a Chromium on
+// PATH, skipping the test if there is neither.
+func testBrowser(t *testing.T) *browserCapturer {
+	t.Helper()
+	path := os.Getenv("CHROME_PATH")
+	for _, name := range []string{"chromium", "chromium-browser", "google-chrome", "headless-shell"} {
+		if path != "" {
+			break
+		}
+		path, _ = exec.LookPath(name)
+	}
+	if path == "" {
+		t.Skip("no Chromium: set CHROME_PATH to run")
+	}
+	b, err := newBrowserCapturer(path, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.close)
+	return b
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// isRed reports whether the pixel at x, y is the test page's red.
+func isRed(img image.Image, x, y int) bool {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return r>>8 > 240 && g>>8 < 16 && b>>8 < 16
+}
+
+func TestBrowserCapture(t *testing.T) {
+	b := testBrowser(t)
+	srv := testPage(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	selector := shotOpts{CaptureOptions: events.CaptureOptions{Wait: events.CaptureWaitSelector, WaitSelector: "#ready"}}
+	data, err := b.capture(ctx, srv.URL, 200, 150, selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := decodePNG(t, data)
+	if got, want := img.Bounds().Size(), image.Pt(200*deviceScale, 300*deviceScale); got != want {
+		t.Errorf("full page is %v, want %v", got, want)
+	}
+	if !isRed(img, 10, 10) || !isRed(img, 119*deviceScale, 79*deviceScale) {
+		t.Error("block drawn after load is missing: the selector wasn't waited for")
+	}
+	if isRed(img, 121*deviceScale, 10) {
+		t.Error("block wider than drawn")
+	}
+
+	viewport := selector
+	viewport.viewportOnly = true
+	if data, err = b.capture(ctx, srv.URL, 200, 150, viewport); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decodePNG(t, data).Bounds().Size(), image.Pt(200*deviceScale, 150*deviceScale); got != want {
+		t.Errorf("viewport is %v, want %v", got, want)
+	}
+}
+
+func TestBrowserCaptureRelaunches(t *testing.T) {
+	b := testBrowser(t)
+	srv := testPage(t)
+	b.mu.Lock()
+	b.cancel() // as if the browser crashed
+	b.mu.Unlock()
+	if _, err := b.capture(context.Background(), srv.URL, 200, 150, shotOpts{viewportOnly: true}); err != nil {
+		t.Fatalf("capture after the browser exited: %v", err)
+	}
+}
+
+func TestCaptureBackendsMatchScale(t *testing.T) {
+	b := testBrowser(t)
+	if err := exec.Command("npx", "--no-install", "playwright", "--version").Run(); err != nil {
+		t.Skip("no Playwright CLI")
+	}
+	srv := testPage(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	o := shotOpts{viewportOnly: true, CaptureOptions: events.CaptureOptions{Wait: events.CaptureWaitSelector, WaitSelector: "#ready"}}
+	var sizes []image.Point
+	for _, c := range []capturer{b, cliCapturer{}} {
+		data, err := c.capture(ctx, srv.URL, 200, 150, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, decodePNG(t, data).Bounds().Size())
+	}
+	if !slices.Equal(sizes[:1], sizes[1:]) {
+		t.Errorf("browser captures %v, CLI %v", sizes[0], sizes[1])
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// Palette extraction and matching. Colors are compared in CIELAB with
+// CIEDE2000, where equal distances look equally different, and each
+// reference color counts by how much of the screen it covers: a wrong page
+// background costs far more than an off-shade icon.
+const (
+	paletteSize     = 8     // dominant colors kept per image
+	paletteMinShare = 0.005 // buckets covering less than this are noise
+	// paletteMatchDE is the CIEDE2000 distance still counted as the same
+	// color; ~2 is barely noticeable side by side.
+	paletteMatchDE = 10
+	// paletteMaxDE is where a pair stops earning any credit.
+	paletteMaxDE = 30
+)
+
+type lab struct{ l, a, b float64 }
+
+// swatch is a dominant color and the share of sampled pixels it covers.
+type swatch struct {
+	c     rgb
+	lab   lab
+	share float64
+}
+
+// palette returns img's most common colors, most frequent first. Pixels are
+// bucketed at 4 bits per channel and each bucket is represented by the mean
+// of its pixels, not the bucket corner.
+func palette(img *image.NRGBA, k int) []swatch {
+	b := img.Bounds()
+	type acc struct {
+		n       int
+		r, g, b float64
+	}
+	buckets := make(map[uint32]*acc)
+	total := 0
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x += 2 {
+			r, g, bl := rgbAt(img, x, y)
+			key := uint32(r>>4)<<8 | uint32(g>>4)<<4 | uint32(bl>>4)
+			a := buckets[key]
+			if a == nil {
+				a = &acc{}
+				buckets[key] = a
+			}
+			a.n++
+			a.r += float64(r)
+			a.g += float64(g)
+			a.b += float64(bl)
+			total++
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	accs := make([]*acc, 0, len(buckets))
+	for _, a := range buckets {
+		accs = append(accs, a)
+	}
+	sort.Slice(accs, func(i, j int) bool { return accs[i].n > accs[j].n })
+
+	var out []swatch
+	for _, a := range accs {
+		share := float64(a.n) / float64(total)
+		if len(out) == k || share < paletteMinShare {
+			break
+		}
+		n := float64(a.n)
+		c := rgb{a.r / n, a.g / n, a.b / n}
+		out = append(out, swatch{c: c, lab: toLab(c), share: share})
+	}
+	return out
+}
+
+// colorScore compares the dominant palettes of ref and gen, 0–100. Both
+// directions count, so a color the design lacks (a dark background where
+// there should be white) is penalised as well as one the capture lacks.
+// The returned matches describe the reference side.
+func colorScore(ref, gen *image.NRGBA) (float64, []events.PaletteMatch) {
+	rp := palette(ref, paletteSize)
+	gp := palette(gen, paletteSize)
+	if len(rp) == 0 {
+		return 100, nil
+	}
+	if len(gp) == 0 {
+		return 0, nil
+	}
+
+	matches := make([]events.PaletteMatch, 0, len(rp))
+	forward := coverage(rp, gp, func(s, near swatch, de float64) {
+		matches = append(matches, events.PaletteMatch{
+			Expected: s.c.hex(),
+			Actual:   near.c.hex(),
+			Coverage: math.Round(s.share*1000) / 1000,
+			DeltaE:   math.Round(de*10) / 10,
+			Matched:  de <= paletteMatchDE,
+		})
+	})
+	backward := coverage(gp, rp, nil)
+	return (forward + backward) / 2 * 100, matches
+}
+
+// coverage is the share-weighted credit, 0–1, that the colors of from earn
+// against their nearest neighbours in to. each, if set, sees every pair.
+func coverage(from, to []swatch, each func(s, near swatch, de float64)) float64 {
+	var credit, weight float64
+	for _, s := range from {
+		best, bestDE := to[0], math.Inf(1)
+		for _, t := range to {
+			if de := deltaE2000(s.lab, t.lab); de < bestDE {
+				best, bestDE = t, de
+			}
+		}
+		if each != nil {
+			each(s, best, bestDE)
+		}
+		credit += s.share * closeness(bestDE)
+		weight += s.share
+	}
+	return credit / weight
+}
+
+// closeness maps a CIEDE2000 distance to credit: full up to the match
+// tolerance, none past paletteMaxDE, linear between.
+func closeness(de float64) float64 {
+	switch {
+	case de <= paletteMatchDE:
+		return 1
+	case de >= paletteMaxDE:
+		return 0
+	}
+	return 1 - (de-paletteMatchDE)/(paletteMaxDE-paletteMatchDE)
+}
+
+// toLab converts an 8-bit sRGB color to CIELAB under D65.
+func toLab(c rgb) lab {
+	lin := func(v float64) float64 {
+		v /= 255
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	r, g, b := lin(c.r), lin(c.g), lin(c.b)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// deltaE2000 is the CIEDE2000 color difference with unit weighting factors.
+func deltaE2000(c1, c2 lab) float64 {
+	const deg = math.Pi / 180
+	pow7 := func(v float64) float64 { return math.Pow(v, 7) }
+
+	cab := (math.Hypot(c1.a, c1.b) + math.Hypot(c2.a, c2.b)) / 2
+	g := 0.5 * (1 - math.Sqrt(pow7(cab)/(pow7(cab)+pow7(25))))
+	a1, a2 := (1+g)*c1.a, (1+g)*c2.a
+	cp1, cp2 := math.Hypot(a1, c1.b), math.Hypot(a2, c2.b)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) / deg
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	hp1, hp2 := hue(c1.b, a1), hue(c2.b, a2)
+
+	dL := c2.l - c1.l
+	dC := cp2 - cp1
+	var dh float64
+	if cp1*cp2 != 0 {
+		dh = hp2 - hp1
+		switch {
+		case dh > 180:
+			dh -= 360
+		case dh < -180:
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(cp1*cp2) * math.Sin(dh/2*deg)
+
+	lMean := (c1.l + c2.l) / 2
+	cMean := (cp1 + cp2) / 2
+	hMean := hp1 + hp2
+	if cp1*cp2 != 0 {
+		switch {
+		case math.Abs(hp1-hp2) <= 180:
+			hMean /= 2
+		case hp1+hp2 < 360:
+			hMean = (hMean + 360) / 2
+		default:
+			hMean = (hMean - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos((hMean-30)*deg) + 0.24*math.Cos(2*hMean*deg) +
+		0.32*math.Cos((3*hMean+6)*deg) - 0.20*math.Cos((4*hMean-63)*deg)
+	dTheta := 30 * math.Exp(-math.Pow((hMean-275)/25, 2))
+	rc := 2 * math.Sqrt(pow7(cMean)/(pow7(cMean)+pow7(25)))
+	l50 := (lMean - 50) * (lMean - 50)
+	sl := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sc := 1 + 0.045*cMean
+	sh := 1 + 0.015*cMean*t
+	rt := -math.Sin(2*dTheta*deg) * rc
+
+	lt, ct, ht := dL/sl, dC/sc, dH/sh
+	return math.Sqrt(lt*lt + ct*ct + ht*ht + rt*ct*ht)
+}
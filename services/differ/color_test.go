@@ -0,0 +1,168 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestDeltaE2000(t *testing.T) {
+	// Pairs from Sharma, Wu and Dalal's CIEDE2000 test data, which cover
+	// the hue-angle edge cases the formula is easy to get wrong on.
+	for _, tc := range []struct {
+		c1, c2 lab
+		want   float64
+	}{
+		{lab{50, 2.6772, -79.7751}, lab{50, 0, -82.7485}, 2.0425},
+		{lab{50, 3.1571, -77.2803}, lab{50, 0, -82.7485}, 2.8615},
+		{lab{50, 2.5, 0}, lab{50, 0, -2.5}, 4.3065},
+		{lab{50, 2.5, 0}, lab{73, 25, -18}, 27.1492},
+		{lab{50, -0.001, 2.49}, lab{50, 0.0009, -2.49}, 4.8045},
+		{lab{50, -0.001, 2.49}, lab{50, 0.0011, -2.49}, 4.7461}, // across the hue-mean discontinuity
+		{lab{60.2574, -34.0099, 36.2677}, lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{lab{2.0776, 0.0795, -1.135}, lab{0.9033, -0.0636, -0.5514}, 0.9082},
+	} {
+		if got := deltaE2000(tc.c1, tc.c2); math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("ΔE(%v, %v) = %.4f, want %.4f", tc.c1, tc.c2, got, tc.want)
+		}
+		if a, b := deltaE2000(tc.c1, tc.c2), deltaE2000(tc.c2, tc.c1); math.Abs(a-b) > 1e-9 {
+			t.Errorf("ΔE(%v, %v) not symmetric: %.6f, %.6f", tc.c1, tc.c2, a, b)
+		}
+	}
+	if de := deltaE2000(toLab(rgb{103, 80, 164}), toLab(rgb{103, 80, 164})); de != 0 {
+		t.Errorf("a color is %.4f from itself", de)
+	}
+}
+
+func TestToLab(t *testing.T) {
+	for _, tc := range []struct {
+		c    rgb
+		want lab
+	}{
+		{rgb{255, 255, 255}, lab{100, 0, 0}},
+		{rgb{0, 0, 0}, lab{0, 0, 0}},
+		{rgb{255, 0, 0}, lab{53.24, 80.09, 67.2}},
+		{rgb{0, 0, 255}, lab{32.3, 79.19, -107.86}},
+		{rgb{128, 128, 128}, lab{53.59, 0, 0}},
+	} {
+		got := toLab(tc.c)
+		if math.Abs(got.l-tc.want.l) > 0.01 || math.Abs(got.a-tc.want.a) > 0.01 || math.Abs(got.b-tc.want.b) > 0.01 {
+			t.Errorf("toLab(%v) = %.2f, want %v", tc.c, got, tc.want)
+		}
+	}
+}
+
+// fill paints r of img c.
+func fill(img *image.NRGBA, r image.Rectangle, c color.NRGBA) {
+	draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+var (
+	white  = color.NRGBA{255, 255, 255, 255}
+	red    = color.NRGBA{255, 0, 0, 255}
+	blue   = color.NRGBA{0, 0, 255, 255}
+	green  = color.NRGBA{0, 160, 0, 255}
+	yellow = color.NRGBA{255, 255, 0, 255}
+)
+
+func TestPaletteOrdersByCoverage(t *testing.T) {
+	// 100×200 in stripes: 70% white, 20% blue, 9% red, 1% green, and a
+	// yellow speck too small to count.
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 200))
+	fill(img, image.Rect(0, 0, 100, 140), white)
+	fill(img, image.Rect(0, 140, 100, 180), blue)
+	fill(img, image.Rect(0, 180, 100, 198), red)
+	fill(img, image.Rect(0, 198, 100, 200), green)
+	fill(img, image.Rect(10, 10, 14, 14), yellow)
+
+	p := palette(img, paletteSize)
+	want := []struct {
+		hex   string
+		share float64
+	}{{"#FFFFFF", 0.7}, {"#0000FF", 0.2}, {"#FF0000", 0.09}, {"#00A000", 0.01}}
+	if len(p) != len(want) {
+		t.Fatalf("%d colors, want %d: %v", len(p), len(want), p)
+	}
+	for i, w := range want {
+		if p[i].c.hex() != w.hex || math.Abs(p[i].share-w.share) > 0.002 {
+			t.Errorf("color %d is %s covering %.3f, want %s covering %.2f", i, p[i].c.hex(), p[i].share, w.hex, w.share)
+		}
+	}
+	if p := palette(img, 2); len(p) != 2 || p[1].c.hex() != "#0000FF" {
+		t.Errorf("palette of 2 kept %v", p)
+	}
+}
+
+// iconScreen is a 200×200 screen of bg with a 20×20 icon, 1% of it, in
+// the middle.
+func iconScreen(bg, icon color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	fill(img, img.Bounds(), bg)
+	fill(img, image.Rect(90, 90, 110, 110), icon)
+	return img
+}
+
+func TestColorScoreWeightsByCoverage(t *testing.T) {
+	ref := iconScreen(white, red)
+
+	score, matches := colorScore(ref, iconScreen(white, red))
+	if score != 100 {
+		t.Errorf("identical palettes score %.1f", score)
+	}
+	for _, m := range matches {
+		if !m.Matched || m.DeltaE != 0 || m.Expected != m.Actual {
+			t.Errorf("identical palettes: %+v", m)
+		}
+	}
+
+	wrongIcon, matches := colorScore(ref, iconScreen(white, blue))
+	darkPage, _ := colorScore(ref, iconScreen(color.NRGBA{32, 32, 32, 255}, red))
+	if wrongIcon <= darkPage {
+		t.Errorf("a wrong icon scores %.1f, a wrong background %.1f; want the icon to cost less", wrongIcon, darkPage)
+	}
+	if wrongIcon < 95 {
+		t.Errorf("a wrong 1%% icon scores %.1f, want ≥95", wrongIcon)
+	}
+	if darkPage > 10 {
+		t.Errorf("a wrong background scores %.1f, want ≤10", darkPage)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("%d palette matches, want 2: %+v", len(matches), matches)
+	}
+	if m := matches[0]; m.Expected != "#FFFFFF" || !m.Matched || m.Coverage != 0.99 {
+		t.Errorf("background %+v, want #FFFFFF matched, covering 0.99", m)
+	}
+	if m := matches[1]; m.Expected != "#FF0000" || m.Matched || m.DeltaE <= paletteMatchDE || m.Coverage != 0.01 {
+		t.Errorf("icon %+v, want #FF0000 unmatched, covering 0.01", m)
+	}
+}
+
+func TestColorScoreCountsExtraColors(t *testing.T) {
+	// Every reference color is in the capture, but so is a green banner
+	// covering a quarter of it: the backward pass marks that down.
+	ref := iconScreen(white, red)
+	gen := iconScreen(white, red)
+	fill(gen, image.Rect(0, 0, 200, 50), green)
+	score, matches := colorScore(ref, gen)
+	for _, m := range matches {
+		if !m.Matched {
+			t.Errorf("reference color unmatched: %+v", m)
+		}
+	}
+	if score >= 95 || score < 75 {
+		t.Errorf("an extra quarter-screen color scores %.1f, want 75-95", score)
+	}
+}
+
+func TestCloseness(t *testing.T) {
+	for _, tc := range []struct{ de, want float64 }{
+		{0, 1}, {paletteMatchDE, 1}, {(paletteMatchDE + paletteMaxDE) / 2, 0.5}, {paletteMaxDE, 0}, {100, 0},
+	} {
+		if got := closeness(tc.de); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("closeness(%g) = %g, want %g", tc.de, got, tc.want)
+		}
+	}
+}
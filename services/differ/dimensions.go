@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// aspectTolerance is the relative aspect-ratio difference below which the
+// capture is simply resized onto the reference. Beyond it, resizing would
+// squash the whole page to hide what is really extra or missing content.
+const aspectTolerance = 0.02
+
+// aspectDelta is how much taller, relative to its width, gen is than ref.
+func aspectDelta(ref, gen image.Rectangle) float64 {
+	if ref.Dx() == 0 || ref.Dy() == 0 || gen.Dx() == 0 {
+		return 0
+	}
+	refAspect := float64(ref.Dy()) / float64(ref.Dx())
+	genAspect := float64(gen.Dy()) / float64(gen.Dx())
+	return genAspect/refAspect - 1
+}
+
+// fitCapture brings gen onto ref's pixel grid. Within aspectTolerance it is
+// resized to ref's size. Otherwise it is scaled to ref's width only and
+// both images are cropped to the height they share, so the overlapping
+// content is compared as rendered; the returned regions then describe the
+// difference in size, in Figma units of a frame frameWidth wide. A capture
+// wider than the viewport it was taken at has content overflowing
+// horizontally; only the part inside the viewport is compared.
+func fitCapture(ref, gen *image.NRGBA, frameWidth float64) (*image.NRGBA, *image.NRGBA, []events.MismatchRegion) {
+	var regions []events.MismatchRegion
+	if frameWidth > 0 {
+		// The capture is frameWidth CSS pixels wide at its device scale,
+		// unless something overflows.
+		gw := float64(gen.Bounds().Dx())
+		scale := math.Max(1, math.Floor(gw/frameWidth))
+		if over := gw/scale - frameWidth; over >= 1 {
+			regions = append(regions, events.MismatchRegion{
+				Property: "page width",
+				Actual:   fmt.Sprintf("rendered content is %.0fpx wider than the design", over),
+				Expected: fmt.Sprintf("%.0fpx wide — find the element overflowing horizontally and constrain it", frameWidth),
+				X:        ref.Bounds().Dx(), W: int(over * float64(ref.Bounds().Dx()) / frameWidth),
+				H: ref.Bounds().Dy(),
+			})
+			gb := gen.Bounds()
+			gen = imaging.Crop(gen, image.Rect(gb.Min.X, gb.Min.Y, gb.Min.X+int(frameWidth*scale), gb.Max.Y))
+		}
+	}
+
+	rb, gb := ref.Bounds(), gen.Bounds()
+	if math.Abs(aspectDelta(rb, gb)) <= aspectTolerance {
+		return ref, imaging.Resize(gen, rb.Dx(), rb.Dy(), imaging.Lanczos), regions
+	}
+
+	h := int(math.Round(float64(gb.Dy()) * float64(rb.Dx()) / float64(gb.Dx())))
+	gen = imaging.Resize(gen, rb.Dx(), h, imaging.Lanczos)
+	common := image.Rect(0, 0, rb.Dx(), min(rb.Dy(), h))
+	ref = imaging.Crop(ref, common.Add(rb.Min))
+	gen = imaging.Crop(gen, common)
+
+	// Reference pixels per Figma unit; the export scale if the frame width
+	// is unknown.
+	perUnit := float64(deviceScale)
+	if frameWidth > 0 {
+		perUnit = float64(rb.Dx()) / frameWidth
+	}
+	designH := float64(rb.Dy()) / perUnit
+	diff := math.Abs(float64(h-rb.Dy())) / perUnit
+
+	r := events.MismatchRegion{
+		Property: "page height",
+		X:        0, Y: common.Dy(),
+		W: rb.Dx(), H: abs(h - rb.Dy()),
+	}
+	if h > rb.Dy() {
+		r.Actual = fmt.Sprintf("rendered content is %.0fpx taller than the design", diff)
+		r.Expected = fmt.Sprintf("%.0fpx tall — reduce vertical spacing or remove overflowing content", designH)
+	} else {
+		r.Actual = fmt.Sprintf("rendered content is %.0fpx shorter than the design", diff)
+		r.Expected = fmt.Sprintf("%.0fpx tall — restore missing sections or vertical spacing", designH)
+	}
+	return ref, gen, append(regions, r)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestFitCapture(t *testing.T) {
+	// A 2× export of a 360×640 frame.
+	ref := image.NewNRGBA(image.Rect(0, 0, 720, 1280))
+	fill(ref, ref.Bounds(), white)
+
+	for _, tc := range []struct {
+		name    string
+		gen     image.Rectangle
+		want    image.Point // the size both images are compared at
+		regions []string    // the properties reported, in order
+		region  string      // in the last region's Actual
+	}{
+		{"same aspect, other scale", image.Rect(0, 0, 1080, 1920), image.Pt(720, 1280), nil, ""},
+		{"within tolerance", image.Rect(0, 0, 720, 1290), image.Pt(720, 1280), nil, ""},
+		{"taller", image.Rect(0, 0, 720, 1600), image.Pt(720, 1280), []string{"page height"}, "160px taller"},
+		{"shorter", image.Rect(0, 0, 720, 960), image.Pt(720, 960), []string{"page height"}, "160px shorter"},
+		{"overflowing", image.Rect(0, 0, 800, 1280), image.Pt(720, 1280), []string{"page width"}, "40px wider"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gen := image.NewNRGBA(tc.gen)
+			fill(gen, gen.Bounds(), red)
+			r, g, regions := fitCapture(ref, gen, 360)
+			if r.Bounds().Size() != tc.want || g.Bounds().Size() != tc.want {
+				t.Errorf("compared at %v and %v, want both %v", r.Bounds().Size(), g.Bounds().Size(), tc.want)
+			}
+			var got []string
+			for _, m := range regions {
+				got = append(got, m.Property)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.regions, ",") {
+				t.Fatalf("regions %v, want %v", got, tc.regions)
+			}
+			if tc.region != "" && !strings.Contains(regions[len(regions)-1].Actual, tc.region) {
+				t.Errorf("region says %q, want %q", regions[len(regions)-1].Actual, tc.region)
+			}
+		})
+	}
+}
+
+func TestFitCaptureReportsTheMissingStrip(t *testing.T) {
+	ref := image.NewNRGBA(image.Rect(0, 0, 720, 1280))
+	gen := image.NewNRGBA(image.Rect(0, 0, 720, 960))
+	_, _, regions := fitCapture(ref, gen, 360)
+	if len(regions) != 1 {
+		t.Fatalf("regions %+v", regions)
+	}
+	// Below the shared 960 rows, in reference pixels.
+	if m := regions[0]; m.X != 0 || m.Y != 960 || m.W != 720 || m.H != 320 {
+		t.Errorf("the missing strip is at %d,%d %d×%d, want 0,960 720×320", m.X, m.Y, m.W, m.H)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/httpx"
+)
+
+func TestDownloadImageRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("\x89PNG"))
+	}))
+	defer srv.Close()
+
+	// The test server is on loopback, as an internal service would be. The
+	// check is on the address dialed, so it holds for a name resolving to
+	// one too.
+	d := &differ{download: httpx.NewClient(5*time.Second, httpx.WithPublicOnly())}
+	if _, err := d.downloadImage(context.Background(), srv.URL); !errors.Is(err, httpx.ErrNotPublic) {
+		t.Errorf("downloaded from %s: %v", srv.URL, err)
+	}
+
+	d.download = srv.Client()
+	if data, err := d.downloadImage(context.Background(), srv.URL); err != nil || !bytes.Equal(data, []byte("\x89PNG")) {
+		t.Errorf("download = %q, %v", data, err)
+	}
+}
+
+func TestDownloadImageIsBounded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		chunk := make([]byte, 1<<20)
+		for range maxReferenceBytes>>20 + 1 {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	d := &differ{download: srv.Client()}
+	if _, err := d.downloadImage(context.Background(), srv.URL); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("an endless body: %v", err)
+	}
+}
+
+// storage records what is uploaded to it, failing uploads named fail.
+type storage struct {
+	mu    sync.Mutex
+	types map[string]string // path → Content-Type
+	fail  string
+}
+
+func (s *storage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/storage/v1/object/forge-assets/")
+	if r.Header.Get("Authorization") != "Bearer service-key" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.fail != "" && strings.HasSuffix(path, s.fail) {
+		http.Error(w, "quota exceeded", http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.types[path] = r.Header.Get("Content-Type")
+	s.mu.Unlock()
+}
+
+func TestUploadCaptures(t *testing.T) {
+	store := &storage{types: map[string]string{}, fail: "generated.png"}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	d := &differ{http: srv.Client(), supabaseURL: srv.URL, supabaseKey: "service-key"}
+	public := srv.URL + "/storage/v1/object/public/forge-assets/"
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	var pngData, jpegData bytes.Buffer
+	png.Encode(&pngData, img)
+	jpeg.Encode(&jpegData, img, nil)
+	imgs := &captures{
+		exportURL: "https://figma.test/export/1.jpg",
+		reference: jpegData.Bytes(),
+		generated: pngData.Bytes(),
+		diff:      pngData.Bytes(),
+	}
+
+	p := events.DiffRequestedPayload{JobID: "job-1", ScreenIndex: 2, Iteration: 1}
+	var first events.DiffResult
+	d.uploadCaptures(context.Background(), p, &first, imgs)
+	if want := public + "diffs/job-1/2/iter-1/diff.png"; first.DiffImageURL != want {
+		t.Errorf("diff at %q, want %q", first.DiffImageURL, want)
+	}
+	if first.GeneratedImageURL != "" {
+		t.Errorf("a failed upload left %q", first.GeneratedImageURL)
+	}
+	// A JPEG export keeps its extension and type.
+	if want := public + "diffs/job-1/2/iter-1/reference.jpg"; first.ReferenceImageURL != want {
+		t.Errorf("reference at %q, want %q", first.ReferenceImageURL, want)
+	}
+	if typ := store.types["diffs/job-1/2/iter-1/reference.jpg"]; typ != "image/jpeg" {
+		t.Errorf("reference uploaded as %q", typ)
+	}
+
+	// The next iteration links the first one's reference.
+	p.Iteration = 2
+	var second events.DiffResult
+	d.uploadCaptures(context.Background(), p, &second, imgs)
+	if second.ReferenceImageURL != first.ReferenceImageURL {
+		t.Errorf("iteration 2 reference %q, want iteration 1's %q", second.ReferenceImageURL, first.ReferenceImageURL)
+	}
+	if _, ok := store.types["diffs/job-1/2/iter-2/reference.jpg"]; ok {
+		t.Error("the reference was uploaded again")
+	}
+	if len(store.types) != 3 {
+		t.Errorf("uploaded %v", store.types)
+	}
+}
+
+func TestUploadCapturesRetriesAFailedReference(t *testing.T) {
+	store := &storage{types: map[string]string{}, fail: "reference.png"}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	d := &differ{http: srv.Client(), supabaseURL: srv.URL, supabaseKey: "service-key"}
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	imgs := &captures{exportURL: "https://figma.test/export/1.png", reference: pngData.Bytes()}
+	p := events.DiffRequestedPayload{JobID: "job-1", Iteration: 1}
+
+	var r events.DiffResult
+	d.uploadCaptures(context.Background(), p, &r, imgs)
+	if r.ReferenceImageURL != "" || len(d.refs) != 0 {
+		t.Fatalf("a failed reference upload gave %q and cached %v", r.ReferenceImageURL, d.refs)
+	}
+	store.fail = ""
+	p.Iteration = 2
+	d.uploadCaptures(context.Background(), p, &r, imgs)
+	if !strings.HasSuffix(r.ReferenceImageURL, "diffs/job-1/0/iter-2/reference.png") {
+		t.Errorf("the next iteration's reference is at %q", r.ReferenceImageURL)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// maskShade paints over ignored areas on the diff image, a flat neutral
+// gray rather than the green of a match, so reviewers can see what the
+// score didn't look at.
+var maskShade = color.NRGBA{R: 128, G: 128, B: 128, A: 255}
+
+// maskRects converts ignore boxes, in Figma units of a frame frameWidth
+// wide, to pixel rectangles of a reference image with the given bounds.
+func maskRects(boxes []events.Box, frameWidth float64, bounds image.Rectangle) []image.Rectangle {
+	if len(boxes) == 0 || frameWidth <= 0 {
+		return nil
+	}
+	scale := float64(bounds.Dx()) / frameWidth
+	var out []image.Rectangle
+	for _, b := range boxes {
+		r := image.Rect(
+			int(math.Floor(b.X*scale)), int(math.Floor(b.Y*scale)),
+			int(math.Ceil((b.X+b.W)*scale)), int(math.Ceil((b.Y+b.H)*scale)),
+		).Add(bounds.Min).Intersect(bounds)
+		if !r.Empty() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// blankMasks paints the masked areas of img with bg. Done to both images,
+// it makes them identical there, so no metric can score them against the
+// match; the pixel scores leave them out altogether, with diffMap.exclude.
+func blankMasks(img draw.Image, masks []image.Rectangle, bg color.NRGBA) {
+	for _, r := range masks {
+		draw.Draw(img, r, &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	}
+}
+
+// shadeMasks paints the masked areas of the diff image neutral.
+func shadeMasks(img draw.Image, masks []image.Rectangle) {
+	for _, r := range masks {
+		draw.Draw(img, r, &image.Uniform{C: maskShade}, image.Point{}, draw.Src)
+	}
+}
+
+// masked reports whether r lies entirely within one of masks.
+func masked(r image.Rectangle, masks []image.Rectangle) bool {
+	for _, m := range masks {
+		if r.In(m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func TestMaskRects(t *testing.T) {
+	// A 2× export of a 360 wide frame.
+	bounds := image.Rect(0, 0, 720, 1280)
+	got := maskRects([]events.Box{
+		{X: 0, Y: 0, W: 360, H: 24},        // the status bar
+		{X: 10.25, Y: 100, W: 20, H: 20.5}, // rounded outward
+		{X: 340, Y: 620, W: 100, H: 100},   // clipped to the image
+		{X: 400, Y: 0, W: 10, H: 10},       // off the image
+	}, 360, bounds)
+	want := []image.Rectangle{
+		image.Rect(0, 0, 720, 48),
+		image.Rect(20, 200, 61, 241),
+		image.Rect(680, 1240, 720, 1280),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("masks %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mask %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+	if m := maskRects([]events.Box{{W: 10, H: 10}}, 0, bounds); m != nil {
+		t.Errorf("masks %v without a frame width", m)
+	}
+}
+
+func TestIgnoreRegionsLeaveOutTheirArea(t *testing.T) {
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same screen but for a carousel that shows another slide in every
+	// capture.
+	screen := func(slide color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 360, 640))
+		fill(img, img.Bounds(), white)
+		fill(img, image.Rect(0, 0, 360, 24), color.NRGBA{28, 27, 31, 255})
+		fill(img, image.Rect(0, 40, 360, 240), slide)
+		fill(img, image.Rect(24, 300, 336, 348), blue)
+		return img
+	}
+	ref, gen := encodePNG(t, screen(red)), encodePNG(t, screen(green))
+
+	compare := func(ignore []events.Box) *events.DiffResult {
+		opts := compareOpts{weights: weights, background: white, frameWidth: 360, ignore: ignore}
+		r, _, err := pixelCompare(context.Background(), ref, gen, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	seen := compare(nil)
+	ignored := compare([]events.Box{{X: 0, Y: 40, W: 360, H: 200}})
+
+	if seen.Score >= 95 {
+		t.Errorf("another slide scores %.1f unmasked; the fixture no longer shows it", seen.Score)
+	}
+	if ignored.Score < 99.5 {
+		t.Errorf("with the carousel ignored the screens score %.1f, up from %.1f; want them identical", ignored.Score, seen.Score)
+	}
+	if len(seen.Regions) == 0 {
+		t.Error("no region reports the carousel unmasked")
+	}
+	for _, m := range ignored.Regions {
+		if m.Y >= 40 && m.Y+m.H <= 240 {
+			t.Errorf("region inside the ignored carousel: %+v", m)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// maxNodeRegions caps the named regions reported per mismatching cell,
+// worst first, so one broken card doesn't flood the prompt.
+const maxNodeRegions = 5
+
+// placedNode is a named component-tree node positioned in reference-image
+// pixels.
+type placedNode struct {
+	node events.ComponentNode
+	rect image.Rectangle
+}
+
+// placeNodes flattens screen's component tree into reference-image
+// coordinates. The root frame and nodes that are tiny or cover most of the
+// screen are left out: neither makes a useful "this element is wrong".
+func placeNodes(screen *events.FigmaScreen, bounds image.Rectangle) []placedNode {
+	if screen == nil || screen.Width <= 0 {
+		return nil
+	}
+	scale := float64(bounds.Dx()) / screen.Width
+	maxArea := bounds.Dx() * bounds.Dy() / 2
+
+	var out []placedNode
+	var walk func(n events.ComponentNode, root bool)
+	walk = func(n events.ComponentNode, root bool) {
+		if !root && n.Box != nil && strings.TrimSpace(n.Name) != "" {
+			r := image.Rect(
+				int(math.Round(n.Box.X*scale)), int(math.Round(n.Box.Y*scale)),
+				int(math.Round((n.Box.X+n.Box.W)*scale)), int(math.Round((n.Box.Y+n.Box.H)*scale)),
+			).Intersect(bounds)
+			if r.Dx() >= 4 && r.Dy() >= 4 && r.Dx()*r.Dy() <= maxArea {
+				out = append(out, placedNode{node: n, rect: r})
+			}
+		}
+		for _, c := range n.Children {
+			walk(c, false)
+		}
+	}
+	walk(screen.ComponentTree, true)
+	return out
+}
+
+// nodeRegions scores every named node overlapping area and describes the
+// ones that fail in terms of the design: which element, and what its fill
+// or type should be. seen stops a node spanning two cells from being
+// reported twice.
+func nodeRegions(diffs *diffMap, ref, gen *image.NRGBA, area image.Rectangle, nodes []placedNode, seen map[int]bool,
+	screen *events.FigmaScreen) []events.MismatchRegion {
+	type failing struct {
+		i     int
+		score float64
+	}
+	var fails []failing
+	for i, pn := range nodes {
+		if seen[i] || !pn.rect.Overlaps(area) {
+			continue
+		}
+		score := diffs.score(pn.rect)
+		if score < 82 {
+			fails = append(fails, failing{i, score})
+		}
+	}
+	sort.Slice(fails, func(a, b int) bool { return fails[a].score < fails[b].score })
+	if len(fails) > maxNodeRegions {
+		fails = fails[:maxNodeRegions]
+	}
+
+	regions := make([]events.MismatchRegion, 0, len(fails))
+	for _, f := range fails {
+		seen[f.i] = true
+		pn := nodes[f.i]
+		r := describeNode(pn.node, ref.SubImage(pn.rect).(*image.NRGBA), gen.SubImage(pn.rect).(*image.NRGBA), f.score, screen)
+		r.X, r.Y, r.W, r.H = pn.rect.Min.X, pn.rect.Min.Y, pn.rect.Dx(), pn.rect.Dy()
+		regions = append(regions, r)
+	}
+	return regions
+}
+
+// describeNode explains a failing node: a wrong fill if the dominant colors
+// differ, otherwise the expected type style for text, otherwise the match.
+func describeNode(n events.ComponentNode, refCrop, genCrop *image.NRGBA, score float64, screen *events.FigmaScreen) events.MismatchRegion {
+	r := events.MismatchRegion{
+		Property: nodeLabel(n),
+		Actual:   fmt.Sprintf("%.0f%% match", score),
+		Expected: "≥82%",
+	}
+
+	want, wantHex := modalColor(refCrop), ""
+	if hex := screen.Colors[screen.NodeColors[n.Name]]; len(hex) >= 7 {
+		if c, err := events.ParseHexColor(hex[:7]); err == nil {
+			want, wantHex = rgb{float64(c.R), float64(c.G), float64(c.B)}, hex
+		}
+	}
+	if wantHex == "" {
+		wantHex = want.hex()
+	}
+	got := modalColor(genCrop)
+	if deltaE2000(toLab(want), toLab(got)) > paletteMatchDE {
+		r.Expected = wantHex + " fill"
+		r.Actual = got.hex() + " fill"
+		return r
+	}
+	if ts, ok := screen.Typography[n.Name]; ok && n.Type == "TEXT" {
+		r.Expected = fmt.Sprintf("%gpx %s, weight %d", ts.FontSize, ts.FontFamily, ts.FontWeight)
+	}
+	return r
+}
+
+// nodeLabel names a node the way a designer would refer to it, e.g.
+// "Button 'Sign in'".
+func nodeLabel(n events.ComponentNode) string {
+	lower := strings.ToLower(n.Name)
+	kind := "Element"
+	switch {
+	case strings.Contains(lower, "button") || strings.Contains(lower, "btn"):
+		kind = "Button"
+	case strings.Contains(lower, "input") || strings.Contains(lower, "field"):
+		kind = "Input"
+	case strings.Contains(lower, "icon"):
+		kind = "Icon"
+	case n.Type == "TEXT":
+		kind = "Text"
+	case n.Props["image_ref"] != nil || n.Props["image_url"] != nil:
+		kind = "Image"
+	case n.Type == "INSTANCE" || n.Type == "COMPONENT":
+		kind = "Component"
+	case n.Type == "FRAME" || n.Type == "GROUP":
+		kind = "Container"
+	case n.Type == "RECTANGLE" || n.Type == "ELLIPSE" || n.Type == "VECTOR":
+		kind = "Shape"
+	}
+	return fmt.Sprintf("%s '%s'", kind, n.Name)
+}
+
+// modalColor is the average of the most common coarse color bucket in img.
+func modalColor(img *image.NRGBA) rgb {
+	b := img.Bounds()
+	type acc struct {
+		n       int
+		r, g, b float64
+	}
+	buckets := make(map[[3]uint8]*acc)
+	var best *acc
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x += 2 {
+			r, g, bl := rgbAt(img, x, y)
+			key := [3]uint8{r >> 4, g >> 4, bl >> 4}
+			a := buckets[key]
+			if a == nil {
+				a = &acc{}
+				buckets[key] = a
+			}
+			a.n++
+			a.r += float64(r)
+			a.g += float64(g)
+			a.b += float64(bl)
+			if best == nil || a.n > best.n {
+				best = a
+			}
+		}
+	}
+	if best == nil {
+		return rgb{}
+	}
+	n := float64(best.n)
+	return rgb{best.r / n, best.g / n, best.b / n}
+}
+
+func (c rgb) hex() string {
+	return fmt.Sprintf("#%02X%02X%02X", uint8(math.Round(c.r)), uint8(math.Round(c.g)), uint8(math.Round(c.b)))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// signInScreen is the figma-parser's output for its Sign in fixture, sent
+// through a diff.requested the way the orchestrator forwards it.
+func signInScreen(t *testing.T) *events.FigmaScreen {
+	t.Helper()
+	data, err := os.ReadFile("../figma-parser/testdata/signin.screen.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p events.DiffRequestedPayload
+	if err := json.Unmarshal(data, &p.Screen); err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got events.DiffRequestedPayload
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	return &got.Screen
+}
+
+// render draws screen's nodes as flat boxes of their fills, with fill
+// overriding the hex of any node it names.
+func render(t *testing.T, screen *events.FigmaScreen, fill map[string]string) *image.NRGBA {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, int(screen.Width), int(screen.Height)))
+	var walk func(n events.ComponentNode)
+	walk = func(n events.ComponentNode) {
+		hex, ok := fill[n.Name]
+		if !ok {
+			hex = screen.Colors[screen.NodeColors[n.Name]]
+		}
+		c, err := events.ParseHexColor(hex)
+		if err != nil {
+			t.Fatalf("%s: %v", n.Name, err)
+		}
+		b := n.Box
+		r := image.Rect(int(b.X), int(b.Y), int(b.X+b.W), int(b.Y+b.H))
+		draw.Draw(img, r, &image.Uniform{color.NRGBA{c.R, c.G, c.B, 255}}, image.Point{}, draw.Src)
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(screen.ComponentTree)
+	return img
+}
+
+func TestPlaceNodesSkipsRootAndTinyNodes(t *testing.T) {
+	screen := signInScreen(t)
+	// At twice the frame's size, as a 2× export is.
+	nodes := placeNodes(screen, image.Rect(0, 0, 720, 1280))
+	got := map[string]image.Rectangle{}
+	for _, pn := range nodes {
+		got[pn.node.Name] = pn.rect
+	}
+	if _, ok := got["Sign in"]; ok {
+		t.Error("the root frame was placed")
+	}
+	if r, want := got["Sign in button"], image.Rect(48, 1120, 672, 1216); r != want {
+		t.Errorf("button at %v, want %v", r, want)
+	}
+	if len(got) != 4 {
+		t.Errorf("placed %v", got)
+	}
+	if nodes := placeNodes(nil, image.Rect(0, 0, 10, 10)); nodes != nil {
+		t.Errorf("placed %v without a screen", nodes)
+	}
+}
+
+func TestNodeLabel(t *testing.T) {
+	for _, tc := range []struct {
+		n    events.ComponentNode
+		want string
+	}{
+		{events.ComponentNode{Type: "FRAME", Name: "Sign in button"}, "Button 'Sign in button'"},
+		{events.ComponentNode{Type: "INSTANCE", Name: "Primary btn"}, "Button 'Primary btn'"},
+		{events.ComponentNode{Type: "RECTANGLE", Name: "Email field"}, "Input 'Email field'"},
+		{events.ComponentNode{Type: "VECTOR", Name: "Search icon"}, "Icon 'Search icon'"},
+		{events.ComponentNode{Type: "TEXT", Name: "Title"}, "Text 'Title'"},
+		{events.ComponentNode{Type: "RECTANGLE", Name: "Hero", Props: map[string]any{"image_ref": "abc"}}, "Image 'Hero'"},
+		{events.ComponentNode{Type: "INSTANCE", Name: "Card"}, "Component 'Card'"},
+		{events.ComponentNode{Type: "GROUP", Name: "Header"}, "Container 'Header'"},
+		{events.ComponentNode{Type: "ELLIPSE", Name: "Dot"}, "Shape 'Dot'"},
+		{events.ComponentNode{Type: "LINE", Name: "Divider"}, "Element 'Divider'"},
+	} {
+		if got := nodeLabel(tc.n); got != tc.want {
+			t.Errorf("nodeLabel(%s %q) = %s, want %s", tc.n.Type, tc.n.Name, got, tc.want)
+		}
+	}
+}
+
+func TestMismatchNamesTheFigmaNode(t *testing.T) {
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen := signInScreen(t)
+	// Blobs, so the area searched for nodes is the button's own rather
+	// than a grid cell it covers a third of.
+	opts := compareOpts{
+		weights:    weights,
+		background: color.NRGBA{255, 255, 255, 255},
+		screen:     screen,
+		frameWidth: screen.Width,
+		regions:    events.RegionOptions{Strategy: events.RegionsBlobs},
+	}
+	ref := render(t, screen, nil)
+	// The generated page forgot the button's fill.
+	gen := render(t, screen, map[string]string{"Sign in button": "#FFFFFF"})
+
+	r, _, err := pixelCompare(context.Background(), encodePNG(t, ref), encodePNG(t, gen), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var button *events.MismatchRegion
+	for i, m := range r.Regions {
+		switch m.Property {
+		case "Button 'Sign in button'":
+			button = &r.Regions[i]
+		case "Input 'Email field'", "Text 'Title'":
+			t.Errorf("%s reported though it matches: %+v", m.Property, m)
+		}
+	}
+	if button == nil {
+		t.Fatalf("no region names the button: %+v", r.Regions)
+	}
+	if button.Expected != "#6750A4 fill" || button.Actual != "#FFFFFF fill" {
+		t.Errorf("button expected %q, actual %q; want #6750A4 fill, #FFFFFF fill", button.Expected, button.Actual)
+	}
+	if button.X != 24 || button.Y != 560 || button.W != 312 || button.H != 48 {
+		t.Errorf("button region at %d,%d %d×%d, want the node's 24,560 312×48", button.X, button.Y, button.W, button.H)
+	}
+}
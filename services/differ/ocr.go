@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/httpx"
+	"github.com/rs/zerolog/log"
+)
+
+// ocrWord is one word read off an image, with its box in that image's
+// pixels.
+type ocrWord struct {
+	Text string `json:"text"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	W    int    `json:"w"`
+	H    int    `json:"h"`
+
+	norm string // Text as compared; see normalizeWord
+}
+
+func (w ocrWord) rect() image.Rectangle { return image.Rect(w.X, w.Y, w.X+w.W, w.Y+w.H) }
+
+// recognizer reads the words off a PNG, in reading order.
+type recognizer interface {
+	recognize(ctx context.Context, png []byte) ([]ocrWord, error)
+}
+
+// newRecognizer picks the OCR backend from DIFFER_OCR; "" turns the text
+// pass off.
+func newRecognizer(mode, tesseractPath, url string) (recognizer, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "tesseract":
+		if _, err := exec.LookPath(tesseractPath); err != nil {
+			return nil, fmt.Errorf("tesseract: %w", err)
+		}
+		return tesseract{path: tesseractPath}, nil
+	case "http":
+		if url == "" {
+			return nil, errors.New("DIFFER_OCR=http needs DIFFER_OCR_URL")
+		}
+		return ocrService{url: url, client: httpx.NewClient(time.Minute)}, nil
+	}
+	return nil, errors.New(`DIFFER_OCR must be "tesseract", "http" or empty`)
+}
+
+// minWordConfidence drops the words Tesseract is guessing at, mostly
+// icons and texture read as letters.
+const minWordConfidence = 40
+
+// tesseract shells out to the Tesseract CLI per image. The binary is not
+// in the default differ image; build it with WITH_TESSERACT=1.
+type tesseract struct{ path string }
+
+func (t tesseract) recognize(ctx context.Context, img []byte) ([]ocrWord, error) {
+	cmd := exec.CommandContext(ctx, t.path, "stdin", "stdout", "tsv")
+	cmd.Stdin = bytes.NewReader(img)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return parseTesseractTSV(out), nil
+}
+
+// parseTesseractTSV reads the word rows (level 5) of Tesseract's TSV:
+// level page block par line word left top width height conf text.
+func parseTesseractTSV(tsv []byte) []ocrWord {
+	var words []ocrWord
+	sc := bufio.NewScanner(bytes.NewReader(tsv))
+	for sc.Scan() {
+		f := strings.Split(sc.Text(), "\t")
+		if len(f) < 12 || f[0] != "5" {
+			continue
+		}
+		conf, _ := strconv.ParseFloat(f[10], 64)
+		text := strings.TrimSpace(f[11])
+		if conf < minWordConfidence || text == "" {
+			continue
+		}
+		var box [4]int
+		for i := range box {
+			box[i], _ = strconv.Atoi(f[6+i])
+		}
+		words = append(words, ocrWord{Text: text, X: box[0], Y: box[1], W: box[2], H: box[3]})
+	}
+	return words
+}
+
+// ocrService posts each image to a hosted OCR endpoint, as image/png. It
+// must answer {"words": [{"text", "x", "y", "w", "h"}, …]} in reading
+// order, boxes in the posted image's pixels.
+type ocrService struct {
+	url    string
+	client *http.Client
+}
+
+func (s ocrService) recognize(ctx context.Context, img []byte) ([]ocrWord, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(img))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("ocr %d: %s", resp.StatusCode, raw)
+	}
+	var out struct {
+		Words []ocrWord `json:"words"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("ocr response: %w", err)
+	}
+	return out.Words, nil
+}
+
+// textResult is the outcome of the text pass: nil when it was skipped.
+type textResult struct {
+	accuracy float64 // 0–100
+	regions  []events.MismatchRegion
+}
+
+// readText starts the text pass over the compared images, which must not
+// change until they are encoded here. The result arrives on the channel,
+// nil if OCR is off, failed, or the reference has no text; words inside
+// masks don't count.
+func readText(ctx context.Context, ocr recognizer, ref, gen *image.NRGBA, masks []image.Rectangle) <-chan *textResult {
+	out := make(chan *textResult, 1)
+	if ocr == nil {
+		out <- nil
+		return out
+	}
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	var refPNG, genPNG bytes.Buffer
+	if enc.Encode(&refPNG, ref) != nil || enc.Encode(&genPNG, gen) != nil {
+		out <- nil
+		return out
+	}
+	go func() {
+		genWords := make(chan []ocrWord, 1)
+		go func() {
+			words, err := ocr.recognize(ctx, genPNG.Bytes())
+			if err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).Msg("OCR of the capture failed — text pass skipped")
+			}
+			genWords <- words
+		}()
+		refWords, err := ocr.recognize(ctx, refPNG.Bytes())
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("OCR of the reference failed — text pass skipped")
+		}
+		gw := <-genWords
+		if err != nil || ctx.Err() != nil {
+			out <- nil
+			return
+		}
+		out <- compareText(unmasked(refWords, masks), unmasked(gw, masks))
+	}()
+	return out
+}
+
+// unmasked normalizes words, dropping those that overlap a mask and those
+// that are nothing but punctuation.
+func unmasked(words []ocrWord, masks []image.Rectangle) []ocrWord {
+	var out []ocrWord
+	for _, w := range words {
+		w.norm = normalizeWord(w.Text)
+		if w.norm == "" || overlapsAny(w.rect(), masks) {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+func overlapsAny(r image.Rectangle, masks []image.Rectangle) bool {
+	for _, m := range masks {
+		if r.Overlaps(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWord lowercases w and trims the punctuation OCR reads
+// unreliably at word edges, so "Sign in." and "sign in" match.
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+// maxTextWords bounds the alignment, which is quadratic in the word count.
+const maxTextWords = 1500
+
+// Edit operations of the word alignment.
+const (
+	textMatch = iota
+	textChanged
+	textMissing // in the reference only
+	textExtra   // in the capture only
+)
+
+// compareText aligns the capture's words to the reference's by edit
+// distance and reports each run of missing, extra or changed words as a
+// region. Accuracy is the share of words matched out of the longer list.
+// A reference without text gives nil: there is nothing to score.
+func compareText(ref, gen []ocrWord) *textResult {
+	if len(ref) == 0 {
+		return nil
+	}
+	ref, gen = ref[:min(len(ref), maxTextWords)], gen[:min(len(gen), maxTextWords)]
+
+	// cost[i][j] aligns ref[i:] with gen[j:].
+	n, m := len(ref), len(gen)
+	cost := make([][]int32, n+1)
+	for i := range cost {
+		cost[i] = make([]int32, m+1)
+	}
+	for i := n; i >= 0; i-- {
+		for j := m; j >= 0; j-- {
+			switch {
+			case i == n:
+				cost[i][j] = int32(m - j)
+			case j == m:
+				cost[i][j] = int32(n - i)
+			default:
+				c := cost[i+1][j+1]
+				if ref[i].norm != gen[j].norm {
+					c++
+				}
+				cost[i][j] = min(c, cost[i+1][j]+1, cost[i][j+1]+1)
+			}
+		}
+	}
+
+	res := &textResult{}
+	matched := 0
+	var run *events.MismatchRegion
+	runOp := textMatch
+	var runRef, runGen []string
+	var runBox image.Rectangle
+	flush := func() {
+		if run != nil {
+			run.Expected, run.Actual = strings.Join(runRef, " "), strings.Join(runGen, " ")
+			run.X, run.Y, run.W, run.H = runBox.Min.X, runBox.Min.Y, runBox.Dx(), runBox.Dy()
+			res.regions = append(res.regions, *run)
+		}
+		run, runOp, runRef, runGen, runBox = nil, textMatch, nil, nil, image.Rectangle{}
+	}
+	step := func(op int, r, g *ocrWord) {
+		if op != runOp {
+			flush()
+		}
+		if op == textMatch {
+			matched++
+			return
+		}
+		if run == nil {
+			run, runOp = &events.MismatchRegion{Property: textProperty[op]}, op
+		}
+		// Boxes are where the fix belongs: in the capture, except for text
+		// that is missing from it.
+		if r != nil {
+			runRef = append(runRef, r.Text)
+			if op == textMissing {
+				runBox = runBox.Union(r.rect())
+			}
+		}
+		if g != nil {
+			runGen = append(runGen, g.Text)
+			runBox = runBox.Union(g.rect())
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && ref[i].norm == gen[j].norm && cost[i][j] == cost[i+1][j+1]:
+			step(textMatch, &ref[i], &gen[j])
+			i, j = i+1, j+1
+		case i < n && j < m && cost[i][j] == cost[i+1][j+1]+1:
+			step(textChanged, &ref[i], &gen[j])
+			i, j = i+1, j+1
+		case i < n && cost[i][j] == cost[i+1][j]+1:
+			step(textMissing, &ref[i], nil)
+			i++
+		default:
+			step(textExtra, nil, &gen[j])
+			j++
+		}
+	}
+	flush()
+	res.accuracy = 100 * float64(matched) / float64(max(n, m))
+	return res
+}
+
+// textProperty names the regions of each kind of text difference.
+var textProperty = map[int]string{
+	textChanged: "text",
+	textMissing: "missing text",
+	textExtra:   "unexpected text",
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// line lays text out as words 40px apart on a row at y.
+func line(y int, text string) []ocrWord {
+	var words []ocrWord
+	for i, w := range strings.Fields(text) {
+		words = append(words, ocrWord{Text: w, X: 10 + 40*i, Y: y, W: 30, H: 16})
+	}
+	return words
+}
+
+func TestCompareText(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		ref, gen string
+		accuracy float64
+		regions  []string // property: expected → actual
+	}{
+		{"identical", "Sign in to Forge", "Sign in to Forge", 100, nil},
+		{"case and punctuation", "Sign in.", "sign in", 100, nil},
+		{"changed word", "Sign in to Forge", "Log in to Forge", 75, []string{"text: Sign → Log"}},
+		{"missing words", "Forgot your password?", "Forgot", 100.0 / 3, []string{"missing text: your password? → "}},
+		{"extra words", "Continue", "Continue with Google", 100.0 / 3, []string{"unexpected text:  → with Google"}},
+		{"two runs", "Email Password Sign in", "Email address Password Log in", 60, []string{
+			"unexpected text:  → address", "text: Sign → Log",
+		}},
+		{"nothing rendered", "Welcome back", "", 0, []string{"missing text: Welcome back → "}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := compareText(unmasked(line(0, tc.ref), nil), unmasked(line(0, tc.gen), nil))
+			if r == nil {
+				t.Fatal("no result")
+			}
+			if d := r.accuracy - tc.accuracy; d > 1e-9 || d < -1e-9 {
+				t.Errorf("accuracy %.2f, want %.2f", r.accuracy, tc.accuracy)
+			}
+			var got []string
+			for _, m := range r.regions {
+				got = append(got, m.Property+": "+m.Expected+" → "+m.Actual)
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.regions, "\n") {
+				t.Errorf("regions\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.regions, "\n"))
+			}
+		})
+	}
+	if r := compareText(nil, line(0, "Hello")); r != nil {
+		t.Errorf("a reference without text scored %+v", r)
+	}
+}
+
+func TestCompareTextBoxes(t *testing.T) {
+	ref := unmasked(append(line(0, "Sign in"), line(100, "Forgot password")...), nil)
+	gen := unmasked(line(0, "Sign in"), nil)
+	r := compareText(ref, gen)
+	if len(r.regions) != 1 {
+		t.Fatalf("regions %+v", r.regions)
+	}
+	// Missing text is boxed where the reference has it.
+	if m := r.regions[0]; m.X != 10 || m.Y != 100 || m.W != 70 || m.H != 16 {
+		t.Errorf("missing text at %d,%d %d×%d, want the reference's 10,100 70×16", m.X, m.Y, m.W, m.H)
+	}
+}
+
+// fakeOCR reads the words for an image off its top-left pixel's color.
+type fakeOCR struct {
+	words map[color.NRGBA][]ocrWord
+	err   error
+}
+
+func (f fakeOCR) recognize(_ context.Context, data []byte) ([]ocrWord, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return f.words[color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)], nil
+}
+
+func TestReadText(t *testing.T) {
+	ref := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	fill(ref, ref.Bounds(), white)
+	gen := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	fill(gen, gen.Bounds(), yellow)
+	ocr := fakeOCR{words: map[color.NRGBA][]ocrWord{
+		white:  append(line(0, "12:30"), line(100, "Sign in")...),
+		yellow: append(line(0, "09:15"), line(100, "Sign in")...),
+	}}
+
+	r := <-readText(context.Background(), ocr, ref, gen, nil)
+	if r == nil || r.accuracy != 100*2.0/3 {
+		t.Errorf("unmasked: %+v", r)
+	}
+	// The clock is masked.
+	r = <-readText(context.Background(), ocr, ref, gen, []image.Rectangle{image.Rect(0, 0, 200, 20)})
+	if r == nil || r.accuracy != 100 || len(r.regions) != 0 {
+		t.Errorf("masked: %+v", r)
+	}
+	if r := <-readText(context.Background(), fakeOCR{err: errors.New("engine down")}, ref, gen, nil); r != nil {
+		t.Errorf("a failed OCR gave %+v", r)
+	}
+	if r := <-readText(context.Background(), nil, ref, gen, nil); r != nil {
+		t.Errorf("OCR off gave %+v", r)
+	}
+}
+
+func TestParseTesseractTSV(t *testing.T) {
+	tsv := "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"4\t1\t1\t1\t1\t0\t10\t20\t200\t18\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t10\t20\t40\t18\t96.5\tSign\n" +
+		"5\t1\t1\t1\t1\t2\t56\t20\t20\t18\t91\tin\n" +
+		"5\t1\t1\t1\t1\t3\t90\t20\t12\t18\t12\t~\n" + // a guess
+		"5\t1\t1\t1\t1\t4\t110\t20\t12\t18\t95\t \n"
+	got := parseTesseractTSV([]byte(tsv))
+	want := []ocrWord{{Text: "Sign", X: 10, Y: 20, W: 40, H: 18}, {Text: "in", X: 56, Y: 20, W: 20, H: 18}}
+	if len(got) != len(want) {
+		t.Fatalf("words %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("word %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTextAccuracyIsReported(t *testing.T) {
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	fill(ref, ref.Bounds(), white)
+	ocr := fakeOCR{words: map[color.NRGBA][]ocrWord{white: line(100, "Sign in")}}
+	opts := compareOpts{weights: weights, background: white, frameWidth: 200, ocr: ocr}
+	r, _, err := pixelCompare(context.Background(), encodePNG(t, ref), encodePNG(t, ref), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TextAccuracy == nil || *r.TextAccuracy != 100 {
+		t.Errorf("text accuracy %v, want 100", r.TextAccuracy)
+	}
+
+	opts.ocr = nil
+	if r, _, _ := pixelCompare(context.Background(), encodePNG(t, ref), encodePNG(t, ref), opts); r.TextAccuracy != nil {
+		t.Errorf("text accuracy %v without OCR", *r.TextAccuracy)
+	}
+}
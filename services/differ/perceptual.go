@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// luma returns img's luminance (ITU-R BT.601) as a row-major w×h grid.
+func luma(ctx context.Context, img *image.NRGBA) ([]float64, int, int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := make([]float64, w*h)
+	parallelRows(ctx, h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			i := img.PixOffset(b.Min.X, b.Min.Y+y)
+			for x := 0; x < w; x, i = x+1, i+4 {
+				out[y*w+x] = 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+			}
+		}
+	})
+	return out, w, h
+}
+
+// SSIM stabilising constants for 8-bit luminance.
+var (
+	ssimC1 = math.Pow(0.01*255, 2)
+	ssimC2 = math.Pow(0.03*255, 2)
+)
+
+const ssimWindow = 8
+
+// ssim is the mean structural similarity of ref and gen over 8×8 luminance
+// windows, scaled to 0–100. Unlike RMSE it compares local structure, so an
+// anti-aliased edge a pixel off costs little while a missing element still
+// costs a lot. gen must already be ref's size.
+func ssim(ctx context.Context, ref, gen *image.NRGBA) float64 {
+	a, w, h := luma(ctx, ref)
+	b, _, _ := luma(ctx, gen)
+	if w < ssimWindow || h < ssimWindow {
+		return 100
+	}
+
+	// One sum per row of windows, added up in order afterwards so the
+	// result doesn't depend on how the rows were split.
+	rows := h / ssimWindow
+	sums := make([]float64, rows)
+	parallelRows(ctx, rows, func(r0, r1 int) {
+		for r := r0; r < r1; r++ {
+			sums[r] = ssimRow(a, b, w, r*ssimWindow)
+		}
+	})
+	total := 0.0
+	for _, s := range sums {
+		total += s
+	}
+	n := rows * (w / ssimWindow)
+	return math.Max(0, total/float64(n)*100)
+}
+
+// ssimRow sums the SSIM of the windows in the row of windows starting at
+// luminance row wy.
+func ssimRow(a, b []float64, w, wy int) float64 {
+	total := 0.0
+	const px = ssimWindow * ssimWindow
+	for wx := 0; wx+ssimWindow <= w; wx += ssimWindow {
+		var sa, sb, saa, sbb, sab float64
+		for y := wy; y < wy+ssimWindow; y++ {
+			row := y * w
+			for x := wx; x < wx+ssimWindow; x++ {
+				va, vb := a[row+x], b[row+x]
+				sa += va
+				sb += vb
+				saa += va * va
+				sbb += vb * vb
+				sab += va * vb
+			}
+		}
+		ma, mb := sa/px, sb/px
+		varA := saa/px - ma*ma
+		varB := sbb/px - mb*mb
+		cov := sab/px - ma*mb
+		total += ((2*ma*mb + ssimC1) * (2*cov + ssimC2)) /
+			((ma*ma + mb*mb + ssimC1) * (varA + varB + ssimC2))
+	}
+	return total
+}
+
+// phash is the 64-bit DCT perceptual hash of img: the signs of the lowest
+// 8×8 frequencies of a 32×32 grayscale thumbnail against their median.
+func phash(ctx context.Context, img *image.NRGBA) uint64 {
+	const size, keep = 32, 8
+	small := imaging.Resize(img, size, size, imaging.Lanczos)
+	px, _, _ := luma(ctx, small)
+
+	var coeffs [keep * keep]float64
+	for v := 0; v < keep; v++ {
+		for u := 0; u < keep; u++ {
+			sum := 0.0
+			for y := 0; y < size; y++ {
+				cy := math.Cos(float64(2*y+1) * float64(v) * math.Pi / (2 * size))
+				for x := 0; x < size; x++ {
+					sum += px[y*size+x] * cy * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*size))
+				}
+			}
+			coeffs[v*keep+u] = sum
+		}
+	}
+
+	// The DC term only tracks overall brightness; leave it out of the median.
+	sorted := coeffs // array copy
+	ac := sorted[1:]
+	sort.Float64s(ac)
+	median := (ac[len(ac)/2-1] + ac[len(ac)/2]) / 2
+
+	var hash uint64
+	for i, c := range coeffs[1:] {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// phashScore is the similarity of two images' perceptual hashes, 0–100:
+// 100 minus the share of the 63 hash bits that differ.
+func phashScore(ctx context.Context, ref, gen *image.NRGBA) float64 {
+	d := bits.OnesCount64(phash(ctx, ref) ^ phash(ctx, gen))
+	return 100 * (1 - float64(d)/63)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// mockup draws a 360×640 app screen: an app bar, then either a list of
+// cards with text lines and a button (list) or a grid of tiles (grid), the
+// structurally different design of the same screen.
+func mockup(grid bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 360, 640))
+	fill := func(r image.Rectangle, c color.NRGBA) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	white := color.NRGBA{255, 255, 255, 255}
+	ink := color.NRGBA{30, 30, 40, 255}
+	purple := color.NRGBA{103, 80, 164, 255}
+	card := color.NRGBA{236, 230, 245, 255}
+
+	fill(img.Bounds(), white)
+	fill(image.Rect(0, 0, 360, 56), purple)
+	fill(image.Rect(16, 20, 140, 36), white) // title
+	if grid {
+		for row := 0; row < 4; row++ {
+			for col := 0; col < 3; col++ {
+				x, y := 12+col*116, 72+row*140
+				fill(image.Rect(x, y, x+104, y+104), card)
+				fill(image.Rect(x+30, y+30, x+74, y+74), purple) // icon
+				fill(image.Rect(x+8, y+114, x+96, y+124), ink)   // caption
+			}
+		}
+		return img
+	}
+	for i := 0; i < 4; i++ {
+		y := 72 + i*120
+		fill(image.Rect(16, y, 344, y+104), card)
+		fill(image.Rect(28, y+12, 76, y+60), purple) // avatar
+		for line := 0; line < 3; line++ {
+			ly := y + 16 + line*22
+			fill(image.Rect(92, ly, 92+200-line*50, ly+8), ink)
+		}
+	}
+	fill(image.Rect(16, 568, 344, 616), purple) // button
+	fill(image.Rect(140, 588, 220, 596), white)
+	return img
+}
+
+// goldenPair returns the reference mockup and, by name, the captures it
+// is compared with: itself, itself moved 2px down and right, and the grid
+// design.
+func goldenPair() (*image.NRGBA, map[string]*image.NRGBA) {
+	ref := mockup(false)
+	return ref, map[string]*image.NRGBA{
+		"identical":   mockup(false),
+		"shifted 2px": shifted(ref, 2, 2),
+		"different":   mockup(true),
+	}
+}
+
+func TestPerceptualMetricsGolden(t *testing.T) {
+	ref, gens := goldenPair()
+	for _, m := range []struct {
+		name   string
+		metric func(ctx context.Context, ref, gen *image.NRGBA) float64
+		// shifted is the least a 2px shift scores and different the most
+		// another design does.
+		shifted, different float64
+	}{
+		// SSIM compares 8×8 windows in place, so a whole-pixel shift moves
+		// every edge out of its window; pixelCompare aligns the capture
+		// before it runs. It still has to rank the shift above a redesign.
+		{"SSIM", ssim, 0, 100},
+		{"pHash", phashScore, 90, 70},
+	} {
+		ctx := context.Background()
+		identical := m.metric(ctx, ref, gens["identical"])
+		shift := m.metric(ctx, ref, gens["shifted 2px"])
+		different := m.metric(ctx, ref, gens["different"])
+		if identical != 100 {
+			t.Errorf("%s: identical images score %.2f", m.name, identical)
+		}
+		if !(identical > shift && shift > different) {
+			t.Errorf("%s: identical %.1f, shifted %.1f, different %.1f: want them in that order", m.name, identical, shift, different)
+		}
+		if shift < m.shifted {
+			t.Errorf("%s: a 2px shift scores %.1f, want at least %.0f", m.name, shift, m.shifted)
+		}
+		if different > m.different {
+			t.Errorf("%s: another design scores %.1f, want at most %.0f", m.name, different, m.different)
+		}
+	}
+}
+
+func TestSSIMSeparatesMissingElementFromAntiAliasing(t *testing.T) {
+	ref := textFixture(0, false)
+	aa := ssim(context.Background(), ref, textFixture(0.4, false))
+	missing := ssim(context.Background(), ref, textFixture(0, true))
+	if aa < 97 || missing > 85 {
+		t.Errorf("SSIM %.1f for subpixel glyph placement, %.1f for a missing button", aa, missing)
+	}
+}
+
+func encodePNG(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompositeScoreGolden(t *testing.T) {
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := compareOpts{weights: weights, background: color.NRGBA{255, 255, 255, 255}, frameWidth: 360}
+	ref, gens := goldenPair()
+	results := map[string]*events.DiffResult{}
+	for name, gen := range gens {
+		r, _, err := pixelCompare(context.Background(), encodePNG(t, ref), encodePNG(t, gen), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results[name] = r
+	}
+
+	if r := results["identical"]; r.Score < 99.5 || r.SSIM < 99.9 || r.PHash < 99.9 {
+		t.Errorf("identical images: score %.1f, SSIM %.1f, pHash %.1f", r.Score, r.SSIM, r.PHash)
+	}
+	// Aligned before the metrics run, the shifted capture compares like
+	// the reference itself.
+	if r := results["shifted 2px"]; r.Score < 95 || r.SSIM < 95 {
+		t.Errorf("a 2px shift: score %.1f, SSIM %.1f; want both to stay high", r.Score, r.SSIM)
+	}
+	if r := results["different"]; r.Score > 70 {
+		t.Errorf("another design scores %.1f, want it to drop sharply", r.Score)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// The comparison works on *image.NRGBA throughout, indexing Pix directly:
+// going through image.Image's At costs an interface call and a color
+// conversion per pixel, which dominated diff time on 2× exports. Images are
+// flattened first, so alpha is always opaque and NRGBA equals RGBA.
+
+// rowBand is how many rows parallelRows hands fn at a time; ctx is checked
+// between bands.
+const rowBand = 64
+
+// parallelRows splits the rows [0, h) into one contiguous range per CPU and
+// runs fn on each concurrently, a band of rows per call. fn must only write
+// to its own rows. Once ctx is done the remaining bands are skipped, so the
+// caller must check ctx.Err() before using the result.
+func parallelRows(ctx context.Context, h int, fn func(y0, y1 int)) {
+	bands := func(y0, y1 int) {
+		for y := y0; y < y1 && ctx.Err() == nil; y += rowBand {
+			fn(y, min(y+rowBand, y1))
+		}
+	}
+	workers := min(runtime.GOMAXPROCS(0), h)
+	if workers <= 1 {
+		bands(0, h)
+		return
+	}
+	var wg sync.WaitGroup
+	step := (h + workers - 1) / workers
+	for y0 := 0; y0 < h; y0 += step {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			bands(y0, y1)
+		}(y0, min(y0+step, h))
+	}
+	wg.Wait()
+}
+
+// rgbAt returns the color channels of img at (x, y).
+func rgbAt(img *image.NRGBA, x, y int) (r, g, b uint8) {
+	i := img.PixOffset(x, y)
+	return img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+}
+
+// diffMap holds the per-pixel difference, after tolerance, of two images
+// of the same size, 0–255. It is computed once per comparison; every
+// pixel-based score reads its rectangles from it.
+type diffMap struct {
+	w, h   int
+	d      []float64
+	masked []bool // pixels no score counts; nil if none are
+}
+
+// exclude leaves the pixels of masks, relative to the images' top-left,
+// out of every score: they count neither for nor against a match.
+func (m *diffMap) exclude(masks []image.Rectangle) {
+	for _, r := range masks {
+		r = r.Intersect(image.Rect(0, 0, m.w, m.h))
+		if r.Empty() {
+			continue
+		}
+		if m.masked == nil {
+			m.masked = make([]bool, len(m.d))
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for i := y*m.w + r.Min.X; i < y*m.w+r.Max.X; i++ {
+				m.masked[i] = true
+			}
+		}
+	}
+}
+
+// pixelDiffs compares ref and gen pixel by pixel and draws the diff image:
+// green for matches, yellow for differences tol forgave, red scaled by how
+// far off the rest are.
+func pixelDiffs(ctx context.Context, ref, gen *image.NRGBA, tol events.DiffTolerance) (*diffMap, *image.NRGBA) {
+	b := ref.Bounds()
+	m := &diffMap{w: b.Dx(), h: b.Dy(), d: make([]float64, b.Dx()*b.Dy())}
+	diffImg := image.NewNRGBA(b)
+	parallelRows(ctx, m.h, func(y0, y1 int) {
+		for y := b.Min.Y + y0; y < b.Min.Y+y1; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				diff := pixelDiff(ref, gen, x, y, x, y)
+				forgiven := false
+				if diff >= 8 {
+					diff, forgiven = tolerantDiff(ref, gen, x, y, tol, diff)
+				}
+				m.d[(y-b.Min.Y)*m.w+x-b.Min.X] = diff
+				switch {
+				case diff < 8 && forgiven:
+					diffImg.SetNRGBA(x, y, color.NRGBA{230, 190, 0, 90})
+				case diff < 8:
+					diffImg.SetNRGBA(x, y, color.NRGBA{0, 200, 50, 60})
+				default:
+					diffImg.SetNRGBA(x, y, color.NRGBA{uint8(math.Min(diff*2, 255)), 0, 0, 200})
+				}
+			}
+		}
+	})
+	return m, diffImg
+}
+
+// score is the RMSE-style match of the pixels in r, 0–100, 100 when all of
+// them are masked. r is relative to the images' top-left.
+func (m *diffMap) score(r image.Rectangle) float64 {
+	s, _ := m.scoreOf(r)
+	return s
+}
+
+// scoreOf is score, and whether r has any pixel left unmasked to score.
+func (m *diffMap) scoreOf(r image.Rectangle) (float64, bool) {
+	r = r.Intersect(image.Rect(0, 0, m.w, m.h))
+	total, n := 0.0, 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for i := y*m.w + r.Min.X; i < y*m.w+r.Max.X; i++ {
+			if m.masked == nil || !m.masked[i] {
+				total += m.d[i]
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 100, false
+	}
+	return math.Max(0, 100-(total/float64(n)/255)*100), true
+}
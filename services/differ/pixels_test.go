@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// testPair returns a reference of w×h, bands of flat color with text-like
+// strokes, and a capture of it with some strokes moved, recolored blocks
+// and noise: every tolerance path has pixels to work on.
+func testPair(w, h int) (ref, gen *image.NRGBA) {
+	rng := rand.New(rand.NewSource(1))
+	ref = image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{uint8(240 - y/64*8), 240, uint8(200 + x%40), 255}
+			if y%24 < 3 && x%90 < 60 { // strokes
+				c = color.NRGBA{20, 20, 20, 255}
+			}
+			ref.SetNRGBA(x, y, c)
+		}
+	}
+	gen = image.NewNRGBA(ref.Bounds())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := ref.NRGBAAt(x, y)
+			switch {
+			case y > h/2 && y%24 < 3 && (x+1)%90 < 60: // strokes a pixel over
+				c = color.NRGBA{20, 20, 20, 255}
+			case x > w/2 && y > h/4 && y < h/3: // a recolored block
+				c = color.NRGBA{200, 60, 60, 255}
+			case rng.Intn(50) == 0:
+				c.R += uint8(rng.Intn(40))
+			}
+			gen.SetNRGBA(x, y, c)
+		}
+	}
+	return ref, gen
+}
+
+// withProcs runs fn with GOMAXPROCS at n: 1 makes parallelRows serial.
+func withProcs(n int, fn func()) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(n))
+	fn()
+}
+
+func TestPixelDiffsParallelMatchesSerial(t *testing.T) {
+	ref, gen := testPair(390, 1000)
+	for _, tol := range []events.DiffTolerance{{}, {AntiAlias: true}, {ShiftPx: 1}, {AntiAlias: true, ShiftPx: 2}} {
+		var serial, parallel *diffMap
+		var serialImg, parallelImg *image.NRGBA
+		withProcs(1, func() { serial, serialImg = pixelDiffs(context.Background(), ref, gen, tol) })
+		withProcs(8, func() { parallel, parallelImg = pixelDiffs(context.Background(), ref, gen, tol) })
+
+		if !bytes.Equal(serialImg.Pix, parallelImg.Pix) {
+			t.Errorf("%+v: diff images differ", tol)
+		}
+		for i := range serial.d {
+			if serial.d[i] != parallel.d[i] {
+				t.Errorf("%+v: diff map differs at pixel %d: %v, %v", tol, i, serial.d[i], parallel.d[i])
+				break
+			}
+		}
+		for _, r := range []image.Rectangle{ref.Bounds(), image.Rect(0, 0, 390, 250), image.Rect(100, 300, 300, 900)} {
+			if s, p := serial.score(r), parallel.score(r); s != p {
+				t.Errorf("%+v: score of %v: serial %v, parallel %v", tol, r, s, p)
+			}
+		}
+	}
+}
+
+func TestParallelRowsCoversEveryRowOnce(t *testing.T) {
+	for _, h := range []int{0, 1, 63, 64, 65, 1000} {
+		seen := make([]int, h)
+		withProcs(8, func() {
+			parallelRows(context.Background(), h, func(y0, y1 int) {
+				for y := y0; y < y1; y++ {
+					seen[y]++
+				}
+			})
+		})
+		for y, n := range seen {
+			if n != 1 {
+				t.Fatalf("h=%d: row %d run %d times", h, y, n)
+			}
+		}
+	}
+}
+
+// BenchmarkPixelDiffs compares the serial and parallel paths on a 2×
+// phone capture.
+func BenchmarkPixelDiffs(b *testing.B) {
+	ref, gen := testPair(1170, 2532)
+	tol := events.DiffTolerance{AntiAlias: true, ShiftPx: 1}
+	for _, bm := range []struct {
+		name  string
+		procs int
+	}{
+		{"serial", 1},
+		{"parallel", runtime.NumCPU()},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			withProcs(bm.procs, func() {
+				for i := 0; i < b.N; i++ {
+					pixelDiffs(context.Background(), ref, gen, tol)
+				}
+			})
+		})
+	}
+}
+
+// The image.Image path the NRGBA diff map replaced: every score re-reads
+// its pixels through At. Kept here to check the scores didn't move and to
+// measure the speedup.
+
+func atDiff(ref, gen image.Image, x, y int) float64 {
+	r1, g1, b1, _ := ref.At(x, y).RGBA()
+	r2, g2, b2, _ := gen.At(x, y).RGBA()
+	dr := float64(r1>>8) - float64(r2>>8)
+	dg := float64(g1>>8) - float64(g2>>8)
+	db := float64(b1>>8) - float64(b2>>8)
+	return math.Sqrt((dr*dr + dg*dg + db*db) / 3.0)
+}
+
+func atRMSE(ref, gen image.Image, r image.Rectangle) float64 {
+	total := 0.0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			total += atDiff(ref, gen, x, y)
+		}
+	}
+	return math.Max(0, 100-(total/float64(r.Dx()*r.Dy())/255)*100)
+}
+
+func atCountWhite(img image.Image) int {
+	b := img.Bounds()
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			if r>>8 > 235 && g>>8 > 235 && bl>>8 > 235 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// pixelScores are the pixel-based scores of one comparison: the whole
+// page, the layout bands, the typography band, the quadrants and
+// whitespace.
+type pixelScores struct {
+	overall, layout, typography, spacing float64
+	quadrants                            [4]float64
+}
+
+func quadrants(b image.Rectangle) [4]image.Rectangle {
+	qw, qh := b.Dx()/2, b.Dy()/2
+	return [4]image.Rectangle{
+		image.Rect(0, 0, qw, qh), image.Rect(qw, 0, b.Dx(), qh),
+		image.Rect(0, qh, qw, b.Dy()), image.Rect(qw, qh, b.Dx(), b.Dy()),
+	}
+}
+
+func atScores(ref, gen image.Image) pixelScores {
+	b := ref.Bounds()
+	s := pixelScores{overall: atRMSE(ref, gen, b)}
+	bh := b.Dy() / 3
+	for i := 0; i < 3; i++ {
+		s.layout += atRMSE(ref, gen, image.Rect(0, i*bh, b.Dx(), (i+1)*bh)) / 3
+	}
+	s.typography = atRMSE(ref, gen, image.Rect(0, 0, b.Dx(), b.Dy()/4))
+	for i, q := range quadrants(b) {
+		s.quadrants[i] = atRMSE(ref, gen, q)
+	}
+	diff := math.Abs(float64(atCountWhite(ref))-float64(atCountWhite(gen))) / float64(b.Dx()*b.Dy())
+	s.spacing = math.Max(0, 100-diff*300)
+	return s
+}
+
+func nrgbaScores(ref, gen *image.NRGBA) pixelScores {
+	b := ref.Bounds()
+	m, _ := pixelDiffs(context.Background(), ref, gen, events.DiffTolerance{})
+	s := pixelScores{
+		overall:    m.score(b),
+		layout:     regionScore(m, b, 3, 1),
+		typography: regionScore(m, b, 1, 4),
+		spacing:    whitespaceScore(ref, gen),
+	}
+	for i, q := range quadrants(b) {
+		s.quadrants[i] = m.score(q)
+	}
+	return s
+}
+
+func TestNRGBAScoresMatchAtPath(t *testing.T) {
+	ref, gen := testPair(390, 1000)
+	want := atScores(ref, gen)
+	got := nrgbaScores(ref, gen)
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if !near(got.overall, want.overall) || !near(got.layout, want.layout) ||
+		!near(got.typography, want.typography) || !near(got.spacing, want.spacing) {
+		t.Errorf("NRGBA scores %+v, At scores %+v", got, want)
+	}
+	for i := range want.quadrants {
+		if !near(got.quadrants[i], want.quadrants[i]) {
+			t.Errorf("quadrant %d: NRGBA %v, At %v", i, got.quadrants[i], want.quadrants[i])
+		}
+	}
+	if want.overall == 100 || want.layout == want.typography {
+		t.Errorf("the pair doesn't exercise the scores: %+v", want)
+	}
+}
+
+// BenchmarkScores compares the At path with the diff map on a 2× phone
+// capture: run with -bench Scores to see the speedup.
+func BenchmarkScores(b *testing.B) {
+	ref, gen := testPair(1170, 2532)
+	b.Run("at", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			atScores(ref, gen)
+		}
+	})
+	b.Run("nrgba", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			nrgbaScores(ref, gen)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// regionThreshold is the score below which an area of the screen is
+// reported as mismatching.
+const regionThreshold = 82
+
+// parseRegions reads DIFF_REGIONS: "COLSxROWS" for a grid, e.g. "4x4",
+// "quadrants" or "blobs". Whatever it names, a job that switches to a
+// grid without sizing it gets 4×4.
+func parseRegions(spec string, worst, minBlob int) (events.RegionOptions, error) {
+	g := events.RegionOptions{Strategy: events.RegionsGrid, Cols: 4, Rows: 4, Worst: worst, MinBlob: minBlob}
+	if worst < 1 || worst > events.MaxRegionWorst {
+		return g, fmt.Errorf("worst %d: want 1-%d", worst, events.MaxRegionWorst)
+	}
+	if minBlob < 0 || minBlob > events.MaxMinBlob {
+		return g, fmt.Errorf("min blob %d: want 0-%d", minBlob, events.MaxMinBlob)
+	}
+	if spec == events.RegionsQuadrants || spec == events.RegionsBlobs {
+		g.Strategy = spec
+		return g, nil
+	}
+	cols, rows, ok := strings.Cut(strings.ToLower(spec), "x")
+	var err error
+	if ok {
+		if g.Cols, err = strconv.Atoi(cols); err == nil {
+			g.Rows, err = strconv.Atoi(rows)
+		}
+	}
+	if !ok || err != nil || g.Cols < 1 || g.Cols > events.MaxRegionGrid || g.Rows < 1 || g.Rows > events.MaxRegionGrid {
+		return g, fmt.Errorf("%q: want COLSxROWS, each 1-%d, quadrants or blobs", spec, events.MaxRegionGrid)
+	}
+	return g, nil
+}
+
+// jobRegions is the service's options with the fields job sets in place
+// of its own. A job that sizes the grid without naming a strategy asks for
+// the grid.
+func jobRegions(g events.RegionOptions, job *events.RegionOptions) events.RegionOptions {
+	if job == nil {
+		return g
+	}
+	if job.Cols > 0 || job.Rows > 0 {
+		g.Strategy = events.RegionsGrid
+	}
+	if job.Strategy != "" {
+		g.Strategy = job.Strategy
+	}
+	if job.Cols > 0 {
+		g.Cols = job.Cols
+	}
+	if job.Rows > 0 {
+		g.Rows = job.Rows
+	}
+	if job.Worst > 0 {
+		g.Worst = job.Worst
+	}
+	if job.MinBlob > 0 {
+		g.MinBlob = job.MinBlob
+	}
+	return g
+}
+
+// gridCell is one area of the screen regions are scored by, named as
+// reported.
+type gridCell struct {
+	name string
+	r    image.Rectangle
+}
+
+// gridCells cuts bounds into g's cells, left to right and top to bottom,
+// or its four quadrants. Cells at the far edges take up the remainder.
+func gridCells(bounds image.Rectangle, g events.RegionOptions) []gridCell {
+	w, h := bounds.Dx(), bounds.Dy()
+	if g.Strategy == events.RegionsQuadrants {
+		qw, qh := w/2, h/2
+		return []gridCell{
+			{"top-left region", image.Rect(0, 0, qw, qh)},
+			{"top-right region", image.Rect(qw, 0, w, qh)},
+			{"bottom-left region", image.Rect(0, qh, qw, h)},
+			{"bottom-right region", image.Rect(qw, qh, w, h)},
+		}
+	}
+	cols, rows := max(g.Cols, 1), max(g.Rows, 1)
+	cells := make([]gridCell, 0, cols*rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			r := image.Rect(col*w/cols, row*h/rows, (col+1)*w/cols, (row+1)*h/rows)
+			if r.Empty() {
+				continue
+			}
+			cells = append(cells, gridCell{fmt.Sprintf("row %d/%d, column %d/%d region", row+1, rows, col+1, cols), r})
+		}
+	}
+	return cells
+}
+
+// scoredCell is a cell that fails, with its score.
+type scoredCell struct {
+	gridCell
+	score float64
+}
+
+// failingCells scores cells and returns those below regionThreshold,
+// worst first, keeping the worst g.Worst of a grid. Quadrants are few
+// enough to report every one that fails.
+func failingCells(diffs *diffMap, cells []gridCell, g events.RegionOptions) []scoredCell {
+	var fails []scoredCell
+	for _, c := range cells {
+		if score := diffs.score(c.r); score < regionThreshold {
+			fails = append(fails, scoredCell{c, score})
+		}
+	}
+	sort.SliceStable(fails, func(i, j int) bool { return fails[i].score < fails[j].score })
+	if g.Strategy == events.RegionsGrid && g.Worst > 0 && len(fails) > g.Worst {
+		fails = fails[:g.Worst]
+	}
+	return fails
+}
+
+// ── Blobs ─────────────────────────────────────────────────────────────────────
+
+// blobDiff is the pixel difference from which a pixel counts towards a
+// blob: the one the diff image starts showing it red at.
+const blobDiff = 8
+
+// blobTile is the side, in pixels, of the tiles differing pixels are
+// joined by: pixels in touching tiles make one blob, so a wrong line of
+// text is one area rather than a blob per glyph.
+const blobTile = 4
+
+// blob is a connected area of differing pixels.
+type blob struct {
+	r      image.Rectangle // bounds of its differing pixels
+	pixels int             // how many of them there are
+}
+
+// blobs labels the 8-connected groups of tiles holding differing pixels
+// and returns those of at least minPixels of them, largest first.
+func (m *diffMap) blobs(minPixels int) []blob {
+	tw, th := (m.w+blobTile-1)/blobTile, (m.h+blobTile-1)/blobTile
+	tiles := make([]blob, tw*th)
+	for y := 0; y < m.h; y++ {
+		row := tiles[(y/blobTile)*tw:]
+		for x, v := range m.d[y*m.w : (y+1)*m.w] {
+			if v >= blobDiff {
+				t := &row[x/blobTile]
+				t.r = t.r.Union(image.Rect(x, y, x+1, y+1))
+				t.pixels++
+			}
+		}
+	}
+
+	var out []blob
+	visited := make([]bool, len(tiles))
+	var stack []int
+	for i := range tiles {
+		if tiles[i].pixels == 0 || visited[i] {
+			continue
+		}
+		var b blob
+		visited[i] = true
+		stack = append(stack[:0], i)
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			b.r = b.r.Union(tiles[j].r)
+			b.pixels += tiles[j].pixels
+			tx, ty := j%tw, j/tw
+			for ny := max(ty-1, 0); ny <= min(ty+1, th-1); ny++ {
+				for nx := max(tx-1, 0); nx <= min(tx+1, tw-1); nx++ {
+					if k := ny*tw + nx; tiles[k].pixels > 0 && !visited[k] {
+						visited[k] = true
+						stack = append(stack, k)
+					}
+				}
+			}
+		}
+		if b.pixels >= minPixels {
+			out = append(out, b)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].r.Dx()*out[i].r.Dy() > out[j].r.Dx()*out[j].r.Dy()
+	})
+	return out
+}
+
+// blobName describes b by its size and position in the screenshot's
+// pixels, factor times the compared images'.
+func blobName(b blob, factor float64) string {
+	scale := func(v int) int { return int(math.Round(float64(v) * factor)) }
+	return fmt.Sprintf("%d×%d region at %d,%d", scale(b.r.Dx()), scale(b.r.Dy()), scale(b.r.Min.X), scale(b.r.Min.Y))
+}
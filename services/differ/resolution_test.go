@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func TestDownscale(t *testing.T) {
+	ref := image.NewNRGBA(image.Rect(0, 0, 780, 1200))
+	gen := image.NewNRGBA(ref.Bounds())
+	for _, tc := range []struct {
+		maxWidth   int
+		want       image.Point
+		wantFactor float64
+	}{
+		{0, image.Pt(780, 1200), 1},    // full resolution
+		{1024, image.Pt(780, 1200), 1}, // already narrower
+		{390, image.Pt(390, 600), 2},   // the 1× page
+		{300, image.Pt(300, 462), 2.6}, // aspect ratio kept, height rounded
+	} {
+		r, g, factor := downscale(ref, gen, tc.maxWidth)
+		if r.Bounds().Size() != tc.want || g.Bounds().Size() != tc.want || factor != tc.wantFactor {
+			t.Errorf("downscale to %d: %v and %v, factor %g; want %v, factor %g",
+				tc.maxWidth, r.Bounds().Size(), g.Bounds().Size(), factor, tc.want, tc.wantFactor)
+		}
+		if tc.wantFactor == 1 && (r != ref || g != gen) {
+			t.Errorf("downscale to %d copied images it had no need to shrink", tc.maxWidth)
+		}
+	}
+}
+
+func TestUpscaleRegions(t *testing.T) {
+	regions := []events.MismatchRegion{{Property: "a", X: 10, Y: 20, W: 30, H: 41}}
+	if got := upscaleRegions(regions, 1); got[0].X != 10 || got[0].H != 41 {
+		t.Errorf("factor 1 moved %+v", got[0])
+	}
+	got := upscaleRegions(regions, 2.5)
+	if r := got[0]; r.X != 25 || r.Y != 50 || r.W != 75 || r.H != 103 || r.Property != "a" {
+		t.Errorf("upscaled to %+v, want 25,50 75×103", r)
+	}
+}
+
+// blockPage is a white 780×800 page, a 390×400 design exported at 2×,
+// with a red block at r in the capture alone.
+func blockPage(t *testing.T, r image.Rectangle) (ref, gen []byte) {
+	t.Helper()
+	refImg := image.NewNRGBA(image.Rect(0, 0, 780, 800))
+	fill(refImg, refImg.Bounds(), white)
+	genImg := image.NewNRGBA(refImg.Bounds())
+	copy(genImg.Pix, refImg.Pix)
+	fill(genImg, r, red)
+	return encodePNG(t, refImg), encodePNG(t, genImg)
+}
+
+func TestDownscaledRegionsStayProportional(t *testing.T) {
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := image.Rect(300, 500, 500, 620)
+	ref, gen := blockPage(t, block)
+	for _, resolution := range []int{0, 390, 256} {
+		opts := compareOpts{weights: weights, background: white, frameWidth: 390, resolution: resolution,
+			regions: events.RegionOptions{Strategy: events.RegionsBlobs}}
+		r, _, err := pixelCompare(context.Background(), ref, gen, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Regions) != 1 {
+			t.Fatalf("resolution %d: regions %+v, want the block", resolution, r.Regions)
+		}
+		// Reported in reference pixels, within a downscaled pixel or so of
+		// the block.
+		got := image.Rect(r.Regions[0].X, r.Regions[0].Y, r.Regions[0].X+r.Regions[0].W, r.Regions[0].Y+r.Regions[0].H)
+		slack := 2
+		if resolution > 0 {
+			slack += 2 * 780 / resolution
+		}
+		if abs(got.Min.X-block.Min.X) > slack || abs(got.Min.Y-block.Min.Y) > slack ||
+			abs(got.Max.X-block.Max.X) > slack || abs(got.Max.Y-block.Max.Y) > slack {
+			t.Errorf("resolution %d: region at %v, want about %v", resolution, got, block)
+		}
+	}
+}
+
+// BenchmarkDiffResolution compares a 390×3000 mobile page, exported at 2×,
+// at full resolution and at the page's own width.
+func BenchmarkDiffResolution(b *testing.B) {
+	weights, err := parseWeights("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	refImg, genImg := testPair(780, 6000)
+	ref, gen := encodePNG(b, refImg), encodePNG(b, genImg)
+	for _, bm := range []struct {
+		name       string
+		resolution int
+	}{
+		{"full", 0},
+		{"390", 390},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			opts := compareOpts{weights: weights, background: color.NRGBA{255, 255, 255, 255}, frameWidth: 390, resolution: bm.resolution}
+			for i := 0; i < b.N; i++ {
+				if _, _, err := pixelCompare(context.Background(), ref, gen, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
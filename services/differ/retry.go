@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errSandboxUnreachable is returned when the sandbox itself stopped
+// answering, as opposed to the browser failing to capture a live page.
+var errSandboxUnreachable = errors.New("sandbox unreachable")
+
+// captureBackoff is the wait before the second attempt; it doubles after.
+const captureBackoff = 500 * time.Millisecond
+
+// captureRetrying captures url, trying up to d.attempts times. A dev
+// server restarting or a renderer crash usually clears within a second or
+// two, so each attempt first checks the sandbox answers at all. If it
+// still doesn't on the last attempt the error wraps errSandboxUnreachable;
+// otherwise it is the last capture failure.
+func (d *differ) captureRetrying(ctx context.Context, jobID, url string, w, h int, o shotOpts) ([]byte, error) {
+	var err error
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(captureBackoff << (attempt - 2)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if err = d.probe(ctx, url); err != nil {
+			err = fmt.Errorf("%w: %v", errSandboxUnreachable, err)
+		} else {
+			var png []byte
+			if png, err = d.capture.capture(ctx, url, w, h, o); err == nil {
+				if attempt > 1 {
+					log.Info().Str("job", jobID).Int("attempt", attempt).Msg("capture succeeded after retry")
+				}
+				return png, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Warn().Err(err).Str("job", jobID).Int("attempt", attempt).Int("of", d.attempts).Msg("capture failed")
+	}
+	log.Error().Err(err).Str("job", jobID).Int("attempts", d.attempts).
+		Bool("sandbox_unreachable", errors.Is(err, errSandboxUnreachable)).Msg("capture gave up")
+	return nil, fmt.Errorf("after %d attempts: %w", d.attempts, err)
+}
+
+// probe checks that something answers at url. Any response short of a
+// server error counts: the page may still be compiling.
+func (d *differ) probe(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
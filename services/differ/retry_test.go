@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyCapturer fails its first failures captures.
+type flakyCapturer struct {
+	failures int
+	calls    atomic.Int32
+}
+
+func (c *flakyCapturer) capture(context.Context, string, int, int, shotOpts) ([]byte, error) {
+	if n := c.calls.Add(1); int(n) <= c.failures {
+		return nil, errors.New("renderer crashed")
+	}
+	return []byte("\x89PNG"), nil
+}
+
+func (c *flakyCapturer) close() {}
+
+func TestCaptureRetrying(t *testing.T) {
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("recovers", func(t *testing.T) {
+		c := &flakyCapturer{failures: 2}
+		d := &differ{http: srv.Client(), capture: c, attempts: 3}
+		png, err := d.captureRetrying(context.Background(), "job", srv.URL, 390, 844, shotOpts{})
+		if err != nil || string(png) != "\x89PNG" {
+			t.Fatalf("capture = %q, %v", png, err)
+		}
+		if n := c.calls.Load(); n != 3 {
+			t.Errorf("%d captures, want 3", n)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		c := &flakyCapturer{failures: 5}
+		d := &differ{http: srv.Client(), capture: c, attempts: 2}
+		_, err := d.captureRetrying(context.Background(), "job", srv.URL, 390, 844, shotOpts{})
+		if err == nil || errors.Is(err, errSandboxUnreachable) {
+			t.Errorf("err = %v, want the capture failure", err)
+		}
+		if n := c.calls.Load(); n != 2 {
+			t.Errorf("%d captures, want 2", n)
+		}
+	})
+
+	t.Run("sandbox down", func(t *testing.T) {
+		down.Store(true)
+		defer down.Store(false)
+		c := &flakyCapturer{}
+		d := &differ{http: srv.Client(), capture: c, attempts: 2}
+		_, err := d.captureRetrying(context.Background(), "job", srv.URL, 390, 844, shotOpts{})
+		if !errors.Is(err, errSandboxUnreachable) {
+			t.Errorf("err = %v, want errSandboxUnreachable", err)
+		}
+		if n := c.calls.Load(); n != 0 {
+			t.Errorf("captured %d times from a sandbox that doesn't answer", n)
+		}
+	})
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		c := &flakyCapturer{failures: 5}
+		d := &differ{http: srv.Client(), capture: c, attempts: 3}
+		ctx, cancel := context.WithTimeout(context.Background(), captureBackoff/5)
+		defer cancel()
+		start := time.Now()
+		_, err := d.captureRetrying(ctx, "job", srv.URL, 390, 844, shotOpts{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want the deadline", err)
+		}
+		if waited := time.Since(start); waited >= captureBackoff {
+			t.Errorf("returned after %v, want before the backoff ends", waited)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"image"
+	"math"
+)
+
+// Structure metrics. Layout and Typography compare where content sits, not
+// what its pixels are: both work on Sobel edge maps, so a page with the
+// right arrangement over a different photo or fill still scores well, and a
+// jumbled page over the right one doesn't.
+
+// edgeThreshold is the Sobel magnitude, on 0–255 luminance, that counts as
+// an edge. It ignores gradients and JPEG noise but keeps glyph outlines.
+const edgeThreshold = 96
+
+// Text bands are runs of edge-dense rows between quieter ones, in reference
+// pixels at export scale 2: roughly 4pt to 60pt type. Taller runs are
+// photos or illustrations.
+const (
+	textBandMinH    = 8
+	textBandMaxH    = 120
+	textRowDensity  = 0.01 // share of a row's pixels that are edges
+	textBandPadding = 2    // rows either side, for descenders and shifts
+)
+
+// edgeMap is a binary Sobel edge map of an image, row-major.
+type edgeMap struct {
+	w, h int
+	on   []bool
+}
+
+func sobelEdges(ctx context.Context, img *image.NRGBA) edgeMap {
+	l, w, h := luma(ctx, img)
+	e := edgeMap{w: w, h: h, on: make([]bool, w*h)}
+	parallelRows(ctx, h, func(y0, y1 int) {
+		for y := max(y0, 1); y < min(y1, h-1); y++ {
+			for x := 1; x < w-1; x++ {
+				at := func(dx, dy int) float64 { return l[(y+dy)*w+x+dx] }
+				gx := at(1, -1) + 2*at(1, 0) + at(1, 1) - at(-1, -1) - 2*at(-1, 0) - at(-1, 1)
+				gy := at(-1, 1) + 2*at(0, 1) + at(1, 1) - at(-1, -1) - 2*at(0, -1) - at(1, -1)
+				e.on[y*w+x] = math.Hypot(gx, gy) > edgeThreshold
+			}
+		}
+	})
+	return e
+}
+
+// profiles returns the edge density of every row and every column within
+// rows [y0, y1).
+func (e edgeMap) profiles(y0, y1 int) (rows, cols []float64) {
+	rows = make([]float64, y1-y0)
+	cols = make([]float64, e.w)
+	for y := y0; y < y1; y++ {
+		for x := 0; x < e.w; x++ {
+			if e.on[y*e.w+x] {
+				rows[y-y0]++
+				cols[x]++
+			}
+		}
+	}
+	for i := range rows {
+		rows[i] /= float64(e.w)
+	}
+	for i := range cols {
+		cols[i] /= float64(y1 - y0)
+	}
+	return rows, cols
+}
+
+// layoutScore compares the row and column edge profiles of ref and gen,
+// 0–100: whether rows and columns of content start and end in the same
+// places. Both maps must be the same size.
+func layoutScore(ref, gen edgeMap) float64 {
+	rr, rc := ref.profiles(0, ref.h)
+	gr, gc := gen.profiles(0, gen.h)
+	return (profileScore(rr, gr) + profileScore(rc, gc)) / 2
+}
+
+// typographyScore compares the text bands found in ref with the same rows
+// of gen, 0–100: each band by how closely its edge density matches (glyph
+// size and weight) and by its column profile (line length and alignment),
+// weighted by band height. A reference with no text scores 100.
+func typographyScore(ref, gen edgeMap) float64 {
+	var total, weight float64
+	for _, band := range textBands(ref) {
+		rr, rc := ref.profiles(band[0], band[1])
+		gr, gc := gen.profiles(band[0], band[1])
+		rd, gd := mean(rr), mean(gr)
+		density := 1.0
+		if m := math.Max(rd, gd); m > 0 {
+			density = math.Min(rd, gd) / m
+		}
+		h := float64(band[1] - band[0])
+		total += h * (density*100 + profileScore(rc, gc)) / 2
+		weight += h
+	}
+	if weight == 0 {
+		return 100
+	}
+	return total / weight
+}
+
+// textBands finds the row ranges of e that look like lines of text.
+func textBands(e edgeMap) [][2]int {
+	rows, _ := e.profiles(0, e.h)
+	var bands [][2]int
+	start := -1
+	for y := 0; y <= len(rows); y++ {
+		dense := y < len(rows) && rows[y] > textRowDensity
+		switch {
+		case dense && start < 0:
+			start = y
+		case !dense && start >= 0:
+			if h := y - start; h >= textBandMinH && h <= textBandMaxH {
+				bands = append(bands, [2]int{max(0, start-textBandPadding), min(e.h, y+textBandPadding)})
+			}
+			start = -1
+		}
+	}
+	return bands
+}
+
+// profileScore is the normalized cross-correlation of two profiles, mapped
+// to 0–100 with anticorrelation scoring 0. Both are smoothed first so
+// content a few pixels off still lines up. Two flat profiles match.
+func profileScore(a, b []float64) float64 {
+	r := max(2, len(a)/200)
+	a, b = smooth(a, r), smooth(b, r)
+	ma, mb := mean(a), mean(b)
+	var num, va, vb float64
+	for i := range a {
+		da, db := a[i]-ma, b[i]-mb
+		num += da * db
+		va += da * da
+		vb += db * db
+	}
+	const flat = 1e-9
+	switch {
+	case va < flat && vb < flat:
+		return 100
+	case va < flat || vb < flat:
+		return 0
+	}
+	return math.Max(0, num/math.Sqrt(va*vb)) * 100
+}
+
+// smooth is a box blur of radius r.
+func smooth(p []float64, r int) []float64 {
+	out := make([]float64, len(p))
+	sum, n := 0.0, 0
+	for i := 0; i < len(p)+r; i++ {
+		if i < len(p) {
+			sum += p[i]
+			n++
+		}
+		if i-2*r-1 >= 0 {
+			sum -= p[i-2*r-1]
+			n--
+		}
+		if c := i - r; c >= 0 && c < len(p) {
+			out[c] = sum / float64(n)
+		}
+	}
+	return out
+}
+
+func mean(p []float64) float64 {
+	if len(p) == 0 {
+		return 0
+	}
+	s := 0.0
+	for _, v := range p {
+		s += v
+	}
+	return s / float64(len(p))
+}
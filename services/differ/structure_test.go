@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// photo is a smooth full-bleed background: colors change too gradually
+// anywhere to make an edge, like an out-of-focus hero photo.
+type photo func(x, y int) color.NRGBA
+
+func warmPhoto(x, y int) color.NRGBA {
+	return color.NRGBA{
+		uint8(170 + 70*math.Sin(float64(x)/70)),
+		uint8(120 + 60*math.Cos(float64(y)/90)),
+		uint8(80 + 40*math.Sin(float64(x+y)/110)),
+		255,
+	}
+}
+
+func nightPhoto(x, y int) color.NRGBA {
+	return color.NRGBA{
+		uint8(30 + 25*math.Cos(float64(y)/80)),
+		uint8(40 + 30*math.Sin(float64(x)/60)),
+		uint8(90 + 60*math.Cos(float64(x-y)/120)),
+		255,
+	}
+}
+
+// card is a white panel of text lines at x, y, w wide.
+type card struct{ x, y, w, lines int }
+
+// photoPage draws a 360×640 screen over bg: a dark header bar and cards of
+// dark glyph-like strokes.
+func photoPage(bg photo, cards ...card) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 360, 640))
+	for y := 0; y < 640; y++ {
+		for x := 0; x < 360; x++ {
+			img.SetNRGBA(x, y, bg(x, y))
+		}
+	}
+	fill(img, image.Rect(0, 0, 360, 56), color.NRGBA{28, 27, 31, 255})
+	for g := 0; g < 8; g++ { // the title, in white
+		fill(img, image.Rect(20+g*14, 18, 23+g*14, 38), white)
+	}
+	dark := color.NRGBA{28, 27, 31, 255}
+	for _, c := range cards {
+		fill(img, image.Rect(c.x, c.y, c.x+c.w, c.y+24+c.lines*30), white)
+		for line := 0; line < c.lines; line++ {
+			top := c.y + 16 + line*30
+			for left := c.x + 16; left+11 < c.x+c.w-16; left += 16 {
+				fill(img, image.Rect(left, top, left+3, top+18), dark)    // stem
+				fill(img, image.Rect(left, top+7, left+11, top+10), dark) // bar
+			}
+		}
+	}
+	return img
+}
+
+// photoCase compares a page with the same layout over another photo, and
+// with its cards moved and resized over the same photo.
+func photoCase(t *testing.T) (rephotographed, jumbled *events.DiffResult) {
+	t.Helper()
+	weights, err := parseWeights("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := compareOpts{weights: weights, background: white, frameWidth: 360}
+	compare := func(ref, gen *image.NRGBA) *events.DiffResult {
+		r, _, err := pixelCompare(context.Background(), encodePNG(t, ref), encodePNG(t, gen), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	ref := photoPage(warmPhoto, card{16, 90, 328, 3}, card{16, 260, 328, 2})
+	return compare(ref, photoPage(nightPhoto, card{16, 90, 328, 3}, card{16, 260, 328, 2})),
+		compare(ref, photoPage(warmPhoto, card{40, 330, 280, 3}, card{16, 120, 328, 2}))
+}
+
+func TestLayoutIgnoresPhotoBackground(t *testing.T) {
+	rephotographed, jumbled := photoCase(t)
+	if rephotographed.Layout < 95 {
+		t.Errorf("the same layout over another photo scores %.1f on layout, want ≥95", rephotographed.Layout)
+	}
+	if jumbled.Layout > rephotographed.Layout-20 {
+		t.Errorf("jumbled layout scores %.1f, want well under the rephotographed %.1f", jumbled.Layout, rephotographed.Layout)
+	}
+	if rephotographed.Typography < 95 || jumbled.Typography > rephotographed.Typography-20 {
+		t.Errorf("typography: rephotographed %.1f, jumbled %.1f", rephotographed.Typography, jumbled.Typography)
+	}
+	// The RMSE scores they replaced get both the wrong way round.
+	if rephotographed.LayoutRMSE >= jumbled.LayoutRMSE || rephotographed.TypographyRMSE >= jumbled.TypographyRMSE {
+		t.Errorf("legacy layout %.1f and typography %.1f rephotographed, %.1f and %.1f jumbled; the fixture no longer shows their flaw",
+			rephotographed.LayoutRMSE, rephotographed.TypographyRMSE, jumbled.LayoutRMSE, jumbled.TypographyRMSE)
+	}
+}
+
+func TestTextBands(t *testing.T) {
+	e := sobelEdges(context.Background(), textFixture(0, true))
+	bands := textBands(e)
+	if len(bands) != 3 {
+		t.Fatalf("%d text bands, want the fixture's 3 lines: %v", len(bands), bands)
+	}
+	for i, b := range bands {
+		top := 12 + i*30 // each line's glyphs span top to top+18
+		if b[0] > top || b[1] < top+18 || b[1]-b[0] > 18+2*textBandPadding+4 {
+			t.Errorf("band %d is rows %d-%d, want about %d-%d", i, b[0], b[1], top, top+18)
+		}
+	}
+
+	// A block too tall to be a line of type is no band.
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 300))
+	fill(img, img.Bounds(), white)
+	for x := 0; x < 100; x += 6 {
+		fill(img, image.Rect(x, 20, x+3, 20+textBandMaxH+20), color.NRGBA{0, 0, 0, 255})
+	}
+	if bands := textBands(sobelEdges(context.Background(), img)); len(bands) != 0 {
+		t.Errorf("a %dpx tall block makes bands %v", textBandMaxH+20, bands)
+	}
+}
+
+func TestProfileScore(t *testing.T) {
+	ramp := make([]float64, 400)
+	for i := range ramp {
+		ramp[i] = float64(i % 100)
+	}
+	inverted := make([]float64, len(ramp))
+	for i, v := range ramp {
+		inverted[i] = 99 - v
+	}
+	flat := make([]float64, len(ramp))
+	for _, tc := range []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", ramp, ramp, 100},
+		{"scaled", ramp, scale(ramp, 3), 100}, // denser but in the same places
+		{"anticorrelated", ramp, inverted, 0},
+		{"both flat", flat, flat, 100},
+		{"one flat", ramp, flat, 0},
+	} {
+		if got := profileScore(tc.a, tc.b); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("%s: %.4f, want %g", tc.name, got, tc.want)
+		}
+	}
+}
+
+func scale(p []float64, k float64) []float64 {
+	out := make([]float64, len(p))
+	for i, v := range p {
+		out[i] = v * k
+	}
+	return out
+}
+
+func TestSmooth(t *testing.T) {
+	got := smooth([]float64{0, 0, 9, 0, 0}, 1)
+	want := []float64{0, 3, 3, 3, 0}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("smooth = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// pixelDiff is the RMS channel difference of two pixels, 0–255.
+func pixelDiff(a, b *image.NRGBA, ax, ay, bx, by int) float64 {
+	r1, g1, b1 := rgbAt(a, ax, ay)
+	r2, g2, b2 := rgbAt(b, bx, by)
+	dr := float64(r1) - float64(r2)
+	dg := float64(g1) - float64(g2)
+	db := float64(b1) - float64(b2)
+	return math.Sqrt((dr*dr + dg*dg + db*db) / 3.0)
+}
+
+// tolerantDiff is pixelDiff at (x, y) after tolerance: 0 for an
+// anti-aliasing artifact, otherwise the closest match within ShiftPx in
+// either direction. The second result reports whether tolerance lowered it.
+func tolerantDiff(ref, gen *image.NRGBA, x, y int, tol events.DiffTolerance, diff float64) (float64, bool) {
+	if tol.AntiAlias && (antialiased(ref, x, y, gen) || antialiased(gen, x, y, ref)) {
+		return 0, true
+	}
+	if tol.ShiftPx <= 0 {
+		return diff, false
+	}
+	// Check both directions so a shift isn't confused with content that
+	// vanished: the ref pixel must appear near (x, y) in gen, and the gen
+	// pixel near (x, y) in ref.
+	shifted := math.Max(nearest(ref, gen, x, y, tol.ShiftPx), nearest(gen, ref, x, y, tol.ShiftPx))
+	if shifted < diff {
+		return shifted, true
+	}
+	return diff, false
+}
+
+// nearest is the smallest pixelDiff between a(x, y) and any pixel of b
+// within r.
+func nearest(a, b *image.NRGBA, x, y, r int) float64 {
+	best := math.Inf(1)
+	bounds := b.Bounds()
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if p := image.Pt(x+dx, y+dy); p.In(bounds) {
+				best = math.Min(best, pixelDiff(a, b, x, y, p.X, p.Y))
+			}
+		}
+	}
+	return best
+}
+
+func lum(img *image.NRGBA, x, y int) float64 {
+	r, g, b := rgbAt(img, x, y)
+	return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+}
+
+// antialiased reports whether img(x, y) looks like an anti-aliased edge
+// pixel, after pixelmatch: it sits between a darker and a brighter
+// neighbour, has few identical neighbours itself, and the darkest or
+// brightest neighbour lies in a flat area in both images — i.e. it is the
+// blend along the boundary of two solid regions.
+func antialiased(img *image.NRGBA, x, y int, other *image.NRGBA) bool {
+	b := img.Bounds()
+	center := lum(img, x, y)
+	zeroes := 0
+	var minD, maxD float64
+	var minX, minY, maxX, maxY int
+	for ny := y - 1; ny <= y+1; ny++ {
+		for nx := x - 1; nx <= x+1; nx++ {
+			if (nx == x && ny == y) || !image.Pt(nx, ny).In(b) {
+				continue
+			}
+			d := lum(img, nx, ny) - center
+			switch {
+			case d == 0:
+				zeroes++
+				if zeroes > 2 {
+					return false
+				}
+			case d < minD:
+				minD, minX, minY = d, nx, ny
+			case d > maxD:
+				maxD, maxX, maxY = d, nx, ny
+			}
+		}
+	}
+	if minD == 0 || maxD == 0 {
+		return false
+	}
+	return (manySiblings(img, minX, minY) && manySiblings(other, minX, minY)) ||
+		(manySiblings(img, maxX, maxY) && manySiblings(other, maxX, maxY))
+}
+
+// manySiblings reports whether at least three neighbours of (x, y) share
+// its exact color.
+func manySiblings(img *image.NRGBA, x, y int) bool {
+	b := img.Bounds()
+	i := img.PixOffset(x, y)
+	c := img.Pix[i : i+4 : i+4]
+	n := 0
+	for ny := y - 1; ny <= y+1; ny++ {
+		for nx := x - 1; nx <= x+1; nx++ {
+			if (nx == x && ny == y) || !image.Pt(nx, ny).In(b) {
+				continue
+			}
+			j := img.PixOffset(nx, ny)
+			if img.Pix[j] == c[0] && img.Pix[j+1] == c[1] && img.Pix[j+2] == c[2] && img.Pix[j+3] == c[3] {
+				n++
+				if n >= 3 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
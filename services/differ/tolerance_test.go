@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// textFixture draws a page of text-like glyph strokes, black on white,
+// rasterized with coverage anti-aliasing as a text renderer does. dx moves
+// every stroke by a fraction of a pixel: two rasterizers placing the same
+// glyphs differently. A missing block, when set, is a button that isn't
+// drawn.
+func textFixture(dx float64, missing bool) *image.NRGBA {
+	const w, h = 240, 160
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	cover := make([]float64, w*h)
+	stroke := func(x0, y0, x1, y1 float64) { // filled box, in fractional pixels
+		for y := int(y0); y < int(math.Ceil(y1)); y++ {
+			for x := int(x0); x < int(math.Ceil(x1)); x++ {
+				cx := math.Min(x1, float64(x+1)) - math.Max(x0, float64(x))
+				cy := math.Min(y1, float64(y+1)) - math.Max(y0, float64(y))
+				cover[y*w+x] = math.Min(1, cover[y*w+x]+cx*cy)
+			}
+		}
+	}
+	// Three lines of "glyphs": a stem and a bar each.
+	for line := 0; line < 3; line++ {
+		top := 12.0 + float64(line)*30
+		for g := 0; g < 12; g++ {
+			left := 12 + float64(g)*18 + dx
+			stroke(left, top, left+3, top+18)    // stem
+			stroke(left, top+7, left+11, top+10) // bar
+		}
+	}
+	if !missing {
+		stroke(40, 110, 200, 150) // button
+	}
+	for i, c := range cover {
+		v := uint8(math.Round(255 * (1 - c)))
+		img.Pix[4*i], img.Pix[4*i+1], img.Pix[4*i+2], img.Pix[4*i+3] = v, v, v, 255
+	}
+	return img
+}
+
+// shifted returns img moved dx, dy pixels, the uncovered edge white.
+func shifted(img *image.NRGBA, dx, dy int) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA{255, 255, 255, 255}
+			if p := image.Pt(x-dx, y-dy); p.In(b) {
+				c = img.NRGBAAt(p.X, p.Y)
+			}
+			out.SetNRGBA(x, y, c)
+		}
+	}
+	return out
+}
+
+func pixelScore(ref, gen *image.NRGBA, tol events.DiffTolerance, r image.Rectangle) float64 {
+	m, _ := pixelDiffs(context.Background(), ref, gen, tol)
+	return m.score(r)
+}
+
+func TestToleranceForgivesRasterizerNoise(t *testing.T) {
+	ref := textFixture(0, false)
+	all := ref.Bounds()
+	for _, tc := range []struct {
+		name string
+		gen  *image.NRGBA
+		tol  events.DiffTolerance
+	}{
+		{"subpixel placement, anti-alias", textFixture(0.4, false), events.DiffTolerance{AntiAlias: true}},
+		{"1px shift, shift tolerance", shifted(ref, 1, 0), events.DiffTolerance{ShiftPx: 1}},
+		{"1px diagonal shift, shift tolerance", shifted(ref, 1, 1), events.DiffTolerance{ShiftPx: 1}},
+		{"subpixel and 1px shift, both", shifted(textFixture(0.4, false), 0, 1), events.DiffTolerance{AntiAlias: true, ShiftPx: 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			strict := pixelScore(ref, tc.gen, events.DiffTolerance{}, all)
+			tolerant := pixelScore(ref, tc.gen, tc.tol, all)
+			if tolerant <= strict {
+				t.Errorf("score %.2f with tolerance, %.2f without: want an improvement", tolerant, strict)
+			}
+			if tolerant < 99 {
+				t.Errorf("score %.2f with tolerance, want at least 99", tolerant)
+			}
+		})
+	}
+}
+
+func TestToleranceStillFailsMissingElements(t *testing.T) {
+	ref := textFixture(0, false)
+	gen := textFixture(0, true)
+	button := image.Rect(40, 110, 200, 150)
+	full := events.DiffTolerance{AntiAlias: true, ShiftPx: events.MaxShiftPx}
+
+	if s := pixelScore(ref, gen, full, button); s > 10 {
+		t.Errorf("missing button scores %.2f with tolerance, want it to fail", s)
+	}
+	strict := pixelScore(ref, gen, events.DiffTolerance{}, ref.Bounds())
+	tolerant := pixelScore(ref, gen, full, ref.Bounds())
+	if tolerant-strict > 1 {
+		t.Errorf("tolerance lifted the page from %.2f to %.2f for a missing element", strict, tolerant)
+	}
+}
+
+func TestToleranceOffComparesInPlace(t *testing.T) {
+	ref := textFixture(0, false)
+	gen := textFixture(0.4, false)
+	m, diffImg := pixelDiffs(context.Background(), ref, gen, events.DiffTolerance{})
+	for i := 0; i < len(diffImg.Pix); i += 4 {
+		// Yellow marks pixels tolerance forgave.
+		if diffImg.Pix[i] == 230 && diffImg.Pix[i+1] == 190 {
+			t.Fatalf("pixel %d forgiven with tolerance off", i/4)
+		}
+	}
+	if s := m.score(ref.Bounds()); s >= 99 {
+		t.Errorf("subpixel placement scores %.2f in place; the fixture has no edge noise", s)
+	}
+}
+
+func TestRegionScoreTypographyFocusesUpperQuarter(t *testing.T) {
+	// Differences only below the top quarter: the typography band is clean.
+	ref := image.NewNRGBA(image.Rect(0, 0, 100, 400))
+	gen := image.NewNRGBA(ref.Bounds())
+	for i := range ref.Pix {
+		ref.Pix[i], gen.Pix[i] = 255, 255
+	}
+	for y := 100; y < 400; y += 2 {
+		for x := 0; x < 100; x++ {
+			gen.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+		}
+	}
+	m, _ := pixelDiffs(context.Background(), ref, gen, events.DiffTolerance{})
+	if s := regionScore(m, ref.Bounds(), 1, 4); s != 100 {
+		t.Errorf("upper quarter scores %.2f, want 100", s)
+	}
+	if s := regionScore(m, ref.Bounds(), 3, 1); s >= 100 {
+		t.Errorf("whole page scores %.2f, want the differences counted", s)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/rs/zerolog/log"
+)
+
+// diffViewports diffs each breakpoint of a responsive screen and averages
+// the scores, so a layout that only holds up at one width can't pass. The
+// returned images are the worst breakpoint's. Breakpoints with no Figma
+// export are skipped; if none has one, the result is noReference.
+func (d *differ) diffViewports(ctx context.Context, p events.DiffRequestedPayload, opts compareOpts) (*events.DiffResult, *captures, error) {
+	agg := &events.DiffResult{}
+	var worstImgs *captures
+	worst := -1.0
+	text, texts := 0.0, 0
+	for _, v := range p.Viewports {
+		// The component tree is the primary frame's; its boxes don't fit
+		// the other breakpoints.
+		vopts := opts
+		if v.NodeID != p.Screen.NodeID {
+			vopts.screen = nil
+		}
+		vopts.ignore = append(append([]events.Box(nil), v.IgnoreRegions...), opts.jobIgnore...)
+		vopts.frameWidth = v.Width
+		vopts.fixedHeight = v.FixedHeight
+		r, imgs, err := d.diffAt(ctx, p.JobID, p.SandboxURL, v.ExportURL, int(v.Width), int(v.Height), vopts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("viewport %s: %w", v.Name, err)
+		}
+		if r.NoReference {
+			log.Warn().Str("job", p.JobID).Str("viewport", v.Name).Msg("no reference for viewport — skipped")
+			continue
+		}
+		agg.Score += r.Score
+		agg.Layout += r.Layout
+		agg.Typography += r.Typography
+		agg.Spacing += r.Spacing
+		agg.Color += r.Color
+		agg.SSIM += r.SSIM
+		agg.PHash += r.PHash
+		agg.LayoutRMSE += r.LayoutRMSE
+		agg.TypographyRMSE += r.TypographyRMSE
+		if r.TextAccuracy != nil {
+			text += *r.TextAccuracy
+			texts++
+		}
+		for _, reg := range r.Regions {
+			reg.Viewport = v.Name
+			agg.Regions = append(agg.Regions, reg)
+		}
+		agg.Viewports = append(agg.Viewports, events.ViewportScore{Name: v.Name, Width: v.Width, Score: r.Score})
+		if worst < 0 || r.Score < worst {
+			worst, worstImgs = r.Score, imgs
+			agg.Palette = r.Palette
+			agg.GeneratedWidth, agg.GeneratedHeight = r.GeneratedWidth, r.GeneratedHeight
+			agg.AspectRatioDelta = r.AspectRatioDelta
+			agg.OffsetX, agg.OffsetY = r.OffsetX, r.OffsetY
+		}
+	}
+
+	n := float64(len(agg.Viewports))
+	if n == 0 {
+		return noReference("no viewport has a Figma export"), nil, nil
+	}
+	agg.Score /= n
+	agg.Layout /= n
+	agg.Typography /= n
+	agg.Spacing /= n
+	agg.Color /= n
+	agg.SSIM /= n
+	agg.PHash /= n
+	agg.LayoutRMSE /= n
+	agg.TypographyRMSE /= n
+	if texts > 0 {
+		text /= float64(texts)
+		agg.TextAccuracy = &text
+	}
+	return agg, worstImgs, nil
+}
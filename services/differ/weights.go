@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// scoreWeights are the composite Score's weights per metric. They are
+// normalised to sum to 1, so DIFF_WEIGHTS only has to get the ratios right.
+type scoreWeights map[string]float64
+
+// defaultWeights lean on the perceptual metrics; raw RMSE stays in the mix
+// but no longer dominates, since it punishes anti-aliasing noise as hard as
+// a missing element. The band-RMSE layout and typography scores the edge
+// metrics replaced are still computed and can be weighted back in.
+var defaultWeights = scoreWeights{
+	"ssim":            0.30,
+	"phash":           0.10,
+	"rmse":            0.15,
+	"layout":          0.20,
+	"typography":      0.10,
+	"color":           0.10,
+	"spacing":         0.05,
+	"layout_rmse":     0,
+	"typography_rmse": 0,
+	// text only counts where the text pass ran; see composite.
+	"text": 0.15,
+}
+
+// parseWeights reads DIFF_WEIGHTS, e.g. "ssim=0.5,rmse=0.1". Listed metrics
+// override the defaults; a weight of 0 drops a metric.
+func parseWeights(spec string) (scoreWeights, error) {
+	w := make(scoreWeights, len(defaultWeights))
+	for k, v := range defaultWeights {
+		w[k] = v
+	}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("%q: want metric=weight", field)
+		}
+		if _, known := defaultWeights[key]; !known {
+			return nil, fmt.Errorf("unknown metric %q (want %s)", key, strings.Join(events.DiffMetrics, ", "))
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("%s=%q: want a non-negative number", key, val)
+		}
+		w[key] = f
+	}
+
+	sum := 0.0
+	for _, v := range w {
+		sum += v
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("all weights are zero")
+	}
+	for k := range w {
+		w[k] /= sum
+	}
+	return w, nil
+}
+
+// with returns w with the metrics in overrides reweighted, normalised
+// again. Override values are on w's scale, where all weights sum to 1.
+// Overrides that would zero every metric leave w as it is.
+func (w scoreWeights) with(overrides map[string]float64) scoreWeights {
+	out := make(scoreWeights, len(w))
+	sum := 0.0
+	for k, v := range w {
+		if o, ok := overrides[k]; ok {
+			v = o
+		}
+		out[k] = v
+		sum += v
+	}
+	if sum == 0 {
+		return w
+	}
+	for k := range out {
+		out[k] /= sum
+	}
+	return out
+}
+
+// checkMinimums records on r each metric that fell short of the score the
+// job requires of it on its own, with a region for the feedback. A metric
+// r has no score for, like text with OCR off, can't fall short.
+func checkMinimums(r *events.DiffResult, minimums map[string]float64) {
+	for _, name := range events.MinimumMetrics {
+		want, ok := minimums[name]
+		if !ok {
+			continue
+		}
+		if score, ok := r.MetricScore(name); ok && score < want {
+			r.BelowMinimum = append(r.BelowMinimum, name)
+			r.Regions = append(r.Regions, events.MismatchRegion{
+				Property: name + " score",
+				Actual:   fmt.Sprintf("%.0f", score),
+				Expected: fmt.Sprintf("≥%.0f", want),
+			})
+		}
+	}
+}
+
+// composite is the weighted mean of the metric scores given. A metric that
+// wasn't measured, like text when OCR is off, drops out rather than
+// counting as 0.
+func (w scoreWeights) composite(scores map[string]float64) float64 {
+	total, sum := 0.0, 0.0
+	for k, v := range scores {
+		total += w[k] * v
+		sum += w[k]
+	}
+	if sum == 0 {
+		return 0
+	}
+	return total / sum
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseWeights(t *testing.T) {
+	w, err := parseWeights("ssim=3, rmse=1, phash=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0.0
+	for _, v := range w {
+		sum += v
+	}
+	if math.Abs(sum-1) > 1e-9 || w["phash"] != 0 || math.Abs(w["ssim"]/w["rmse"]-3) > 1e-9 {
+		t.Errorf("weights %v: want them normalised, pHash dropped and SSIM three times RMSE", w)
+	}
+	for _, spec := range []string{"ssim", "ssim=", "ssim=-1", "ssim=lots", "psnr=1"} {
+		if _, err := parseWeights(spec); err == nil {
+			t.Errorf("parseWeights(%q): no error", spec)
+		}
+	}
+	zero := "ssim=0,phash=0,rmse=0,layout=0,typography=0,color=0,spacing=0,text=0"
+	if _, err := parseWeights(zero); err == nil {
+		t.Error("all weights zero: no error")
+	}
+}
+
+func TestCompositeSkipsUnmeasuredMetrics(t *testing.T) {
+	w := scoreWeights{"ssim": 0.5, "rmse": 0.25, "text": 0.25}
+	if got := w.composite(map[string]float64{"ssim": 80, "rmse": 50}); math.Abs(got-70) > 1e-9 {
+		t.Errorf("composite %.2f without text, want 70", got)
+	}
+	if got := w.composite(map[string]float64{"ssim": 80, "rmse": 50, "text": 0}); math.Abs(got-52.5) > 1e-9 {
+		t.Errorf("composite %.2f with text at 0, want 52.5", got)
+	}
+}
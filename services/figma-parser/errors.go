@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+var (
+	ErrFigmaAuth        = errors.New("figma rejected the access token")
+	ErrFigmaNotFound    = errors.New("figma file not found")
+	ErrFigmaRateLimited = errors.New("figma rate limit hit")
+)
+
+// apiError is a non-200 Figma response. It unwraps to one of the sentinel
+// errors above when the status has a specific meaning.
+type apiError struct {
+	Endpoint   string
+	Status     int
+	Body       string
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *apiError) Error() string {
+	if e.kind != nil {
+		return fmt.Sprintf("%v (%s %d): %s", e.kind, e.Endpoint, e.Status, e.Body)
+	}
+	return fmt.Sprintf("figma %s API %d: %s", e.Endpoint, e.Status, e.Body)
+}
+
+func (e *apiError) Unwrap() error { return e.kind }
+
+// statusError reads a failed response into an apiError.
+func statusError(endpoint string, resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	e := &apiError{Endpoint: endpoint, Status: resp.StatusCode, Body: string(b)}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		e.kind = ErrFigmaAuth
+	case http.StatusNotFound:
+		e.kind = ErrFigmaNotFound
+	case http.StatusTooManyRequests:
+		e.kind = ErrFigmaRateLimited
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+	return e
+}
+
+// failurePayload classifies err for the orchestrator: rate limits, 5xx and
+// transport errors are worth retrying, auth and not-found are not.
+func failurePayload(jobID string, err error) events.FigmaFailedPayload {
+	p := events.FigmaFailedPayload{JobID: jobID, Error: err.Error()}
+	var ae *apiError
+	switch {
+	case errors.Is(err, ErrFigmaAuth):
+		p.Code = events.FigmaErrAuth
+	case errors.Is(err, ErrFigmaNotFound):
+		p.Code = events.FigmaErrNotFound
+	case errors.Is(err, ErrFigmaRateLimited):
+		p.Code = events.FigmaErrRateLimited
+		p.Retryable = true
+		if errors.As(err, &ae) {
+			p.RetryAfter = int(ae.RetryAfter.Seconds())
+		}
+	case errors.As(err, &ae):
+		p.Retryable = ae.Status >= 500
+	default:
+		// Network failures; a malformed URL is the one input error we know of.
+		var urlErr *invalidURLError
+		p.Retryable = !errors.As(err, &urlErr)
+	}
+	return p
+}
+
+type invalidURLError struct{ url string }
+
+func (e *invalidURLError) Error() string { return fmt.Sprintf("invalid Figma URL: %q", e.url) }
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// ignoreRegions collects the boxes of nodes whose name carries
+// events.IgnoreMarker. A marked node's children are covered by its box.
+func ignoreRegions(n events.ComponentNode) []events.Box {
+	if strings.Contains(strings.ToLower(n.Name), events.IgnoreMarker) {
+		if n.Box == nil {
+			return nil
+		}
+		return []events.Box{*n.Box}
+	}
+	var out []events.Box
+	for _, c := range n.Children {
+		out = append(out, ignoreRegions(c)...)
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// update rewrites testdata/signin.screen.json from the parser's output.
+// The differ's tests read that file, so a change here shows up there.
+var update = flag.Bool("update", false, "rewrite testdata/signin.screen.json")
+
+// signIn parses testdata/signin.figma.json: a Sign in frame placed away
+// from the canvas origin, with a title, an email field and a button.
+func signIn(t *testing.T) events.FigmaScreen {
+	t.Helper()
+	data, err := os.ReadFile("testdata/signin.figma.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []figmaNode
+	if err := json.Unmarshal(data, &pages); err != nil {
+		t.Fatal(err)
+	}
+	screens := extractScreens(pages)
+	if len(screens) != 1 {
+		t.Fatalf("%d screens", len(screens))
+	}
+	return screens[0]
+}
+
+func TestNodeBoxesAreFrameRelative(t *testing.T) {
+	s := signIn(t)
+	if s.Width != 360 || s.Height != 640 {
+		t.Errorf("frame %gx%g", s.Width, s.Height)
+	}
+	boxes := map[string]events.Box{}
+	var walk func(n events.ComponentNode)
+	walk = func(n events.ComponentNode) {
+		if n.Box == nil {
+			t.Errorf("%s has no box", n.Name)
+		} else {
+			boxes[n.Name] = *n.Box
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(s.ComponentTree)
+	for name, want := range map[string]events.Box{
+		"Sign in":        {X: 0, Y: 0, W: 360, H: 640},
+		"Title":          {X: 24, Y: 80, W: 240, H: 32},
+		"Email field":    {X: 24, Y: 200, W: 312, H: 48},
+		"Sign in button": {X: 24, Y: 560, W: 312, H: 48},
+		"Sign in label":  {X: 150, Y: 574, W: 60, H: 20}, // the frame's, not its parent's
+	} {
+		if got := boxes[name]; got != want {
+			t.Errorf("%s at %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestNodeTokensNameTheButtonFill(t *testing.T) {
+	s := signIn(t)
+	if got := s.Colors[s.NodeColors["Sign in button"]]; got != "#6750A4" {
+		t.Errorf("button fill %s, want #6750A4", got)
+	}
+	if got := s.Colors[s.NodeColors["Email field"]]; got != "#F2F2F2" {
+		t.Errorf("field fill %s, want #F2F2F2", got)
+	}
+	if ts := s.Typography["Title"]; ts.FontSize != 24 || ts.FontWeight != 700 {
+		t.Errorf("title style %+v", ts)
+	}
+}
+
+func TestSignInScreenGolden(t *testing.T) {
+	got, err := json.MarshalIndent(signIn(t), "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	const golden = "testdata/signin.screen.json"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("parsed screen differs from %s; run go test -update if the change is intended:\n%s", golden, got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// paletteNames are handed out in order of how often a color is used, so the
+// dominant brand color ends up as "primary".
+var paletteNames = []string{"primary", "secondary", "tertiary", "accent"}
+
+// buildPalette collapses per-node colors into one entry per distinct hex.
+// nodeHex maps node name → hex, freq counts fills per hex across the whole
+// tree (node names repeat, so nodeHex alone undercounts). It returns the
+// palette (token → hex) and the per-node mapping (node name → token).
+func buildPalette(nodeHex map[string]string, freq map[string]int) (map[string]string, map[string]string) {
+	hexes := make([]string, 0, len(freq))
+	for hex := range freq {
+		hexes = append(hexes, hex)
+	}
+	sort.Slice(hexes, func(i, j int) bool {
+		if freq[hexes[i]] != freq[hexes[j]] {
+			return freq[hexes[i]] > freq[hexes[j]]
+		}
+		return hexes[i] < hexes[j]
+	})
+
+	palette := make(map[string]string, len(hexes))
+	tokenOf := make(map[string]string, len(hexes))
+	for i, hex := range hexes {
+		name := fmt.Sprintf("color-%d", i+1)
+		if i < len(paletteNames) {
+			name = paletteNames[i]
+		}
+		palette[name] = hex
+		tokenOf[hex] = name
+	}
+
+	nodes := make(map[string]string, len(nodeHex))
+	for node, hex := range nodeHex {
+		nodes[node] = tokenOf[hex]
+	}
+	return palette, nodes
+}
+
+// hexColor formats Figma's 0–1 float channels as #RRGGBB, or #RRGGBBAA when
+// the fill is translucent. Channels are clamped first: malformed files can
+// carry values outside [0,1], which would otherwise wrap.
+func hexColor(r, g, b, a float64) string {
+	if a < 1 {
+		return fmt.Sprintf("#%02X%02X%02X%02X", channel(r), channel(g), channel(b), channel(a))
+	}
+	return fmt.Sprintf("#%02X%02X%02X", channel(r), channel(g), channel(b))
+}
+
+func channel(v float64) uint8 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return uint8(math.Round(v * 255))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestHexColor(t *testing.T) {
+	for _, tc := range []struct {
+		r, g, b, a float64
+		want       string
+	}{
+		{1, 0, 0, 1, "#FF0000"},
+		{0.2, 0.4, 0.6, 1, "#336699"},
+		{0, 0, 0, 0.5, "#00000080"},
+		{1, 1, 1, 0, "#FFFFFF00"},
+		{1.5, -0.2, 300, 1, "#FF00FF"},          // clamped, not wrapped
+		{math.NaN(), 0, 0, 2, "#000000"},        // NaN is 0; alpha over 1 is opaque
+		{0.5, 0.5, 0.5, -1, "#80808000"},        // alpha under 0 is transparent
+		{0.999, 0.001, 0.5, 0.999, "#FF0080FF"}, // translucent, if only just
+	} {
+		if got := hexColor(tc.r, tc.g, tc.b, tc.a); got != tc.want {
+			t.Errorf("hexColor(%v, %v, %v, %v) = %s, want %s", tc.r, tc.g, tc.b, tc.a, got, tc.want)
+		}
+	}
+}
+
+func TestHalfTransparentFillKeepsAlpha(t *testing.T) {
+	// A scrim at 50% over an opaque card, twice, so it is the primary.
+	const file = `[{"type": "CANVAS", "children": [{
+		"id": "1:1", "name": "Modal", "type": "FRAME",
+		"absoluteBoundingBox": {"x": 0, "y": 0, "width": 390, "height": 844},
+		"fills": [{"type": "SOLID", "color": {"r": 1, "g": 1, "b": 1, "a": 1}}],
+		"children": [
+			{"id": "1:2", "name": "Scrim", "type": "RECTANGLE", "fills": [{"type": "SOLID", "color": {"r": 0, "g": 0, "b": 0, "a": 0.5}}]},
+			{"id": "1:3", "name": "Backdrop", "type": "RECTANGLE", "fills": [{"type": "SOLID", "color": {"r": 0, "g": 0, "b": 0, "a": 0.5}}]}
+		]
+	}]}]`
+	var pages []figmaNode
+	if err := json.Unmarshal([]byte(file), &pages); err != nil {
+		t.Fatal(err)
+	}
+	screens := extractScreens(pages)
+	if len(screens) != 1 {
+		t.Fatalf("%d screens", len(screens))
+	}
+	s := screens[0]
+	if got := s.Colors["primary"]; got != "#00000080" {
+		t.Errorf("primary %s, want the scrim's #00000080", got)
+	}
+	if got := s.Colors["secondary"]; got != "#FFFFFF" {
+		t.Errorf("secondary %s, want the opaque #FFFFFF", got)
+	}
+	if s.NodeColors["Scrim"] != "primary" || s.NodeColors["Modal"] != "secondary" {
+		t.Errorf("node colors %v", s.NodeColors)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tokenSource holds the Figma personal access token. When backed by a file
+// (a mounted secret) it re-reads it on demand, so a rotated token is picked
+// up without restarting the parser.
+type tokenSource struct {
+	mu    sync.RWMutex
+	file  string
+	token string
+}
+
+func newTokenSource(token, file string) (*tokenSource, error) {
+	ts := &tokenSource{file: file, token: token}
+	if _, err := ts.reload(); err != nil {
+		if token == "" {
+			return nil, err
+		}
+		log.Warn().Err(err).Msg("using FIGMA_TOKEN until the token file is readable")
+	}
+	if ts.get() == "" {
+		return nil, fmt.Errorf("no Figma token: set FIGMA_TOKEN or FIGMA_TOKEN_FILE")
+	}
+	return ts, nil
+}
+
+func (ts *tokenSource) get() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.token
+}
+
+// reload re-reads the token file and reports whether the token changed.
+func (ts *tokenSource) reload() (bool, error) {
+	if ts.file == "" {
+		return false, nil
+	}
+	b, err := os.ReadFile(ts.file)
+	if err != nil {
+		return false, fmt.Errorf("read Figma token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	changed := token != "" && token != ts.token
+	if changed {
+		ts.token = token
+	}
+	return changed, nil
+}
+
+// get issues an authenticated GET against the Figma API. An auth rejection
+// usually means the token was rotated under us: reload it and retry once.
+func (c *figmaClient) get(ctx context.Context, url string) (*http.Response, error) {
+	resp, err := c.send(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return resp, nil
+	}
+	changed, rerr := c.token.reload()
+	if rerr != nil {
+		log.Warn().Err(rerr).Msg("figma token reload failed")
+	}
+	if !changed {
+		return resp, nil
+	}
+	resp.Body.Close()
+	log.Info().Msg("figma token rotated — retrying request")
+	return c.send(ctx, url)
+}
+
+func (c *figmaClient) send(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Figma-Token", c.token.get())
+	return c.http.Do(req)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// viewportSuffix is the naming convention for responsive variants: frames
+// called "Home @mobile" and "Home @desktop" are one screen at two
+// breakpoints.
+var viewportSuffix = regexp.MustCompile(`^(.*\S)\s*@\s*([\w-]+)$`)
+
+// groupViewports folds frames that share a base name and carry a breakpoint
+// suffix into one screen. The widest variant supplies the design data the
+// component is generated from; every variant, that one included, becomes a
+// Viewport to diff against. Frames without a suffix, or alone under their
+// base name, pass through unchanged.
+func groupViewports(screens []events.FigmaScreen) []events.FigmaScreen {
+	groups := make(map[string][]int)
+	var order []string
+	for i, s := range screens {
+		m := viewportSuffix.FindStringSubmatch(s.Name)
+		if m == nil {
+			continue
+		}
+		base := strings.ToLower(m[1])
+		if _, ok := groups[base]; !ok {
+			order = append(order, base)
+		}
+		groups[base] = append(groups[base], i)
+	}
+
+	merged := make(map[int]bool) // variants folded into another screen
+	for _, base := range order {
+		idx := groups[base]
+		if len(idx) < 2 {
+			continue
+		}
+		primary := idx[0]
+		for _, i := range idx[1:] {
+			if screens[i].Width > screens[primary].Width {
+				primary = i
+			}
+		}
+		var vps []events.Viewport
+		for _, i := range idx {
+			s := screens[i]
+			vps = append(vps, events.Viewport{
+				Name:   viewportSuffix.FindStringSubmatch(s.Name)[2],
+				NodeID: s.NodeID,
+				Width:  s.Width,
+				Height: s.Height,
+
+				FixedHeight:   s.FixedHeight,
+				IgnoreRegions: s.IgnoreRegions,
+			})
+			if i != primary {
+				merged[i] = true
+			}
+		}
+		sort.SliceStable(vps, func(a, b int) bool { return vps[a].Width < vps[b].Width })
+		screens[primary].Name = viewportSuffix.FindStringSubmatch(screens[primary].Name)[1]
+		screens[primary].Viewports = vps
+	}
+
+	out := screens[:0]
+	for i, s := range screens {
+		if !merged[i] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
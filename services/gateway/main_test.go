@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/jobdb"
+	"github.com/google/uuid"
+)
+
+// call runs handler on a request and decodes its JSON response.
+func call(t *testing.T, handler http.HandlerFunc, r *http.Request) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func TestCreateJobUndecodableBody(t *testing.T) {
+	gw := &gateway{threshold: 95}
+	for _, tc := range []struct {
+		body, field string
+	}{
+		{`{"figma_url": "https://www.figma.com/file/abc/X", "threshold": "high"}`, "threshold"},
+		{`{"platforms": "react"}`, "platforms"},
+		{`{"figma_url": `, "body"},
+		{`not json`, "body"},
+	} {
+		r := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(tc.body))
+		code, body := call(t, gw.createJob, r)
+		if code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: %d, want 422", tc.body, code)
+		}
+		errs, _ := body["errors"].(map[string]any)
+		if errs[tc.field] == nil {
+			t.Errorf("%s: %v, want an error for %s", tc.body, body, tc.field)
+		}
+	}
+}
+
+// stubReader is a jobdb.Reader with one job and no iterations or results.
+// It fails the test when asked for a job by an ID that isn't one.
+type stubReader struct {
+	jobdb.Reader
+	t  *testing.T
+	id string
+}
+
+func (s stubReader) Job(_ context.Context, id string) (jobdb.Row, error) {
+	s.check(id)
+	if id == s.id {
+		return jobdb.Row{"id": id, "status": "done"}, nil
+	}
+	return nil, nil
+}
+
+func (s stubReader) Iterations(_ context.Context, id string) ([]jobdb.Row, error) {
+	s.check(id)
+	return nil, nil
+}
+
+func (s stubReader) ScreenResults(_ context.Context, id string) ([]jobdb.Row, error) {
+	s.check(id)
+	return nil, nil
+}
+
+func (s stubReader) check(id string) {
+	if !jobdb.ValidID(id) {
+		s.t.Errorf("store asked for job %q", id)
+	}
+}
+
+func TestInvalidJobIDs(t *testing.T) {
+	id := uuid.NewString()
+	gw := &gateway{jobs: stubReader{t: t, id: id}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/jobs/{id}", gw.getJob)
+	mux.HandleFunc("GET /api/jobs/{id}/screens", gw.getScreens)
+	mux.HandleFunc("POST /api/jobs/{id}/retry", gw.retryJob)
+
+	for _, bad := range []string{
+		"not-a-uuid",
+		id + "&status=eq.failed",
+		id + ",id.neq.0",
+		id + ")",
+		"eq." + id,
+		"in.(" + id + ")",
+		id[:35] + "&",
+		"{" + id + "}",
+		"urn:uuid:" + id,
+	} {
+		for _, route := range []struct{ method, path string }{
+			{"GET", "/api/jobs/%s"},
+			{"GET", "/api/jobs/%s/screens"},
+			{"POST", "/api/jobs/%s/retry"},
+		} {
+			r := httptest.NewRequest(route.method, fmt.Sprintf(route.path, url.PathEscape(bad)), nil)
+			code, body := call(t, mux.ServeHTTP, r)
+			if code != http.StatusBadRequest {
+				t.Errorf("%s %q: %d %v, want 400", route.method, bad, code, body)
+			}
+		}
+	}
+
+	// A valid ID reaches the store: the job, or a 404 for one not there.
+	if code, _ := call(t, mux.ServeHTTP, httptest.NewRequest("GET", "/api/jobs/"+id, nil)); code != http.StatusOK {
+		t.Errorf("GET job: %d", code)
+	}
+	if code, _ := call(t, mux.ServeHTTP, httptest.NewRequest("GET", "/api/jobs/"+uuid.NewString(), nil)); code != http.StatusNotFound {
+		t.Errorf("GET unknown job: %d", code)
+	}
+}
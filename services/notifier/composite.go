@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // Figma jpg exports
+	"image/png"
+
+	"github.com/disintegration/imaging"
+)
+
+// Side-by-side layout: panels are scaled to one height, which Telegram
+// would otherwise shrink the whole photo to fit anyway.
+const (
+	panelHeight = 1600
+	panelGap    = 24
+)
+
+// sideBySide lays the decodable images out left to right on white, each
+// scaled to the same height, e.g. reference | generated | diff. The diff
+// overlay is translucent, so it is drawn over the generated capture when
+// both are present. It returns nil if nothing decodes.
+func sideBySide(reference, generated, diff []byte) []byte {
+	var panels []image.Image
+	ref := decode(reference)
+	gen := decode(generated)
+	if ref != nil {
+		panels = append(panels, ref)
+	}
+	if gen != nil {
+		panels = append(panels, gen)
+	}
+	if d := decode(diff); d != nil {
+		if gen != nil {
+			base := imaging.Clone(gen)
+			draw.Draw(base, base.Bounds(), imaging.Resize(d, base.Bounds().Dx(), base.Bounds().Dy(), imaging.NearestNeighbor), image.Point{}, draw.Over)
+			d = base
+		}
+		panels = append(panels, d)
+	}
+	if len(panels) == 0 {
+		return nil
+	}
+
+	h := panelHeight
+	for _, p := range panels {
+		h = min(h, p.Bounds().Dy())
+	}
+	w := panelGap * (len(panels) - 1)
+	for i, p := range panels {
+		panels[i] = imaging.Resize(p, 0, h, imaging.Lanczos)
+		w += panels[i].Bounds().Dx()
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(out, out.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	x := 0
+	for _, p := range panels {
+		r := image.Rect(x, 0, x+p.Bounds().Dx(), h)
+		draw.Draw(out, r, p, p.Bounds().Min, draw.Over)
+		x = r.Max.X + panelGap
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func decode(data []byte) image.Image {
+	if len(data) == 0 {
+		return nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return img
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/rs/zerolog/log"
+)
+
+// digestSettings are the notifier's defaults for digests, from env.
+type digestSettings struct {
+	enabled  bool          // NOTIFY_DIGEST
+	interval time.Duration // NOTIFY_DIGEST_INTERVAL
+	screens  int           // NOTIFY_DIGEST_SCREENS
+	// maxAge is how long a job's digest waits for anything more before it
+	// is flushed and forgotten, for jobs whose end never arrives.
+	maxAge time.Duration // NOTIFY_DIGEST_MAX_AGE
+}
+
+// digestEvent reports whether event is one digests batch.
+func digestEvent(event string) bool {
+	return event == events.NotifyScreenPassed || event == events.NotifyMaxIter
+}
+
+// digestKey is one batch: a job's notifications to one set of channels,
+// as a job's events may each go to different ones.
+type digestKey struct {
+	job      string
+	channels string // the channels as JSON; empty is the defaults
+}
+
+type digestBuffer struct {
+	channels []events.NotifyChannel
+	fileName string
+	entries  []*events.NotifyRequestedPayload
+	first    time.Time // of the oldest entry
+	last     time.Time // of the newest
+	interval time.Duration
+	screens  int
+}
+
+// digestBatch is a buffer's entries on their way out.
+type digestBatch struct {
+	jobID    string
+	fileName string
+	channels []events.NotifyChannel
+	entries  []*events.NotifyRequestedPayload
+}
+
+// digester buffers screen notifications per job and channels, and hands
+// them to flush as one batch every interval or screens entries. Buffers
+// are dropped when their job ends, or after maxAge without an entry.
+type digester struct {
+	mu       sync.Mutex
+	settings digestSettings
+	buffers  map[digestKey]*digestBuffer
+	flush    func(ctx context.Context, b digestBatch)
+}
+
+func newDigester(s digestSettings, flush func(ctx context.Context, b digestBatch)) *digester {
+	return &digester{settings: s, buffers: make(map[digestKey]*digestBuffer), flush: flush}
+}
+
+// wants reports whether p, of a screen-level event, is batched: as the
+// job asks, or by the notifier's default when it doesn't.
+func (d *digester) wants(p *events.NotifyRequestedPayload) bool {
+	if p.Digest != nil {
+		return p.Digest.Enabled
+	}
+	return d.settings.enabled
+}
+
+// add buffers p, returning the batch to send now if p filled it.
+func (d *digester) add(p *events.NotifyRequestedPayload, now time.Time) *digestBatch {
+	key := keyOf(p.JobID, p.Channels)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b := d.buffers[key]
+	if b == nil {
+		b = &digestBuffer{channels: p.Channels, interval: d.settings.interval, screens: d.settings.screens}
+		if p.Digest != nil && p.Digest.IntervalMin > 0 {
+			b.interval = time.Duration(p.Digest.IntervalMin) * time.Minute
+		}
+		if p.Digest != nil && p.Digest.Screens > 0 {
+			b.screens = p.Digest.Screens
+		}
+		d.buffers[key] = b
+	}
+	if len(b.entries) == 0 {
+		b.first = now
+	}
+	b.entries = append(b.entries, p)
+	b.last = now
+	if p.FileName != "" {
+		b.fileName = p.FileName
+	}
+	if len(b.entries) >= b.screens {
+		return b.take(p.JobID)
+	}
+	return nil
+}
+
+// end removes the job's buffers, returning the batches still in them.
+func (d *digester) end(jobID string) []digestBatch {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []digestBatch
+	for key, b := range d.buffers {
+		if key.job != jobID {
+			continue
+		}
+		delete(d.buffers, key)
+		if batch := b.take(jobID); batch != nil {
+			out = append(out, *batch)
+		}
+	}
+	return out
+}
+
+// due returns the batches whose interval has passed, and forgets buffers
+// that have waited maxAge for anything more, flushing what they hold.
+func (d *digester) due(now time.Time) []digestBatch {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []digestBatch
+	for key, b := range d.buffers {
+		abandoned := now.Sub(b.last) >= d.settings.maxAge
+		if abandoned {
+			delete(d.buffers, key)
+		}
+		if len(b.entries) > 0 && (abandoned || now.Sub(b.first) >= b.interval) {
+			out = append(out, *b.take(key.job))
+		}
+	}
+	return out
+}
+
+// run flushes due batches until ctx ends.
+func (d *digester) run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, b := range d.due(now) {
+				d.flush(ctx, b)
+			}
+		}
+	}
+}
+
+// take empties b into a batch, or returns nil if it holds nothing.
+func (b *digestBuffer) take(jobID string) *digestBatch {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	batch := &digestBatch{jobID: jobID, fileName: b.fileName, channels: b.channels, entries: b.entries}
+	b.entries = nil
+	return batch
+}
+
+func keyOf(jobID string, channels []events.NotifyChannel) digestKey {
+	k := digestKey{job: jobID}
+	if len(channels) > 0 {
+		raw, _ := json.Marshal(channels)
+		k.channels = string(raw)
+	}
+	return k
+}
+
+// sameChannels reports whether a batch goes where channels do.
+func (b digestBatch) sameChannels(channels []events.NotifyChannel) bool {
+	return keyOf(b.jobID, b.channels) == keyOf(b.jobID, channels)
+}
+
+// lines is the batch as one Markdown line per screen.
+func (b digestBatch) lines() string {
+	lines := make([]string, len(b.entries))
+	for i, p := range b.entries {
+		if p.Event == events.NotifyMaxIter {
+			lines[i] = fmt.Sprintf("⚠️ **%s** [%s] stopped at %.1f%% after %d iterations", p.ScreenName, p.Platform, p.Score, p.Iterations)
+		} else {
+			lines[i] = fmt.Sprintf("✅ **%s** [%s] %.1f%% in %d iterations", p.ScreenName, p.Platform, p.Score, p.Iterations)
+		}
+		if p.DiffImageURL != "" {
+			lines[i] += " · [diff](" + p.DiffImageURL + ")"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notification is the batch as a message of its own.
+func (b digestBatch) notification() Notification {
+	job := "`job: " + b.jobID + "`"
+	if b.fileName != "" {
+		job = b.fileName + " · " + job
+	}
+	return Notification{
+		Title: fmt.Sprintf("📋 %d screens finished", len(b.entries)),
+		Body:  b.lines() + "\n" + job,
+		Event: events.NotifyScreenPassed,
+		// The screens' own events tell the ones that passed from the rest.
+		Requests: b.entries,
+	}
+}
+
+// sendDigest sends a batch to its channels.
+func (n *notifier) sendDigest(ctx context.Context, b digestBatch) {
+	sinks := n.sinks
+	if len(b.channels) > 0 {
+		sinks = channelSinks(b.channels, n.http, n.webhooks)
+	}
+	log.Info().Str("job", b.jobID).Int("screens", len(b.entries)).Int("sinks", len(sinks)).Msg("sending digest")
+	if err := sendAll(ctx, sinks, b.notification()); err != nil {
+		log.Error().Err(err).Str("job", b.jobID).Msg("digest not sent")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func screenPassed(job, screen string) *events.NotifyRequestedPayload {
+	return &events.NotifyRequestedPayload{
+		JobID: job, ScreenName: screen, Platform: events.PlatformReact,
+		Score: 97.25, Iterations: 2, Event: events.NotifyScreenPassed,
+	}
+}
+
+func TestDigesterBatches(t *testing.T) {
+	d := newDigester(digestSettings{enabled: true, interval: 10 * time.Minute, screens: 3, maxAge: time.Hour}, nil)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Full at the third screen.
+	for i, screen := range []string{"Home", "Profile"} {
+		if b := d.add(screenPassed("job-1", screen), now.Add(time.Duration(i)*time.Second)); b != nil {
+			t.Fatalf("sent after %d screens", i+1)
+		}
+	}
+	b := d.add(screenPassed("job-1", "Settings"), now.Add(2*time.Second))
+	if b == nil || b.jobID != "job-1" || len(b.entries) != 3 || b.entries[2].ScreenName != "Settings" {
+		t.Fatalf("batch %+v", b)
+	}
+
+	// Another job, and the same job to other channels, are batches of
+	// their own.
+	d.add(screenPassed("job-2", "Home"), now)
+	elsewhere := screenPassed("job-1", "Login")
+	elsewhere.Channels = []events.NotifyChannel{{Sink: events.SinkSlack}}
+	d.add(elsewhere, now)
+	d.add(screenPassed("job-1", "About"), now.Add(5*time.Minute))
+
+	if due := d.due(now.Add(9 * time.Minute)); len(due) != 0 {
+		t.Errorf("due before the interval: %+v", due)
+	}
+	due := d.due(now.Add(10 * time.Minute))
+	got := map[string]int{}
+	for _, b := range due {
+		got[b.jobID+" "+b.entries[0].ScreenName] = len(b.entries)
+	}
+	// job-1's About came 5 minutes after its batch emptied.
+	if len(got) != 2 || got["job-2 Home"] != 1 || got["job-1 Login"] != 1 {
+		t.Errorf("due %v", got)
+	}
+
+	// The job's end takes what is left.
+	left := d.end("job-1")
+	if len(left) != 1 || left[0].entries[0].ScreenName != "About" {
+		t.Errorf("left %+v", left)
+	}
+	if left := d.end("job-1"); len(left) != 0 {
+		t.Errorf("ended twice: %+v", left)
+	}
+}
+
+func TestDigesterJobSettings(t *testing.T) {
+	d := newDigester(digestSettings{interval: time.Hour, screens: 10, maxAge: 2 * time.Hour}, nil)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	p := screenPassed("job-1", "Home")
+	if d.wants(p) {
+		t.Error("batched with digests off")
+	}
+	p.Digest = &events.NotifyDigest{Enabled: true, IntervalMin: 5, Screens: 2}
+	if !d.wants(p) {
+		t.Error("not batched though the job asks")
+	}
+	d.add(p, now)
+	if due := d.due(now.Add(5 * time.Minute)); len(due) != 1 {
+		t.Errorf("the job's 5 minute interval flushed %d batches", len(due))
+	}
+	d.add(p, now)
+	if b := d.add(p, now); b == nil {
+		t.Error("the job's 2 screens didn't fill the batch")
+	}
+}
+
+func TestDigesterForgetsAbandonedJobs(t *testing.T) {
+	d := newDigester(digestSettings{enabled: true, interval: time.Hour, screens: 10, maxAge: 30 * time.Minute}, nil)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	d.add(screenPassed("job-1", "Home"), now)
+
+	// Its end never arrives: past maxAge the screen is flushed, though the
+	// interval hasn't passed, and the buffer dropped.
+	due := d.due(now.Add(30 * time.Minute))
+	if len(due) != 1 || len(d.buffers) != 0 {
+		t.Errorf("due %+v, %d buffers left", due, len(d.buffers))
+	}
+}
+
+func TestDigestNotification(t *testing.T) {
+	stopped := screenPassed("job-1", "Settings")
+	stopped.Event, stopped.Score, stopped.Iterations = events.NotifyMaxIter, 81.5, 5
+	passed := screenPassed("job-1", "Home")
+	passed.DiffImageURL = "https://cdn.test/0.png"
+	b := digestBatch{jobID: "job-1", fileName: "App", entries: []*events.NotifyRequestedPayload{passed, stopped}}
+
+	n := b.notification()
+	if n.Title != "📋 2 screens finished" || len(n.Requests) != 2 {
+		t.Errorf("title %q, %d requests", n.Title, len(n.Requests))
+	}
+	want := "✅ **Home** [react] 97.2% in 2 iterations · [diff](https://cdn.test/0.png)\n" +
+		"⚠️ **Settings** [react] stopped at 81.5% after 5 iterations\n" +
+		"App · `job: job-1`"
+	if n.Body != want {
+		t.Errorf("body\n%s\nwant\n%s", n.Body, want)
+	}
+}
+
+// recordingSink keeps what it is sent.
+type recordingSink struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(_ context.Context, n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+func TestJobDoneCarriesTheDigest(t *testing.T) {
+	sink := &recordingSink{}
+	n := &notifier{
+		sinks:  []Sink{sink},
+		events: []string{events.NotifyScreenPassed, events.NotifyJobDone},
+		digest: newDigester(digestSettings{enabled: true, interval: time.Hour, screens: 10, maxAge: time.Hour}, nil),
+	}
+	deliver := func(p *events.NotifyRequestedPayload) {
+		t.Helper()
+		body, err := events.Wrap(events.NotifyRequested, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handle(context.Background(), amqp.Delivery{Body: body}, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliver(screenPassed("job-1", "Home"))
+	deliver(screenPassed("job-1", "Profile"))
+	if len(sink.sent) != 0 {
+		t.Fatalf("sent %d notifications for batched screens", len(sink.sent))
+	}
+
+	deliver(&events.NotifyRequestedPayload{JobID: "job-1", Event: events.NotifyJobDone, Score: 97, Iterations: 4})
+	if len(sink.sent) != 1 {
+		t.Fatalf("sent %d notifications at the job's end, want 1", len(sink.sent))
+	}
+	done := sink.sent[0]
+	// Its own request and the two screens'.
+	if done.Event != events.NotifyJobDone || len(done.Requests) != 3 ||
+		!strings.Contains(done.Body, "**Home**") || !strings.Contains(done.Body, "**Profile**") {
+		t.Errorf("job done %q carries %d requests", done.Body, len(done.Requests))
+	}
+}
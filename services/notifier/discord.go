@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// embedColor is the stripe down the side of Discord embeds.
+const embedColor = 0x22C55E
+
+// discordSink posts to a Discord channel webhook: an embed with the
+// message, and the image attached and shown inside it.
+type discordSink struct {
+	webhookURL string
+	http       *http.Client
+}
+
+func (d *discordSink) Name() string { return "discord" }
+
+func (d *discordSink) Send(ctx context.Context, n Notification) error {
+	embed := map[string]any{
+		"title":       n.Title,
+		"description": renderDiscord(n.markdown()),
+		"color":       embedColor,
+	}
+	payload := map[string]any{"embeds": []any{embed}}
+	if len(n.Image) == 0 {
+		body, _ := json.Marshal(payload)
+		return d.post(ctx, "application/json", bytes.NewReader(body))
+	}
+
+	embed["image"] = map[string]string{"url": "attachment://screen.png"}
+	body, _ := json.Marshal(payload)
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	_ = w.WriteField("payload_json", string(body))
+	part, _ := w.CreateFormFile("files[0]", "screen.png")
+	part.Write(n.Image)
+	w.Close()
+	return d.post(ctx, w.FormDataContentType(), &buf)
+}
+
+func (d *discordSink) post(ctx context.Context, contentType string, body io.Reader) error {
+	req, _ := http.NewRequestWithContext(ctx, "POST", d.webhookURL, body)
+	req.Header.Set("Content-Type", contentType)
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("discord %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
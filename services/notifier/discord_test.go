@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiscordEmbeds(t *testing.T) {
+	mock := &apiMock{}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	d := &discordSink{webhookURL: srv.URL + "/api/webhooks/1/tok", http: srv.Client()}
+
+	n := testNotification()
+	if err := d.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	n.Image = testPNG(t, 4, 4)
+	if err := d.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	calls := mock.recorded()
+	if len(calls) != 2 {
+		t.Fatalf("%d calls", len(calls))
+	}
+
+	type embed struct {
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		Color       int               `json:"color"`
+		Image       map[string]string `json:"image"`
+	}
+	var plain struct{ Embeds []embed }
+	if calls[0].contentType != "application/json" {
+		t.Errorf("sent as %s", calls[0].contentType)
+	}
+	if err := json.Unmarshal(calls[0].body, &plain); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.Embeds) != 1 || plain.Embeds[0].Title != n.Title || plain.Embeds[0].Color != embedColor ||
+		!strings.Contains(plain.Embeds[0].Description, "[Open](https://forge.test/jobs/1)") || plain.Embeds[0].Image != nil {
+		t.Errorf("embeds %+v", plain.Embeds)
+	}
+
+	// With an image, the payload is a form field and the image a file the
+	// embed shows.
+	c := calls[1]
+	if !strings.HasPrefix(c.contentType, "multipart/form-data") || c.form["files[0]"] != "screen.png" {
+		t.Fatalf("sent as %s %v", c.contentType, c.form)
+	}
+	var withImage struct{ Embeds []embed }
+	if err := json.Unmarshal([]byte(c.form["payload_json"]), &withImage); err != nil {
+		t.Fatal(err)
+	}
+	if len(withImage.Embeds) != 1 || withImage.Embeds[0].Image["url"] != "attachment://screen.png" {
+		t.Errorf("embeds %+v", withImage.Embeds)
+	}
+}
+
+func TestDiscordErrors(t *testing.T) {
+	for _, tc := range []struct {
+		reply reply
+		want  string
+	}{
+		{reply{429, `{"message":"You are being rate limited.","retry_after":0.5}`}, `discord 429: {"message":"You are being rate limited.","retry_after":0.5}`},
+		{reply{500, "oops"}, "discord 500: oops"},
+		{reply{404, `{"message":"Unknown Webhook"}`}, `discord 404: {"message":"Unknown Webhook"}`},
+	} {
+		mock := &apiMock{replies: []reply{tc.reply}}
+		srv := httptest.NewServer(mock)
+		d := &discordSink{webhookURL: srv.URL, http: srv.Client()}
+		if err := d.Send(context.Background(), testNotification()); err == nil || err.Error() != tc.want {
+			t.Errorf("%d: err = %v, want %q", tc.reply.status, err, tc.want)
+		}
+		srv.Close()
+	}
+	// 204 is what Discord answers a webhook without ?wait.
+	mock := &apiMock{replies: []reply{{204, ""}}}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	if err := (&discordSink{webhookURL: srv.URL, http: srv.Client()}).Send(context.Background(), testNotification()); err != nil {
+		t.Errorf("204: %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// maxInlineDiffs is how many diff thumbnails a report embeds; the rows
+// after it link their diff instead, keeping the mail a sensible size.
+const maxInlineDiffs = 24
+
+// thumbWidth is the width, in pixels, diffs are embedded at.
+const thumbWidth = 240
+
+// emailSink mails a report of the job: an HTML summary with a row per
+// screen×platform and its diff inline, and a plain-text alternative. It is
+// sent the job-level events only, as a mail per screen would bury them.
+type emailSink struct {
+	smtp smtpServer
+	from string
+	to   []string
+	http *http.Client
+}
+
+func (e *emailSink) Name() string { return "email" }
+
+func (e *emailSink) Wants(event string) bool {
+	return event == events.NotifyJobDone || event == events.NotifyJobFailed
+}
+
+func (e *emailSink) Send(ctx context.Context, n Notification) error {
+	msg, err := buildMail(e.from, e.to, n, e.thumbnails(ctx, n.Screens), time.Now())
+	if err != nil {
+		return err
+	}
+	return e.smtp.send(ctx, e.from, e.to, msg)
+}
+
+// thumbnails downloads and shrinks the diffs of the first maxInlineDiffs
+// screens, by index into screens. Those that fail to download are linked
+// instead.
+func (e *emailSink) thumbnails(ctx context.Context, screens []events.ManifestScreen) map[int][]byte {
+	thumbs := make(map[int][]byte)
+	for i, s := range screens {
+		if len(thumbs) == maxInlineDiffs {
+			break
+		}
+		if s.DiffImageURL == "" {
+			continue
+		}
+		req, _ := http.NewRequestWithContext(ctx, "GET", s.DiffImageURL, nil)
+		resp, err := e.http.Do(req)
+		if err != nil {
+			continue
+		}
+		img, err := imaging.Decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if png.Encode(&buf, imaging.Resize(img, thumbWidth, 0, imaging.Lanczos)) == nil {
+			thumbs[i] = buf.Bytes()
+		}
+	}
+	return thumbs
+}
+
+// ── Report ────────────────────────────────────────────────────────────────────
+
+var reportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><body style="font-family:-apple-system,'Segoe UI',Helvetica,Arial,sans-serif;color:#111827">
+<h2 style="margin:0 0 12px">{{.Title}}</h2>
+<p style="line-height:1.5">{{.Body}}</p>
+{{- if .Rows}}
+<table cellpadding="8" style="border-collapse:collapse;font-size:14px">
+<tr style="background:#F3F4F6"><th align="left">Screen</th><th align="left">Platform</th><th align="right">Score</th><th align="right">Iterations</th><th></th><th align="left">Diff</th></tr>
+{{- range .Rows}}
+<tr style="border-top:1px solid #E5E7EB">
+<td>{{.Name}}</td><td>{{.Platform}}</td><td align="right">{{printf "%.1f%%" .BestScore}}</td><td align="right">{{.Iterations}}</td>
+<td>{{if .Passed}}<span style="background:#22C55E;color:#fff;padding:2px 8px;border-radius:9px">PASS</span>{{else}}<span style="background:#EF4444;color:#fff;padding:2px 8px;border-radius:9px">FAIL</span>{{end}}</td>
+<td>{{if .Src}}<a href="{{.DiffImageURL}}"><img src="{{.Src}}" width="{{$.ThumbWidth}}" alt="diff"></a>{{else if .DiffImageURL}}<a href="{{.DiffImageURL}}">diff</a>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+{{- end}}
+</body></html>
+`))
+
+type reportRow struct {
+	events.ManifestScreen
+	Src template.URL // cid: of the embedded thumbnail, if any
+}
+
+// inlineImage is an image part a report refers to by Content-ID.
+type inlineImage struct {
+	cid  string
+	data []byte
+}
+
+// report renders n as HTML and plain text, with the thumbs it embeds.
+func report(n Notification, thumbs map[int][]byte) (htmlBody, text string, images []inlineImage, err error) {
+	rows := make([]reportRow, len(n.Screens))
+	for i, s := range n.Screens {
+		rows[i].ManifestScreen = s
+		if data, ok := thumbs[i]; ok {
+			cid := fmt.Sprintf("diff-%d@forge", i)
+			rows[i].Src = template.URL("cid:" + cid)
+			images = append(images, inlineImage{cid, data})
+		}
+	}
+	var buf bytes.Buffer
+	err = reportHTML.Execute(&buf, map[string]any{
+		"Title":      n.Title,
+		"Body":       template.HTML(renderHTML(n.markdown())),
+		"Rows":       rows,
+		"ThumbWidth": thumbWidth / 2, // shown at half size, sharp on high-DPI screens
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var t strings.Builder
+	t.WriteString(n.Title + "\n\n" + renderText(n.markdown()) + "\n")
+	if len(n.Screens) > 0 {
+		t.WriteString("\n")
+	}
+	for _, s := range n.Screens {
+		verdict := "FAIL"
+		if s.Passed {
+			verdict = "PASS"
+		}
+		fmt.Fprintf(&t, "%-4s  %5.1f%%  %2d iter  %s [%s]", verdict, s.BestScore, s.Iterations, s.Name, s.Platform)
+		if s.DiffImageURL != "" {
+			t.WriteString("  " + s.DiffImageURL)
+		}
+		t.WriteString("\n")
+	}
+	return buf.String(), t.String(), images, nil
+}
+
+// buildMail assembles the report of n as a MIME message: the plain text
+// and HTML as alternatives, the HTML related to the images it embeds.
+func buildMail(from string, to []string, n Notification, thumbs map[int][]byte, at time.Time) ([]byte, error) {
+	htmlBody, text, images, err := report(n, thumbs)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	alt := multipart.NewWriter(&msg)
+	for _, h := range [][2]string{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", n.Title)},
+		{"Date", at.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + randomID() + "@forge>"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + alt.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+
+	if err := writeText(alt, "text/plain", text); err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		if err := writeText(alt, "text/html", htmlBody); err != nil {
+			return nil, err
+		}
+		if err := alt.Close(); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	// The related part is written aside first, since its header carries
+	// the boundary its writer picks.
+	var rel bytes.Buffer
+	related := multipart.NewWriter(&rel)
+	if err := writeText(related, "text/html", htmlBody); err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + img.cid + ">"},
+			"Content-Disposition":       {`inline; filename="` + strings.SplitN(img.cid, "@", 2)[0] + `.png"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, img.data)
+	}
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+	part, err := alt.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {`multipart/related; type="text/html"; boundary=` + related.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(rel.Bytes())
+	if err := alt.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeText adds a quoted-printable UTF-8 part of the given type to w.
+func writeText(w *multipart.Writer, contentType, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data base64-encoded, in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		w.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	w.Write([]byte(enc + "\r\n"))
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ── SMTP ──────────────────────────────────────────────────────────────────────
+
+// smtpServer is where mail is submitted. Port 465 speaks TLS from the
+// start; on any other, startTLS requires the server to upgrade the
+// connection, so mail is never sent in the clear by surprise. Without a
+// username, mail is sent unauthenticated.
+type smtpServer struct {
+	host     string
+	port     string
+	startTLS bool
+	username string
+	password string
+}
+
+func (s smtpServer) send(ctx context.Context, from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(s.host, s.port)
+	var conn net.Conn
+	var err error
+	if s.port == "465" {
+		d := &tls.Dialer{Config: &tls.Config{ServerName: s.host}}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if s.startTLS && s.port != "465" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp %s: no STARTTLS (set SMTP_STARTTLS=false to send unencrypted)", addr)
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(bareAddress(from)); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(bareAddress(rcpt)); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// bareAddress is the address of "Name <addr>", which the SMTP envelope
+// wants on its own.
+func bareAddress(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Address
+	}
+	return s
+}
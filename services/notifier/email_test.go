@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Title: "Job done — 2 screens",
+		Body:  "Average score **96.5%**",
+		Links: []Link{{Text: "Open", URL: "https://forge.test/jobs/1"}},
+		Event: events.NotifyJobDone,
+		Screens: []events.ManifestScreen{
+			{Index: 0, Name: "Home", Platform: events.PlatformReact, BestScore: 98.4, Iterations: 2, Passed: true, DiffImageURL: "https://cdn.test/0.png"},
+			{Index: 1, Name: "<Settings & more>", Platform: events.PlatformKMP, BestScore: 80, Iterations: 5, DiffImageURL: "https://cdn.test/1.png"},
+		},
+	}
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReport(t *testing.T) {
+	thumb := []byte("png")
+	htmlBody, text, images, err := report(testNotification(), map[int][]byte{0: thumb})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<h2", "Job done — 2 screens",
+		"<b>96.5%</b>",
+		`<img src="cid:diff-0@forge" width="120"`,   // the thumbnail, at half size
+		`<a href="https://cdn.test/1.png">diff</a>`, // the row without one links its diff
+		"98.4%", "80.0%", ">PASS<", ">FAIL<",
+		"&lt;Settings &amp; more&gt;",
+	} {
+		if !strings.Contains(htmlBody, want) {
+			t.Errorf("HTML lacks %q:\n%s", want, htmlBody)
+		}
+	}
+	if strings.Contains(htmlBody, "<Settings") {
+		t.Error("screen name not escaped")
+	}
+	if len(images) != 1 || images[0].cid != "diff-0@forge" || !bytes.Equal(images[0].data, thumb) {
+		t.Errorf("images %+v", images)
+	}
+
+	for _, want := range []string{
+		"Job done — 2 screens\n",
+		"PASS   98.4%   2 iter  Home [react]  https://cdn.test/0.png\n",
+		"FAIL   80.0%   5 iter  <Settings & more> [kmp]  https://cdn.test/1.png\n",
+		"https://forge.test/jobs/1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "**") {
+		t.Errorf("markdown left in the text:\n%s", text)
+	}
+}
+
+// mimePart is a leaf part of a parsed message, its body decoded.
+type mimePart struct {
+	contentType string
+	header      map[string][]string
+	body        []byte
+}
+
+// parseMail parses a message into its leaf parts, depth first, and its
+// structure: the types of the multiparts in the order they are entered.
+func parseMail(t *testing.T, raw []byte) (*mail.Message, []string, []mimePart) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var structure []string
+	var parts []mimePart
+	var walk func(contentType string, header map[string][]string, body io.Reader)
+	walk = func(contentType string, header map[string][]string, body io.Reader) {
+		mt, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("content type %q: %v", contentType, err)
+		}
+		if strings.HasPrefix(mt, "multipart/") {
+			structure = append(structure, mt)
+			r := multipart.NewReader(body, params["boundary"])
+			for {
+				p, err := r.NextRawPart()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				walk(p.Header.Get("Content-Type"), p.Header, p)
+			}
+		}
+		var data []byte
+		switch enc := textproto.MIMEHeader(header).Get("Content-Transfer-Encoding"); enc {
+		case "quoted-printable":
+			data, err = io.ReadAll(quotedprintable.NewReader(body))
+		case "base64":
+			data, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+		default:
+			t.Fatalf("%s part encoded %q", mt, enc)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimePart{mt, header, data})
+	}
+	walk(msg.Header.Get("Content-Type"), msg.Header, msg.Body)
+	return msg, structure, parts
+}
+
+func TestBuildMail(t *testing.T) {
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	thumb := testPNG(t, 4, 4)
+	raw, err := buildMail("Forge <forge@example.com>", []string{"a@example.com", "b@example.com"}, testNotification(), map[int][]byte{0: thumb}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, structure, parts := parseMail(t, raw)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Job done — 2 screens" {
+		t.Errorf("subject %q, %v", subject, err)
+	}
+	if got := msg.Header.Get("To"); got != "a@example.com, b@example.com" {
+		t.Errorf("To %q", got)
+	}
+	if date, err := msg.Header.Date(); err != nil || !date.Equal(at) {
+		t.Errorf("Date %v, %v", date, err)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@forge>") {
+		t.Errorf("Message-ID %q", msg.Header.Get("Message-ID"))
+	}
+
+	if got := strings.Join(structure, " > "); got != "multipart/alternative > multipart/related" {
+		t.Errorf("structure %s", got)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("%d parts", len(parts))
+	}
+	text, html, img := parts[0], parts[1], parts[2]
+	if text.contentType != "text/plain" || !strings.Contains(string(text.body), "PASS   98.4%") {
+		t.Errorf("first part %s:\n%s", text.contentType, text.body)
+	}
+	if html.contentType != "text/html" || !strings.Contains(string(html.body), `src="cid:diff-0@forge"`) {
+		t.Errorf("second part %s:\n%s", html.contentType, html.body)
+	}
+	if img.contentType != "image/png" || textproto.MIMEHeader(img.header).Get("Content-ID") != "<diff-0@forge>" || !bytes.Equal(img.body, thumb) {
+		t.Errorf("image part %s %v, %d bytes", img.contentType, img.header, len(img.body))
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("line of %d characters", len(line))
+		}
+	}
+}
+
+func TestBuildMailWithoutImages(t *testing.T) {
+	n := testNotification()
+	n.Screens = nil
+	raw, err := buildMail("forge@example.com", []string{"a@example.com"}, n, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, structure, parts := parseMail(t, raw)
+	if len(structure) != 1 || len(parts) != 2 || parts[0].contentType != "text/plain" || parts[1].contentType != "text/html" {
+		t.Errorf("structure %v, parts %d", structure, len(parts))
+	}
+	if strings.Contains(string(parts[1].body), "<table") {
+		t.Error("table rendered without screens")
+	}
+}
+
+// smtpMock is an SMTP server on localhost that accepts every mail, keeping
+// the commands it was sent and the message.
+type smtpMock struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	commands []string
+	data     []byte
+}
+
+func newSMTPMock(t *testing.T) *smtpMock {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &smtpMock{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+func (m *smtpMock) port() string {
+	_, port, _ := net.SplitHostPort(m.ln.Addr().String())
+	return port
+}
+
+func (m *smtpMock) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { fmt.Fprintf(conn, "%s\r\n", s) }
+	reply("220 mock ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m.mu.Lock()
+		m.commands = append(m.commands, line)
+		m.mu.Unlock()
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			reply("250-mock\r\n250 AUTH PLAIN")
+		case "AUTH":
+			reply("235 2.7.0 accepted")
+		case "MAIL", "RCPT":
+			reply("250 2.1.0 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			m.mu.Lock()
+			m.data = data.Bytes()
+			m.mu.Unlock()
+			reply("250 2.0.0 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown")
+		}
+	}
+}
+
+func (m *smtpMock) sent() ([]string, []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.commands...), m.data
+}
+
+func TestEmailSinkSendsOverSMTP(t *testing.T) {
+	diff := testPNG(t, 960, 540)
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/0.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(diff)
+	}))
+	defer cdn.Close()
+	n := testNotification()
+	n.Screens[0].DiffImageURL = cdn.URL + "/0.png"
+	n.Screens[1].DiffImageURL = cdn.URL + "/missing.png"
+
+	m := newSMTPMock(t)
+	e := &emailSink{
+		// net/smtp sends PLAIN credentials unencrypted to localhost only.
+		smtp: smtpServer{host: "127.0.0.1", port: m.port(), username: "forge", password: "secret"},
+		from: "Forge <forge@example.com>",
+		to:   []string{"Team <team@example.com>", "ops@example.com"},
+		http: cdn.Client(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Send(ctx, n); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, data := m.sent()
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00forge\x00secret"))
+	want := []string{
+		"EHLO localhost",
+		"AUTH PLAIN " + auth,
+		"MAIL FROM:<forge@example.com> BODY=8BITMIME",
+		"RCPT TO:<team@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	if len(commands) != len(want) {
+		t.Fatalf("commands %q", commands)
+	}
+	for i, c := range want {
+		// net/smtp adds BODY=8BITMIME only if the server offers it.
+		if commands[i] != c && commands[i] != strings.TrimSuffix(c, " BODY=8BITMIME") {
+			t.Errorf("command %d: %q, want %q", i, commands[i], c)
+		}
+	}
+
+	_, _, parts := parseMail(t, data)
+	var images int
+	for _, p := range parts {
+		if p.contentType != "image/png" {
+			continue
+		}
+		images++
+		img, err := png.Decode(bytes.NewReader(p.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := img.Bounds().Dx(); w != thumbWidth {
+			t.Errorf("thumbnail %dpx wide, want %d", w, thumbWidth)
+		}
+	}
+	if images != 1 {
+		t.Errorf("%d images embedded; the missing diff should be linked", images)
+	}
+}
+
+func TestEmailSinkRefusesMissingSTARTTLS(t *testing.T) {
+	m := newSMTPMock(t)
+	s := smtpServer{host: "127.0.0.1", port: m.port(), startTLS: true}
+	err := s.send(context.Background(), "forge@example.com", []string{"a@example.com"}, []byte("Subject: x\r\n\r\nx\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "no STARTTLS") {
+		t.Fatalf("err %v, want a refusal to send in the clear", err)
+	}
+	if commands, data := m.sent(); data != nil || len(commands) > 1 {
+		t.Errorf("sent %q after EHLO", commands)
+	}
+}
+
+func TestEmailSinkWantsJobEventsOnly(t *testing.T) {
+	e := &emailSink{}
+	for event, want := range map[string]bool{
+		events.NotifyJobDone:      true,
+		events.NotifyJobFailed:    true,
+		events.NotifyScreenPassed: false,
+		events.NotifyMaxIter:      false,
+	} {
+		if e.Wants(event) != want {
+			t.Errorf("Wants(%s) = %v", event, !want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"html"
+	"strings"
+)
+
+// Notification bodies use a Markdown subset every sink can show: **bold**,
+// `code` and [text](url), plus plain text and line breaks. Each sink has
+// a renderer for its own dialect, escaping what its dialect would
+// otherwise read as markup.
+
+type spanKind int
+
+const (
+	spanText spanKind = iota
+	spanBold
+	spanCode
+	spanLink
+)
+
+type span struct {
+	kind spanKind
+	text string
+	url  string // spanLink only
+}
+
+// parseMarkdown splits s into spans. Markup that is never closed is text.
+func parseMarkdown(s string) []span {
+	var out []span
+	text := func(t string) {
+		if n := len(out); n > 0 && out[n-1].kind == spanText {
+			out[n-1].text += t
+			return
+		}
+		out = append(out, span{kind: spanText, text: t})
+	}
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, "**"):
+			if end := strings.Index(s[2:], "**"); end > 0 {
+				out = append(out, span{kind: spanBold, text: s[2 : 2+end]})
+				s = s[4+end:]
+				continue
+			}
+		case s[0] == '`':
+			if end := strings.IndexByte(s[1:], '`'); end > 0 {
+				out = append(out, span{kind: spanCode, text: s[1 : 1+end]})
+				s = s[2+end:]
+				continue
+			}
+		case s[0] == '[':
+			if mid := strings.IndexByte(s, ']'); mid > 1 && strings.HasPrefix(s[mid:], "](") {
+				if end := strings.IndexByte(s[mid+2:], ')'); end > 0 {
+					out = append(out, span{kind: spanLink, text: s[1:mid], url: s[mid+2 : mid+2+end]})
+					s = s[mid+3+end:]
+					continue
+				}
+			}
+		}
+		// Plain text, up to where markup could start.
+		next := strings.IndexAny(s[1:], "*`[")
+		if next < 0 {
+			text(s)
+			break
+		}
+		text(s[:1+next])
+		s = s[1+next:]
+	}
+	return out
+}
+
+// telegramEscaper backslash-escapes every character MarkdownV2 reserves;
+// Telegram rejects the whole message over any one left bare.
+var telegramEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// renderTelegram renders md as Telegram's MarkdownV2. Code and link URLs
+// escape only what ends them, as MarkdownV2 wants.
+func renderTelegram(md string) string {
+	var b strings.Builder
+	for _, s := range parseMarkdown(md) {
+		switch s.kind {
+		case spanText:
+			b.WriteString(telegramEscaper.Replace(s.text))
+		case spanBold:
+			b.WriteString("*" + telegramEscaper.Replace(s.text) + "*")
+		case spanCode:
+			b.WriteString("`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s.text) + "`")
+		case spanLink:
+			b.WriteString("[" + telegramEscaper.Replace(s.text) + "](" + strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(s.url) + ")")
+		}
+	}
+	return b.String()
+}
+
+// slackEscaper escapes the characters Slack's mrkdwn reserves for links and
+// mentions.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// renderSlack renders md as Slack mrkdwn.
+func renderSlack(md string) string {
+	var b strings.Builder
+	for _, s := range parseMarkdown(md) {
+		switch s.kind {
+		case spanText:
+			b.WriteString(slackEscaper.Replace(s.text))
+		case spanBold:
+			b.WriteString("*" + slackEscaper.Replace(s.text) + "*")
+		case spanCode:
+			b.WriteString("`" + slackEscaper.Replace(s.text) + "`")
+		case spanLink:
+			b.WriteString("<" + s.url + "|" + strings.ReplaceAll(slackEscaper.Replace(s.text), "|", "¦") + ">")
+		}
+	}
+	return b.String()
+}
+
+// discordEscaper backslash-escapes Discord's markdown characters.
+var discordEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`, "|", `\|`, "[", `\[`, ">", `\>`)
+
+// renderDiscord renders md as Discord markdown, for an embed description,
+// where masked links work.
+func renderDiscord(md string) string {
+	var b strings.Builder
+	for _, s := range parseMarkdown(md) {
+		switch s.kind {
+		case spanText:
+			b.WriteString(discordEscaper.Replace(s.text))
+		case spanBold:
+			b.WriteString("**" + discordEscaper.Replace(s.text) + "**")
+		case spanCode:
+			b.WriteString("`" + strings.ReplaceAll(s.text, "`", "'") + "`")
+		case spanLink:
+			b.WriteString("[" + discordEscaper.Replace(s.text) + "](" + s.url + ")")
+		}
+	}
+	return b.String()
+}
+
+// renderHTML renders md as HTML, line breaks included.
+func renderHTML(md string) string {
+	var b strings.Builder
+	for _, s := range parseMarkdown(md) {
+		switch s.kind {
+		case spanText:
+			b.WriteString(strings.ReplaceAll(html.EscapeString(s.text), "\n", "<br>\n"))
+		case spanBold:
+			b.WriteString("<b>" + html.EscapeString(s.text) + "</b>")
+		case spanCode:
+			b.WriteString("<code>" + html.EscapeString(s.text) + "</code>")
+		case spanLink:
+			b.WriteString(`<a href="` + html.EscapeString(s.url) + `">` + html.EscapeString(s.text) + "</a>")
+		}
+	}
+	return b.String()
+}
+
+// renderText renders md as plain text, links spelled out.
+func renderText(md string) string {
+	var b strings.Builder
+	for _, s := range parseMarkdown(md) {
+		switch s.kind {
+		case spanLink:
+			b.WriteString(s.text + ": " + s.url)
+		default:
+			b.WriteString(s.text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/svc"
+	"github.com/rs/zerolog/log"
+)
+
+// Notification is one message, written once and rendered by each sink in
+// its own dialect.
+type Notification struct {
+	Title string
+	// Body is in the Markdown subset of parseMarkdown.
+	Body string
+	// Image is a PNG shown with the message; nil for none.
+	Image []byte
+	Links []Link
+
+	// Event is the events.Notify* the notification is of.
+	Event string
+	// Screens are the job's screen×platforms, for a job that is done.
+	Screens []events.ManifestScreen
+	// Requests are what the notification reports, for sinks that send
+	// data rather than a message: a digest's every screen.
+	Requests []*events.NotifyRequestedPayload
+}
+
+type Link struct {
+	Text string
+	URL  string
+}
+
+// markdown is the body with the links on a last line of their own.
+func (n Notification) markdown() string {
+	if len(n.Links) == 0 {
+		return n.Body
+	}
+	links := make([]string, len(n.Links))
+	for i, l := range n.Links {
+		links[i] = "[" + l.Text + "](" + l.URL + ")"
+	}
+	return n.Body + "\n" + strings.Join(links, " · ")
+}
+
+// Sink delivers notifications to one channel.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// eventSink is a Sink only sent some events.
+type eventSink interface {
+	Wants(event string) bool
+}
+
+// newSinks builds the sinks named in NOTIFY_SINKS, comma-separated. A sink
+// that isn't configured is left out with a warning, as the notifier still
+// has a use without it; an unknown name is an error.
+func newSinks(names string, client *http.Client, hooks *webhooks) ([]Sink, error) {
+	var sinks []Sink
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !slices.Contains(events.NotifySinks, name) {
+			return nil, fmt.Errorf("unknown sink %q in NOTIFY_SINKS (want %s)", name, strings.Join(events.NotifySinks, ", "))
+		}
+		s, missing := newSink(name, "", "", client, hooks)
+		if missing != "" {
+			log.Warn().Str("sink", name).Msg(missing + " not set — sink disabled")
+			continue
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// channelSinks builds the sinks of a job's channels. A channel whose
+// credentials aren't in the env is left out with a warning.
+func channelSinks(channels []events.NotifyChannel, client *http.Client, hooks *webhooks) []Sink {
+	var sinks []Sink
+	for _, ch := range channels {
+		s, missing := newSink(ch.Sink, ch.Credentials, ch.Target, client, hooks)
+		if missing != "" {
+			log.Warn().Str("sink", ch.Sink).Str("credentials", ch.Credentials).Msg(missing + " not set — channel skipped")
+			continue
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks
+}
+
+// newSink builds the named sink, one of events.NotifySinks, from the env
+// vars of the named credentials: the sink's usual ones for none. target,
+// if set, is the chat, channel or addresses to post to instead of theirs,
+// as far as the credentials' allowlist lets it. Webhook sinks deliver
+// through hooks. missing names the env vars it lacks, if any.
+func newSink(name, credentials, target string, client *http.Client, hooks *webhooks) (s Sink, missing string) {
+	env := func(key string) string {
+		return svc.EnvOr(events.CredentialsEnv(credentials, key), "")
+	}
+	or := func(v, def string) string {
+		if v != "" {
+			return v
+		}
+		return def
+	}
+	// allowed is the part of target the allowlist in env key admits.
+	allowed := func(key string) string {
+		if target == "" {
+			return ""
+		}
+		ok := allowedTargets(target, splitList(env(key)))
+		if len(splitList(ok)) < len(splitList(target)) {
+			log.Warn().Str("sink", name).Str("credentials", credentials).Str("target", target).
+				Msg("target not in " + events.CredentialsEnv(credentials, key) + " — ignoring what isn't")
+		}
+		return ok
+	}
+	switch name {
+	case events.SinkTelegram:
+		t := &telegramSink{token: env("TELEGRAM_BOT_TOKEN"), chat: or(allowed("TELEGRAM_ALLOWED_CHATS"), env("TELEGRAM_CHAT_ID")), http: client}
+		if t.token == "" || t.chat == "" {
+			missing = envNames(credentials, "TELEGRAM_BOT_TOKEN", "and", "TELEGRAM_CHAT_ID")
+		}
+		return t, missing
+	case events.SinkSlack:
+		sl := &slackSink{
+			webhookURL: env("SLACK_WEBHOOK_URL"),
+			token:      env("SLACK_BOT_TOKEN"),
+			channel:    or(allowed("SLACK_ALLOWED_CHANNELS"), env("SLACK_CHANNEL")),
+			http:       client,
+		}
+		if sl.webhookURL == "" && (sl.token == "" || sl.channel == "") {
+			missing = envNames(credentials, "SLACK_WEBHOOK_URL", ", or", "SLACK_BOT_TOKEN", "and", "SLACK_CHANNEL")
+		}
+		return sl, missing
+	case events.SinkEmail:
+		e := &emailSink{
+			smtp: smtpServer{
+				host:     env("SMTP_HOST"),
+				port:     or(env("SMTP_PORT"), "587"),
+				startTLS: env("SMTP_STARTTLS") != "false",
+				username: env("SMTP_USERNAME"),
+				password: env("SMTP_PASSWORD"),
+			},
+			from: env("EMAIL_FROM"),
+			to:   splitList(or(allowed("EMAIL_ALLOWED_TO"), env("EMAIL_TO"))),
+			http: client,
+		}
+		if e.smtp.host == "" || e.from == "" || len(e.to) == 0 {
+			missing = envNames(credentials, "SMTP_HOST,", "EMAIL_FROM", "and", "EMAIL_TO")
+		}
+		return e, missing
+	case events.SinkWebhook:
+		w := &webhookSink{urls: splitList(env("WEBHOOK_URLS")), secret: env("WEBHOOK_SECRET"), hooks: hooks}
+		if len(w.urls) == 0 {
+			missing = envNames(credentials, "WEBHOOK_URLS")
+		}
+		return w, missing
+	default:
+		d := &discordSink{webhookURL: env("DISCORD_WEBHOOK_URL"), http: client}
+		if d.webhookURL == "" {
+			missing = envNames(credentials, "DISCORD_WEBHOOK_URL")
+		}
+		return d, missing
+	}
+}
+
+// envNames joins words into a message, the upper-case ones taken as env
+// var keys and named as the credentials' vars.
+func envNames(credentials string, words ...string) string {
+	for i, w := range words {
+		if w == strings.ToUpper(w) {
+			words[i] = events.CredentialsEnv(credentials, w)
+		}
+	}
+	return strings.ReplaceAll(strings.Join(words, " "), " ,", ",")
+}
+
+// allowedTargets returns the comma-separated entries of target that allow
+// lists, rejoined: a chat or channel ID exactly, an address exactly or by
+// an "@domain" entry. A job picks its own target, so without the list it
+// could send the notifier's bot or mail server anywhere.
+func allowedTargets(target string, allow []string) string {
+	var ok []string
+	for _, t := range splitList(target) {
+		id := t
+		if addr, err := mail.ParseAddress(t); err == nil {
+			id = addr.Address
+		}
+		for _, a := range allow {
+			domain := strings.HasPrefix(a, "@")
+			if !domain && strings.EqualFold(id, a) || domain && len(id) > len(a) && strings.EqualFold(id[len(id)-len(a):], a) {
+				ok = append(ok, t)
+				break
+			}
+		}
+	}
+	return strings.Join(ok, ",")
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// sendAll sends n to every sink that wants it, each regardless of the
+// others failing. It fails only if no sink succeeded.
+func sendAll(ctx context.Context, sinks []Sink, n Notification) error {
+	sinks = slices.DeleteFunc(slices.Clone(sinks), func(s Sink) bool {
+		es, ok := s.(eventSink)
+		return ok && !es.Wants(n.Event)
+	})
+	var errs []error
+	for _, s := range sinks {
+		if err := s.Send(ctx, n); err != nil {
+			log.Error().Err(err).Str("sink", s.Name()).Msg("notification not sent")
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	if len(errs) == len(sinks) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
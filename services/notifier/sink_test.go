@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func TestAllowedTargets(t *testing.T) {
+	allow := []string{"-1001234567890", "C0123", "lead@studio.test", "@forge.test"}
+	for target, want := range map[string]string{
+		"-1001234567890":                     "-1001234567890",
+		"-100999":                            "",
+		"c0123":                              "c0123",
+		"lead@studio.test":                   "lead@studio.test",
+		"someone@studio.test":                "",
+		"a@forge.test, b@evil.test":          "a@forge.test",
+		"Ann <ann@forge.test>":               "Ann <ann@forge.test>",
+		"x@notforge.test":                    "",
+		"@forge.test":                        "",
+		"b@evil.test, LEAD@studio.test, c@x": "LEAD@studio.test",
+	} {
+		if got := allowedTargets(target, allow); got != want {
+			t.Errorf("allowedTargets(%q) = %q, want %q", target, got, want)
+		}
+	}
+	if got := allowedTargets("-1001234567890", nil); got != "" {
+		t.Errorf("no allowlist admits %q", got)
+	}
+}
+
+func TestChannelTargetNeedsTheAllowlist(t *testing.T) {
+	t.Setenv("NOTIFY_DESIGN_TELEGRAM_BOT_TOKEN", "tok")
+	t.Setenv("NOTIFY_DESIGN_TELEGRAM_CHAT_ID", "-100own")
+	t.Setenv("NOTIFY_DESIGN_SLACK_BOT_TOKEN", "xoxb")
+	t.Setenv("NOTIFY_DESIGN_SLACK_CHANNEL", "COWN")
+	t.Setenv("NOTIFY_DESIGN_SMTP_HOST", "smtp.test")
+	t.Setenv("NOTIFY_DESIGN_EMAIL_FROM", "forge@forge.test")
+	t.Setenv("NOTIFY_DESIGN_EMAIL_TO", "team@forge.test")
+	t.Setenv("NOTIFY_DESIGN_TELEGRAM_ALLOWED_CHATS", "-100team")
+	t.Setenv("NOTIFY_DESIGN_EMAIL_ALLOWED_TO", "@forge.test")
+
+	sink := func(name, target string) Sink {
+		s, missing := newSink(name, "design", target, http.DefaultClient, nil)
+		if missing != "" {
+			t.Fatalf("%s: %s missing", name, missing)
+		}
+		return s
+	}
+	if chat := sink(events.SinkTelegram, "-100team").(*telegramSink).chat; chat != "-100team" {
+		t.Errorf("allowed chat: posting to %s", chat)
+	}
+	if chat := sink(events.SinkTelegram, "-100elsewhere").(*telegramSink).chat; chat != "-100own" {
+		t.Errorf("chat not on the allowlist: posting to %s, want the credentials' own", chat)
+	}
+	// Slack has no allowlist here, so no target is taken.
+	if ch := sink(events.SinkSlack, "CANY").(*slackSink).channel; ch != "COWN" {
+		t.Errorf("slack without an allowlist: posting to %s", ch)
+	}
+	if to := sink(events.SinkEmail, "a@forge.test, b@evil.test").(*emailSink).to; !slices.Equal(to, []string{"a@forge.test"}) {
+		t.Errorf("mailing %q, want the allowed address alone", to)
+	}
+	if to := sink(events.SinkEmail, "b@evil.test").(*emailSink).to; !slices.Equal(to, []string{"team@forge.test"}) {
+		t.Errorf("mailing %q, want the credentials' own", to)
+	}
+}
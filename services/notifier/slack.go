@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const slackAPI = "https://slack.com/api/"
+
+// slackSink posts to Slack, through a bot token when one is set and an
+// incoming webhook otherwise. Only the bot can upload the image; through
+// the webhook the message carries its links alone. SLACK_CHANNEL must be
+// a channel ID, which file uploads require.
+type slackSink struct {
+	webhookURL string
+	token      string
+	channel    string
+	http       *http.Client
+}
+
+func (s *slackSink) Name() string { return "slack" }
+
+func (s *slackSink) Send(ctx context.Context, n Notification) error {
+	text := renderSlack("**" + n.Title + "**\n" + n.markdown())
+	switch {
+	case s.token == "":
+		return s.postWebhook(ctx, text)
+	case len(n.Image) > 0:
+		return s.uploadImage(ctx, text, n.Image)
+	default:
+		return s.api(ctx, "chat.postMessage", url.Values{"channel": {s.channel}, "text": {text}}, nil)
+	}
+}
+
+func (s *slackSink) postWebhook(ctx context.Context, text string) error {
+	body, _ := json.Marshal(map[string]string{"text": text})
+	req, _ := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("slack webhook %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
+
+// uploadImage shares the image in the channel with text as its comment,
+// by Slack's external upload flow: reserve an upload URL, send the bytes
+// there, then complete the upload into the channel.
+func (s *slackSink) uploadImage(ctx context.Context, text string, img []byte) error {
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	err := s.api(ctx, "files.getUploadURLExternal", url.Values{
+		"filename": {"screen.png"},
+		"length":   {strconv.Itoa(len(img))},
+	}, &upload)
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", upload.UploadURL, bytes.NewReader(img))
+	req.Header.Set("Content-Type", "image/png")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("slack upload %d", resp.StatusCode)
+	}
+
+	files, _ := json.Marshal([]map[string]string{{"id": upload.FileID, "title": "screen.png"}})
+	return s.api(ctx, "files.completeUploadExternal", url.Values{
+		"files":           {string(files)},
+		"channel_id":      {s.channel},
+		"initial_comment": {text},
+	}, nil)
+}
+
+// api calls a Slack Web API method with form-encoded args, decoding the
+// response into out if it isn't nil. Slack answers 200 even to failed
+// calls; ok in the body says which.
+func (s *slackSink) api(ctx context.Context, method string, args url.Values, out any) error {
+	req, _ := http.NewRequestWithContext(ctx, "POST", slackAPI+method, strings.NewReader(args.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("slack %s %d: %s", method, resp.StatusCode, raw)
+	}
+	var res struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	if !res.OK {
+		return fmt.Errorf("slack %s: %s", method, res.Error)
+	}
+	if out != nil {
+		return json.Unmarshal(raw, out)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSlackWebhook(t *testing.T) {
+	mock := &apiMock{}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	s := &slackSink{webhookURL: srv.URL + "/services/T0/B0/x", http: srv.Client()}
+
+	n := testNotification()
+	n.Image = testPNG(t, 4, 4) // the webhook can't carry it
+	if err := s.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	calls := mock.recorded()
+	if len(calls) != 1 || calls[0].path != "/services/T0/B0/x" || calls[0].contentType != "application/json" {
+		t.Fatalf("calls %+v", calls)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal(calls[0].body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(msg["text"], "*Job done") || !strings.Contains(msg["text"], "<https://forge.test/jobs/1|Open>") {
+		t.Errorf("text %q", msg["text"])
+	}
+}
+
+func TestSlackUploadsTheImage(t *testing.T) {
+	mock := &apiMock{replies: []reply{
+		{200, `{"ok":true,"upload_url":"https://files.slack.test/upload/v1/abc","file_id":"F123"}`},
+	}}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	s := &slackSink{token: "xoxb-1", channel: "C42", http: redirect(srv)}
+
+	n := testNotification()
+	n.Image = testPNG(t, 4, 4)
+	if err := s.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	calls := mock.recorded()
+	if len(calls) != 3 {
+		t.Fatalf("%d calls: %+v", len(calls), calls)
+	}
+	reserve, _ := url.ParseQuery(string(calls[0].body))
+	if calls[0].path != "/api/files.getUploadURLExternal" || reserve.Get("filename") != "screen.png" || reserve.Get("length") != strconv.Itoa(len(n.Image)) {
+		t.Errorf("reserved %s %v", calls[0].path, reserve)
+	}
+	if calls[1].path != "/upload/v1/abc" || calls[1].contentType != "image/png" || string(calls[1].body) != string(n.Image) {
+		t.Errorf("uploaded to %s as %s", calls[1].path, calls[1].contentType)
+	}
+	done, _ := url.ParseQuery(string(calls[2].body))
+	if calls[2].path != "/api/files.completeUploadExternal" || done.Get("channel_id") != "C42" ||
+		!strings.Contains(done.Get("files"), `"id":"F123"`) || !strings.Contains(done.Get("initial_comment"), "Job done") {
+		t.Errorf("completed %s %v", calls[2].path, done)
+	}
+}
+
+func TestSlackErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		sink  func(srv *httptest.Server) *slackSink
+		reply reply
+		want  string
+	}{
+		{"webhook rate limited", func(srv *httptest.Server) *slackSink {
+			return &slackSink{webhookURL: srv.URL + "/hook", http: srv.Client()}
+		}, reply{429, "rate_limited"}, "slack webhook 429: rate_limited"},
+		{"webhook down", func(srv *httptest.Server) *slackSink {
+			return &slackSink{webhookURL: srv.URL + "/hook", http: srv.Client()}
+		}, reply{503, "unavailable"}, "slack webhook 503: unavailable"},
+		{"api rate limited", func(srv *httptest.Server) *slackSink {
+			return &slackSink{token: "xoxb-1", channel: "C42", http: redirect(srv)}
+		}, reply{429, ""}, "slack chat.postMessage 429: "},
+		// Slack answers 200 to calls that failed.
+		{"api not ok", func(srv *httptest.Server) *slackSink {
+			return &slackSink{token: "xoxb-1", channel: "C42", http: redirect(srv)}
+		}, reply{200, `{"ok":false,"error":"channel_not_found"}`}, "slack chat.postMessage: channel_not_found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &apiMock{replies: []reply{tc.reply}}
+			srv := httptest.NewServer(mock)
+			defer srv.Close()
+			if err := tc.sink(srv).Send(context.Background(), testNotification()); err == nil || err.Error() != tc.want {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+			if n := len(mock.recorded()); n != 1 {
+				t.Errorf("%d calls", n)
+			}
+		})
+	}
+}
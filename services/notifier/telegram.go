@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+const telegramAPI = "https://api.telegram.org/bot"
+
+// maxCaption is the longest photo caption Telegram takes. It counts
+// characters after parsing, so measuring the escaped text errs short.
+const maxCaption = 1024
+
+// Calls that Telegram rate-limits, or that fail on its side, are retried:
+// after its retry_after when it gives one and backing off from
+// telegramBackoff otherwise, up to telegramAttempts in all. No wait is
+// longer than maxTelegramWait.
+const (
+	telegramAttempts = 4
+	telegramBackoff  = time.Second
+	maxTelegramWait  = time.Minute
+)
+
+// telegramSink posts to a chat through the Telegram Bot API: the image as
+// a photo captioned with the message, or the message alone.
+type telegramSink struct {
+	token string
+	chat  string
+	http  *http.Client
+}
+
+func (t *telegramSink) Name() string { return "telegram" }
+
+func (t *telegramSink) Send(ctx context.Context, n Notification) error {
+	text := renderTelegram("**" + n.Title + "**\n" + n.markdown())
+	if len(n.Image) == 0 {
+		return t.sendMessage(ctx, text)
+	}
+	if utf8.RuneCountInString(text) <= maxCaption {
+		return t.sendPhoto(ctx, text, n.Image)
+	}
+	// Too long for a caption: the photo goes with the title, the message
+	// follows on its own.
+	if err := t.sendPhoto(ctx, renderTelegram("**"+n.Title+"**"), n.Image); err != nil {
+		return err
+	}
+	return t.sendMessage(ctx, text)
+}
+
+func (t *telegramSink) sendMessage(ctx context.Context, text string) error {
+	body, _ := json.Marshal(map[string]string{
+		"chat_id":    t.chat,
+		"text":       text,
+		"parse_mode": "MarkdownV2",
+	})
+	return t.call(ctx, "sendMessage", "application/json", body)
+}
+
+func (t *telegramSink) sendPhoto(ctx context.Context, caption string, imgData []byte) error {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	_ = w.WriteField("chat_id", t.chat)
+	_ = w.WriteField("caption", caption)
+	_ = w.WriteField("parse_mode", "MarkdownV2")
+	part, _ := w.CreateFormFile("photo", "screen.png")
+	part.Write(imgData)
+	w.Close()
+	return t.call(ctx, "sendPhoto", w.FormDataContentType(), buf.Bytes())
+}
+
+// telegramError is a failed Bot API call, with how long Telegram asked to
+// wait before the next when it is rate limiting.
+type telegramError struct {
+	method     string
+	status     int
+	desc       string
+	retryAfter time.Duration
+}
+
+func (e *telegramError) Error() string {
+	return fmt.Sprintf("telegram %s %d: %s", e.method, e.status, e.desc)
+}
+
+func (e *telegramError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// call posts body to a Bot API method, retrying what Telegram rate-limits
+// or fails on its side.
+func (t *telegramSink) call(ctx context.Context, method, contentType string, body []byte) error {
+	wait := telegramBackoff
+	for attempt := 1; ; attempt++ {
+		err := t.post(ctx, method, contentType, body)
+		te, ok := err.(*telegramError)
+		if err == nil || !ok || !te.retryable() || attempt == telegramAttempts {
+			return err
+		}
+		d := wait
+		if te.retryAfter > 0 {
+			d = te.retryAfter
+		}
+		d = min(d, maxTelegramWait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+		wait *= 2
+	}
+}
+
+func (t *telegramSink) post(ctx context.Context, method, contentType string, body []byte) error {
+	req, _ := http.NewRequestWithContext(ctx, "POST", telegramAPI+t.token+"/"+method, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 200 {
+		return nil
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var res struct {
+		Description string `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	te := &telegramError{method: method, status: resp.StatusCode, desc: string(raw)}
+	if json.Unmarshal(raw, &res) == nil && res.Description != "" {
+		te.desc = res.Description
+		te.retryAfter = time.Duration(res.Parameters.RetryAfter) * time.Second
+	}
+	return te
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redirect is a client sending every request to srv instead of the host it
+// names, for the sinks whose API hosts are fixed.
+func redirect(srv *httptest.Server) *http.Client {
+	target, _ := url.Parse(srv.URL)
+	return &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// apiCall is a request an API mock received.
+type apiCall struct {
+	path        string
+	contentType string
+	body        []byte
+	form        map[string]string // multipart fields, files by filename
+}
+
+// apiMock records calls and answers each with the next of its replies,
+// then 200 with ok once they run out.
+type apiMock struct {
+	mu      sync.Mutex
+	calls   []apiCall
+	replies []reply
+}
+
+type reply struct {
+	status int
+	body   string
+}
+
+func (m *apiMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := apiCall{path: r.URL.Path, contentType: r.Header.Get("Content-Type")}
+	if strings.HasPrefix(c.contentType, "multipart/") {
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			c.form = map[string]string{}
+			for k, v := range r.MultipartForm.Value {
+				c.form[k] = v[0]
+			}
+			for k, fhs := range r.MultipartForm.File {
+				c.form[k] = fhs[0].Filename
+			}
+		}
+	} else {
+		c.body, _ = io.ReadAll(r.Body)
+	}
+	m.mu.Lock()
+	m.calls = append(m.calls, c)
+	rep := reply{200, `{"ok":true}`}
+	if len(m.replies) > 0 {
+		rep, m.replies = m.replies[0], m.replies[1:]
+	}
+	m.mu.Unlock()
+	w.WriteHeader(rep.status)
+	io.WriteString(w, rep.body)
+}
+
+func (m *apiMock) recorded() []apiCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]apiCall(nil), m.calls...)
+}
+
+func TestTelegramSendsMessageAndPhoto(t *testing.T) {
+	mock := &apiMock{}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	s := &telegramSink{token: "123:abc", chat: "-100200", http: redirect(srv)}
+
+	n := testNotification()
+	if err := s.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	n.Image = testPNG(t, 4, 4)
+	if err := s.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := mock.recorded()
+	if len(calls) != 2 {
+		t.Fatalf("%d calls", len(calls))
+	}
+	if c := calls[0]; c.path != "/bot123:abc/sendMessage" || c.contentType != "application/json" {
+		t.Errorf("message sent as %s %s", c.path, c.contentType)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal(calls[0].body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["chat_id"] != "-100200" || msg["parse_mode"] != "MarkdownV2" || !strings.Contains(msg["text"], "Job done") {
+		t.Errorf("message %v", msg)
+	}
+	c := calls[1]
+	if c.path != "/bot123:abc/sendPhoto" || c.form["chat_id"] != "-100200" || c.form["photo"] != "screen.png" || !strings.Contains(c.form["caption"], "Job done") {
+		t.Errorf("photo sent as %s %v", c.path, c.form)
+	}
+}
+
+func TestTelegramSplitsLongCaptions(t *testing.T) {
+	mock := &apiMock{}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	s := &telegramSink{token: "t", chat: "1", http: redirect(srv)}
+
+	n := testNotification()
+	n.Body = strings.Repeat("long ", maxCaption/4)
+	n.Image = testPNG(t, 4, 4)
+	if err := s.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	calls := mock.recorded()
+	if len(calls) != 2 || calls[0].path != "/bott/sendPhoto" || calls[1].path != "/bott/sendMessage" {
+		t.Fatalf("calls %+v", calls)
+	}
+	if strings.Contains(calls[0].form["caption"], "long") {
+		t.Error("the caption carries the body it is too short for")
+	}
+}
+
+func TestTelegramRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		replies []reply
+		calls   int
+		wantErr string
+	}{
+		{"rate limited", []reply{{429, `{"ok":false,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`}}, 2, ""},
+		{"server error", []reply{{502, `Bad Gateway`}}, 2, ""},
+		{"bad request", []reply{{400, `{"ok":false,"description":"Bad Request: chat not found"}`}}, 1, "telegram sendMessage 400: Bad Request: chat not found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &apiMock{replies: tc.replies}
+			srv := httptest.NewServer(mock)
+			defer srv.Close()
+			s := &telegramSink{token: "t", chat: "1", http: redirect(srv)}
+
+			start := time.Now()
+			err := s.Send(context.Background(), testNotification())
+			if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Errorf("err = %v, want %q", err, tc.wantErr)
+			}
+			if n := len(mock.recorded()); n != tc.calls {
+				t.Errorf("%d calls, want %d", n, tc.calls)
+			}
+			if tc.calls > 1 && time.Since(start) < time.Second {
+				t.Errorf("retried after %v, before the wait asked for", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestTelegramGivesUpWhenCancelled(t *testing.T) {
+	mock := &apiMock{replies: []reply{{429, `{"ok":false,"description":"slow down","parameters":{"retry_after":30}}`}}}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	s := &telegramSink{token: "t", chat: "1", http: redirect(srv)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := s.Send(ctx, testNotification())
+	if te, ok := err.(*telegramError); !ok || te.status != 429 || te.retryAfter != 30*time.Second {
+		t.Errorf("err = %v, want the 429 it was waiting out", err)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/rs/zerolog/log"
+)
+
+// signatureHeader carries the hex HMAC-SHA256 of the body under the
+// webhook secret, prefixed "sha256=", as on the orchestrator's job state
+// webhook.
+const signatureHeader = "X-Forge-Signature"
+
+// An endpoint that fails breakerThreshold attempts in a row is left alone
+// for the cool-down, then probed with a single delivery: one that gets
+// through closes the breaker again, one that fails reopens it.
+const breakerThreshold = 10
+
+// maxWebhookWait caps the backoff between attempts.
+const maxWebhookWait = time.Minute
+
+// maxDeliveryLog is how many attempts the delivery log keeps.
+const maxDeliveryLog = 200
+
+var errCircuitOpen = errors.New("circuit open")
+
+// webhookSink POSTs what a notification reports to each of its URLs as
+// JSON documents, one per screen or job event, signed when it has a
+// secret.
+type webhookSink struct {
+	urls   []string
+	secret string
+	hooks  *webhooks
+}
+
+// webhookDocument is the body of a delivery. ID is the same on every
+// attempt, and sent as the Idempotency-Key, so receivers can drop the
+// duplicates a retry may produce.
+type webhookDocument struct {
+	ID                string                  `json:"id"`
+	Event             string                  `json:"event"`
+	JobID             string                  `json:"job_id"`
+	FileName          string                  `json:"file_name,omitempty"`
+	Screen            string                  `json:"screen,omitempty"`
+	Platform          string                  `json:"platform,omitempty"`
+	Score             float64                 `json:"score"`      // the screen's, or the job's average
+	Iterations        int                     `json:"iterations"` // the screen's, or the job's total
+	Screens           int                     `json:"screens,omitempty"`
+	Error             string                  `json:"error,omitempty"`
+	DiffImageURL      string                  `json:"diff_image_url,omitempty"`
+	ReferenceImageURL string                  `json:"reference_image_url,omitempty"`
+	GeneratedImageURL string                  `json:"generated_image_url,omitempty"`
+	ManifestURL       string                  `json:"manifest_url,omitempty"`
+	Results           []events.ManifestScreen `json:"results,omitempty"`
+	Cost              *events.JobCost         `json:"cost,omitempty"`
+	At                time.Time               `json:"at"` // when the notifier sent it on
+}
+
+func (w *webhookSink) Name() string { return "webhook" }
+
+func (w *webhookSink) Send(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, p := range n.Requests {
+		doc := webhookDocument{
+			ID:                randomID(),
+			Event:             cmp.Or(p.Event, n.Event),
+			JobID:             p.JobID,
+			FileName:          p.FileName,
+			Screen:            p.ScreenName,
+			Platform:          p.Platform,
+			Score:             p.Score,
+			Iterations:        p.Iterations,
+			Screens:           p.Screens,
+			Error:             p.Error,
+			DiffImageURL:      p.DiffImageURL,
+			ReferenceImageURL: p.ReferenceImageURL,
+			GeneratedImageURL: p.GeneratedImageURL,
+			ManifestURL:       p.ManifestURL,
+			Results:           p.Results,
+			Cost:              p.Cost,
+			At:                time.Now().UTC(),
+		}
+		body, _ := json.Marshal(doc)
+		for _, u := range w.urls {
+			if err := w.hooks.deliver(ctx, u, w.secret, doc, body); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", redactURL(u), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ── Delivery ──────────────────────────────────────────────────────────────────
+
+// webhooks delivers for every webhook sink, so that an endpoint's breaker
+// and the delivery log span all the jobs and channels that post to it.
+// Failed attempts are retried, backing off from backoff, up to attempts
+// in all.
+type webhooks struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*breaker // by URL
+	log      []deliveryAttempt   // newest last
+}
+
+func newWebhooks(timeout time.Duration, attempts int, cooldown time.Duration) *webhooks {
+	return &webhooks{
+		client:   &http.Client{Timeout: timeout},
+		attempts: max(attempts, 1),
+		backoff:  time.Second,
+		cooldown: cooldown,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+type breaker struct {
+	failures  int       // attempts in a row
+	openUntil time.Time // zero while closed
+	probing   bool      // a probe is out after the cool-down
+}
+
+// deliveryAttempt is one entry of the delivery log.
+type deliveryAttempt struct {
+	ID         string    `json:"id"` // of the document
+	Event      string    `json:"event"`
+	JobID      string    `json:"job_id"`
+	Endpoint   string    `json:"endpoint"`
+	Attempt    int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// deliver POSTs body to url, retrying what may succeed on another try,
+// until it is delivered, the attempts run out or the endpoint's breaker
+// opens.
+func (h *webhooks) deliver(ctx context.Context, url, secret string, doc webhookDocument, body []byte) error {
+	wait := h.backoff
+	for attempt := 1; ; attempt++ {
+		a := deliveryAttempt{ID: doc.ID, Event: doc.Event, JobID: doc.JobID, Endpoint: redactURL(url), Attempt: attempt, At: time.Now()}
+		if !h.allow(url, a.At) {
+			a.Error = errCircuitOpen.Error()
+			h.record(url, a, false)
+			return errCircuitOpen
+		}
+		status, err := h.post(ctx, url, secret, doc, body)
+		a.Status, a.DurationMs = status, time.Since(a.At).Milliseconds()
+		if err != nil {
+			a.Error = err.Error()
+		}
+		h.record(url, a, err == nil)
+		if err == nil {
+			return nil
+		}
+		retryable := status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+		if !retryable || attempt == h.attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(min(wait, maxWebhookWait)):
+		}
+		wait *= 2
+	}
+}
+
+func (h *webhooks) post(ctx context.Context, url, secret string, doc webhookDocument, body []byte) (status int, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", doc.ID)
+	req.Header.Set("X-Forge-Event", doc.Event)
+	if secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+sign(secret, body))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// allow reports whether url may be tried now: its breaker is closed, or
+// its cool-down is over and this is the one probe.
+func (h *webhooks) allow(url string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b := h.breakers[url]
+	if b == nil || b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record logs an attempt and counts it towards url's breaker.
+func (h *webhooks) record(url string, a deliveryAttempt, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.log = append(h.log, a)
+	if len(h.log) > maxDeliveryLog {
+		h.log = h.log[len(h.log)-maxDeliveryLog:]
+	}
+
+	ev := log.Info()
+	if !ok {
+		ev = log.Warn().Str("error", a.Error)
+	}
+	ev = ev.Str("job", a.JobID).Str("event", a.Event).Str("delivery", a.ID).Str("endpoint", a.Endpoint).
+		Int("attempt", a.Attempt).Int("status", a.Status).Int64("duration_ms", a.DurationMs)
+	if a.Error == errCircuitOpen.Error() {
+		ev.Msg("webhook delivery skipped")
+		return
+	}
+
+	b := h.breakers[url]
+	if b == nil {
+		b = &breaker{}
+		h.breakers[url] = b
+	}
+	b.probing = false
+	if ok {
+		b.failures, b.openUntil = 0, time.Time{}
+		ev.Msg("webhook delivered")
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = a.At.Add(h.cooldown)
+		ev.Time("open_until", b.openUntil).Msg("webhook delivery failed — circuit open")
+		return
+	}
+	ev.Msg("webhook delivery failed")
+}
+
+// ── Delivery log ──────────────────────────────────────────────────────────────
+
+// endpointState is an endpoint's breaker, as the delivery log shows it.
+type endpointState struct {
+	Endpoint  string     `json:"endpoint"`
+	Failures  int        `json:"failures"`
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+// deliveries serves the delivery log, at GET /webhooks on the admin
+// server: every endpoint's breaker and the latest attempts, newest first.
+func (h *webhooks) deliveries(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	endpoints := make([]endpointState, 0, len(h.breakers))
+	for u, b := range h.breakers {
+		s := endpointState{Endpoint: redactURL(u), Failures: b.failures}
+		if !b.openUntil.IsZero() {
+			until := b.openUntil
+			s.OpenUntil = &until
+		}
+		endpoints = append(endpoints, s)
+	}
+	attempts := make([]deliveryAttempt, len(h.log))
+	for i, a := range h.log {
+		attempts[len(h.log)-1-i] = a
+	}
+	h.mu.Unlock()
+
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Endpoint < endpoints[j].Endpoint })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"endpoints": endpoints, "deliveries": attempts})
+}
+
+// redactURL is u without its query or user info, which may hold secrets,
+// for logs.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	return parsed.Scheme + "://" + parsed.Host + parsed.Path
+}
+
+// sign returns the hex HMAC-SHA256 of body under secret.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/jobdb"
 	"github.com/google/uuid"
 )
 
@@ -14,6 +15,7 @@ func (o *Orchestrator) serveAPI(ctx context.Context) error {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("POST /api/jobs", o.handleCreateJob)
+	mux.HandleFunc("POST /api/jobs/{id}/retry", o.handleRetryJob)
 	mux.HandleFunc("GET /api/status", o.handleStatus)
 	mux.HandleFunc("/ws", o.hub.ServeWS)
 
@@ -44,11 +46,29 @@ func (o *Orchestrator) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		Platforms []string `json:"platforms"`
 		Styling   string   `json:"styling"`
 		Threshold int      `json:"threshold"`
+
+		PromptPrefix   string `json:"prompt_prefix"`
+		SystemOverride string `json:"system_override"`
+
+		Tolerance      *events.DiffTolerance  `json:"tolerance"`
+		Background     string                 `json:"background"`
+		ExportScale    float64                `json:"export_scale"`
+		IgnoreRegions  []events.Box           `json:"ignore_regions"`
+		DiffResolution int                    `json:"diff_resolution"`
+		Capture        *events.CaptureOptions `json:"capture"`
+		Diff           *events.DiffConfig     `json:"diff"`
+		SandboxEnv     map[string]string      `json:"sandbox_env"`
+		PresetCode     map[int]string         `json:"preset_code"`
+
+		References      []events.ReferenceScreen `json:"references"`
+		ReferenceImages map[int]string           `json:"reference_images"`
+
+		Notifications *events.NotifyConfig `json:"notifications"`
+		Priority      int                  `json:"priority"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonErr(w, "invalid body", 400); return
+		jsonErrors(w, events.DecodeErrors(err)); return
 	}
-	if req.FigmaURL == "" { jsonErr(w, "figma_url required", 400); return }
 	if len(req.Platforms) == 0 { req.Platforms = []string{events.PlatformReact, events.PlatformKMP} }
 	if req.Styling   == "" { req.Styling = "tailwind" }
 	if req.Threshold == 0  { req.Threshold = o.cfg.DefaultThreshold }
@@ -57,19 +77,49 @@ func (o *Orchestrator) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		JobID: uuid.New().String(), FigmaURL: req.FigmaURL,
 		RepoURL: req.RepoURL, Platforms: req.Platforms,
 		Styling: req.Styling, Threshold: req.Threshold,
+		PromptPrefix: req.PromptPrefix, SystemOverride: req.SystemOverride,
+		Tolerance: req.Tolerance, Background: req.Background,
+		ExportScale: req.ExportScale, IgnoreRegions: req.IgnoreRegions,
+		DiffResolution: req.DiffResolution, Capture: req.Capture,
+		Diff: req.Diff, Notifications: req.Notifications,
+		SandboxEnv: req.SandboxEnv, PresetCode: req.PresetCode,
+		References: req.References, ReferenceImages: req.ReferenceImages,
+		Priority: req.Priority,
+	}
+	if errs := events.ValidateJob(p); errs != nil {
+		jsonErrors(w, errs); return
 	}
 	b, _ := events.Wrap(events.JobSubmitted, p)
-	if err := o.broker.Publish(r.Context(), events.JobSubmitted, b); err != nil {
+	if err := o.broker.PublishWithPriority(r.Context(), events.JobSubmitted, b, uint8(p.Priority)); err != nil {
 		jsonErr(w, "queue error", 500); return
 	}
 	jsonOK(w, map[string]any{"job_id": p.JobID, "status": "queued"}, 201)
 }
 
+func (o *Orchestrator) handleRetryJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !jobdb.ValidID(id) {
+		jsonErr(w, "invalid job id", 400); return
+	}
+	if o.job(id) != nil {
+		jsonErr(w, "job is still running", 409); return
+	}
+	b, _ := events.Wrap(events.JobRetryRequested, events.JobRetryRequestedPayload{JobID: id})
+	if err := o.broker.Publish(r.Context(), events.JobRetryRequested, b); err != nil {
+		jsonErr(w, "queue error", 500); return
+	}
+	jsonOK(w, map[string]any{"job_id": id, "status": "queued"}, 202)
+}
+
 func (o *Orchestrator) handleStatus(w http.ResponseWriter, r *http.Request) {
 	o.mu.RLock()
 	active := len(o.jobs)
 	o.mu.RUnlock()
-	jsonOK(w, map[string]any{"status": "online", "active_jobs": active}, 200)
+	jsonOK(w, map[string]any{
+		"status": "online", "active_jobs": active,
+		"clients": o.hub.Clients(), "dropped": o.hub.Dropped(),
+		"store_writes": o.writes.stats(),
+	}, 200)
 }
 
 func jsonOK(w http.ResponseWriter, v any, code int) {
@@ -84,6 +134,12 @@ func jsonErr(w http.ResponseWriter, msg string, code int) {
 	json.NewEncoder(w).Encode(map[string]string{"error": msg})
 }
 
+func jsonErrors(w http.ResponseWriter, errs map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{"errors": errs})
+}
+
 func cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
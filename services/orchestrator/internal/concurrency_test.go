@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// standing is an Orchestrator that isn't running, for calling its handlers
+// straight: its job is submitted and parsed, and the job.done and
+// screen.done events it publishes are kept on done and screens.
+type standing struct {
+	t       *testing.T
+	o       *Orchestrator
+	id      string
+	done    <-chan amqp.Delivery
+	screens <-chan amqp.Delivery
+}
+
+func newStanding(t *testing.T, screens int, platforms ...string) *standing {
+	t.Helper()
+	bus := mq.NewMemory()
+	t.Cleanup(bus.Close)
+	o, err := newOrchestrator(Config{APIPort: "0", MaxIter: 5, DefaultThreshold: 95, StoreQueue: 1000}, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(o.Close)
+	o.store.db = newFakeDB()
+	s := &standing{t: t, o: o, id: uuid.NewString()}
+	if s.done, err = bus.Subscribe("test.done", events.JobDone); err != nil {
+		t.Fatal(err)
+	}
+	if s.screens, err = bus.Subscribe("test.screens", events.ScreenDone); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.deliver(o.onJobSubmitted, events.JobSubmitted, events.JobSubmittedPayload{
+		JobID:     s.id,
+		FigmaURL:  "https://www.figma.com/file/abc/Test",
+		Platforms: platforms,
+		Threshold: 95,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	parsed := events.FigmaParsedPayload{JobID: s.id, FileName: "Test", ScreenCount: screens}
+	for i := 0; i < screens; i++ {
+		parsed.Screens = append(parsed.Screens, events.FigmaScreen{
+			NodeID:        fmt.Sprintf("1:%d", i),
+			Name:          fmt.Sprintf("Screen %d", i),
+			ComponentName: fmt.Sprintf("Screen%d", i),
+			Width:         390,
+			Height:        844,
+		})
+	}
+	if err := s.deliver(o.onFigmaParsed, events.FigmaParsed, parsed); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// deliver hands handler an event key of payload, as consume would. Its
+// error is returned for the caller to judge.
+func (s *standing) deliver(handler func(context.Context, amqp.Delivery) error, key string, payload any) error {
+	body, err := events.Wrap(key, payload)
+	if err != nil {
+		s.t.Fatalf("wrap %s: %v", key, err)
+	}
+	return handler(context.Background(), amqp.Delivery{RoutingKey: key, Body: body})
+}
+
+// count reads deliveries until none has come for a while and returns how
+// many there were. The handlers publish before they return, so once they
+// have, what is there to read is all there will be.
+func count(deliveries <-chan amqp.Delivery) int {
+	n := 0
+	for {
+		select {
+		case d := <-deliveries:
+			_ = d.Ack(false)
+			n++
+		case <-time.After(200 * time.Millisecond):
+			return n
+		}
+	}
+}
+
+// progress returns the job's Completed and TotalWork, or ok false once the
+// job is complete.
+func (s *standing) progress() (completed, total int, ok bool) {
+	js := s.o.job(s.id)
+	if js == nil {
+		return 0, 0, false
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.Completed, js.TotalWork, true
+}
+
+func TestHandlersConcurrentlyOnOneJob(t *testing.T) {
+	platforms := []string{events.PlatformReact, events.PlatformNextJS, events.PlatformKMP}
+	s := newStanding(t, 3, platforms...)
+	o := s.o
+
+	// Every unit gets its events at once, the way redeliveries and stale
+	// retries can land together, while the job's state is read.
+	var wg sync.WaitGroup
+	for screen := 0; screen < 3; screen++ {
+		for _, platform := range platforms {
+			screen, platform := screen, platform
+			scr := events.FigmaScreen{Name: fmt.Sprintf("Screen %d", screen), ComponentName: fmt.Sprintf("Screen%d", screen)}
+			handlers := []func(){
+				func() {
+					_ = s.deliver(o.onCodegenComplete, events.CodegenComplete, events.CodegenCompletePayload{
+						JobID: s.id, ScreenIndex: screen, Platform: platform, Iteration: 1,
+						Code: "export default function X() {}", Filename: "X.tsx", Threshold: 95, Screen: scr,
+					})
+				},
+				func() {
+					_ = s.deliver(o.onDiffComplete, events.DiffComplete, events.DiffCompletePayload{
+						JobID: s.id, ScreenIndex: screen, Platform: platform, Iteration: 1,
+						Diff: events.DiffResult{Score: 99}, Threshold: 95, Passed: true, Screen: scr,
+					})
+				},
+				func() {
+					_ = s.deliver(o.onCodegenFailed, events.CodegenFailed, events.CodegenFailedPayload{
+						JobID: s.id, ScreenIndex: screen, Platform: platform, Error: "upstream 500",
+						Usage: []events.TokenUsage{{Provider: "fake:model", InputTokens: 10}},
+					})
+				},
+				func() {
+					_ = s.deliver(o.onSandboxFailed, events.SandboxFailed, events.SandboxFailedPayload{
+						JobID: s.id, ScreenIndex: screen, Platform: platform, Iteration: 1, Error: "no base image",
+					})
+				},
+				func() {
+					_ = s.deliver(o.onDiffFailed, events.DiffFailed, events.DiffFailedPayload{
+						JobID: s.id, ScreenIndex: screen, Platform: platform, Iteration: 1, Error: "capture failed",
+					})
+				},
+				func() {
+					o.handleStatus(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil))
+					if js := o.job(s.id); js != nil {
+						js.manifest(s.id, 0)
+						js.nextScreen(s.id, 0, platform)
+					}
+				},
+			}
+			for _, h := range handlers {
+				for i := 0; i < 2; i++ {
+					wg.Add(1)
+					go func(h func()) {
+						defer wg.Done()
+						h()
+					}(h)
+				}
+			}
+		}
+	}
+	wg.Wait()
+
+	if completed, total, ok := s.progress(); ok {
+		t.Fatalf("job still running with %d of %d units done", completed, total)
+	}
+	if n := count(s.done); n != 1 {
+		t.Errorf("%d job.done events, want 1", n)
+	}
+	if n := count(s.screens); n != 9 {
+		t.Errorf("%d screen.done events, want one per screen×platform", n)
+	}
+}
+
+func TestConcurrentJobsKeepTheirTotals(t *testing.T) {
+	h := newHarness(t, Config{}, 3)
+	h.score = func(p *events.DiffRequestedPayload) float64 {
+		if p.Iteration == 1 {
+			return 80
+		}
+		return 97
+	}
+
+	platforms := []string{events.PlatformReact, events.PlatformNextJS, events.PlatformKMP}
+	ids := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		ids[h.submit(platforms...)] = true
+	}
+	// until reads past the other jobs' job.done, so they are collected
+	// from what was seen.
+	done := map[string]*events.JobDonePayload{}
+	perJob := map[string]int{}
+	for id := range ids {
+		if perJob[id] == 0 {
+			until[events.JobDonePayload](h, events.JobDone, id)
+		}
+		for k := range perJob {
+			delete(perJob, k)
+		}
+		for _, p := range payloads[events.JobDonePayload](h, events.JobDone) {
+			done[p.JobID] = p
+			perJob[p.JobID]++
+		}
+	}
+	if len(done) != len(ids) {
+		t.Fatalf("%d of %d jobs done", len(done), len(ids))
+	}
+	for id, p := range done {
+		if perJob[id] != 1 {
+			t.Errorf("job %s: %d job.done events", id, perJob[id])
+		}
+		if p.Screens != 3 || len(p.Platforms) != 3 || p.TotalIter != 18 || p.AvgScore != 97 {
+			t.Errorf("job %s: %d screens × %d platforms, %d iterations, avg %.1f; want 3 × 3, 18, 97",
+				id, p.Screens, len(p.Platforms), p.TotalIter, p.AvgScore)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDuplicateFailuresCompleteJobOnce(t *testing.T) {
+	s := newStanding(t, 1, events.PlatformReact, events.PlatformNextJS)
+	o := s.o
+	must := func(deliver func() error) {
+		t.Helper()
+		if err := deliver(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	codegenFailed := func(platform string) func() error {
+		return func() error {
+			return s.deliver(o.onCodegenFailed, events.CodegenFailed, events.CodegenFailedPayload{
+				JobID: s.id, Platform: platform, Error: "upstream 500",
+			})
+		}
+	}
+	sandboxFailed := func(platform string) func() error {
+		return func() error {
+			return s.deliver(o.onSandboxFailed, events.SandboxFailed, events.SandboxFailedPayload{
+				JobID: s.id, Platform: platform, Iteration: 1, Error: "no base image",
+			})
+		}
+	}
+	diffFailed := func(platform string) func() error {
+		return func() error {
+			return s.deliver(o.onDiffFailed, events.DiffFailed, events.DiffFailedPayload{
+				JobID: s.id, Platform: platform, Iteration: 1, Error: "capture failed",
+			})
+		}
+	}
+
+	// One unit fails, then its redelivery and the stale failures of its
+	// other stages arrive: it is counted once, and the job waits for the
+	// other platform.
+	for _, f := range []func() error{
+		codegenFailed(events.PlatformReact), codegenFailed(events.PlatformReact),
+		sandboxFailed(events.PlatformReact), diffFailed(events.PlatformReact),
+	} {
+		must(f)
+		if completed, total, ok := s.progress(); !ok || completed != 1 {
+			t.Fatalf("after a duplicate failure: completed %d of %d, running %v; want 1 of 2", completed, total, ok)
+		}
+	}
+	if n := count(s.done); n != 0 {
+		t.Fatalf("%d job.done events with one platform left", n)
+	}
+
+	// The last unit completes the job, and replays after that are no-ops.
+	for _, f := range []func() error{
+		diffFailed(events.PlatformNextJS), diffFailed(events.PlatformNextJS),
+		codegenFailed(events.PlatformReact), sandboxFailed(events.PlatformNextJS),
+	} {
+		must(f)
+	}
+	if _, _, ok := s.progress(); ok {
+		t.Fatal("job still running with every unit failed")
+	}
+	if n := count(s.done); n != 1 {
+		t.Errorf("%d job.done events, want 1", n)
+	}
+	if n := count(s.screens); n != 2 {
+		t.Errorf("%d screen.done events, want one per screen×platform", n)
+	}
+}
+
+func TestLateEventsDoNotReopenFinishedScreen(t *testing.T) {
+	s := newStanding(t, 2, events.PlatformReact)
+	o := s.o
+	subscribe := func(key string) <-chan amqp.Delivery {
+		t.Helper()
+		ch, err := o.broker.Subscribe("test."+key, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ch
+	}
+	codegens, builds, diffs := subscribe(events.CodegenRequested), subscribe(events.SandboxBuildRequested), subscribe(events.DiffRequested)
+	scr := events.FigmaScreen{Name: "Screen 0", ComponentName: "Screen0"}
+	diffComplete := func(screen int, score float64) error {
+		return s.deliver(o.onDiffComplete, events.DiffComplete, events.DiffCompletePayload{
+			JobID: s.id, ScreenIndex: screen, Platform: events.PlatformReact, Iteration: 1,
+			Diff: events.DiffResult{Score: score}, Threshold: 95, Passed: score >= 95, Screen: scr,
+		})
+	}
+
+	if err := diffComplete(0, 99); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(codegens); n != 1 {
+		t.Fatalf("%d codegen.requested after screen 0 passed, want screen 1's", n)
+	}
+
+	// Screen 0's failing diff is redelivered late, along with a stale
+	// iteration's code and sandbox: none of them may refine it again.
+	for _, replay := range []func() error{
+		func() error { return diffComplete(0, 80) },
+		func() error {
+			return s.deliver(o.onCodegenComplete, events.CodegenComplete, events.CodegenCompletePayload{
+				JobID: s.id, ScreenIndex: 0, Platform: events.PlatformReact, Iteration: 2,
+				Code: "export default function Screen0() {}", Filename: "Screen0.tsx", Threshold: 95, Screen: scr,
+			})
+		},
+		func() error {
+			return s.deliver(o.onSandboxReady, events.SandboxReady, events.SandboxReadyPayload{
+				JobID: s.id, ScreenIndex: 0, Platform: events.PlatformReact, Iteration: 2,
+				URL: "http://sandbox:3000", ContainerID: "abc", Threshold: 95, Screen: scr,
+			})
+		},
+	} {
+		if err := replay(); err != nil {
+			t.Fatalf("a late event for a finished screen failed, to be redelivered forever: %v", err)
+		}
+	}
+	if n := count(codegens) + count(builds) + count(diffs); n != 0 {
+		t.Errorf("%d pipeline events for a finished screen", n)
+	}
+	if completed, _, ok := s.progress(); !ok || completed != 1 {
+		t.Errorf("completed %d, running %v; want screen 0 counted once and the job running", completed, ok)
+	}
+
+	// Once the job is done, its late events are dropped too.
+	if err := diffComplete(1, 99); err != nil {
+		t.Fatal(err)
+	}
+	if err := diffComplete(1, 80); err != nil {
+		t.Errorf("late diff.complete after the job finished: %v", err)
+	}
+	if n := count(codegens); n != 0 {
+		t.Errorf("%d codegen.requested after the job finished", n)
+	}
+	if n := count(s.done); n != 1 {
+		t.Errorf("%d job.done events, want 1", n)
+	}
+	if n := count(s.screens); n != 2 {
+		t.Errorf("%d screen.done events, want one per screen", n)
+	}
+}
+
+func TestLintWarningsReachTheNextPrompt(t *testing.T) {
+	s := newStanding(t, 1, events.PlatformReact)
+	o := s.o
+	codegens, err := o.broker.Subscribe("test.codegen", events.CodegenRequested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scr := events.FigmaScreen{Name: "Screen 0", ComponentName: "Screen0"}
+	// next generates iteration's code with warnings, fails to compile it
+	// and returns the request for the iteration after.
+	next := func(iteration int, warnings ...string) *events.CodegenRequestedPayload {
+		t.Helper()
+		if err := s.deliver(o.onCodegenComplete, events.CodegenComplete, events.CodegenCompletePayload{
+			JobID: s.id, ScreenIndex: 0, Platform: events.PlatformReact, Iteration: iteration,
+			Code: fmt.Sprintf("export default function Screen0() { return <p>%d</p> }", iteration), Filename: "Screen0.tsx",
+			Threshold: 95, Screen: scr, Warnings: warnings,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.deliver(o.onSandboxFailed, events.SandboxFailed, events.SandboxFailedPayload{
+			JobID: s.id, ScreenIndex: 0, Platform: events.PlatformReact, Iteration: iteration,
+			Error: "build failed", CompileError: "Screen0.tsx(1,40): error TS1005", Screen: scr,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case d := <-codegens:
+			d.Ack(false)
+			p, err := events.UnwrapChecked[events.CodegenRequestedPayload](d.Body, events.CodegenRequested)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		case <-time.After(time.Second):
+			t.Fatalf("no codegen.requested after iteration %d", iteration)
+			return nil
+		}
+	}
+
+	p := next(1, "unclosed '{' at end of code")
+	if p.Iteration != 2 || len(p.Warnings) != 1 || p.Warnings[0] != "unclosed '{' at end of code" || p.BuildError == "" {
+		t.Errorf("iteration %d asked with warnings %q and build error %q", p.Iteration, p.Warnings, p.BuildError)
+	}
+	if p := next(2); p.Warnings != nil {
+		t.Errorf("iteration 3 repeats warnings %q about code that had none", p.Warnings)
+	}
+}
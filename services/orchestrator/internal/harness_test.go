@@ -0,0 +1,454 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+)
+
+// TestMain silences the orchestrator's logs: the harness's traces say
+// what happened.
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// fakeDB is a storeDB kept in memory. Rows of a table with upsertKeys
+// replace those with the same key, as ON CONFLICT does in Postgres.
+type fakeDB struct {
+	mu   sync.Mutex
+	rows map[string][]map[string]any
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{rows: make(map[string][]map[string]any)}
+}
+
+func (f *fakeDB) insert(_ context.Context, table string, rows []map[string]any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, row := range rows {
+		row = cloneRow(row)
+		if i := f.find(table, row); i >= 0 {
+			f.rows[table][i] = row
+			continue
+		}
+		f.rows[table] = append(f.rows[table], row)
+	}
+	return nil
+}
+
+// find returns the index of table's row with row's upsert key, or -1.
+func (f *fakeDB) find(table string, row map[string]any) int {
+	keys := upsertKeys[table]
+	if len(keys) == 0 {
+		return -1
+	}
+next:
+	for i, r := range f.rows[table] {
+		for _, k := range keys {
+			if !reflect.DeepEqual(r[k], row[k]) {
+				continue next
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+func (f *fakeDB) updateJob(_ context.Context, jobID string, fields map[string]any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i := f.find("jobs", map[string]any{"id": jobID}); i >= 0 {
+		for k, v := range fields {
+			f.rows["jobs"][i][k] = v
+		}
+	}
+	return nil
+}
+
+func (f *fakeDB) loadJob(_ context.Context, jobID string) (*storedJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.find("jobs", map[string]any{"id": jobID})
+	if i < 0 {
+		return nil, nil
+	}
+	var j storedJob
+	return &j, remarshal(f.rows["jobs"][i], &j)
+}
+
+func (f *fakeDB) loadIterations(_ context.Context, jobID string) ([]storedIteration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []storedIteration
+	for _, r := range f.rows["iterations"] {
+		if r["job_id"] != jobID {
+			continue
+		}
+		var it storedIteration
+		if err := remarshal(r, &it); err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+// table returns a copy of table's rows of job jobID.
+func (f *fakeDB) table(table, jobID string) []map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	col := "job_id"
+	if table == "jobs" {
+		col = "id"
+	}
+	var out []map[string]any
+	for _, r := range f.rows[table] {
+		if r[col] == jobID {
+			out = append(out, cloneRow(r))
+		}
+	}
+	return out
+}
+
+func cloneRow(row map[string]any) map[string]any {
+	c := make(map[string]any, len(row))
+	for k, v := range row {
+		c[k] = v
+	}
+	return c
+}
+
+func remarshal(from, to any) error {
+	b, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
+
+// traced is an event as the trace queue saw it.
+type traced struct {
+	key  string
+	body []byte
+}
+
+// harness runs an Orchestrator on an mq.Memory with fake figma-parser,
+// codegen, sandbox and differ services answering its requests, and a
+// fakeDB for its store.
+type harness struct {
+	t   *testing.T
+	bus *mq.Memory
+	o   *Orchestrator
+	db  *fakeDB
+
+	trace <-chan amqp.Delivery
+	seen  []traced // read from trace so far
+
+	// screens is what the fake parser finds in every file.
+	screens []events.FigmaScreen
+	// score is what the fake differ scores an iteration; it passes at the
+	// request's threshold.
+	score func(p *events.DiffRequestedPayload) float64
+}
+
+// newHarness starts the orchestrator with cfg, the harness's defaults
+// filled in, and a fake parser finding screens screens.
+func newHarness(t *testing.T, cfg Config, screens int) *harness {
+	t.Helper()
+	if cfg.APIPort == "" {
+		cfg.APIPort = "0"
+	}
+	if cfg.MaxIter == 0 {
+		cfg.MaxIter = 5
+	}
+	if cfg.DefaultThreshold == 0 {
+		cfg.DefaultThreshold = 95
+	}
+	if cfg.StoreQueue == 0 {
+		cfg.StoreQueue = 1000
+	}
+	if cfg.NoReferencePolicy == "" {
+		cfg.NoReferencePolicy = "skip"
+	}
+
+	bus := mq.NewMemory()
+	o, err := newOrchestrator(cfg, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &harness{
+		t:     t,
+		bus:   bus,
+		o:     o,
+		db:    newFakeDB(),
+		score: func(*events.DiffRequestedPayload) float64 { return 100 },
+	}
+	o.store.db = h.db
+	for i := 0; i < screens; i++ {
+		h.screens = append(h.screens, events.FigmaScreen{
+			NodeID:        fmt.Sprintf("1:%d", i),
+			Name:          fmt.Sprintf("Screen %d", i),
+			ComponentName: fmt.Sprintf("Screen%d", i),
+			Width:         390,
+			Height:        844,
+			ExportURL:     fmt.Sprintf("https://figma.test/export/%d.png", i),
+		})
+	}
+
+	if h.trace, err = bus.Subscribe("test.trace", "#"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.fakeServices(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- o.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("orchestrator: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("orchestrator did not stop")
+		}
+		o.Close()
+	})
+
+	// Run subscribes in order: once the last queue is there, every event
+	// reaches it.
+	h.eventually("orchestrator subscribed", func() bool {
+		_, err := bus.QueueDepth("orch.log.relay")
+		return err == nil
+	})
+	return h
+}
+
+// fakeServices answers the orchestrator's requests as the services would.
+// Codegen writes different code every iteration, or the orchestrator
+// would call the screen stuck.
+func (h *harness) fakeServices(ctx context.Context) {
+	h.fake(ctx, "fake.figma", events.ParseFigmaRequested, func(body []byte) (string, any, error) {
+		p, err := events.UnwrapChecked[events.ParseFigmaRequestedPayload](body, events.ParseFigmaRequested)
+		if err != nil {
+			return "", nil, err
+		}
+		return events.FigmaParsed, events.FigmaParsedPayload{
+			JobID:       p.JobID,
+			FileName:    "Test",
+			Screens:     h.screens,
+			ScreenCount: len(h.screens),
+		}, nil
+	})
+	h.fake(ctx, "fake.codegen", events.CodegenRequested, func(body []byte) (string, any, error) {
+		p, err := events.UnwrapChecked[events.CodegenRequestedPayload](body, events.CodegenRequested)
+		if err != nil {
+			return "", nil, err
+		}
+		return events.CodegenComplete, events.CodegenCompletePayload{
+			JobID:       p.JobID,
+			ScreenIndex: p.ScreenIndex,
+			Platform:    p.Platform,
+			Iteration:   p.Iteration,
+			Code:        fmt.Sprintf("export default function %s() { return %d }", p.Screen.ComponentName, p.Iteration),
+			Filename:    p.Screen.ComponentName + ".tsx",
+			Threshold:   p.Threshold,
+			Screen:      p.Screen,
+			Provider:    "fake:model",
+			Usage:       []events.TokenUsage{{Provider: "fake:model", InputTokens: 1000, OutputTokens: 500}},
+		}, nil
+	})
+	h.fake(ctx, "fake.sandbox", events.SandboxBuildRequested, func(body []byte) (string, any, error) {
+		p, err := events.UnwrapChecked[events.SandboxBuildRequestedPayload](body, events.SandboxBuildRequested)
+		if err != nil {
+			return "", nil, err
+		}
+		return events.SandboxReady, events.SandboxReadyPayload{
+			JobID:       p.JobID,
+			ScreenIndex: p.ScreenIndex,
+			Platform:    p.Platform,
+			Iteration:   p.Iteration,
+			ContainerID: fmt.Sprintf("c-%d-%s", p.ScreenIndex, p.Platform),
+			Port:        3000,
+			URL:         "http://sandbox.test:3000",
+			Threshold:   p.Threshold,
+			Screen:      p.Screen,
+		}, nil
+	})
+	h.fake(ctx, "fake.differ", events.DiffRequested, func(body []byte) (string, any, error) {
+		p, err := events.UnwrapChecked[events.DiffRequestedPayload](body, events.DiffRequested)
+		if err != nil {
+			return "", nil, err
+		}
+		s := h.score(p)
+		return events.DiffComplete, events.DiffCompletePayload{
+			JobID:       p.JobID,
+			ScreenIndex: p.ScreenIndex,
+			Platform:    p.Platform,
+			Iteration:   p.Iteration,
+			ContainerID: p.ContainerID,
+			Diff:        events.DiffResult{Score: s, Layout: s, Typography: s, Spacing: s, Color: s, SSIM: s, PHash: s},
+			Threshold:   p.Threshold,
+			Passed:      s >= float64(p.Threshold),
+			Screen:      p.Screen,
+		}, nil
+	})
+}
+
+// fake consumes pattern on queue, publishing what respond returns for
+// every delivery.
+func (h *harness) fake(ctx context.Context, queue, pattern string, respond func(body []byte) (string, any, error)) {
+	h.t.Helper()
+	deliveries, err := h.bus.Subscribe(queue, pattern)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	go func() {
+		for d := range deliveries {
+			key, payload, err := respond(d.Body)
+			_ = d.Ack(false)
+			if err != nil {
+				h.t.Errorf("%s: %v", queue, err)
+				continue
+			}
+			h.publish(ctx, key, payload)
+		}
+	}()
+}
+
+func (h *harness) publish(ctx context.Context, key string, payload any) {
+	body, err := events.Wrap(key, payload)
+	if err != nil {
+		h.t.Errorf("wrap %s: %v", key, err)
+		return
+	}
+	if err := h.bus.Publish(ctx, key, body); err != nil && ctx.Err() == nil {
+		h.t.Errorf("publish %s: %v", key, err)
+	}
+}
+
+// submit publishes a job for platforms and returns its ID.
+func (h *harness) submit(platforms ...string) string {
+	id := uuid.NewString()
+	h.publish(context.Background(), events.JobSubmitted, events.JobSubmittedPayload{
+		JobID:     id,
+		FigmaURL:  "https://www.figma.com/file/abc/Test",
+		Platforms: platforms,
+		Threshold: h.o.cfg.DefaultThreshold,
+	})
+	return id
+}
+
+// until reads the trace up to the first event key of job jobID and
+// returns its payload.
+func until[T any](h *harness, key, jobID string) *T {
+	h.t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case d := <-h.trace:
+			_ = d.Ack(false)
+			h.seen = append(h.seen, traced{d.RoutingKey, d.Body})
+			if d.RoutingKey != key {
+				continue
+			}
+			p := unwrap[T](h.t, d.Body, key)
+			if jobOf(d.Body) == jobID {
+				return p
+			}
+		case <-timeout:
+			h.t.Fatalf("no %s for job %s; saw %v", key, jobID, h.keys())
+			return nil
+		}
+	}
+}
+
+// keys returns the routing keys of the events seen so far, leaving out
+// the logs and notifications that come with them.
+func (h *harness) keys(except ...string) []string {
+	var out []string
+next:
+	for _, e := range h.seen {
+		switch e.key {
+		case events.LogEvent, events.NotifyRequested:
+			continue
+		}
+		for _, k := range except {
+			if e.key == k {
+				continue next
+			}
+		}
+		out = append(out, e.key)
+	}
+	return out
+}
+
+// payloads returns the payloads of the events key seen so far.
+func payloads[T any](h *harness, key string) []*T {
+	h.t.Helper()
+	var out []*T
+	for _, e := range h.seen {
+		if e.key == key {
+			out = append(out, unwrap[T](h.t, e.body, key))
+		}
+	}
+	return out
+}
+
+// eventually polls cond until it holds, failing the test after a while.
+func (h *harness) eventually(what string, cond func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// rows waits for n rows of job jobID in table, the writes being queued,
+// and returns them.
+func (h *harness) rows(table, jobID string, n int) []map[string]any {
+	h.t.Helper()
+	var rows []map[string]any
+	h.eventually(fmt.Sprintf("%d %s rows", n, table), func() bool {
+		rows = h.db.table(table, jobID)
+		return len(rows) >= n
+	})
+	return rows
+}
+
+func unwrap[T any](t *testing.T, body []byte, key string) *T {
+	t.Helper()
+	p, err := events.UnwrapChecked[T](body, key)
+	if err != nil {
+		t.Fatalf("unwrap %s: %v", key, err)
+	}
+	return p
+}
+
+// jobOf returns the job_id of an event.
+func jobOf(body []byte) string {
+	var p struct {
+		JobID string `json:"job_id"`
+	}
+	if env, err := events.UnwrapEnvelope(body); err == nil {
+		_ = json.Unmarshal(env.Payload, &p)
+	}
+	return p.JobID
+}
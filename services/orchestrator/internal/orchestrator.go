@@ -2,12 +2,20 @@ package internal
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/jobdb"
 	"github.com/forge-ai/forge/shared/mq"
+	"github.com/forge-ai/forge/shared/wshub"
+	"github.com/jackc/pgx/v5/pgxpool"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -27,9 +35,152 @@ type screenState struct {
 	BestScore float64
 	BestCode  string
 	Done      bool
+	Passed    bool // an iteration passed, metric minimums included
+
+	Filename    string    // of the latest generated code
+	Code        string    // the latest generated code, to rebuild its sandbox
+	CodeURL     string    // where Code is uploaded; empty if it isn't
+	BestDiffURL string    // diff image of the best-scoring iteration
+	BestIter    int       // the best-scoring iteration; 0 until one is diffed
+	BestCodeURL string    // where BestIter's code is uploaded
+	started     time.Time // of the first code generation
+	rebuiltIter int       // iteration whose sandbox was last rebuilt
+	containerID string    // sandbox of the latest diffed iteration
+	codeHash    [sha256.Size]byte
+	codeIter    int      // iteration codeHash is of
+	warnings    []string // codegen's doubts about codeIter's code, for the next prompt
+	// nearPass is set while the latest diff reached the threshold without
+	// clearing the hysteresis margin; see passes.
+	nearPass bool
+	// Delta is how the latest iteration's scores moved from the one
+	// before's; nil until there are two. lastDiff is the latest diff, of
+	// iteration diffIter.
+	Delta    *events.DiffDelta
+	lastDiff *events.DiffResult
+	diffIter int
+	// genCost is what the latest code cost to generate, stored with the
+	// iteration that diffs it.
+	genCost events.JobCost
+
+	// regionFailures counts consecutive failing diffs per region, keyed by
+	// regionKey; regions that pass drop out.
+	regionFailures map[string]int
+	lastRegions    map[string]events.MismatchRegion
 }
 
-// jobState tracks overall job progress.
+// delta records p's diff as the latest and returns how its scores moved
+// from the previous iteration's, or nil for a first iteration. A diff
+// delivered again gets the delta it had the first time. Call with ss.mu
+// held.
+func (ss *screenState) delta(p *events.DiffCompletePayload) *events.DiffDelta {
+	switch {
+	case p.Iteration < ss.diffIter:
+		return nil
+	case p.Iteration > ss.diffIter:
+		ss.Delta = nil
+		if ss.lastDiff != nil && p.Iteration == ss.diffIter+1 {
+			d := p.Diff.Delta(*ss.lastDiff)
+			ss.Delta = &d
+		}
+		diff := p.Diff
+		diff.Regions, diff.Viewports, diff.Palette = nil, nil, nil
+		ss.lastDiff, ss.diffIter = &diff, p.Iteration
+	}
+	return ss.Delta
+}
+
+// passes decides whether a diff passes the screen, given the hysteresis
+// margin around its threshold, and whether it regressed. A score clear of
+// threshold+margin passes outright; one reaching the threshold only sets
+// nearPass, and the next passes too unless it falls below
+// threshold−margin, which is a regression. Renders a hair either side of
+// the threshold then settle the screen instead of flipping it. With no
+// margin the differ's decision stands. Call with ss.mu held.
+func (ss *screenState) passes(p *events.DiffCompletePayload, margin float64) (passed, regressed bool) {
+	if margin <= 0 {
+		return p.Passed, false
+	}
+	if len(p.Diff.BelowMinimum) > 0 {
+		ss.nearPass = false
+		return false, false
+	}
+	threshold, score := float64(p.Threshold), p.Diff.Score
+	switch {
+	case score >= threshold+margin:
+		return true, false
+	case score < threshold-margin:
+		regressed, ss.nearPass = ss.nearPass, false
+		return false, regressed
+	case ss.nearPass:
+		return true, false
+	}
+	ss.nearPass = score >= threshold
+	return false, false
+}
+
+// done reports whether the unit has finished.
+func (ss *screenState) done() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.Done
+}
+
+// repeatsCode reports whether the code generated for iteration is
+// byte-identical to the previous iteration's: the sandbox would build the
+// same page and the diff score it the same, so refining is stuck. A
+// redelivered iteration is not a repeat. Call with ss.mu held.
+func (ss *screenState) repeatsCode(iteration int, code string) bool {
+	return iteration == ss.codeIter+1 && sha256.Sum256([]byte(code)) == ss.codeHash
+}
+
+// persistentAfter is how many consecutive failures make a region persistent.
+const persistentAfter = 2
+
+// regionKey identifies a mismatch region across iterations. Positions are
+// bucketed so a region that shifts by a few pixels still counts as the same;
+// the same spot at two breakpoints is two regions.
+func regionKey(r events.MismatchRegion) string {
+	return fmt.Sprintf("%s@%s:%d,%d", r.Property, r.Viewport, r.X/64, r.Y/64)
+}
+
+// recordRegions updates the failure counts with the regions of the latest
+// diff. Call with ss.mu held.
+func (ss *screenState) recordRegions(regions []events.MismatchRegion) {
+	counts := make(map[string]int, len(regions))
+	latest := make(map[string]events.MismatchRegion, len(regions))
+	for _, r := range regions {
+		k := regionKey(r)
+		if _, seen := latest[k]; seen {
+			continue
+		}
+		counts[k] = ss.regionFailures[k] + 1
+		latest[k] = r
+	}
+	ss.regionFailures, ss.lastRegions = counts, latest
+}
+
+// persistentIssues lists the regions that have failed at least
+// persistentAfter times in a row, most-repeated first. Call with ss.mu held.
+func (ss *screenState) persistentIssues() []events.PersistentIssue {
+	var issues []events.PersistentIssue
+	for k, n := range ss.regionFailures {
+		if n >= persistentAfter {
+			issues = append(issues, events.PersistentIssue{Region: ss.lastRegions[k], Failures: n})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Failures != issues[j].Failures {
+			return issues[i].Failures > issues[j].Failures
+		}
+		return regionKey(issues[i].Region) < regionKey(issues[j].Region)
+	})
+	return issues
+}
+
+// jobState tracks overall job progress. mu guards every field, the
+// ScreenStates map included; each screenState has its own lock for its
+// fields. When both are needed, take mu first and never hold it while
+// publishing. Orchestrator.mu only guards the jobs map, not what is in it.
 type jobState struct {
 	mu           sync.Mutex
 	Platforms    []string
@@ -39,16 +190,146 @@ type jobState struct {
 	Completed    int
 	TotalScore   float64
 	TotalIter    int
+	Cost         events.JobCost // of every generation so far
 	RepoContext  string
 	Threshold    int
+
+	FigmaURL      string
+	FileName      string // Figma file name, once parsed
+	FigmaAttempts int    // retryable parse failures so far
+	SandboxMode   string
+	SandboxEnv    map[string]string
+	PresetCode    map[int]string // by screen index
+	// ReferenceOnly jobs have no Figma file; their screens are built from
+	// the submitted references. ReferenceImages replace a Figma job's
+	// exports, by screen index.
+	ReferenceOnly   bool
+	ReferenceImages map[int]string
+
+	PromptPrefix   string
+	SystemOverride string
+	ExportScale    float64
+	Diff           *events.DiffConfig // effective; see JobSubmittedPayload.DiffConfig
+	Notifications  *events.NotifyConfig
+	Priority       uint8 // of the messages for its work
+
+	// Resumed holds the stored progress of a retried job until its screens
+	// are parsed again; see resume.
+	Resumed map[resumeKey]resumedUnit
+}
+
+// newJobState starts the state of a submitted job.
+func newJobState(p *events.JobSubmittedPayload) *jobState {
+	return &jobState{
+		Platforms:    p.Platforms,
+		ScreenStates: make(map[screenKey]*screenState),
+		Threshold:    p.Threshold,
+		FigmaURL:     p.FigmaURL,
+		SandboxMode:  p.SandboxMode,
+		SandboxEnv:   p.SandboxEnv,
+		PresetCode:   p.PresetCode,
+
+		ReferenceOnly:   p.ReferenceOnly(),
+		ReferenceImages: p.ReferenceImages,
+
+		PromptPrefix:   p.PromptPrefix,
+		SystemOverride: p.SystemOverride,
+		ExportScale:    p.ExportScale,
+		Diff:           p.DiffConfig(),
+		Notifications:  p.Notifications,
+		Priority:       uint8(p.Priority),
+	}
+}
+
+// screen returns the state of one screen×platform unit, or nil.
+func (js *jobState) screen(key screenKey) *screenState {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.ScreenStates[key]
+}
+
+// finished reports whether key's unit has nothing left to do: it is done, or
+// its job is no longer running. A redelivered or late event for it is
+// acknowledged and dropped, since acting on it would start another
+// iteration of a finished screen and re-open it.
+func (o *Orchestrator) finished(key screenKey, event string, iteration int) bool {
+	js := o.job(key.JobID)
+	if js != nil {
+		if ss := js.screen(key); ss == nil || !ss.done() {
+			return false
+		}
+	}
+	log.Info().Str("job", key.JobID).Int("screen", key.ScreenIndex).Str("platform", key.Platform).Int("iter", iteration).
+		Str("event", event).Msg("event for a finished screen — ignored")
+	return true
+}
+
+// nextScreen returns the index of the first screen at or after from that
+// platform hasn't finished, or -1.
+func (js *jobState) nextScreen(jobID string, from int, platform string) int {
+	js.mu.Lock()
+	n := len(js.Screens)
+	js.mu.Unlock()
+	for i := from; i < n; i++ {
+		if ss := js.screen(screenKey{jobID, i, platform}); ss != nil && !ss.done() {
+			return i
+		}
+	}
+	return -1
+}
+
+// manifest assembles the job's JobManifest from its screen states.
+func (js *jobState) manifest(jobID string, avgScore float64) events.JobManifest {
+	js.mu.Lock()
+	m := events.JobManifest{
+		JobID:       jobID,
+		FigmaURL:    js.FigmaURL,
+		FileName:    js.FileName,
+		Platforms:   js.Platforms,
+		Threshold:   js.Threshold,
+		AvgScore:    avgScore,
+		TotalIter:   js.TotalIter,
+		Tokens:      events.SummarizeTokens(js.Screens),
+		CompletedAt: time.Now().UTC(),
+	}
+	screens := js.Screens
+	js.mu.Unlock()
+
+	for i, s := range screens {
+		for _, platform := range m.Platforms {
+			ss := js.screen(screenKey{jobID, i, platform})
+			if ss == nil {
+				continue
+			}
+			ss.mu.Lock()
+			m.Screens = append(m.Screens, events.ManifestScreen{
+				Index:         i,
+				Name:          s.Name,
+				ComponentName: s.ComponentName,
+				Platform:      platform,
+				Filename:      ss.Filename,
+				BestScore:     ss.BestScore,
+				Iterations:    ss.Iteration,
+				Passed:        ss.Passed,
+				DiffImageURL:  ss.BestDiffURL,
+			})
+			ss.mu.Unlock()
+		}
+	}
+	return m
 }
 
 // Orchestrator subscribes to the topic exchange and drives the full pipeline.
 type Orchestrator struct {
 	cfg    Config
-	broker *mq.Broker
-	hub    *Hub   // WebSocket broadcast to frontend
-	store  *Store // Supabase
+	broker mq.Bus
+	hub    *wshub.Hub    // WebSocket broadcast to frontend
+	store  *Store        // Supabase
+	pool   *pgxpool.Pool // the store's, with SUPABASE_DB_URL
+
+	webhook *stateWebhook // job state changes, fed by store
+	writes  *writeQueue   // to store, off the handlers' path
+	pricing Pricing
 
 	mu   sync.RWMutex
 	jobs map[string]*jobState
@@ -59,21 +340,58 @@ func NewOrchestrator(cfg Config) (*Orchestrator, error) {
 	if err != nil {
 		return nil, fmt.Errorf("mq connect: %w", err)
 	}
+	return newOrchestrator(cfg, broker)
+}
 
-	store := NewStore(cfg.SupabaseURL, cfg.SupabaseKey)
-	hub := NewHub()
+// newOrchestrator is NewOrchestrator on broker, an mq.Memory to run the
+// pipeline within a process. broker is closed with the Orchestrator, or
+// on error.
+func newOrchestrator(cfg Config, broker mq.Bus) (*Orchestrator, error) {
+	pricing, err := LoadPricing(cfg.LLMPricing, cfg.LLMPricingFile)
+	if err != nil {
+		broker.Close()
+		return nil, fmt.Errorf("llm pricing: %w", err)
+	}
+	var pool *pgxpool.Pool
+	if cfg.SupabaseDBURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		pool, err = jobdb.Connect(ctx, cfg.SupabaseDBURL)
+		cancel()
+		if err != nil {
+			broker.Close()
+			return nil, fmt.Errorf("postgres: %w", err)
+		}
+	}
+	webhook := newStateWebhook(cfg.JobStateWebhookURL, cfg.JobStateWebhookSecret)
+	store := NewStore(cfg.SupabaseURL, cfg.SupabaseKey, cfg.Store, pool, webhook)
+	hub := wshub.New()
+
+	o := &Orchestrator{
+		cfg:     cfg,
+		broker:  broker,
+		pool:    pool,
+		hub:     hub,
+		store:   store,
+		webhook: webhook,
+		pricing: pricing,
+		jobs:    make(map[string]*jobState),
+	}
+	o.writes = newWriteQueue(store, cfg.StoreQueue, o.writeFailed)
+	return o, nil
+}
 
-	return &Orchestrator{
-		cfg:    cfg,
-		broker: broker,
-		hub:    hub,
-		store:  store,
-		jobs:   make(map[string]*jobState),
-	}, nil
+// job returns the state of a running job, or nil.
+func (o *Orchestrator) job(id string) *jobState {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.jobs[id]
 }
 
 func (o *Orchestrator) Close() {
 	o.broker.Close()
+	if o.pool != nil {
+		o.pool.Close()
+	}
 }
 
 // Run starts all consumers and the API server.
@@ -86,6 +404,12 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	// API server (REST + WS)
 	g.Go(func() error { return o.serveAPI(ctx) })
 
+	// Job state webhook deliveries
+	g.Go(func() error { return o.webhook.Run(ctx) })
+
+	// Queued writes to Supabase, drained on shutdown
+	g.Go(func() error { return o.writes.Run(ctx) })
+
 	// Subscribe to every event the orchestrator cares about
 	subs := []struct {
 		queue   string
@@ -93,6 +417,7 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 		handler func(context.Context, amqp.Delivery) error
 	}{
 		{"orch.job.submitted", events.JobSubmitted, o.onJobSubmitted},
+		{"orch.job.retry", events.JobRetryRequested, o.onJobRetryRequested},
 		{"orch.figma.parsed", events.FigmaParsed, o.onFigmaParsed},
 		{"orch.figma.failed", events.FigmaFailed, o.onFigmaFailed},
 		{"orch.codegen.complete", events.CodegenComplete, o.onCodegenComplete},
@@ -146,7 +471,7 @@ func (o *Orchestrator) consume(
 // ── Event Handlers ────────────────────────────────────────────────────────────
 
 func (o *Orchestrator) onJobSubmitted(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.JobSubmittedPayload](d.Body)
+	p, err := events.UnwrapChecked[events.JobSubmittedPayload](d.Body, events.JobSubmitted)
 	if err != nil {
 		return err
 	}
@@ -155,39 +480,60 @@ func (o *Orchestrator) onJobSubmitted(ctx context.Context, d amqp.Delivery) erro
 		fmt.Sprintf("Job received — platforms: %v", p.Platforms), nil)
 
 	// Create job state
-	js := &jobState{
-		Platforms:    p.Platforms,
-		ScreenStates: make(map[screenKey]*screenState),
-		Threshold:    p.Threshold,
-	}
+	js := newJobState(p)
 	o.mu.Lock()
 	o.jobs[p.JobID] = js
 	o.mu.Unlock()
 
 	// Persist to Supabase
-	_ = o.store.CreateJob(ctx, p)
+	o.persist(p.JobID, "create job", func(ctx context.Context) error { return o.store.CreateJob(ctx, p) })
+
+	return o.requestScreens(ctx, p)
+}
 
-	// Request Figma parse
-	return o.publish(ctx, events.ParseFigmaRequested,
+// requestScreens gets a job's screens: a Figma job's are parsed from its
+// file, a reference-only job's are built from its references on the spot.
+func (o *Orchestrator) requestScreens(ctx context.Context, p *events.JobSubmittedPayload) error {
+	if p.ReferenceOnly() {
+		screens := events.ReferenceScreens(p.References)
+		return o.startScreens(ctx, &events.FigmaParsedPayload{JobID: p.JobID, Screens: screens, ScreenCount: len(screens)})
+	}
+	return o.publishJob(ctx, p.JobID, events.ParseFigmaRequested,
 		events.ParseFigmaRequestedPayload{
-			JobID:    p.JobID,
-			FigmaURL: p.FigmaURL,
+			JobID:       p.JobID,
+			FigmaURL:    p.FigmaURL,
+			ExportScale: p.ExportScale,
 		})
 }
 
 func (o *Orchestrator) onFigmaParsed(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.FigmaParsedPayload](d.Body)
+	p, err := events.UnwrapChecked[events.FigmaParsedPayload](d.Body, events.FigmaParsed)
 	if err != nil {
 		return err
 	}
+	return o.startScreens(ctx, p)
+}
 
-	o.mu.Lock()
-	js, ok := o.jobs[p.JobID]
-	if !ok {
-		o.mu.Unlock()
+// startScreens sets a job's screens up and requests the first codegen of
+// every platform.
+func (o *Orchestrator) startScreens(ctx context.Context, p *events.FigmaParsedPayload) error {
+	js := o.job(p.JobID)
+	if js == nil {
 		return fmt.Errorf("job %s not found in state", p.JobID)
 	}
+	js.mu.Lock()
+	var unreferenced []int
+	for i, url := range js.ReferenceImages {
+		if i >= len(p.Screens) {
+			unreferenced = append(unreferenced, i)
+			continue
+		}
+		// The image is of one size: the breakpoints' exports don't apply.
+		p.Screens[i].ExportURL = url
+		p.Screens[i].Viewports = nil
+	}
 	js.Screens = p.Screens
+	js.FileName = p.FileName
 	js.TotalWork = len(p.Screens) * len(js.Platforms)
 	// Initialise screen states
 	for i := range p.Screens {
@@ -195,24 +541,65 @@ func (o *Orchestrator) onFigmaParsed(ctx context.Context, d amqp.Delivery) error
 			js.ScreenStates[screenKey{p.JobID, i, platform}] = &screenState{}
 		}
 	}
-	o.mu.Unlock()
+	resumed := js.resume(p.JobID)
+	platforms := js.Platforms
+	var unmatched []int
+	for i := range js.PresetCode {
+		if i >= len(p.Screens) {
+			unmatched = append(unmatched, i)
+		}
+	}
+	completed, total := js.Completed, js.TotalWork
+	referenceOnly := js.ReferenceOnly
+	js.mu.Unlock()
 
-	o.emitLog(ctx, p.JobID, "success", "figma_parsed",
-		fmt.Sprintf("✓ %d screens detected: %s", p.ScreenCount, p.FileName), map[string]any{
-			"screens":   p.ScreenCount,
-			"platforms": js.Platforms,
-		})
+	if referenceOnly {
+		o.emitLog(ctx, p.JobID, "success", "references",
+			fmt.Sprintf("✓ %d reference screens — diffing against the given images", p.ScreenCount), map[string]any{
+				"screens":   p.ScreenCount,
+				"platforms": platforms,
+			})
+	} else {
+		o.emitLog(ctx, p.JobID, "success", "figma_parsed",
+			fmt.Sprintf("✓ %d screens detected: %s", p.ScreenCount, p.FileName), map[string]any{
+				"screens":   p.ScreenCount,
+				"platforms": platforms,
+			})
+	}
+
+	if resumed > 0 {
+		o.emitLog(ctx, p.JobID, "info", "job_resumed",
+			fmt.Sprintf("↻ %d of %d screen×platforms already passed — resuming the rest", resumed, total), nil)
+	}
 
-	_ = o.store.UpdateJobScreenCount(ctx, p.JobID, p.ScreenCount)
+	if len(unmatched) > 0 {
+		sort.Ints(unmatched)
+		o.emitLog(ctx, p.JobID, "warn", "preset_code",
+			fmt.Sprintf("⚠ provided code for screens %v ignored — the file has %d screens", unmatched, len(p.Screens)), nil)
+	}
+
+	if len(unreferenced) > 0 {
+		sort.Ints(unreferenced)
+		o.emitLog(ctx, p.JobID, "warn", "reference_images",
+			fmt.Sprintf("⚠ reference images for screens %v ignored — the file has %d screens", unreferenced, len(p.Screens)), nil)
+	}
+
+	o.persist(p.JobID, "update screen count", func(ctx context.Context) error {
+		return o.store.UpdateJobScreenCount(ctx, p.JobID, p.ScreenCount)
+	})
 
-	// Fan out: request codegen for screen[0] × all platforms
+	// Fan out: request codegen for each platform's first incomplete screen
 	// (screens are processed sequentially per platform, in parallel across platforms)
-	if len(p.Screens) == 0 {
+	if completed == total {
 		return o.completeJob(ctx, p.JobID)
 	}
 
-	for _, platform := range js.Platforms {
-		if err := o.requestCodegen(ctx, p.JobID, 0, platform, p.Screens[0], nil, 1); err != nil {
+	for _, platform := range platforms {
+		i := js.nextScreen(p.JobID, 0, platform)
+		if i < 0 {
+			continue
+		}
+		if err := o.requestCodegen(ctx, p.JobID, i, platform, p.Screens[i], nil, "", 1); err != nil {
 			return err
 		}
 	}
@@ -220,30 +607,146 @@ func (o *Orchestrator) onFigmaParsed(ctx context.Context, d amqp.Delivery) error
 }
 
 func (o *Orchestrator) onFigmaFailed(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.FigmaFailedPayload](d.Body)
+	p, err := events.UnwrapChecked[events.FigmaFailedPayload](d.Body, events.FigmaFailed)
 	if err != nil {
 		return err
 	}
-	o.emitLog(ctx, p.JobID, "error", "figma_failed", "Figma parse failed: "+p.Error, nil)
-	_ = o.store.MarkJobFailed(ctx, p.JobID, p.Error)
+
+	js := o.job(p.JobID)
+	if p.Retryable && js != nil {
+		js.mu.Lock()
+		js.FigmaAttempts++
+		attempt, url, scale := js.FigmaAttempts, js.FigmaURL, js.ExportScale
+		js.mu.Unlock()
+
+		if attempt <= o.cfg.FigmaRetries {
+			delay := time.Duration(p.RetryAfter) * time.Second
+			if delay == 0 {
+				delay = time.Duration(1<<(attempt-1)) * 5 * time.Second
+			}
+			o.emitLog(ctx, p.JobID, "warn", "figma_retry",
+				fmt.Sprintf("Figma request failed (%s) — retry %d/%d in %s", p.Error, attempt, o.cfg.FigmaRetries, delay),
+				map[string]any{"code": p.Code})
+			time.AfterFunc(delay, func() {
+				_ = o.publishJob(context.Background(), p.JobID, events.ParseFigmaRequested,
+					events.ParseFigmaRequestedPayload{JobID: p.JobID, FigmaURL: url, ExportScale: scale})
+			})
+			return nil
+		}
+	}
+
+	msg := figmaFailureMessage(p)
+	o.emitLog(ctx, p.JobID, "error", "figma_failed", msg, map[string]any{"code": p.Code})
+	o.persist(p.JobID, "mark job failed", func(ctx context.Context) error { return o.store.MarkJobFailed(ctx, p.JobID, "figma_parse", msg) })
+	o.notify(ctx, js, events.NotifyJobFailed, events.NotifyRequestedPayload{JobID: p.JobID, Error: msg})
 	return o.publish(ctx, events.JobFailed, events.JobFailedPayload{
 		JobID: p.JobID,
-		Error: p.Error,
+		Error: msg,
 		Step:  "figma_parse",
 	})
 }
 
+// figmaFailureMessage turns a classified Figma failure into something the
+// user can act on.
+func figmaFailureMessage(p *events.FigmaFailedPayload) string {
+	switch p.Code {
+	case events.FigmaErrAuth:
+		return "Figma rejected the access token — check that FIGMA_TOKEN is valid and can open this file"
+	case events.FigmaErrNotFound:
+		return "Figma file not found — check the URL and that the file is shared with the token's account"
+	case events.FigmaErrRateLimited:
+		return "Figma rate limit persisted after retries — try again later"
+	default:
+		return "Figma parse failed: " + p.Error
+	}
+}
+
 func (o *Orchestrator) onCodegenComplete(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.CodegenCompletePayload](d.Body)
+	p, err := events.UnwrapChecked[events.CodegenCompletePayload](d.Body, events.CodegenComplete)
 	if err != nil {
 		return err
 	}
+	if o.finished(screenKey{p.JobID, p.ScreenIndex, p.Platform}, events.CodegenComplete, p.Iteration) {
+		return nil
+	}
 
+	var cost events.JobCost
+	o.pricing.cost(&cost, p.Usage)
 	o.emitLog(ctx, p.JobID, "info", "codegen_complete",
-		fmt.Sprintf("[%s] iter %d — code generated (%d bytes)", p.Platform, p.Iteration, len(p.Code)), nil)
+		fmt.Sprintf("[%s] iter %d — code generated (%d bytes, $%.4f)", p.Platform, p.Iteration, len(p.Code), cost.USD),
+		map[string]any{"provider": p.Provider, "input_tokens": cost.InputTokens, "output_tokens": cost.OutputTokens, "cost_usd": cost.USD})
+	if stuck, err := o.stuck(ctx, p); stuck {
+		return err
+	}
+	return o.buildSandbox(ctx, p)
+}
+
+// stuck ends a screen×platform whose new code is the same as the last
+// iteration's, as building and diffing it again cannot change the score.
+// The screen finishes on its best score so far, like one out of
+// iterations.
+func (o *Orchestrator) stuck(ctx context.Context, p *events.CodegenCompletePayload) (bool, error) {
+	js := o.job(p.JobID)
+	if js == nil {
+		return false, nil
+	}
+	ss := js.screen(screenKey{p.JobID, p.ScreenIndex, p.Platform})
+	if ss == nil {
+		return false, nil
+	}
+	ss.mu.Lock()
+	if !ss.repeatsCode(p.Iteration, p.Code) {
+		ss.mu.Unlock()
+		return false, nil
+	}
+	best, iterations, diffURL, containerID := ss.BestScore, ss.Iteration, ss.BestDiffURL, ss.containerID
+	ss.mu.Unlock()
+	// The repeat was paid for all the same.
+	js.mu.Lock()
+	o.pricing.cost(&js.Cost, p.Usage)
+	js.mu.Unlock()
+
+	_ = o.killSandbox(ctx, p.JobID, p.ScreenIndex, p.Platform, containerID)
+	o.emitLog(ctx, p.JobID, "warn", "stuck",
+		fmt.Sprintf("⚠ [%s] %s — iter %d generated the same code as iter %d; stopping at %.1f%%",
+			p.Platform, p.Screen.Name, p.Iteration, p.Iteration-1, best),
+		map[string]any{"score": best, "iterations": iterations})
+	o.notify(ctx, js, events.NotifyMaxIter, events.NotifyRequestedPayload{
+		JobID:        p.JobID,
+		ScreenName:   p.Screen.Name,
+		Platform:     p.Platform,
+		Score:        best,
+		Iterations:   iterations,
+		DiffImageURL: diffURL,
+	})
+	return true, o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, best, iterations, events.ScreenStatusStuck)
+}
+
+// buildSandbox remembers an iteration's code and asks the sandbox to serve
+// it.
+func (o *Orchestrator) buildSandbox(ctx context.Context, p *events.CodegenCompletePayload) error {
+	mode, env := "", map[string]string(nil)
+	if js := o.job(p.JobID); js != nil {
+		var cost events.JobCost
+		o.pricing.cost(&cost, p.Usage)
+		js.mu.Lock()
+		mode, env = js.SandboxMode, js.SandboxEnv
+		o.pricing.cost(&js.Cost, p.Usage)
+		ss := js.ScreenStates[screenKey{p.JobID, p.ScreenIndex, p.Platform}]
+		js.mu.Unlock()
+		if ss != nil {
+			codeURL := o.uploadCode(p)
+			ss.mu.Lock()
+			ss.Filename, ss.Code, ss.CodeURL = p.Filename, p.Code, codeURL
+			ss.codeHash, ss.codeIter = sha256.Sum256([]byte(p.Code)), p.Iteration
+			ss.warnings = p.Warnings
+			ss.genCost = cost
+			ss.mu.Unlock()
+		}
+	}
 
 	// Forward to sandbox
-	return o.publish(ctx, events.SandboxBuildRequested,
+	return o.publishJob(ctx, p.JobID, events.SandboxBuildRequested,
 		events.SandboxBuildRequestedPayload{
 			JobID:       p.JobID,
 			ScreenIndex: p.ScreenIndex,
@@ -253,30 +756,74 @@ func (o *Orchestrator) onCodegenComplete(ctx context.Context, d amqp.Delivery) e
 			Filename:    p.Filename,
 			Threshold:   p.Threshold,
 			Screen:      p.Screen,
+			Mode:        mode,
+			Env:         env,
 		})
 }
 
+// uploadCode queues the upload of an iteration's code to Storage and
+// returns the URL it will be at, or "" if it isn't uploaded: without
+// Storage, or when it is larger than maxCodeUpload.
+func (o *Orchestrator) uploadCode(p *events.CodegenCompletePayload) string {
+	objectPath := codePath(p.JobID, p.ScreenIndex, p.Platform, p.Iteration, p.Filename)
+	url := o.store.AssetURL(objectPath)
+	if url == "" {
+		return ""
+	}
+	if len(p.Code) > maxCodeUpload {
+		log.Warn().Str("job", p.JobID).Int("iter", p.Iteration).Int("bytes", len(p.Code)).Msg("code too large to upload")
+		return ""
+	}
+	filename, code := p.Filename, p.Code
+	o.persist(p.JobID, "upload code", func(ctx context.Context) error {
+		return o.store.UploadCode(ctx, objectPath, filename, code)
+	})
+	return url
+}
+
 func (o *Orchestrator) onCodegenFailed(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.CodegenFailedPayload](d.Body)
+	p, err := events.UnwrapChecked[events.CodegenFailedPayload](d.Body, events.CodegenFailed)
 	if err != nil {
 		return err
 	}
-	o.emitLog(ctx, p.JobID, "error", "codegen_failed",
-		fmt.Sprintf("[%s] codegen error: %s", p.Platform, p.Error), nil)
+	if js := o.job(p.JobID); js != nil {
+		js.mu.Lock()
+		o.pricing.cost(&js.Cost, p.Usage)
+		js.mu.Unlock()
+	}
+	if p.Truncated {
+		o.emitLog(ctx, p.JobID, "error", "codegen_truncated",
+			fmt.Sprintf("[%s] codegen output truncated — the screen needs more than the LLM's max_tokens; raise LLM_MAX_TOKENS (%s)", p.Platform, p.Error), nil)
+	} else {
+		o.emitLog(ctx, p.JobID, "error", "codegen_failed",
+			fmt.Sprintf("[%s] codegen error: %s", p.Platform, p.Error), nil)
+	}
 	// Don't fail the whole job — skip this screen×platform
-	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, 0, "")
+	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, 0, events.ScreenStatusFailed)
 }
 
 func (o *Orchestrator) onSandboxReady(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.SandboxReadyPayload](d.Body)
+	p, err := events.UnwrapChecked[events.SandboxReadyPayload](d.Body, events.SandboxReady)
 	if err != nil {
 		return err
 	}
+	if o.finished(screenKey{p.JobID, p.ScreenIndex, p.Platform}, events.SandboxReady, p.Iteration) {
+		// Nothing will diff it.
+		return o.killSandbox(ctx, p.JobID, p.ScreenIndex, p.Platform, p.ContainerID)
+	}
 
 	o.emitLog(ctx, p.JobID, "info", "sandbox_ready",
-		fmt.Sprintf("[%s] sandbox running on port %d", p.Platform, p.Port), nil)
+		fmt.Sprintf("[%s] sandbox running on port %d", p.Platform, p.Port),
+		map[string]any{"startup_ms": p.StartupMs})
+
+	var cfg *events.DiffConfig
+	if js := o.job(p.JobID); js != nil {
+		js.mu.Lock()
+		cfg = js.Diff
+		js.mu.Unlock()
+	}
 
-	return o.publish(ctx, events.DiffRequested,
+	return o.publishJob(ctx, p.JobID, events.DiffRequested,
 		events.DiffRequestedPayload{
 			JobID:          p.JobID,
 			ScreenIndex:    p.ScreenIndex,
@@ -287,91 +834,151 @@ func (o *Orchestrator) onSandboxReady(ctx context.Context, d amqp.Delivery) erro
 			FigmaExportURL: p.Screen.ExportURL,
 			Screen:         p.Screen,
 			Threshold:      p.Threshold,
+			Viewports:      p.Screen.Viewports,
+			Config:         cfg,
 		})
 }
 
 func (o *Orchestrator) onSandboxFailed(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.SandboxFailedPayload](d.Body)
+	p, err := events.UnwrapChecked[events.SandboxFailedPayload](d.Body, events.SandboxFailed)
 	if err != nil {
 		return err
 	}
+	if p.BuildLog != "" {
+		o.emitLog(ctx, p.JobID, "info", "build_log",
+			fmt.Sprintf("[%s] build output:\n%s", p.Platform, tailLines(p.BuildLog, 20)), nil)
+	}
+
+	// A compile error in the generated file is the model's to fix; anything
+	// else (registry outage, missing base image) won't improve by retrying.
+	if p.CompileError != "" && p.Iteration < o.cfg.MaxIter {
+		o.emitLog(ctx, p.JobID, "warn", "sandbox_failed",
+			fmt.Sprintf("[%s] generated code failed to compile — regenerating", p.Platform), nil)
+		return o.requestCodegen(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Screen, nil, p.CompileError, p.Iteration+1)
+	}
+
 	o.emitLog(ctx, p.JobID, "warn", "sandbox_failed",
-		fmt.Sprintf("[%s] build failed — skipping: %s", p.Platform, p.Error), nil)
-	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, 0, "")
+		fmt.Sprintf("[%s] build failed — skipping: %s", p.Platform, p.Error),
+		map[string]any{"code": p.Code})
+	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, 0, events.ScreenStatusFailed)
+}
+
+// tailLines returns at most the last n lines of s.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (o *Orchestrator) onDiffComplete(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.DiffCompletePayload](d.Body)
+	p, err := events.UnwrapChecked[events.DiffCompletePayload](d.Body, events.DiffComplete)
 	if err != nil {
 		return err
 	}
+	key := screenKey{p.JobID, p.ScreenIndex, p.Platform}
+	if o.finished(key, events.DiffComplete, p.Iteration) {
+		return nil
+	}
 
-	o.emitLog(ctx, p.JobID, func() string {
-		if p.Diff.Score >= float64(p.Threshold) {
-			return "success"
-		}
-		return "warn"
-	}(), "diff_result",
-		fmt.Sprintf("[%s] iter %d — score: %.1f%% (layout:%.0f%% typo:%.0f%% spacing:%.0f%% color:%.0f%%)",
-			p.Platform, p.Iteration, p.Diff.Score,
-			p.Diff.Layout, p.Diff.Typography, p.Diff.Spacing, p.Diff.Color),
-		map[string]any{"score": p.Diff.Score, "passed": p.Passed})
-
-	// Update best score
-	o.mu.Lock()
-	js := o.jobs[p.JobID]
-	o.mu.Unlock()
+	if p.Diff.NoReference {
+		return o.onNoReference(ctx, p)
+	}
 
+	js := o.job(p.JobID)
 	if js == nil {
 		return fmt.Errorf("job state not found: %s", p.JobID)
 	}
 
-	key := screenKey{p.JobID, p.ScreenIndex, p.Platform}
-	js.mu.Lock()
-	ss := js.ScreenStates[key]
-	js.mu.Unlock()
-
+	ss := js.screen(key)
 	if ss == nil {
 		return fmt.Errorf("screen state not found")
 	}
 
+	ss.mu.Lock()
+	passed, regressed := ss.passes(p, o.cfg.DiffHysteresis)
+	p.Passed = passed
+	delta := ss.delta(p)
+	ss.mu.Unlock()
+
+	msg := fmt.Sprintf("[%s] iter %d — score: %.1f%% (layout:%.0f%% typo:%.0f%% spacing:%.0f%% color:%.0f%%)",
+		p.Platform, p.Iteration, p.Diff.Score,
+		p.Diff.Layout, p.Diff.Typography, p.Diff.Spacing, p.Diff.Color)
+	data := map[string]any{"score": p.Diff.Score, "passed": p.Passed}
+	if delta != nil {
+		msg += fmt.Sprintf(" — vs iter %d: %s", p.Iteration-1, delta)
+		data["delta"] = delta
+	}
+	o.emitLog(ctx, p.JobID, func() string {
+		if p.Passed {
+			return "success"
+		}
+		return "warn"
+	}(), "diff_result", msg, data)
+	if regressed {
+		o.emitLog(ctx, p.JobID, "warn", "regression",
+			fmt.Sprintf("[%s] %s — %.1f%% fell more than %g below %d%% after reaching it",
+				p.Platform, p.Screen.Name, p.Diff.Score, o.cfg.DiffHysteresis, p.Threshold), nil)
+	}
+
+	// Update best score
 	ss.mu.Lock()
 	ss.Iteration = p.Iteration
-	if p.Diff.Score > ss.BestScore {
+	ss.Passed = ss.Passed || p.Passed
+	if p.Diff.Score > ss.BestScore || ss.BestIter == 0 {
 		ss.BestScore = p.Diff.Score
+		ss.BestDiffURL = p.Diff.DiffImageURL
+		ss.BestIter, ss.BestCodeURL = p.Iteration, ss.CodeURL
 	}
+	ss.containerID = p.ContainerID
+	ss.recordRegions(p.Diff.Regions)
+	cost, code, codeURL := ss.genCost, ss.Code, ss.CodeURL
 	ss.mu.Unlock()
 
-	// Kill sandbox regardless
-	_ = o.killSandbox(ctx, p.ContainerID)
-
 	// Save iteration to Supabase
-	_ = o.store.SaveIteration(ctx, *p)
+	o.writes.enqueue(storeWrite{jobID: p.JobID, what: "save iteration", table: "iterations", row: iterationRow(*p, code, codeURL, cost, delta)})
 
 	if p.Passed {
 		// ✅ Screen passed
+		_ = o.killSandbox(ctx, p.JobID, p.ScreenIndex, p.Platform, p.ContainerID)
 		o.emitLog(ctx, p.JobID, "success", "screen_passed",
 			fmt.Sprintf("✅ [%s] %s — %.1f%% in %d iterations",
 				p.Platform, p.Screen.Name, p.Diff.Score, p.Iteration), nil)
 
-		_ = o.publish(ctx, events.NotifyRequested, events.NotifyRequestedPayload{
+		o.notify(ctx, js, events.NotifyScreenPassed, events.NotifyRequestedPayload{
 			JobID:        p.JobID,
 			ScreenName:   p.Screen.Name,
 			Platform:     p.Platform,
 			Score:        p.Diff.Score,
 			Iterations:   p.Iteration,
 			DiffImageURL: p.Diff.DiffImageURL,
+
+			ReferenceImageURL: p.Diff.ReferenceImageURL,
+			GeneratedImageURL: p.Diff.GeneratedImageURL,
 		})
 
-		return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Diff.Score, p.Iteration, "")
+		return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Diff.Score, p.Iteration, events.ScreenStatusPassed)
 	}
 
 	// Not passed — check max iterations
 	maxIter := o.cfg.MaxIter
 	if p.Iteration >= maxIter {
+		_ = o.killSandbox(ctx, p.JobID, p.ScreenIndex, p.Platform, p.ContainerID)
 		o.emitLog(ctx, p.JobID, "warn", "max_iter",
 			fmt.Sprintf("⚠ [%s] max iterations reached (best: %.1f%%) — moving on", p.Platform, p.Diff.Score), nil)
-		return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Diff.Score, p.Iteration, "")
+		o.notify(ctx, js, events.NotifyMaxIter, events.NotifyRequestedPayload{
+			JobID:        p.JobID,
+			ScreenName:   p.Screen.Name,
+			Platform:     p.Platform,
+			Score:        p.Diff.Score,
+			Iterations:   p.Iteration,
+			DiffImageURL: p.Diff.DiffImageURL,
+
+			ReferenceImageURL: p.Diff.ReferenceImageURL,
+			GeneratedImageURL: p.Diff.GeneratedImageURL,
+		})
+		return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Diff.Score, p.Iteration, events.ScreenStatusMaxIterations)
 	}
 
 	// Refine — show diff regions
@@ -380,22 +987,114 @@ func (o *Orchestrator) onDiffComplete(ctx context.Context, d amqp.Delivery) erro
 			fmt.Sprintf("  ↳ %s: found %q, expected %q", r.Property, r.Actual, r.Expected), nil)
 	}
 
+	shortfall := fmt.Sprintf("%.1f%% < %d%%", p.Diff.Score, p.Threshold)
+	switch {
+	case p.Diff.Score < float64(p.Threshold):
+	case len(p.Diff.BelowMinimum) > 0:
+		shortfall = "below the minimum for " + strings.Join(p.Diff.BelowMinimum, ", ")
+	default:
+		shortfall = fmt.Sprintf("%.1f%% is within %g of %d%%, to be confirmed", p.Diff.Score, o.cfg.DiffHysteresis, p.Threshold)
+	}
 	o.emitLog(ctx, p.JobID, "info", "refining",
-		fmt.Sprintf("[%s] %.1f%% < %d%% — refining (iter %d → %d)…",
-			p.Platform, p.Diff.Score, p.Threshold, p.Iteration, p.Iteration+1), nil)
+		fmt.Sprintf("[%s] %s — refining (iter %d → %d)…",
+			p.Platform, shortfall, p.Iteration, p.Iteration+1), nil)
 
 	// Feed diff back to codegen for next iteration
-	return o.requestCodegen(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Screen, &p.Diff, p.Iteration+1)
+	return o.requestCodegen(ctx, p.JobID, p.ScreenIndex, p.Platform, p.Screen, &p.Diff, "", p.Iteration+1)
+}
+
+// onNoReference handles a diff that could not run because the screen has no
+// Figma reference image. Refining is pointless, so the screen is skipped or,
+// under the "fail" policy, the whole job is failed.
+func (o *Orchestrator) onNoReference(ctx context.Context, p *events.DiffCompletePayload) error {
+	reason := ""
+	if len(p.Diff.Regions) > 0 {
+		reason = p.Diff.Regions[0].Actual
+	}
+	_ = o.killSandbox(ctx, p.JobID, p.ScreenIndex, p.Platform, p.ContainerID)
+
+	if o.cfg.NoReferencePolicy == "fail" {
+		msg := fmt.Sprintf("no Figma reference for %s — cannot diff (%s)", p.Screen.Name, reason)
+		o.emitLog(ctx, p.JobID, "error", "no_reference", "✗ "+msg, nil)
+		o.mu.Lock()
+		js := o.jobs[p.JobID]
+		delete(o.jobs, p.JobID)
+		o.mu.Unlock()
+		o.persist(p.JobID, "mark job failed", func(ctx context.Context) error { return o.store.MarkJobFailed(ctx, p.JobID, "diff", msg) })
+		o.notify(ctx, js, events.NotifyJobFailed, events.NotifyRequestedPayload{JobID: p.JobID, Error: msg})
+		return o.publish(ctx, events.JobFailed, events.JobFailedPayload{
+			JobID: p.JobID,
+			Error: msg,
+			Step:  "diff",
+		})
+	}
+
+	o.emitLog(ctx, p.JobID, "warn", "no_reference",
+		fmt.Sprintf("⚠ [%s] %s — no Figma reference, cannot diff (%s) — skipping screen",
+			p.Platform, p.Screen.Name, reason), nil)
+	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, p.Iteration, events.ScreenStatusSkipped)
 }
 
 func (o *Orchestrator) onDiffFailed(ctx context.Context, d amqp.Delivery) error {
-	p, err := events.Unwrap[events.DiffFailedPayload](d.Body)
+	p, err := events.UnwrapChecked[events.DiffFailedPayload](d.Body, events.DiffFailed)
 	if err != nil {
 		return err
 	}
+	if p.Code == events.DiffErrSandboxUnreachable && o.rebuildSandbox(ctx, p) {
+		return nil
+	}
 	o.emitLog(ctx, p.JobID, "error", "diff_failed",
 		fmt.Sprintf("[%s] diff error: %s", p.Platform, p.Error), nil)
-	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, 0, "")
+	return o.advanceOrComplete(ctx, p.JobID, p.ScreenIndex, p.Platform, 0, 0, events.ScreenStatusFailed)
+}
+
+// rebuildSandbox requests a fresh sandbox for an iteration whose sandbox
+// stopped answering, reusing the code already generated for it. Each
+// iteration gets one rebuild; it reports false if that is used up or the
+// code isn't known.
+func (o *Orchestrator) rebuildSandbox(ctx context.Context, p *events.DiffFailedPayload) bool {
+	js := o.job(p.JobID)
+	if js == nil {
+		return false
+	}
+	js.mu.Lock()
+	ss := js.ScreenStates[screenKey{p.JobID, p.ScreenIndex, p.Platform}]
+	threshold, mode, env := js.Threshold, js.SandboxMode, js.SandboxEnv
+	var screen events.FigmaScreen
+	if p.ScreenIndex < len(js.Screens) {
+		screen = js.Screens[p.ScreenIndex]
+	}
+	js.mu.Unlock()
+	if ss == nil {
+		return false
+	}
+	ss.mu.Lock()
+	code, filename := ss.Code, ss.Filename
+	retry := code != "" && ss.rebuiltIter != p.Iteration
+	if retry {
+		ss.rebuiltIter = p.Iteration
+	}
+	ss.mu.Unlock()
+	if !retry {
+		return false
+	}
+
+	o.emitLog(ctx, p.JobID, "warn", "sandbox_unreachable",
+		fmt.Sprintf("[%s] sandbox stopped responding — rebuilding for iter %d", p.Platform, p.Iteration), nil)
+	err := o.publishJob(ctx, p.JobID, events.SandboxBuildRequested,
+		events.SandboxBuildRequestedPayload{
+			JobID:       p.JobID,
+			ScreenIndex: p.ScreenIndex,
+			Platform:    p.Platform,
+			Iteration:   p.Iteration,
+			Code:        code,
+			Filename:    filename,
+			Threshold:   threshold,
+			Screen:      screen,
+			Mode:        mode,
+			Env:         env,
+		})
+	return err == nil
 }
 
 func (o *Orchestrator) onLogRelay(ctx context.Context, d amqp.Delivery) error {
@@ -404,7 +1103,14 @@ func (o *Orchestrator) onLogRelay(ctx context.Context, d amqp.Delivery) error {
 	if err != nil {
 		return nil // non-fatal
 	}
-	o.hub.Broadcast(env)
+	o.hub.Broadcast(d.Body)
+
+	// Every service's log events, the orchestrator's own included, pass
+	// through here once: the place to keep them for the audit trail.
+	var p events.LogEventPayload
+	_ = json.Unmarshal(env.Payload, &p)
+	o.writes.enqueue(storeWrite{jobID: p.JobID, what: "store log event", log: true,
+		table: "events", row: eventRow(p.JobID, env.RoutingKey, env.Payload)})
 	return nil
 }
 
@@ -413,23 +1119,64 @@ func (o *Orchestrator) onLogRelay(ctx context.Context, d amqp.Delivery) error {
 func (o *Orchestrator) requestCodegen(
 	ctx context.Context,
 	jobID string, screenIdx int, platform string,
-	screen events.FigmaScreen, prevDiff *events.DiffResult, iteration int,
+	screen events.FigmaScreen, prevDiff *events.DiffResult, buildError string, iteration int,
 ) error {
-	o.mu.RLock()
-	js := o.jobs[jobID]
-	o.mu.RUnlock()
-
+	if o.finished(screenKey{jobID, screenIdx, platform}, events.CodegenRequested, iteration) {
+		return nil
+	}
 	threshold := o.cfg.DefaultThreshold
-	repoCtx := ""
-	if js != nil {
+	repoCtx, prefix, system, preset := "", "", "", ""
+	var persistent []events.PersistentIssue
+	var warnings []string
+	if js := o.job(jobID); js != nil {
+		js.mu.Lock()
 		threshold = js.Threshold
 		repoCtx = js.RepoContext
+		prefix, system = js.PromptPrefix, js.SystemOverride
+		preset = js.PresetCode[screenIdx]
+		ss := js.ScreenStates[screenKey{jobID, screenIdx, platform}]
+		js.mu.Unlock()
+		if ss != nil {
+			ss.mu.Lock()
+			if ss.started.IsZero() {
+				ss.started = time.Now()
+			}
+			if prevDiff != nil {
+				persistent = ss.persistentIssues()
+			}
+			if iteration == ss.codeIter+1 {
+				warnings = ss.warnings
+			}
+			ss.mu.Unlock()
+		}
+	}
+
+	// The user's own code stands in for the first iteration; codegen only
+	// sees the screen if that code needs refining.
+	if preset != "" && iteration == 1 && prevDiff == nil && buildError == "" {
+		o.emitLog(ctx, jobID, "info", "codegen_skipped",
+			fmt.Sprintf("[%s] iter 1 — using the provided code for %s", platform, screen.Name), nil)
+		name := screen.ComponentName
+		if name == "" {
+			name = events.ComponentName(screen.Name, screenIdx)
+		}
+		return o.buildSandbox(ctx, &events.CodegenCompletePayload{
+			JobID:       jobID,
+			ScreenIndex: screenIdx,
+			Platform:    platform,
+			Iteration:   1,
+			Code:        preset,
+			Filename:    events.ComponentFilename(name, platform),
+			Threshold:   threshold,
+			Screen:      screen,
+			Provider:    "preset",
+		})
 	}
 
 	o.emitLog(ctx, jobID, "info", "codegen_start",
 		fmt.Sprintf("[%s] iter %d — generating %s…", platform, iteration, screen.Name), nil)
 
-	return o.publish(ctx, events.CodegenRequested, events.CodegenRequestedPayload{
+	return o.publishJob(ctx, jobID, events.CodegenRequested, events.CodegenRequestedPayload{
 		JobID:       jobID,
 		ScreenIndex: screenIdx,
 		Screen:      screen,
@@ -437,34 +1184,63 @@ func (o *Orchestrator) requestCodegen(
 		Styling:     "tailwind",
 		RepoContext: repoCtx,
 		PrevDiff:    prevDiff,
-		Iteration:   iteration,
-		Threshold:   threshold,
+		BuildError:  buildError,
+
+		PersistentIssues: persistent,
+		Iteration:        iteration,
+		Threshold:        threshold,
+
+		PromptPrefix:   prefix,
+		SystemOverride: system,
+		Warnings:       warnings,
 	})
 }
 
-// advanceOrComplete marks a screen×platform done, then either starts
-// the next screen×platform or completes the whole job.
+// advanceOrComplete marks a screen×platform done with status, one of the
+// events.ScreenStatus values, and stores its result; then it either starts
+// the next screen×platform or completes the whole job. A unit is counted
+// once: a duplicate or stale event for one already done is ignored.
 func (o *Orchestrator) advanceOrComplete(
 	ctx context.Context,
 	jobID string, screenIdx int, platform string,
-	score float64, iterations int, code string,
+	score float64, iterations int, status string,
 ) error {
-	o.mu.Lock()
-	js, ok := o.jobs[jobID]
-	if !ok {
-		o.mu.Unlock()
+	js := o.job(jobID)
+	if js == nil {
 		return nil
 	}
 
-	key := screenKey{jobID, screenIdx, platform}
-	ss := js.ScreenStates[key]
-	if ss != nil {
-		ss.mu.Lock()
-		ss.Done = true
-		ss.mu.Unlock()
-	}
-
 	js.mu.Lock()
+	ss := js.ScreenStates[screenKey{jobID, screenIdx, platform}]
+	if ss == nil {
+		js.mu.Unlock()
+		log.Warn().Str("job", jobID).Int("screen", screenIdx).Str("platform", platform).Msg("completion for unknown screen — ignored")
+		return nil
+	}
+	ss.mu.Lock()
+	already := ss.Done
+	ss.Done = true
+	result := events.ScreenDonePayload{
+		JobID:         jobID,
+		ScreenIndex:   screenIdx,
+		Platform:      platform,
+		Score:         score,
+		Iterations:    iterations,
+		Status:        status,
+		BestScore:     ss.BestScore,
+		BestIteration: ss.BestIter,
+		CodeURL:       ss.BestCodeURL,
+		DiffImageURL:  ss.BestDiffURL,
+	}
+	if !ss.started.IsZero() {
+		result.DurationMS = time.Since(ss.started).Milliseconds()
+	}
+	ss.mu.Unlock()
+	if already {
+		js.mu.Unlock()
+		log.Debug().Str("job", jobID).Int("screen", screenIdx).Str("platform", platform).Msg("screen already done — duplicate event ignored")
+		return nil
+	}
 	js.Completed++
 	js.TotalScore += score
 	js.TotalIter += iterations
@@ -472,78 +1248,108 @@ func (o *Orchestrator) advanceOrComplete(
 	total := js.TotalWork
 	screens := js.Screens
 	js.mu.Unlock()
-	o.mu.Unlock()
 
 	// Publish screen.done
 	if screenIdx < len(screens) {
-		_ = o.publish(ctx, events.ScreenDone, events.ScreenDonePayload{
-			JobID:       jobID,
-			ScreenIndex: screenIdx,
-			ScreenName:  screens[screenIdx].Name,
-			Platform:    platform,
-			Score:       score,
-			Iterations:  iterations,
-		})
+		result.ScreenName = screens[screenIdx].Name
+		o.writes.enqueue(storeWrite{jobID: jobID, what: "save screen result", table: "screen_results", row: screenResultRow(result)})
+		_ = o.publish(ctx, events.ScreenDone, result)
 	}
 
-	// Check if we should start next screen for this platform
-	nextIdx := screenIdx + 1
-	if nextIdx < len(screens) {
-		// Find next incomplete screen for this platform
-		nextKey := screenKey{jobID, nextIdx, platform}
-		o.mu.RLock()
-		nextSS := js.ScreenStates[nextKey]
-		o.mu.RUnlock()
-
-		if nextSS != nil && !nextSS.Done {
-			return o.requestCodegen(ctx, jobID, nextIdx, platform, screens[nextIdx], nil, 1)
-		}
+	// Start the next incomplete screen for this platform
+	if nextIdx := js.nextScreen(jobID, screenIdx+1, platform); nextIdx >= 0 {
+		return o.requestCodegen(ctx, jobID, nextIdx, platform, screens[nextIdx], nil, "", 1)
 	}
 
 	// All work done?
-	if completed >= total {
+	if completed == total {
 		return o.completeJob(ctx, jobID)
 	}
 	return nil
 }
 
+// completeJob finishes a job once: the first call removes it from o.jobs,
+// so later ones find nothing and return.
 func (o *Orchestrator) completeJob(ctx context.Context, jobID string) error {
 	o.mu.Lock()
 	js := o.jobs[jobID]
 	delete(o.jobs, jobID)
 	o.mu.Unlock()
+	if js == nil {
+		return nil
+	}
 
 	avgScore := 0.0
-	totalIter := 0
-	platforms := []string{}
-	screens := 0
-
-	if js != nil {
-		js.mu.Lock()
-		if js.Completed > 0 {
-			avgScore = js.TotalScore / float64(js.Completed)
-		}
-		totalIter = js.TotalIter
-		platforms = js.Platforms
-		screens = len(js.Screens)
-		js.mu.Unlock()
+	js.mu.Lock()
+	if js.Completed > 0 {
+		avgScore = js.TotalScore / float64(js.Completed)
 	}
+	totalIter := js.TotalIter
+	platforms := js.Platforms
+	screens := len(js.Screens)
+	cost := js.Cost
+	js.mu.Unlock()
 
 	o.emitLog(ctx, jobID, "success", "job_done",
-		fmt.Sprintf("🎉 Job complete! %d screens × %d platforms | avg score: %.1f%% | %d total iterations",
-			screens, len(platforms), avgScore, totalIter), nil)
+		fmt.Sprintf("🎉 Job complete! %d screens × %d platforms | avg score: %.1f%% | %d total iterations | cost $%.2f",
+			screens, len(platforms), avgScore, totalIter, cost.USD),
+		map[string]any{"cost_usd": cost.USD, "input_tokens": cost.InputTokens, "output_tokens": cost.OutputTokens})
+	if len(cost.Unpriced) > 0 {
+		o.emitLog(ctx, jobID, "warn", "job_done",
+			"No price for "+strings.Join(cost.Unpriced, ", ")+" — their tokens are left out of the cost; set LLM_PRICING", nil)
+	}
+
+	o.persist(jobID, "mark job done", func(ctx context.Context) error { return o.store.MarkJobDone(ctx, jobID, cost) })
 
-	_ = o.store.MarkJobDone(ctx, jobID)
+	manifest := js.manifest(jobID, avgScore)
+	manifest.Cost = cost
+	manifestURL, err := o.store.UploadManifest(ctx, manifest)
+	if err != nil {
+		o.storeFailed(ctx, jobID, "upload manifest", err)
+	}
+	o.notify(ctx, js, events.NotifyJobDone, events.NotifyRequestedPayload{
+		JobID:       jobID,
+		Score:       avgScore,
+		Iterations:  totalIter,
+		Screens:     screens,
+		ManifestURL: manifestURL,
+		Results:     manifest.Screens,
+		Cost:        &cost,
+	})
 
 	return o.publish(ctx, events.JobDone, events.JobDonePayload{
-		JobID:     jobID,
-		Screens:   screens,
-		Platforms: platforms,
-		AvgScore:  avgScore,
-		TotalIter: totalIter,
+		JobID:       jobID,
+		Screens:     screens,
+		Platforms:   platforms,
+		AvgScore:    avgScore,
+		TotalIter:   totalIter,
+		ManifestURL: manifestURL,
+		Cost:        cost,
 	})
 }
 
+// notify requests a notification of event, sent to the job's channels that
+// want it, or to the notifier's defaults when the job set none. js may be
+// nil, for a job this orchestrator no longer holds.
+func (o *Orchestrator) notify(ctx context.Context, js *jobState, event string, p events.NotifyRequestedPayload) {
+	p.Event = event
+	if js != nil {
+		js.mu.Lock()
+		p.FileName = js.FileName
+		notifications := js.Notifications
+		js.mu.Unlock()
+		if notifications != nil && len(notifications.Channels) > 0 {
+			if p.Channels = notifications.ChannelsFor(event); len(p.Channels) == 0 {
+				return
+			}
+		}
+		if notifications != nil {
+			p.Digest = notifications.Digest
+		}
+	}
+	_ = o.publish(ctx, events.NotifyRequested, p)
+}
+
 func (o *Orchestrator) publish(ctx context.Context, routingKey string, payload any) error {
 	b, err := events.Wrap(routingKey, payload)
 	if err != nil {
@@ -552,6 +1358,21 @@ func (o *Orchestrator) publish(ctx context.Context, routingKey string, payload a
 	return o.broker.Publish(ctx, routingKey, b)
 }
 
+// publishJob is publish for a job's work, at the job's priority.
+func (o *Orchestrator) publishJob(ctx context.Context, jobID, routingKey string, payload any) error {
+	b, err := events.Wrap(routingKey, payload)
+	if err != nil {
+		return err
+	}
+	var priority uint8
+	if js := o.job(jobID); js != nil {
+		js.mu.Lock()
+		priority = js.Priority
+		js.mu.Unlock()
+	}
+	return o.broker.PublishWithPriority(ctx, routingKey, b, priority)
+}
+
 func (o *Orchestrator) emitLog(ctx context.Context, jobID, level, step, message string, data map[string]any) {
 	log.Info().Str("job", jobID).Str("step", step).Msg(message)
 	p := events.LogEventPayload{
@@ -561,18 +1382,54 @@ func (o *Orchestrator) emitLog(ctx context.Context, jobID, level, step, message
 		Message: message,
 		Data:    data,
 	}
-	b, _ := json.Marshal(p)
-	// Publish both as log.event and directly to hub
-	_ = o.broker.Publish(ctx, events.LogEvent, func() []byte {
-		wrapped, _ := events.Wrap(events.LogEvent, p)
-		return wrapped
-	}())
-	o.hub.BroadcastRaw(b)
+	b, err := events.Wrap(events.LogEvent, p)
+	if err != nil {
+		return
+	}
+	// Our own clients get the envelope straight away; the copy the relay
+	// brings back has the same id and is dropped by the hub. The publish is
+	// for the gateway's clients.
+	o.hub.Broadcast(b)
+	_ = o.broker.Publish(ctx, events.LogEvent, b)
+}
+
+// persist queues a write to Supabase, made once the writes queued before
+// it are.
+func (o *Orchestrator) persist(jobID, what string, run func(context.Context) error) {
+	o.writes.enqueue(storeWrite{jobID: jobID, what: what, run: run})
+}
+
+// writeFailed reports a queued write that did not go through. Failed log
+// rows are only logged: reporting them would queue more of them.
+func (o *Orchestrator) writeFailed(w storeWrite, err error) {
+	if w.log {
+		log.Warn().Err(err).Str("job", w.jobID).Msg("log event not stored")
+		return
+	}
+	o.storeFailed(context.Background(), w.jobID, w.what, err)
+}
+
+// storeFailed reports a write to Supabase that did not go through. The
+// pipeline goes on without it, but the job's rows are now behind.
+func (o *Orchestrator) storeFailed(ctx context.Context, jobID, what string, err error) {
+	log.Warn().Err(err).Str("job", jobID).Str("op", what).Msg("store write failed")
+	data := map[string]any{"op": what, "error": err.Error()}
+	var se *StoreError
+	if errors.As(err, &se) {
+		data["kind"] = se.Kind
+	}
+	o.emitLog(ctx, jobID, "warn", "store_failed", "⚠ Could not "+what+" in Supabase — the job's stored state is behind", data)
 }
 
-func (o *Orchestrator) killSandbox(ctx context.Context, containerID string) error {
-	// publish internal kill message or call docker directly
-	// For now just log — sandbox service handles its own cleanup
+// killSandbox releases the container of a finished screen×platform unit.
+// It is not called between iterations: the sandbox service keeps the
+// container alive to hot-swap the next iteration's code into it.
+func (o *Orchestrator) killSandbox(ctx context.Context, jobID string, screenIdx int, platform, containerID string) error {
 	log.Debug().Str("container", containerID).Msg("requesting sandbox kill")
-	return nil
+	return o.publish(ctx, events.SandboxRelease, events.SandboxReleasePayload{
+		JobID:       jobID,
+		ScreenIndex: screenIdx,
+		Platform:    platform,
+		ContainerID: containerID,
+	})
 }
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pgDB keeps rows straight in Supabase's Postgres, with SUPABASE_DB_URL.
+// Column names come from the store's own row builders, never from input;
+// values are always parameters.
+type pgDB struct {
+	pool *pgxpool.Pool
+}
+
+// insert adds rows, updating those of upsertKeys already there with the
+// rest of their columns. A row of another table that clashes with one
+// already there is skipped.
+func (d *pgDB) insert(ctx context.Context, table string, rows []map[string]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	cols := make([]string, 0, len(rows[0]))
+	for c := range rows[0] {
+		cols = append(cols, c)
+	}
+	sort.Strings(cols)
+
+	var sql strings.Builder
+	sql.WriteString("insert into " + pgx.Identifier{"public", table}.Sanitize() + " (")
+	for i, c := range cols {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(pgx.Identifier{c}.Sanitize())
+	}
+	sql.WriteString(") values ")
+	args := make([]any, 0, len(rows)*len(cols))
+	for i, row := range rows {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString("(")
+		for j, c := range cols {
+			if j > 0 {
+				sql.WriteString(", ")
+			}
+			args = append(args, row[c])
+			sql.WriteString("$" + strconv.Itoa(len(args)))
+		}
+		sql.WriteString(")")
+	}
+	sql.WriteString(onConflict(upsertKeys[table], cols))
+	_, err := d.pool.Exec(ctx, sql.String(), args...)
+	return pgError("INSERT "+table, err)
+}
+
+// onConflict is the on conflict clause of an insert of cols: an update of
+// the columns outside key, or nothing without a key.
+func onConflict(key, cols []string) string {
+	var sets []string
+	for _, c := range cols {
+		if !slices.Contains(key, c) {
+			sets = append(sets, pgx.Identifier{c}.Sanitize()+" = excluded."+pgx.Identifier{c}.Sanitize())
+		}
+	}
+	if key == nil || sets == nil {
+		return " on conflict do nothing"
+	}
+	target := make([]string, len(key))
+	for i, c := range key {
+		target[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return " on conflict (" + strings.Join(target, ", ") + ") do update set " + strings.Join(sets, ", ")
+}
+
+func (d *pgDB) updateJob(ctx context.Context, jobID string, fields map[string]any) error {
+	cols := make([]string, 0, len(fields))
+	for c := range fields {
+		cols = append(cols, c)
+	}
+	sort.Strings(cols)
+
+	args := make([]any, 0, len(cols)+1)
+	sets := make([]string, len(cols))
+	for i, c := range cols {
+		args = append(args, fields[c])
+		sets[i] = pgx.Identifier{c}.Sanitize() + " = $" + strconv.Itoa(len(args))
+	}
+	args = append(args, jobID)
+	sql := "update public.jobs set " + strings.Join(sets, ", ") + " where id = $" + strconv.Itoa(len(args))
+	_, err := d.pool.Exec(ctx, sql, args...)
+	return pgError("UPDATE jobs", err)
+}
+
+func (d *pgDB) loadJob(ctx context.Context, jobID string) (*storedJob, error) {
+	var j storedJob
+	err := d.pool.QueryRow(ctx, `
+		select status, request, figma_url, coalesce(repo_url, ''), platforms, styling, threshold
+		from public.jobs where id = $1`, jobID).
+		Scan(&j.Status, &j.Request, &j.FigmaURL, &j.RepoURL, &j.Platforms, &j.Styling, &j.Threshold)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, pgError("SELECT jobs", err)
+	}
+	return &j, nil
+}
+
+func (d *pgDB) loadIterations(ctx context.Context, jobID string) ([]storedIteration, error) {
+	rows, err := d.pool.Query(ctx, `
+		select coalesce(screen_index, -1), screen_name, platform, iteration, score, coalesce(diff_url, ''), coalesce(code_url, ''),
+		       coalesce(cost_usd, 0), coalesce(input_tokens, 0), coalesce(output_tokens, 0)
+		from public.iterations where job_id = $1`, jobID)
+	if err != nil {
+		return nil, pgError("SELECT iterations", err)
+	}
+	its, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storedIteration, error) {
+		var it storedIteration
+		err := row.Scan(&it.ScreenIndex, &it.ScreenName, &it.Platform, &it.Iteration, &it.Score, &it.DiffURL, &it.CodeURL,
+			&it.CostUSD, &it.InputTokens, &it.OutputTokens)
+		return it, err
+	})
+	return its, pgError("SELECT iterations", err)
+}
+
+// pgError is err as a *StoreError of the kind its SQLSTATE class is:
+// connection failures and serialization conflicts may succeed later, a
+// refused login never will.
+func pgError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	kind := StoreTransient
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch code := pgErr.Code; {
+		case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "53"), strings.HasPrefix(code, "57"),
+			code == "40001", code == "40P01":
+			kind = StoreTransient
+		case strings.HasPrefix(code, "28"), code == "42501":
+			kind = StoreAuth
+		case code == "23505":
+			kind = StoreConflict
+		default:
+			kind = StoreRejected
+		}
+	}
+	return &StoreError{Op: op, Kind: kind, Err: err}
+}
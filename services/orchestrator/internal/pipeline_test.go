@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func TestPipelineEventSequence(t *testing.T) {
+	h := newHarness(t, Config{}, 1)
+	h.score = func(*events.DiffRequestedPayload) float64 { return 97 }
+
+	id := h.submit(events.PlatformReact)
+	until[events.JobDonePayload](h, events.JobDone, id)
+
+	want := []string{
+		events.JobSubmitted,
+		events.ParseFigmaRequested,
+		events.FigmaParsed,
+		events.CodegenRequested,
+		events.CodegenComplete,
+		events.SandboxBuildRequested,
+		events.SandboxReady,
+		events.DiffRequested,
+		events.DiffComplete,
+		events.ScreenDone,
+		events.JobDone,
+	}
+	if got := h.keys(events.SandboxRelease); !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestPipelineIteratesOnLowScore(t *testing.T) {
+	h := newHarness(t, Config{}, 1)
+	scores := []float64{80, 90, 96}
+	h.score = func(p *events.DiffRequestedPayload) float64 { return scores[p.Iteration-1] }
+
+	id := h.submit(events.PlatformReact)
+	done := until[events.ScreenDonePayload](h, events.ScreenDone, id)
+	until[events.JobDonePayload](h, events.JobDone, id)
+
+	reqs := payloads[events.CodegenRequestedPayload](h, events.CodegenRequested)
+	if len(reqs) != len(scores) {
+		t.Fatalf("%d codegen requests, want %d", len(reqs), len(scores))
+	}
+	for i, r := range reqs {
+		if r.Iteration != i+1 {
+			t.Errorf("request %d is of iteration %d", i, r.Iteration)
+		}
+		// Every iteration after the first is told what the last got wrong.
+		if hasPrev := r.PrevDiff != nil; hasPrev != (i > 0) {
+			t.Errorf("iteration %d: PrevDiff set %v", r.Iteration, hasPrev)
+		} else if i > 0 && r.PrevDiff.Score != scores[i-1] {
+			t.Errorf("iteration %d: PrevDiff score %v, want %v", r.Iteration, r.PrevDiff.Score, scores[i-1])
+		}
+	}
+	if done.Status != events.ScreenStatusPassed || done.Iterations != 3 || done.Score != 96 {
+		t.Errorf("screen done %+v, want passed at 96 in 3 iterations", done)
+	}
+}
+
+func TestPipelineStopsAtMaxIterations(t *testing.T) {
+	h := newHarness(t, Config{MaxIter: 3}, 1)
+	scores := []float64{50, 60, 55}
+	h.score = func(p *events.DiffRequestedPayload) float64 { return scores[p.Iteration-1] }
+
+	id := h.submit(events.PlatformReact)
+	done := until[events.ScreenDonePayload](h, events.ScreenDone, id)
+	job := until[events.JobDonePayload](h, events.JobDone, id)
+
+	if n := len(payloads[events.CodegenRequestedPayload](h, events.CodegenRequested)); n != 3 {
+		t.Errorf("%d codegen requests, want 3", n)
+	}
+	if done.Status != events.ScreenStatusMaxIterations || done.Iterations != 3 {
+		t.Errorf("screen done %+v, want max_iterations after 3", done)
+	}
+	if done.BestScore != 60 || done.BestIteration != 2 {
+		t.Errorf("best %v at %d, want 60 at 2", done.BestScore, done.BestIteration)
+	}
+	if job.TotalIter != 3 {
+		t.Errorf("job total iterations %d, want 3", job.TotalIter)
+	}
+}
+
+func TestPipelineJobDoneTotals(t *testing.T) {
+	h := newHarness(t, Config{}, 2)
+	// Screen 1 on react takes two iterations; the rest pass at once.
+	h.score = func(p *events.DiffRequestedPayload) float64 {
+		switch {
+		case p.ScreenIndex == 1 && p.Platform == events.PlatformReact:
+			return []float64{70, 96}[p.Iteration-1]
+		case p.Platform == events.PlatformReact:
+			return 98
+		default:
+			return 99
+		}
+	}
+
+	id := h.submit(events.PlatformReact, events.PlatformNextJS)
+	job := until[events.JobDonePayload](h, events.JobDone, id)
+
+	if job.Screens != 2 {
+		t.Errorf("screens %d, want 2", job.Screens)
+	}
+	if want := []string{events.PlatformReact, events.PlatformNextJS}; !reflect.DeepEqual(job.Platforms, want) {
+		t.Errorf("platforms %v, want %v", job.Platforms, want)
+	}
+	if want := (98 + 96 + 99 + 99) / 4.0; job.AvgScore != want {
+		t.Errorf("avg score %v, want %v", job.AvgScore, want)
+	}
+	if job.TotalIter != 5 {
+		t.Errorf("total iterations %d, want 5", job.TotalIter)
+	}
+	if job.Cost.InputTokens != 5*1000 || job.Cost.OutputTokens != 5*500 {
+		t.Errorf("cost %+v, want the tokens of 5 generations", job.Cost)
+	}
+	if n := len(payloads[events.ScreenDonePayload](h, events.ScreenDone)); n != 4 {
+		t.Errorf("%d screens done, want 4", n)
+	}
+}
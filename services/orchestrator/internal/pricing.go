@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// ModelPrice is what a model charges, in USD per 1K tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Pricing prices models by name. Keys are a model as codegen names it
+// ("claude-opus-4-5"), or "kind:model" to price one provider's apart.
+type Pricing map[string]ModelPrice
+
+// defaultPricing is Anthropic's list prices, which OpenRouter passes on.
+var defaultPricing = Pricing{
+	"claude-opus-4-5":   {Input: 0.005, Output: 0.025},
+	"claude-opus-4-1":   {Input: 0.015, Output: 0.075},
+	"claude-opus-4":     {Input: 0.015, Output: 0.075},
+	"claude-sonnet-4-5": {Input: 0.003, Output: 0.015},
+	"claude-sonnet-4":   {Input: 0.003, Output: 0.015},
+	"claude-haiku-4-5":  {Input: 0.001, Output: 0.005},
+	"claude-3-5-haiku":  {Input: 0.0008, Output: 0.004},
+}
+
+// LoadPricing returns the default prices with those of LLM_PRICING, a JSON
+// object of ModelPrices, and then of the JSON file at LLM_PRICING_FILE
+// laid over them.
+func LoadPricing(inline, file string) (Pricing, error) {
+	p := make(Pricing, len(defaultPricing))
+	for k, v := range defaultPricing {
+		p[k] = v
+	}
+	layer := func(raw []byte, from string) error {
+		var over Pricing
+		if err := json.Unmarshal(raw, &over); err != nil {
+			return fmt.Errorf("%s: %w", from, err)
+		}
+		for k, v := range over {
+			if v.Input < 0 || v.Output < 0 {
+				return fmt.Errorf("%s: %s: prices must be >= 0", from, k)
+			}
+			p[k] = v
+		}
+		return nil
+	}
+	if inline != "" {
+		if err := layer([]byte(inline), "LLM_PRICING"); err != nil {
+			return nil, err
+		}
+	}
+	if file != "" {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := layer(raw, file); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// price looks provider, "kind:model", up: as is, then by model, then by
+// model as Anthropic names it. OpenRouter's "anthropic/claude-opus-4.5" is
+// Anthropic's claude-opus-4-5.
+func (p Pricing) price(provider string) (ModelPrice, bool) {
+	if mp, ok := p[provider]; ok {
+		return mp, true
+	}
+	_, model, _ := strings.Cut(provider, ":")
+	if mp, ok := p[model]; ok {
+		return mp, true
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	mp, ok := p[strings.ReplaceAll(model, ".", "-")]
+	return mp, ok
+}
+
+// cost prices usage, adding it to c. Presets and other code no provider
+// was billed for cost nothing.
+func (p Pricing) cost(c *events.JobCost, usage []events.TokenUsage) {
+	for _, u := range usage {
+		c.InputTokens += u.InputTokens
+		c.OutputTokens += u.OutputTokens
+		mp, ok := p.price(u.Provider)
+		if !ok {
+			if !slices.Contains(c.Unpriced, u.Provider) {
+				c.Unpriced = append(c.Unpriced, u.Provider)
+			}
+			continue
+		}
+		c.USD += float64(u.InputTokens)/1000*mp.Input + float64(u.OutputTokens)/1000*mp.Output
+	}
+}
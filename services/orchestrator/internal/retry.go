@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/forge-ai/forge/shared/events"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+)
+
+// resumeKey matches stored iterations to screens after a retry re-parses
+// the file. The index tells screens of the same name apart; the name
+// catches frames added or removed in the meantime, which shift the
+// indexes: a screen whose index now holds another name starts over.
+// Iterations stored before screen_index was have -1 and match nothing.
+type resumeKey struct {
+	ScreenIndex int
+	ScreenName  string
+	Platform    string
+}
+
+// resumedUnit is the best stored result of one screen×platform.
+type resumedUnit struct {
+	BestScore  float64
+	BestDiff   string
+	BestIter   int
+	BestCode   string // BestIter's code URL
+	Iterations int
+}
+
+// onJobRetryRequested restarts a failed job. The job is rebuilt from its
+// stored submission and its screens parsed again; screen×platforms whose
+// stored iterations already reached the threshold are then marked done
+// instead of being generated again.
+func (o *Orchestrator) onJobRetryRequested(ctx context.Context, d amqp.Delivery) error {
+	p, err := events.UnwrapChecked[events.JobRetryRequestedPayload](d.Body, events.JobRetryRequested)
+	if err != nil {
+		return err
+	}
+	if o.job(p.JobID) != nil {
+		log.Warn().Str("job", p.JobID).Msg("retry requested for a running job — ignored")
+		return nil
+	}
+
+	job, status, err := o.store.LoadJob(ctx, p.JobID)
+	if err != nil {
+		o.emitLog(ctx, p.JobID, "error", "job_retry", "Retry failed — could not load the job: "+err.Error(), nil)
+		return nil
+	}
+	if job == nil {
+		log.Warn().Str("job", p.JobID).Msg("retry requested for an unknown job — ignored")
+		return nil
+	}
+	if status == "done" {
+		o.emitLog(ctx, p.JobID, "warn", "job_retry", "Job already completed — nothing to retry", nil)
+		return nil
+	}
+	iters, err := o.store.LoadIterations(ctx, p.JobID)
+	if err != nil {
+		o.emitLog(ctx, p.JobID, "error", "job_retry", "Retry failed — could not load iterations: "+err.Error(), nil)
+		return nil
+	}
+
+	js := newJobState(job)
+	js.Resumed = make(map[resumeKey]resumedUnit)
+	for _, it := range iters {
+		k := resumeKey{it.ScreenIndex, it.ScreenName, it.Platform}
+		u := js.Resumed[k]
+		u.Iterations = max(u.Iterations, it.Iteration)
+		if it.Score > u.BestScore {
+			u.BestScore, u.BestDiff, u.BestIter, u.BestCode = it.Score, it.DiffURL, it.Iteration, it.CodeURL
+		}
+		js.Resumed[k] = u
+		js.Cost.USD += it.CostUSD
+		js.Cost.InputTokens += it.InputTokens
+		js.Cost.OutputTokens += it.OutputTokens
+	}
+
+	o.mu.Lock()
+	if o.jobs[p.JobID] != nil {
+		o.mu.Unlock()
+		return nil
+	}
+	o.jobs[p.JobID] = js
+	o.mu.Unlock()
+
+	o.emitLog(ctx, p.JobID, "info", "job_retry",
+		fmt.Sprintf("Retrying job — %d screen×platforms have stored iterations", len(js.Resumed)), nil)
+	o.persist(p.JobID, "reopen job", func(ctx context.Context) error { return o.store.ReopenJob(ctx, p.JobID) })
+
+	return o.requestScreens(ctx, job)
+}
+
+// resume marks the screen×platforms of a retried job that already passed
+// as done, counting them towards the job's totals, and returns how many
+// there were. Units that never passed start over. Call with js.mu held,
+// after the screen states are created.
+func (js *jobState) resume(jobID string) int {
+	n := 0
+	for i, s := range js.Screens {
+		for _, platform := range js.Platforms {
+			u, ok := js.Resumed[resumeKey{i, s.Name, platform}]
+			if !ok || u.BestScore < float64(js.Threshold) {
+				continue
+			}
+			ss := js.ScreenStates[screenKey{jobID, i, platform}]
+			ss.mu.Lock()
+			ss.Done = true
+			ss.Iteration = u.Iterations
+			ss.BestScore = u.BestScore
+			ss.Passed = true
+			ss.BestDiffURL = u.BestDiff
+			ss.BestIter, ss.BestCodeURL = u.BestIter, u.BestCode
+			ss.mu.Unlock()
+			js.Completed++
+			js.TotalScore += u.BestScore
+			js.TotalIter += u.Iterations
+			n++
+		}
+	}
+	js.Resumed = nil
+	return n
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+	"github.com/google/uuid"
+)
+
+func TestRetryResumesScreensOfTheSameName(t *testing.T) {
+	bus := mq.NewMemory()
+	t.Cleanup(bus.Close)
+	o, err := newOrchestrator(Config{APIPort: "0", MaxIter: 5, DefaultThreshold: 95, StoreQueue: 1000}, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(o.Close)
+	db := newFakeDB()
+	o.store.db = db
+	s := &standing{t: t, o: o, id: uuid.NewString()}
+
+	// Two frames named Home: the first passed before the job failed, the
+	// second never did. The name alone can't tell their iterations apart.
+	job := &events.JobSubmittedPayload{JobID: s.id, FigmaURL: "https://www.figma.com/file/abc/Test",
+		Platforms: []string{events.PlatformReact}, Styling: events.StylingTailwind, Threshold: 95}
+	row := jobRow(job)
+	row["status"] = "failed"
+	iteration := func(screen, iter int, score float64) map[string]any {
+		return map[string]any{"job_id": s.id, "screen_index": screen, "screen_name": "Home",
+			"platform": events.PlatformReact, "iteration": iter, "score": score}
+	}
+	ctx := context.Background()
+	if err := db.insert(ctx, "jobs", []map[string]any{row}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.insert(ctx, "iterations", []map[string]any{
+		iteration(0, 1, 90), iteration(0, 2, 98),
+		iteration(1, 1, 60), iteration(1, 2, 70),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	codegens, err := bus.Subscribe("test.codegen", events.CodegenRequested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.deliver(o.onJobRetryRequested, events.JobRetryRequested, events.JobRetryRequestedPayload{JobID: s.id}); err != nil {
+		t.Fatal(err)
+	}
+	home := events.FigmaScreen{Name: "Home", ComponentName: "Home", Width: 390, Height: 844}
+	if err := s.deliver(o.onFigmaParsed, events.FigmaParsed, events.FigmaParsedPayload{
+		JobID: s.id, FileName: "Test", ScreenCount: 2, Screens: []events.FigmaScreen{home, home},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if completed, _, ok := s.progress(); !ok || completed != 1 {
+		t.Errorf("%d units resumed as done, want screen 0 alone", completed)
+	}
+	js := o.job(s.id)
+	for i, want := range []struct {
+		done  bool
+		score float64
+	}{{true, 98}, {false, 0}} {
+		ss := js.screen(screenKey{s.id, i, events.PlatformReact})
+		ss.mu.Lock()
+		done, score := ss.Done, ss.BestScore
+		ss.mu.Unlock()
+		if done != want.done || score != want.score {
+			t.Errorf("screen %d: done %v at %.0f, want done %v at %.0f", i, done, score, want.done, want.score)
+		}
+	}
+	select {
+	case d := <-codegens:
+		d.Ack(false)
+		p, err := events.UnwrapChecked[events.CodegenRequestedPayload](d.Body, events.CodegenRequested)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ScreenIndex != 1 || p.Iteration != 1 {
+			t.Errorf("codegen requested for screen %d iteration %d, want screen 1 from the start", p.ScreenIndex, p.Iteration)
+		}
+	case <-time.After(time.Second):
+		t.Error("the screen that never passed was not generated again")
+	}
+}
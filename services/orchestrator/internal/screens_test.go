@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// screenResult waits for the screen_results rows of job id, one per
+// screen×platform, and returns the one of screen and platform.
+func screenResult(h *harness, id string, units, screen int, platform string) map[string]any {
+	h.t.Helper()
+	for _, r := range h.rows("screen_results", id, units) {
+		if r["screen_index"] == screen && r["platform"] == platform {
+			return r
+		}
+	}
+	h.t.Fatalf("no screen_results row for screen %d on %s", screen, platform)
+	return nil
+}
+
+func TestScreenResultPassed(t *testing.T) {
+	h := newHarness(t, Config{}, 1)
+	scores := []float64{70, 97}
+	h.score = func(p *events.DiffRequestedPayload) float64 { return scores[p.Iteration-1] }
+
+	id := h.submit(events.PlatformReact)
+	until[events.JobDonePayload](h, events.JobDone, id)
+
+	row := screenResult(h, id, 1, 0, events.PlatformReact)
+	want := map[string]any{
+		"screen_name":    "Screen 0",
+		"status":         events.ScreenStatusPassed,
+		"score":          97.0,
+		"best_score":     97.0,
+		"best_iteration": 2,
+		"iterations":     2,
+	}
+	for k, v := range want {
+		if row[k] != v {
+			t.Errorf("%s = %v, want %v", k, row[k], v)
+		}
+	}
+	if d, _ := row["duration_ms"].(int64); d < 0 {
+		t.Errorf("duration_ms = %v", row["duration_ms"])
+	}
+}
+
+func TestScreenResultMaxIterations(t *testing.T) {
+	h := newHarness(t, Config{MaxIter: 3}, 1)
+	scores := []float64{60, 80, 75}
+	h.score = func(p *events.DiffRequestedPayload) float64 { return scores[p.Iteration-1] }
+
+	id := h.submit(events.PlatformReact)
+	until[events.JobDonePayload](h, events.JobDone, id)
+
+	row := screenResult(h, id, 1, 0, events.PlatformReact)
+	want := map[string]any{
+		"status":         events.ScreenStatusMaxIterations,
+		"score":          75.0, // the last iteration's
+		"best_score":     80.0,
+		"best_iteration": 2,
+		"iterations":     3,
+	}
+	for k, v := range want {
+		if row[k] != v {
+			t.Errorf("%s = %v, want %v", k, row[k], v)
+		}
+	}
+}
+
+func TestScreenResultPerPlatform(t *testing.T) {
+	h := newHarness(t, Config{MaxIter: 2}, 2)
+	h.score = func(p *events.DiffRequestedPayload) float64 {
+		if p.Platform == events.PlatformNextJS {
+			return 50
+		}
+		return 99
+	}
+
+	id := h.submit(events.PlatformReact, events.PlatformNextJS)
+	until[events.JobDonePayload](h, events.JobDone, id)
+
+	for screen := 0; screen < 2; screen++ {
+		if s := screenResult(h, id, 4, screen, events.PlatformReact)["status"]; s != events.ScreenStatusPassed {
+			t.Errorf("screen %d on react: %v", screen, s)
+		}
+		if s := screenResult(h, id, 4, screen, events.PlatformNextJS)["status"]; s != events.ScreenStatusMaxIterations {
+			t.Errorf("screen %d on nextjs: %v", screen, s)
+		}
+	}
+	if rows := h.db.table("screen_results", id); len(rows) != 4 {
+		t.Errorf("%d screen_results rows, want one per screen×platform", len(rows))
+	}
+}
@@ -4,27 +4,137 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/jobdb"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Kinds of StoreError, by what trying again may do.
+const (
+	StoreTransient = "transient" // network errors, timeouts, 408, 429 and 5xx: may succeed later
+	StoreAuth      = "auth"      // 401 and 403: the service key is wrong, nothing will succeed
+	StoreConflict  = "conflict"  // 409: the row is already there
+	StoreRejected  = "rejected"  // any other 4xx: the request itself is wrong
+)
+
+// storeBreakerThreshold transient failures in a row open the store's
+// breaker: calls then fail at once for the cool-down, instead of each
+// waiting out its timeout and retries, and are let through again after a
+// single probe gets an answer.
+const storeBreakerThreshold = 5
+
+// maxStoreWait caps the backoff between attempts.
+const maxStoreWait = 2 * time.Second
+
+var errStoreOpen = errors.New("circuit open")
+
+// StoreError is a failed call to Supabase.
+type StoreError struct {
+	Op     string // method and table, e.g. "PATCH jobs"
+	Kind   string // one of the Store* kinds
+	Status int    // 0 without a response
+	Err    error
+}
+
+func (e *StoreError) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("supabase %s (%s): %v", e.Op, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("supabase %s %d (%s): %v", e.Op, e.Status, e.Kind, e.Err)
+}
+
+func (e *StoreError) Unwrap() error { return e.Err }
+
+// storeErrorKind returns the kind of error a response status is.
+func storeErrorKind(status int) string {
+	switch {
+	case status == 0, status == http.StatusRequestTimeout, status == http.StatusTooManyRequests, status >= 500:
+		return StoreTransient
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return StoreAuth
+	case status == http.StatusConflict:
+		return StoreConflict
+	}
+	return StoreRejected
+}
+
+// StorePolicy bounds the store's calls: each attempt gets Timeout,
+// idempotent calls are tried up to Attempts times in all, and the breaker
+// stays open for Cooldown.
+type StorePolicy struct {
+	Timeout  time.Duration
+	Attempts int
+	Cooldown time.Duration
+}
+
+// storeDB is where the store keeps its rows: Supabase's REST API, or
+// straight its Postgres.
+type storeDB interface {
+	// insert adds rows, which all have the same columns, to table. Rows of
+	// a table with upsertKeys replace those already there with their key.
+	insert(ctx context.Context, table string, rows []map[string]any) error
+	updateJob(ctx context.Context, jobID string, fields map[string]any) error
+	// loadJob returns nil for no such job.
+	loadJob(ctx context.Context, jobID string) (*storedJob, error)
+	loadIterations(ctx context.Context, jobID string) ([]storedIteration, error)
+}
+
+// upsertKeys are the natural keys of the tables whose rows are upserted:
+// a row inserted again, as a redelivered event does, replaces the one
+// there instead of adding a second. Events, the audit trail, are only
+// ever added.
+var upsertKeys = map[string][]string{
+	"jobs":           {"id"},
+	"iterations":     {"job_id", "screen_index", "platform", "iteration"},
+	"screen_results": {"job_id", "screen_index", "platform"},
+}
+
 type Store struct {
-	url    string
-	key    string
-	client *http.Client
+	db      storeDB       // nil without a database configured
+	rest    *restDB       // for Supabase Storage; nil without SUPABASE_URL
+	webhook *stateWebhook // told of every status the store writes
+
+	mu     sync.Mutex
+	status map[string]string // last status written or read, per unfinished job
 }
 
-func NewStore(url, key string) *Store {
-	return &Store{url: url, key: key, client: &http.Client{Timeout: 10 * time.Second}}
+// NewStore keeps rows in the Postgres pool when there is one, and through
+// Supabase's REST API at url otherwise. Manifests always go to Supabase
+// Storage at url.
+func NewStore(url, key string, policy StorePolicy, pool *pgxpool.Pool, webhook *stateWebhook) *Store {
+	s := &Store{webhook: webhook, status: make(map[string]string)}
+	if url != "" {
+		s.rest = newRestDB(url, key, policy)
+		s.db = s.rest
+	}
+	if pool != nil {
+		s.db = &pgDB{pool: pool}
+	}
+	return s
 }
 
 func (s *Store) CreateJob(ctx context.Context, p *events.JobSubmittedPayload) error {
-	if s.url == "" { return nil }
-	return s.post(ctx, "jobs", map[string]any{
+	if s.db != nil {
+		if err := s.db.insert(ctx, "jobs", []map[string]any{jobRow(p)}); err != nil { return err }
+	}
+	s.transition(p.JobID, "pending")
+	return nil
+}
+
+// jobRow is the jobs row of a new job.
+func jobRow(p *events.JobSubmittedPayload) map[string]any {
+	return map[string]any{
 		"id":        p.JobID,
 		"figma_url": p.FigmaURL,
 		"repo_url":  p.RepoURL,
@@ -32,36 +142,156 @@ func (s *Store) CreateJob(ctx context.Context, p *events.JobSubmittedPayload) er
 		"styling":   p.Styling,
 		"threshold": p.Threshold,
 		"status":    "pending",
+		"request":   p,
+	}
+}
+
+// storedJob is a job row as LoadJob reads it.
+type storedJob struct {
+	Status  string                      `json:"status"`
+	Request *events.JobSubmittedPayload `json:"request"`
+
+	FigmaURL  string   `json:"figma_url"`
+	RepoURL   string   `json:"repo_url"`
+	Platforms []string `json:"platforms"`
+	Styling   string   `json:"styling"`
+	Threshold int      `json:"threshold"`
+}
+
+// storedIteration is the part of an iteration row a retry needs.
+type storedIteration struct {
+	ScreenIndex int     `json:"screen_index"`
+	ScreenName  string  `json:"screen_name"`
+	Platform    string  `json:"platform"`
+	Iteration   int     `json:"iteration"`
+	Score       float64 `json:"score"`
+	DiffURL     string  `json:"diff_url"`
+	CodeURL     string  `json:"code_url"`
+
+	CostUSD      float64 `json:"cost_usd"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+}
+
+// LoadJob returns the stored submission of a job and its status, or a nil
+// payload if there is no such job. Jobs stored before the request column
+// existed are rebuilt from their columns, without the per-job options.
+func (s *Store) LoadJob(ctx context.Context, jobID string) (*events.JobSubmittedPayload, string, error) {
+	if s.db == nil { return nil, "", fmt.Errorf("no store configured") }
+	j, err := s.db.loadJob(ctx, jobID)
+	if err != nil || j == nil { return nil, "", err }
+	if j.Status != "done" {
+		s.mu.Lock()
+		s.status[jobID] = j.Status
+		s.mu.Unlock()
+	}
+	if j.Request != nil { return j.Request, j.Status, nil }
+	return &events.JobSubmittedPayload{
+		JobID: jobID, FigmaURL: j.FigmaURL, RepoURL: j.RepoURL,
+		Platforms: j.Platforms, Styling: j.Styling, Threshold: j.Threshold,
+	}, j.Status, nil
+}
+
+// LoadIterations returns every stored iteration of a job.
+func (s *Store) LoadIterations(ctx context.Context, jobID string) ([]storedIteration, error) {
+	if s.db == nil { return nil, nil }
+	return s.db.loadIterations(ctx, jobID)
+}
+
+// ReopenJob puts a failed job back to pending for a retry.
+func (s *Store) ReopenJob(ctx context.Context, jobID string) error {
+	return s.setStatus(ctx, jobID, map[string]any{
+		"status": "pending", "error": nil, "failed_step": nil, "updated_at": time.Now(),
 	})
 }
 
 func (s *Store) UpdateJobScreenCount(ctx context.Context, jobID string, count int) error {
-	if s.url == "" { return nil }
-	return s.patch(ctx, "jobs?id=eq."+jobID, map[string]any{
+	return s.setStatus(ctx, jobID, map[string]any{
 		"screen_count": count,
 		"status":       "running",
 		"updated_at":   time.Now(),
 	})
 }
 
-func (s *Store) MarkJobDone(ctx context.Context, jobID string) error {
-	if s.url == "" { return nil }
-	return s.patch(ctx, "jobs?id=eq."+jobID, map[string]any{
+func (s *Store) MarkJobDone(ctx context.Context, jobID string, cost events.JobCost) error {
+	return s.setStatus(ctx, jobID, map[string]any{
 		"status": "done", "updated_at": time.Now(),
+		"cost_usd": cost.USD, "input_tokens": cost.InputTokens, "output_tokens": cost.OutputTokens,
 	})
 }
 
-func (s *Store) MarkJobFailed(ctx context.Context, jobID, errMsg string) error {
-	if s.url == "" { return nil }
-	return s.patch(ctx, "jobs?id=eq."+jobID, map[string]any{
-		"status": "failed", "error": errMsg, "updated_at": time.Now(),
+// MarkJobFailed records that a job failed at step, as job.failed names it.
+func (s *Store) MarkJobFailed(ctx context.Context, jobID, step, errMsg string) error {
+	return s.setStatus(ctx, jobID, map[string]any{
+		"status": "failed", "error": errMsg, "failed_step": step, "updated_at": time.Now(),
 	})
 }
 
-func (s *Store) SaveIteration(ctx context.Context, p events.DiffCompletePayload) error {
-	if s.url == "" { return nil }
-	return s.post(ctx, "iterations", map[string]any{
+// setStatus writes fields, which include the job's new status, to its row
+// and reports the change once the write went through.
+func (s *Store) setStatus(ctx context.Context, jobID string, fields map[string]any) error {
+	if s.db != nil {
+		if err := s.db.updateJob(ctx, jobID, fields); err != nil { return err }
+	}
+	s.transition(jobID, fields["status"].(string))
+	return nil
+}
+
+// transition sends the state webhook a job's move from its last known
+// status to status. Finished jobs are forgotten; a retry reads the status
+// back through LoadJob.
+func (s *Store) transition(jobID, status string) {
+	s.mu.Lock()
+	from := s.status[jobID]
+	if status == "done" || status == "failed" {
+		delete(s.status, jobID)
+	} else {
+		s.status[jobID] = status
+	}
+	s.mu.Unlock()
+	if from == status { return }
+	s.webhook.send(jobStateChange{JobID: jobID, From: from, To: status, At: time.Now().UTC()})
+}
+
+// insertRows inserts rows, which must all have the same columns, into table
+// in one request.
+func (s *Store) insertRows(ctx context.Context, table string, rows []map[string]any) error {
+	if s.db == nil || len(rows) == 0 { return nil }
+	return s.db.insert(ctx, table, lastByKey(table, rows))
+}
+
+// lastByKey drops the rows of a batch that a later one has the same
+// upsertKeys as: one upsert can't write a row twice.
+func lastByKey(table string, rows []map[string]any) []map[string]any {
+	key := upsertKeys[table]
+	if key == nil || len(rows) < 2 { return rows }
+	keyOf := func(row map[string]any) string {
+		vals := make([]string, len(key))
+		for i, c := range key {
+			vals[i] = fmt.Sprint(row[c])
+		}
+		return strings.Join(vals, "\x00")
+	}
+	last := make(map[string]int, len(rows))
+	for i, row := range rows {
+		last[keyOf(row)] = i
+	}
+	if len(last) == len(rows) { return rows }
+	out := make([]map[string]any, 0, len(last))
+	for i, row := range rows {
+		if last[keyOf(row)] == i { out = append(out, row) }
+	}
+	return out
+}
+
+// iterationRow is the iterations row of a diffed iteration, with its code,
+// where that is uploaded and what it cost to generate.
+func iterationRow(p events.DiffCompletePayload, code, codeURL string, cost events.JobCost, delta *events.DiffDelta) map[string]any {
+	return map[string]any{
 		"job_id":          p.JobID,
+		"code":            code,
+		"code_url":        codeURL,
+		"screen_index":    p.ScreenIndex,
 		"screen_name":     p.Screen.Name,
 		"platform":        p.Platform,
 		"iteration":       p.Iteration,
@@ -71,37 +301,288 @@ func (s *Store) SaveIteration(ctx context.Context, p events.DiffCompletePayload)
 		"spacing_score":   p.Diff.Spacing,
 		"color_score":     p.Diff.Color,
 		"diff_url":        p.Diff.DiffImageURL,
+		"screenshot_url":  p.Diff.GeneratedImageURL,
+		"reference_url":   p.Diff.ReferenceImageURL,
 		"mismatch_regions": p.Diff.Regions,
+		"cost_usd":        cost.USD,
+		"input_tokens":    cost.InputTokens,
+		"output_tokens":   cost.OutputTokens,
+		"score_delta":     delta,
+	}
+}
+
+// screenResultRow is the screen_results row of a finished screen×platform.
+func screenResultRow(p events.ScreenDonePayload) map[string]any {
+	return map[string]any{
+		"job_id":         p.JobID,
+		"screen_index":   p.ScreenIndex,
+		"screen_name":    p.ScreenName,
+		"platform":       p.Platform,
+		"status":         p.Status,
+		"score":          p.Score,
+		"best_score":     p.BestScore,
+		"best_iteration": p.BestIteration,
+		"iterations":     p.Iterations,
+		"code_url":       p.CodeURL,
+		"diff_image_url": p.DiffImageURL,
+		"duration_ms":    p.DurationMS,
+	}
+}
+
+// eventRow is the events row, the audit trail, of an event about a job.
+// Events whose job ID is not one, which the row could not refer to, are
+// stored without it.
+func eventRow(jobID, routingKey string, payload json.RawMessage) map[string]any {
+	row := map[string]any{"job_id": nil, "routing_key": routingKey, "payload": payload}
+	if _, err := uuid.Parse(jobID); err == nil { row["job_id"] = jobID }
+	return row
+}
+
+// UploadManifest stores m as manifests/<job>.json in the assets bucket and
+// returns its public URL.
+func (s *Store) UploadManifest(ctx context.Context, m events.JobManifest) (string, error) {
+	if s.rest == nil { return "", nil }
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil { return "", err }
+	path := "manifests/" + m.JobID + ".json"
+	if err := s.rest.upload(ctx, path, "application/json", b); err != nil { return "", err }
+	return s.AssetURL(path), nil
+}
+
+// maxCodeUpload caps the code uploaded per iteration. Larger code is still
+// on the iterations row, just not in Storage.
+const maxCodeUpload = 1 << 20
+
+// codePath is where an iteration's code is kept in the assets bucket.
+func codePath(jobID string, screenIndex int, platform string, iteration int, filename string) string {
+	return fmt.Sprintf("code/%s/%d/%s/iter-%d/%s", jobID, screenIndex, platform, iteration, path.Base(filename))
+}
+
+// AssetURL is the public URL of path in the assets bucket, or "" without
+// Supabase Storage to keep it in.
+func (s *Store) AssetURL(path string) string {
+	if s.rest == nil { return "" }
+	return s.rest.url + "/storage/v1/object/public/forge-assets/" + path
+}
+
+// UploadCode stores an iteration's code, from a file named filename, at
+// path in the assets bucket.
+func (s *Store) UploadCode(ctx context.Context, path, filename, code string) error {
+	if s.rest == nil { return nil }
+	return s.rest.upload(ctx, path, codeContentType(filename), []byte(code))
+}
+
+// codeContentType is the type code is served as: text, so that browsers
+// show it rather than download or run it.
+func codeContentType(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ts", ".tsx":
+		return "text/typescript; charset=utf-8"
+	case ".kt":
+		return "text/x-kotlin; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// ── Supabase REST ─────────────────────────────────────────────────────────────
+
+// restDB keeps rows through Supabase's REST API.
+type restDB struct {
+	url     string
+	key     string
+	client  *http.Client
+	policy  StorePolicy
+	backoff time.Duration
+
+	// The breaker.
+	mu        sync.Mutex
+	failures  int       // transient failures in a row
+	openUntil time.Time // zero while closed
+	probing   bool      // a probe is out after the cool-down
+}
+
+func newRestDB(url, key string, policy StorePolicy) *restDB {
+	policy.Attempts = max(policy.Attempts, 1)
+	return &restDB{url: url, key: key, client: &http.Client{}, policy: policy, backoff: 200 * time.Millisecond}
+}
+
+func (r *restDB) insert(ctx context.Context, table string, rows []map[string]any) error {
+	if key := upsertKeys[table]; key != nil {
+		return r.upsert(ctx, jobdb.From(table).OnConflict(key...), rows)
+	}
+	return r.post(ctx, jobdb.From(table), rows)
+}
+
+func (r *restDB) updateJob(ctx context.Context, jobID string, fields map[string]any) error {
+	return r.patch(ctx, jobdb.From("jobs").EqUUID("id", jobID), fields)
+}
+
+func (r *restDB) loadJob(ctx context.Context, jobID string) (*storedJob, error) {
+	var rows []storedJob
+	q := jobdb.From("jobs").EqUUID("id", jobID).
+		Select("status", "request", "figma_url", "repo_url", "platforms", "styling", "threshold")
+	if err := r.get(ctx, q, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 { return nil, nil }
+	return &rows[0], nil
+}
+
+func (r *restDB) loadIterations(ctx context.Context, jobID string) ([]storedIteration, error) {
+	// Rows stored before screen_index existed have it null: -1, as in pgDB.
+	var rows []struct {
+		storedIteration
+		ScreenIndex *int `json:"screen_index"`
+	}
+	q := jobdb.From("iterations").EqUUID("job_id", jobID).
+		Select("screen_index", "screen_name", "platform", "iteration", "score", "diff_url", "code_url", "cost_usd", "input_tokens", "output_tokens")
+	if err := r.get(ctx, q, &rows); err != nil { return nil, err }
+	its := make([]storedIteration, len(rows))
+	for i, row := range rows {
+		its[i], its[i].ScreenIndex = row.storedIteration, -1
+		if row.ScreenIndex != nil { its[i].ScreenIndex = *row.ScreenIndex }
+	}
+	return its, nil
+}
+
+func (r *restDB) get(ctx context.Context, q *jobdb.Query, out any) error {
+	path, err := restPath("GET", q)
+	if err != nil { return err }
+	return r.do(ctx, "GET", path, nil, true, out, nil)
+}
+
+// post inserts a row. Inserting is not idempotent, so it is not retried:
+// a retry of an insert that went through would add the row twice.
+func (r *restDB) post(ctx context.Context, q *jobdb.Query, v any) error {
+	path, err := restPath("POST", q)
+	if err != nil { return err }
+	b, _ := json.Marshal(v)
+	return r.do(ctx, "POST", path, b, false, nil, func(req *http.Request) {
+		req.Header.Set("Prefer", "return=minimal")
 	})
 }
 
-func (s *Store) post(ctx context.Context, table string, v any) error {
+// upsert inserts rows, merging each whose q.OnConflict columns match a row
+// already there into it.
+// Unlike post it can be repeated safely, so it is retried.
+func (r *restDB) upsert(ctx context.Context, q *jobdb.Query, v any) error {
+	path, err := restPath("POST", q)
+	if err != nil { return err }
 	b, _ := json.Marshal(v)
-	req, _ := http.NewRequestWithContext(ctx, "POST", s.url+"/rest/v1/"+table, bytes.NewReader(b))
-	s.headers(req)
-	req.Header.Set("Prefer", "return=minimal")
-	resp, err := s.client.Do(req)
+	return r.do(ctx, "POST", path, b, true, nil, func(req *http.Request) {
+		req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	})
+}
+
+func (r *restDB) patch(ctx context.Context, q *jobdb.Query, v any) error {
+	path, err := restPath("PATCH", q)
 	if err != nil { return err }
+	b, _ := json.Marshal(v)
+	return r.do(ctx, "PATCH", path, b, true, nil, func(req *http.Request) {
+		req.Header.Set("Prefer", "return=minimal")
+	})
+}
+
+// upload stores body at path in the assets bucket. x-upsert replaces what
+// is there, which makes the upload safe to repeat.
+func (r *restDB) upload(ctx context.Context, path, contentType string, body []byte) error {
+	return r.do(ctx, "POST", "/storage/v1/object/forge-assets/"+path, body, true, nil, func(req *http.Request) {
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("x-upsert", "true")
+	})
+}
+
+// restPath is q's path under the REST API. A query with an invalid part,
+// an ID that isn't a UUID, is never sent: it is rejected as it is.
+func restPath(method string, q *jobdb.Query) (string, error) {
+	path, err := q.Path()
+	if err != nil { return "", &StoreError{Op: method + " " + q.Table(), Kind: StoreRejected, Err: err} }
+	return "/rest/v1/" + path, nil
+}
+
+// do sends a request to Supabase, decoding the answer into out when it is
+// non-nil. Idempotent requests are retried on transient failures, backing
+// off between attempts, until they succeed, the attempts run out or the
+// breaker opens. Every failure is a *StoreError.
+func (r *restDB) do(ctx context.Context, method, path string, body []byte, idempotent bool, out any, prep func(*http.Request)) error {
+	table, _, _ := strings.Cut(strings.TrimPrefix(path, "/rest/v1/"), "?")
+	op := method + " " + table
+	wait := r.backoff
+	for attempt := 1; ; attempt++ {
+		if !r.allow(time.Now()) {
+			return &StoreError{Op: op, Kind: StoreTransient, Err: errStoreOpen}
+		}
+		err := r.attempt(ctx, method, path, body, out, prep)
+		r.record(err)
+		if err == nil { return nil }
+		err.Op = op
+		if err.Kind != StoreTransient || !idempotent || attempt >= r.policy.Attempts { return err }
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(min(wait, maxStoreWait)):
+		}
+		wait *= 2
+	}
+}
+
+func (r *restDB) attempt(ctx context.Context, method, path string, body []byte, out any, prep func(*http.Request)) *StoreError {
+	if r.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.policy.Timeout)
+		defer cancel()
+	}
+	var rd io.Reader
+	if body != nil { rd = bytes.NewReader(body) }
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, rd)
+	if err != nil { return &StoreError{Kind: StoreRejected, Err: err} }
+	r.headers(req)
+	if prep != nil { prep(req) }
+	resp, err := r.client.Do(req)
+	if err != nil { return &StoreError{Kind: StoreTransient, Err: err} }
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		raw, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("supabase %d: %s", resp.StatusCode, raw)
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		msg := strings.TrimSpace(string(raw))
+		if msg == "" { msg = http.StatusText(resp.StatusCode) }
+		return &StoreError{Kind: storeErrorKind(resp.StatusCode), Status: resp.StatusCode, Err: errors.New(msg)}
+	}
+	if out == nil { return nil }
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &StoreError{Kind: StoreTransient, Status: resp.StatusCode, Err: fmt.Errorf("decode: %w", err)}
 	}
 	return nil
 }
 
-func (s *Store) patch(ctx context.Context, path string, v any) error {
-	b, _ := json.Marshal(v)
-	req, _ := http.NewRequestWithContext(ctx, "PATCH", s.url+"/rest/v1/"+path, bytes.NewReader(b))
-	s.headers(req)
-	resp, err := s.client.Do(req)
-	if err != nil { return err }
-	defer resp.Body.Close()
-	return nil
+// allow reports whether the store may be called now: its breaker is
+// closed, or its cool-down is over and this is the one probe.
+func (r *restDB) allow(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.openUntil.IsZero() { return true }
+	if now.Before(r.openUntil) || r.probing { return false }
+	r.probing = true
+	return true
 }
 
-func (s *Store) headers(req *http.Request) {
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.key)
-	req.Header.Set("apikey", s.key)
+// record counts an attempt towards the breaker. Only transient failures
+// count against Supabase; an answer of any other kind shows it is up.
+func (r *restDB) record(err *StoreError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.probing = false
+	if err == nil || err.Kind != StoreTransient {
+		r.failures, r.openUntil = 0, time.Time{}
+		return
+	}
+	r.failures++
+	if r.failures >= storeBreakerThreshold {
+		r.openUntil = time.Now().Add(r.policy.Cooldown)
+	}
 }
+
+func (r *restDB) headers(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.key)
+	req.Header.Set("apikey", r.key)
+}
\ No newline at end of file
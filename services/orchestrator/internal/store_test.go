@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/google/uuid"
+)
+
+// postgREST is a Supabase REST API that keeps its tables in memory. A
+// POST merges the rows matching on its on_conflict columns when it
+// prefers resolution=merge-duplicates, as PostgREST does; without that,
+// every row is added.
+type postgREST struct {
+	mu     sync.Mutex
+	tables map[string][]map[string]any
+}
+
+func newPostgREST(t *testing.T) (*postgREST, *httptest.Server) {
+	t.Helper()
+	p := &postgREST{tables: make(map[string][]map[string]any)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "unexpected "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		var rows []map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var key []string
+		if strings.Contains(r.Header.Get("Prefer"), "resolution=merge-duplicates") {
+			if c := r.URL.Query().Get("on_conflict"); c != "" {
+				key = strings.Split(c, ",")
+			}
+		}
+		p.insert(strings.TrimPrefix(r.URL.Path, "/rest/v1/"), key, rows)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+func (p *postgREST) insert(table string, key []string, rows []map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keyOf := func(row map[string]any) string {
+		vals := make([]string, len(key))
+		for i, c := range key {
+			vals[i] = fmt.Sprint(row[c])
+		}
+		return strings.Join(vals, "\x00")
+	}
+next:
+	for _, row := range rows {
+		if key != nil {
+			for i, have := range p.tables[table] {
+				if keyOf(have) == keyOf(row) {
+					for c, v := range row {
+						have[c] = v
+					}
+					p.tables[table][i] = have
+					continue next
+				}
+			}
+		}
+		p.tables[table] = append(p.tables[table], row)
+	}
+}
+
+func (p *postgREST) rows(table string) []map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]map[string]any(nil), p.tables[table]...)
+}
+
+func testStore(t *testing.T) (*Store, *postgREST) {
+	t.Helper()
+	p, srv := newPostgREST(t)
+	return NewStore(srv.URL, "key", StorePolicy{Timeout: 5 * time.Second, Attempts: 1}, nil, newStateWebhook("", "")), p
+}
+
+func TestStoreCreateJobTwiceKeepsOneRow(t *testing.T) {
+	s, db := testStore(t)
+	p := &events.JobSubmittedPayload{
+		JobID:     uuid.NewString(),
+		FigmaURL:  "https://www.figma.com/file/abc/Test",
+		Platforms: []string{events.PlatformReact},
+		Styling:   events.StylingTailwind,
+		Threshold: 95,
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.CreateJob(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rows := db.rows("jobs"); len(rows) != 1 {
+		t.Errorf("%d jobs rows for one job submitted twice", len(rows))
+	}
+}
+
+func TestStoreSaveIterationTwiceKeepsOneRow(t *testing.T) {
+	s, db := testStore(t)
+	ctx := context.Background()
+	jobID := uuid.NewString()
+	diff := func(screen, iteration int, score float64) map[string]any {
+		return iterationRow(events.DiffCompletePayload{
+			JobID:       jobID,
+			ScreenIndex: screen,
+			Platform:    events.PlatformReact,
+			Iteration:   iteration,
+			Diff:        events.DiffResult{Score: score},
+			Screen:      events.FigmaScreen{Name: fmt.Sprintf("Screen %d", screen)},
+		}, "code", "", events.JobCost{}, nil)
+	}
+
+	// A redelivered diff.complete saves its iteration again, in another
+	// batch and in the same one; each screen keeps its own row.
+	for _, batch := range [][]map[string]any{
+		{diff(0, 1, 80)},
+		{diff(0, 1, 81), diff(1, 1, 70)},
+		{diff(1, 1, 71), diff(1, 1, 72)},
+	} {
+		if err := s.insertRows(ctx, "iterations", batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := db.rows("iterations")
+	if len(rows) != 2 {
+		t.Fatalf("%d iterations rows, want one per screen: %v", len(rows), rows)
+	}
+	scores := map[float64]float64{} // by screen_index
+	for _, r := range rows {
+		scores[r["screen_index"].(float64)] = r["score"].(float64)
+	}
+	if scores[0] != 81 || scores[1] != 72 {
+		t.Errorf("scores by screen %v, want the last saved: 81 and 72", scores)
+	}
+}
+
+func TestStoreSaveScreenResultTwiceKeepsOneRow(t *testing.T) {
+	s, db := testStore(t)
+	jobID := uuid.NewString()
+	for _, status := range []string{events.ScreenStatusFailed, events.ScreenStatusPassed} {
+		row := screenResultRow(events.ScreenDonePayload{JobID: jobID, ScreenIndex: 2, Platform: events.PlatformKMP, Status: status})
+		if err := s.insertRows(context.Background(), "screen_results", []map[string]any{row}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows := db.rows("screen_results")
+	if len(rows) != 1 {
+		t.Fatalf("%d screen_results rows", len(rows))
+	}
+	if rows[0]["screen_index"] != 2.0 || rows[0]["status"] != events.ScreenStatusPassed {
+		t.Errorf("row %v", rows[0])
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	cols := []string{"iteration", "job_id", "platform", "score", "screen_index"}
+	got := onConflict(upsertKeys["iterations"], cols)
+	want := ` on conflict ("job_id", "screen_index", "platform", "iteration") do update set "score" = excluded."score"`
+	if got != want {
+		t.Errorf("\n got %s\nwant %s", got, want)
+	}
+	if got := onConflict(nil, []string{"job_id", "payload"}); got != " on conflict do nothing" {
+		t.Errorf("events: %s", got)
+	}
+}
+
+// failingREST answers every request with status after delay, counting them.
+func failingREST(t *testing.T, status int, delay time.Duration) (*restDB, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"message":"%s"}`, http.StatusText(status))
+	}))
+	t.Cleanup(srv.Close)
+	r := newRestDB(srv.URL, "key", StorePolicy{Timeout: 100 * time.Millisecond, Attempts: 3, Cooldown: time.Hour})
+	r.backoff = time.Millisecond
+	return r, &hits
+}
+
+func TestStoreErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		delay  time.Duration
+		kind   string
+		tries  int32 // of an idempotent call, with 3 attempts
+	}{
+		{"unauthorized", http.StatusUnauthorized, 0, StoreAuth, 1},
+		{"forbidden", http.StatusForbidden, 0, StoreAuth, 1},
+		{"conflict", http.StatusConflict, 0, StoreConflict, 1},
+		{"bad request", http.StatusBadRequest, 0, StoreRejected, 1},
+		{"unprocessable", http.StatusUnprocessableEntity, 0, StoreRejected, 1},
+		{"server error", http.StatusInternalServerError, 0, StoreTransient, 3},
+		{"unavailable", http.StatusServiceUnavailable, 0, StoreTransient, 3},
+		{"rate limited", http.StatusTooManyRequests, 0, StoreTransient, 3},
+		{"request timeout", http.StatusRequestTimeout, 0, StoreTransient, 3},
+		{"timeout", http.StatusOK, time.Second, StoreTransient, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, hits := failingREST(t, tc.status, tc.delay)
+			err := r.updateJob(context.Background(), uuid.NewString(), map[string]any{"status": "running"})
+			var se *StoreError
+			if !errors.As(err, &se) {
+				t.Fatalf("err = %v, want a *StoreError", err)
+			}
+			if se.Kind != tc.kind || se.Op != "PATCH jobs" {
+				t.Errorf("%s is %q on %q, want %q", err, se.Kind, se.Op, tc.kind)
+			}
+			wantStatus := tc.status
+			if tc.delay > 0 {
+				wantStatus = 0 // no response
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("a timeout is %v", err)
+				}
+			}
+			if se.Status != wantStatus {
+				t.Errorf("status %d, want %d", se.Status, wantStatus)
+			}
+			if n := hits.Load(); n != tc.tries {
+				t.Errorf("tried %d times, want %d", n, tc.tries)
+			}
+		})
+	}
+}
+
+func TestStoreDoesNotRetryInserts(t *testing.T) {
+	r, hits := failingREST(t, http.StatusBadGateway, 0)
+	// Events are only ever added, so a retry could add one twice.
+	err := r.insert(context.Background(), "events", []map[string]any{{"job_id": uuid.NewString()}})
+	var se *StoreError
+	if !errors.As(err, &se) || se.Kind != StoreTransient || se.Op != "POST events" {
+		t.Errorf("err = %v", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("an insert was tried %d times", n)
+	}
+}
+
+func TestStoreBreaker(t *testing.T) {
+	r, hits := failingREST(t, http.StatusServiceUnavailable, 0)
+	r.policy.Attempts = 1
+	patch := func() error {
+		return r.updateJob(context.Background(), uuid.NewString(), map[string]any{"status": "running"})
+	}
+	for range storeBreakerThreshold {
+		patch()
+	}
+	err := patch()
+	var se *StoreError
+	if !errors.As(err, &se) || se.Kind != StoreTransient || !errors.Is(err, errStoreOpen) {
+		t.Errorf("with the breaker open: %v", err)
+	}
+	if n := hits.Load(); n != storeBreakerThreshold {
+		t.Errorf("Supabase was called %d times, want %d", n, storeBreakerThreshold)
+	}
+
+	// An answer of any other kind shows Supabase is up: a 409 doesn't
+	// count towards the breaker.
+	c, hits := failingREST(t, http.StatusConflict, 0)
+	c.policy.Attempts = 1
+	for range storeBreakerThreshold + 2 {
+		c.updateJob(context.Background(), uuid.NewString(), map[string]any{"status": "running"})
+	}
+	if n := hits.Load(); n != storeBreakerThreshold+2 {
+		t.Errorf("conflicts opened the breaker after %d calls", n)
+	}
+}
+
+func TestStoreRejectsInvalidIDsUnsent(t *testing.T) {
+	r, hits := failingREST(t, http.StatusOK, 0)
+	err := r.updateJob(context.Background(), "not-a-uuid", map[string]any{"status": "running"})
+	var se *StoreError
+	if !errors.As(err, &se) || se.Kind != StoreRejected {
+		t.Errorf("err = %v, want rejected", err)
+	}
+	if hits.Load() != 0 {
+		t.Error("the query was sent")
+	}
+}
+
+// upload is a request the storage mock received.
+type upload struct {
+	path, contentType, upsert, auth string
+	body                            []byte
+}
+
+func TestIterationCodeIsUploaded(t *testing.T) {
+	var mu sync.Mutex
+	var uploads []upload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		uploads = append(uploads, upload{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("x-upsert"), r.Header.Get("Authorization"), body})
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := newStanding(t, 1, events.PlatformReact)
+	o := s.o
+	o.store.rest = newRestDB(srv.URL, "service-key", StorePolicy{Timeout: 5 * time.Second, Attempts: 1})
+	db := o.store.db.(*fakeDB)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.writes.Run(ctx) // uploads go through the write-behind queue
+	scr := events.FigmaScreen{Name: "Screen 0", ComponentName: "Screen0"}
+
+	iterate := func(iteration int, code string) {
+		t.Helper()
+		if err := s.deliver(o.onCodegenComplete, events.CodegenComplete, events.CodegenCompletePayload{
+			JobID: s.id, ScreenIndex: 0, Platform: events.PlatformReact, Iteration: iteration,
+			Code: code, Filename: "../src/Screen0.tsx", Threshold: 95, Screen: scr,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.deliver(o.onDiffComplete, events.DiffComplete, events.DiffCompletePayload{
+			JobID: s.id, ScreenIndex: 0, Platform: events.PlatformReact, Iteration: iteration,
+			Diff: events.DiffResult{Score: 80}, Threshold: 95, Screen: scr,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	codeURL := func(iteration int) (string, bool) {
+		for _, row := range db.table("iterations", s.id) {
+			if row["iteration"] == iteration {
+				url, _ := row["code_url"].(string)
+				return url, true
+			}
+		}
+		return "", false
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	const code = "export default function Screen0() { return <p>hi</p> }"
+	iterate(1, code)
+	waitFor("the upload", func() bool { mu.Lock(); defer mu.Unlock(); return len(uploads) == 1 })
+	objectPath := "code/" + s.id + "/0/react/iter-1/Screen0.tsx" // the file's own name, not its path
+	u := uploads[0]
+	if u.path != "/storage/v1/object/forge-assets/"+objectPath {
+		t.Errorf("uploaded to %s", u.path)
+	}
+	if u.contentType != "text/typescript; charset=utf-8" || u.upsert != "true" || u.auth != "Bearer service-key" || string(u.body) != code {
+		t.Errorf("upload %+v", u)
+	}
+	waitFor("iteration 1's row", func() bool { _, ok := codeURL(1); return ok })
+	if url, _ := codeURL(1); url != srv.URL+"/storage/v1/object/public/forge-assets/"+objectPath {
+		t.Errorf("code_url %q", url)
+	}
+
+	// Code over the cap stays on the row alone.
+	iterate(2, strings.Repeat("/", maxCodeUpload+1))
+	waitFor("iteration 2's row", func() bool { _, ok := codeURL(2); return ok })
+	if url, _ := codeURL(2); url != "" {
+		t.Errorf("oversized code linked at %q", url)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(uploads) != 1 {
+		t.Errorf("%d uploads", len(uploads))
+	}
+}
+
+func TestCodeContentType(t *testing.T) {
+	for name, want := range map[string]string{
+		"Screen0.tsx": "text/typescript; charset=utf-8",
+		"api.TS":      "text/typescript; charset=utf-8",
+		"Screen0.kt":  "text/x-kotlin; charset=utf-8",
+		"index.html":  "text/plain; charset=utf-8", // shown, not rendered
+		"Makefile":    "text/plain; charset=utf-8",
+	} {
+		if got := codeContentType(name); got != want {
+			t.Errorf("codeContentType(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/forge-ai/forge/shared/httpx"
+	"github.com/rs/zerolog/log"
+)
+
+// jobStateChange is the body POSTed to JOB_STATE_WEBHOOK_URL on every job
+// status change. States are the ones stored on the job row: pending,
+// running, done and failed. From is empty when the previous state isn't
+// known, as for a new job.
+type jobStateChange struct {
+	JobID string    `json:"job_id"`
+	From  string    `json:"from,omitempty"`
+	To    string    `json:"to"`
+	At    time.Time `json:"at"`
+}
+
+// signatureHeader carries the hex HMAC-SHA256 of the body under the
+// webhook secret, prefixed "sha256=".
+const signatureHeader = "X-Forge-Signature"
+
+// stateWebhook delivers job state changes in the order they happened, off
+// the event handlers' path: a slow or unreachable receiver delays other
+// deliveries, never the pipeline.
+type stateWebhook struct {
+	url    string
+	secret string
+	client *http.Client
+	queue  chan jobStateChange
+}
+
+func newStateWebhook(url, secret string) *stateWebhook {
+	return &stateWebhook{
+		url:    url,
+		secret: secret,
+		client: httpx.NewClient(30 * time.Second),
+		queue:  make(chan jobStateChange, 256),
+	}
+}
+
+// send queues a change for delivery. With no URL configured it does
+// nothing; with the queue full the change is dropped and logged.
+func (w *stateWebhook) send(c jobStateChange) {
+	if w.url == "" {
+		return
+	}
+	select {
+	case w.queue <- c:
+	default:
+		log.Warn().Str("job", c.JobID).Str("to", c.To).Msg("job state webhook backlog full — change dropped")
+	}
+}
+
+// Run delivers queued changes until ctx is done.
+func (w *stateWebhook) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case c := <-w.queue:
+			if err := w.deliver(ctx, c); err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).Str("job", c.JobID).Str("to", c.To).Msg("job state webhook failed")
+			}
+		}
+	}
+}
+
+func (w *stateWebhook) deliver(ctx context.Context, c jobStateChange) error {
+	body, _ := json.Marshal(c)
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// The same change always carries the same key, so receivers can drop
+	// the duplicates a retried delivery may produce.
+	req.Header.Set("Idempotency-Key", c.JobID+":"+c.To+":"+c.At.Format(time.RFC3339Nano))
+	if w.secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+sign(w.secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sign returns the hex HMAC-SHA256 of body under secret.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
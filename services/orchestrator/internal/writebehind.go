@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Bounds on the write-behind queue's worker.
+const (
+	maxWriteBatch = 500              // rows per insert
+	writeAttempts = 6                // per write while the store's breaker is open
+	maxWriteWait  = 30 * time.Second // between those attempts
+	drainTimeout  = 15 * time.Second // for what is still queued at shutdown
+)
+
+// storeWrite is one queued write to Supabase: rows to insert into table,
+// which are batched with the other rows queued for it, or run, done on its
+// own.
+type storeWrite struct {
+	jobID string
+	what  string // for reports, e.g. "save iteration"
+	// log marks a log-event row for the audit trail. They are worth least,
+	// so a full queue drops them first.
+	log bool
+
+	table string
+	row   map[string]any
+
+	run func(ctx context.Context) error
+}
+
+// writeQueue writes to Supabase off the event handlers' path: handlers
+// queue their writes and return, and a single worker writes them, so
+// Supabase's latency never holds up an ack.
+//
+// Writes of one job are made in the order they were queued, except that
+// rows are inserted after the writes queued along with them: a job's row
+// is always created before the iterations and events that refer to it.
+type writeQueue struct {
+	store  *Store
+	max    int
+	report func(w storeWrite, err error) // a write that did not go through
+
+	mu      sync.Mutex
+	pending []storeWrite
+	wake    chan struct{}
+	// Writes dropped because the queue was full.
+	droppedLogs   int
+	droppedWrites int
+}
+
+func newWriteQueue(store *Store, max int, report func(storeWrite, error)) *writeQueue {
+	return &writeQueue{store: store, max: max, report: report, wake: make(chan struct{}, 1)}
+}
+
+// writeStats is the queue as /api/status reports it.
+type writeStats struct {
+	Queued        int `json:"queued"`
+	DroppedLogs   int `json:"dropped_logs"`
+	DroppedWrites int `json:"dropped_writes"`
+}
+
+func (q *writeQueue) stats() writeStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return writeStats{Queued: len(q.pending), DroppedLogs: q.droppedLogs, DroppedWrites: q.droppedWrites}
+}
+
+// enqueue queues w. With the queue full, the oldest log-event row makes
+// room for it; when there is none, w itself is dropped.
+func (q *writeQueue) enqueue(w storeWrite) {
+	q.mu.Lock()
+	if len(q.pending) >= q.max {
+		evict := -1
+		if !w.log {
+			for i, p := range q.pending {
+				if p.log {
+					evict = i
+					break
+				}
+			}
+		}
+		if evict < 0 {
+			q.drop(w)
+			q.mu.Unlock()
+			return
+		}
+		q.drop(q.pending[evict])
+		q.pending = append(q.pending[:evict], q.pending[evict+1:]...)
+	}
+	q.pending = append(q.pending, w)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drop counts w as dropped. Call with q.mu held.
+func (q *writeQueue) drop(w storeWrite) {
+	if w.log {
+		q.droppedLogs++
+		return
+	}
+	q.droppedWrites++
+	log.Error().Str("job", w.jobID).Str("op", w.what).Msg("store write queue full — write dropped")
+}
+
+// Run writes what is queued until ctx is done. Writes outlive ctx by up to
+// drainTimeout, so that the one in flight at shutdown and those still
+// queued are made.
+func (q *writeQueue) Run(ctx context.Context) error {
+	wctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { time.AfterFunc(drainTimeout, cancel) })
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			q.drain(wctx)
+			if n := q.stats().Queued; n > 0 {
+				log.Warn().Int("writes", n).Msg("store write queue not drained at shutdown")
+			}
+			return nil
+		case <-q.wake:
+			q.drain(wctx)
+		}
+	}
+}
+
+// drain writes batches until the queue is empty or ctx is done.
+func (q *writeQueue) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		batch := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		q.flush(ctx, batch)
+	}
+}
+
+// flush writes a batch: the writes run in order, then the rows, one
+// insert per table and maxWriteBatch rows.
+func (q *writeQueue) flush(ctx context.Context, batch []storeWrite) {
+	var tables []string
+	rows := make(map[string][]storeWrite)
+	for _, w := range batch {
+		if w.run == nil {
+			if rows[w.table] == nil {
+				tables = append(tables, w.table)
+			}
+			rows[w.table] = append(rows[w.table], w)
+			continue
+		}
+		if err := q.retry(ctx, w.run); err != nil {
+			q.report(w, err)
+		}
+	}
+	for _, table := range tables {
+		ws := rows[table]
+		for len(ws) > 0 {
+			n := min(len(ws), maxWriteBatch)
+			chunk := make([]map[string]any, n)
+			for i, w := range ws[:n] {
+				chunk[i] = w.row
+			}
+			err := q.retry(ctx, func(ctx context.Context) error { return q.store.insertRows(ctx, table, chunk) })
+			if err != nil {
+				q.reportRows(ws[:n], err)
+			}
+			ws = ws[n:]
+		}
+	}
+}
+
+// retry runs write, trying again while the store's breaker is open: the
+// write was never sent, so even an insert is safe to repeat. Other
+// failures are the store's to retry.
+func (q *writeQueue) retry(ctx context.Context, write func(context.Context) error) error {
+	wait := time.Second
+	for attempt := 1; ; attempt++ {
+		err := write(ctx)
+		if err == nil || !errors.Is(err, errStoreOpen) || attempt == writeAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(min(wait, maxWriteWait)):
+		}
+		wait *= 2
+	}
+}
+
+// reportRows reports an insert that failed, once per job and kind of row.
+func (q *writeQueue) reportRows(ws []storeWrite, err error) {
+	seen := make(map[string]bool)
+	for _, w := range ws {
+		if k := w.jobID + "\x00" + w.what; !seen[k] {
+			seen[k] = true
+			q.report(w, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// opLog records the writes a queue makes, in order. Before each, it waits
+// for gate, when set, to be closed.
+type opLog struct {
+	mu   sync.Mutex
+	ops  []string
+	gate chan struct{}
+}
+
+func (l *opLog) add(op string) {
+	if l.gate != nil {
+		<-l.gate
+	}
+	l.mu.Lock()
+	l.ops = append(l.ops, op)
+	l.mu.Unlock()
+}
+
+func (l *opLog) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.ops)
+}
+
+// insert is a storeDB's insert, logging one op per row.
+func (l *opLog) insert(_ context.Context, table string, rows []map[string]any) error {
+	for _, r := range rows {
+		l.add(fmt.Sprintf("%s %s %v", table, r["job_id"], r["iteration"]))
+	}
+	return nil
+}
+
+func (l *opLog) updateJob(context.Context, string, map[string]any) error { return nil }
+
+func (l *opLog) loadJob(context.Context, string) (*storedJob, error) { return nil, nil }
+
+func (l *opLog) loadIterations(context.Context, string) ([]storedIteration, error) { return nil, nil }
+
+// run is a storeWrite of job that logs op.
+func (l *opLog) run(job, op string) storeWrite {
+	return storeWrite{jobID: job, what: op, run: func(context.Context) error {
+		l.add(op + " " + job)
+		return nil
+	}}
+}
+
+func iteration(job string, n int) storeWrite {
+	return storeWrite{jobID: job, what: "save iteration", table: "iterations", row: map[string]any{"job_id": job, "iteration": n}}
+}
+
+// startQueue runs a writeQueue of max writes on log until the returned
+// cancel. done is closed when Run returns.
+func startQueue(t *testing.T, log *opLog, max int) (q *writeQueue, cancel context.CancelFunc, done <-chan struct{}) {
+	t.Helper()
+	q = newWriteQueue(&Store{db: log}, max, func(w storeWrite, err error) {
+		t.Errorf("%s of %s failed: %v", w.what, w.jobID, err)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		_ = q.Run(ctx)
+	}()
+	return q, cancel, ran
+}
+
+// waitOps waits for n ops to be logged.
+func waitOps(t *testing.T, log *opLog, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if ops := log.list(); len(ops) >= n {
+			return ops
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d writes made: %v", len(log.list()), n, log.list())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteQueueKeepsJobOrder(t *testing.T) {
+	log := &opLog{gate: make(chan struct{})}
+	q, _, _ := startQueue(t, log, 100)
+
+	// The worker is held at the first write while the rest queue up
+	// behind it, interleaved across jobs, to be written as one batch.
+	q.enqueue(log.run("a", "create job"))
+	q.enqueue(iteration("a", 1))
+	q.enqueue(log.run("b", "create job"))
+	q.enqueue(iteration("b", 1))
+	q.enqueue(iteration("a", 2))
+	q.enqueue(log.run("a", "update screen count"))
+	q.enqueue(iteration("b", 2))
+	q.enqueue(log.run("a", "mark job done"))
+	close(log.gate)
+
+	ops := waitOps(t, log, 8)
+	for _, before := range [][2]string{
+		{"create job a", "iterations a 1"},
+		{"create job b", "iterations b 1"},
+		{"iterations a 1", "iterations a 2"},
+		{"iterations b 1", "iterations b 2"},
+		{"create job a", "update screen count a"},
+		{"update screen count a", "mark job done a"},
+	} {
+		if i, j := slices.Index(ops, before[0]), slices.Index(ops, before[1]); i < 0 || j < 0 || i > j {
+			t.Errorf("%q written after %q: %v", before[0], before[1], ops)
+		}
+	}
+}
+
+func TestWriteQueueOrdersAcrossBatches(t *testing.T) {
+	log := &opLog{}
+	q, _, _ := startQueue(t, log, 100)
+	var want []string
+	for i := 1; i <= 50; i++ {
+		q.enqueue(iteration("a", i))
+		want = append(want, fmt.Sprintf("iterations a %d", i))
+		if i%7 == 0 {
+			time.Sleep(time.Millisecond) // let the worker take a batch
+		}
+	}
+	if ops := waitOps(t, log, 50); !slices.Equal(ops, want) {
+		t.Errorf("written out of order: %v", ops)
+	}
+}
+
+func TestWriteQueueDrainsOnShutdown(t *testing.T) {
+	log := &opLog{gate: make(chan struct{})}
+	q, cancel, done := startQueue(t, log, 100)
+	q.enqueue(log.run("a", "create job"))
+	for i := 1; i <= 10; i++ {
+		q.enqueue(iteration("a", i))
+	}
+	q.enqueue(log.run("a", "mark job done"))
+
+	// Shut down with the worker in the middle of a write and the rest
+	// still queued: Run waits for all of them.
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("Run returned with writes queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(log.gate)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after draining")
+	}
+	if ops := log.list(); len(ops) != 12 || !slices.Contains(ops, "mark job done a") || !slices.Contains(ops, "iterations a 10") {
+		t.Errorf("wrote %v", ops)
+	}
+	if n := q.stats().Queued; n != 0 {
+		t.Errorf("%d writes left queued", n)
+	}
+}
+
+func TestWriteQueueFullDropsLogRowsFirst(t *testing.T) {
+	// Not running: the queue only fills.
+	q := newWriteQueue(&Store{}, 3, func(storeWrite, error) {})
+	logRow := storeWrite{jobID: "a", what: "save event", table: "events", log: true}
+	q.enqueue(logRow)
+	q.enqueue(iteration("a", 1))
+	q.enqueue(logRow)
+	q.enqueue(iteration("a", 2)) // evicts the first log row
+	q.enqueue(iteration("a", 3)) // and the second
+	q.enqueue(iteration("a", 4)) // no log row left: dropped itself
+	q.enqueue(logRow)            // dropped
+
+	st := q.stats()
+	if st.Queued != 3 || st.DroppedLogs != 3 || st.DroppedWrites != 1 {
+		t.Errorf("stats %+v, want 3 queued, 3 logs and 1 write dropped", st)
+	}
+	for i, w := range q.pending {
+		if w.row["iteration"] != i+1 {
+			t.Errorf("queued %v", q.pending)
+			break
+		}
+	}
+}
@@ -23,36 +23,21 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/forge-ai/forge/services/orchestrator/internal"
-	"github.com/joho/godotenv"
-	"github.com/rs/zerolog"
+	"github.com/forge-ai/forge/shared/svc"
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "15:04:05"})
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if os.Getenv("DEBUG") == "1" {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
-
-	_ = godotenv.Load()
+	ctx, cancel := svc.Bootstrap()
+	defer cancel()
 
 	cfg := internal.ConfigFromEnv()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		<-sigs
+		<-ctx.Done()
 		log.Info().Msg("shutdown signal — stopping orchestrator")
-		cancel()
 	}()
 
 	o, err := internal.NewOrchestrator(cfg)
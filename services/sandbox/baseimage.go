@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/svc"
+	"github.com/rs/zerolog/log"
+)
+
+// Dependency sets are fixed per platform so they can be installed once into
+// a base image; per-iteration builds then only copy the generated sources.
+
+const reactDeps = `"dependencies": { "react": "^18.3.0", "react-dom": "^18.3.0" },
+  "devDependencies": {
+    "vite": "^5.2.0",
+    "@vitejs/plugin-react": "^4.2.1",
+    "tailwindcss": "^3.4.3",
+    "postcss": "^8.4.38",
+    "autoprefixer": "^10.4.19",
+    "typescript": "^5.4.5",
+    "@types/react": "^18.3.0",
+    "@types/react-dom": "^18.3.0"
+  }`
+
+const nextDeps = `"dependencies": { "next": "14.2.3", "react": "^18.3.0", "react-dom": "^18.3.0" },
+  "devDependencies": {
+    "tailwindcss": "^3.4.3",
+    "postcss": "^8.4.38",
+    "autoprefixer": "^10.4.19",
+    "typescript": "^5.4.5",
+    "@types/node": "^20.12.0",
+    "@types/react": "^18.3.0",
+    "@types/react-dom": "^18.3.0"
+  }`
+
+const kmpBuildGradle = `
+plugins {
+    kotlin("multiplatform") version "1.9.23"
+    id("org.jetbrains.compose") version "1.6.2"
+}
+kotlin {
+    js(IR) {
+        browser { commonWebpackConfig { outputFileName = "forge-preview.js" } }
+        binaries.executable()
+    }
+    sourceSets {
+        val commonMain by getting { dependencies {
+            implementation(compose.runtime)
+            implementation(compose.foundation)
+            implementation(compose.material3)
+            implementation(compose.ui)
+            implementation(compose.components.uiToolingPreview)
+        }}
+    }
+}
+// Unpacks skiko.wasm next to the bundle so the canvas renderer can load.
+compose.experimental { web.application {} }`
+
+const kmpSettingsGradle = `
+pluginManagement {
+    repositories {
+        gradlePluginPortal()
+        google()
+        mavenCentral()
+        maven("https://maven.pkg.jetbrains.space/public/p/compose/dev")
+    }
+}
+dependencyResolutionManagement {
+    repositories {
+        google()
+        mavenCentral()
+        maven("https://maven.pkg.jetbrains.space/public/p/compose/dev")
+    }
+}
+rootProject.name = "forge-preview"`
+
+// baseImageFiles is the build context for a platform's base image.
+func baseImageFiles(platform string) map[string]string {
+	switch platform {
+	case events.PlatformKMP:
+		return map[string]string{
+			"build.gradle.kts":    kmpBuildGradle,
+			"settings.gradle.kts": kmpSettingsGradle,
+			"src/commonMain/kotlin/Warmup.kt": `import androidx.compose.runtime.Composable
+@Composable fun Warmup() {}`,
+			// Resolve and compile once so the gradle cache ships in the image.
+			"Dockerfile": `FROM gradle:8-jdk17
+WORKDIR /app
+COPY . .
+RUN gradle compileKotlinJs --no-daemon && rm -rf src build`,
+		}
+	case events.PlatformNextJS:
+		return map[string]string{
+			"package.json": "{\n  \"name\": \"forge-sandbox-next\",\n  \"private\": true,\n  " + nextDeps + "\n}",
+			"Dockerfile": `FROM node:20-alpine
+WORKDIR /app
+ENV NEXT_TELEMETRY_DISABLED=1
+COPY package.json .
+RUN npm install`,
+		}
+	default:
+		return map[string]string{
+			"package.json": "{\n  \"name\": \"forge-sandbox\",\n  \"private\": true,\n  " + reactDeps + "\n}",
+			"Dockerfile": `FROM node:20-alpine
+WORKDIR /app
+COPY package.json .
+RUN npm install`,
+		}
+	}
+}
+
+// baseImageTag names the default base image after a hash of its build
+// context, so changing a dependency produces a fresh tag instead of silently
+// reusing a stale image.
+func baseImageTag(platform string) string {
+	files := baseImageFiles(platform)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte(files[name]))
+	}
+	return fmt.Sprintf("forge-sandbox-%s:%s", platform, hex.EncodeToString(h.Sum(nil))[:12])
+}
+
+// ensureBaseImages makes sure a base image exists for every platform,
+// pulling or building it when missing, and returns platform → image tag.
+// SANDBOX_BASE_IMAGE_<PLATFORM> overrides the tag (e.g. a registry image).
+// Platforms whose image can't be prepared are left out and fall back to a
+// full install per build.
+func ensureBaseImages(ctx context.Context, h *dockerHost) map[string]string {
+	bases := make(map[string]string)
+	for _, platform := range []string{events.PlatformReact, events.PlatformNextJS, events.PlatformKMP} {
+		tag := svc.EnvOr("SANDBOX_BASE_IMAGE_"+strings.ToUpper(platform), baseImageTag(platform))
+		if err := ensureImage(ctx, h, tag, platform); err != nil {
+			log.Warn().Err(err).Stringer("host", h).Str("platform", platform).Msg("base image unavailable — builds will install dependencies")
+			continue
+		}
+		bases[platform] = tag
+	}
+	return bases
+}
+
+func ensureImage(ctx context.Context, h *dockerHost, tag, platform string) error {
+	if h.command(ctx, "image", "inspect", tag).Run() == nil {
+		return nil
+	}
+	if h.command(ctx, "pull", tag).Run() == nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "forge-base-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := writeFiles(dir, baseImageFiles(platform)); err != nil {
+		return err
+	}
+
+	log.Info().Str("image", tag).Stringer("host", h).Msg("building sandbox base image")
+	start := time.Now()
+	out, err := h.command(ctx, "build", "-t", tag, dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker build %s: %s", tag, lastLine(string(out)))
+	}
+	log.Info().Str("image", tag).Dur("took", time.Since(start)).Msg("base image ready")
+	return nil
+}
+
+// workDir is where node sandboxes run from. The image is read-only, so the
+// project is staged onto a tmpfs at startup, with node_modules linked back
+// to the image rather than copied.
+const workDir = "/work"
+
+const stageAndRun = `CMD ["sh", "-c", "mkdir -p ` + workDir + ` && for f in /app/* /app/.[!.]*; do [ -e \"$f\" ] || continue; case \"$f\" in */node_modules) ln -s /app/node_modules ` + workDir + `/node_modules;; *) cp -a \"$f\" ` + workDir + `/;; esac; done && cd ` + workDir + ` && exec npm run dev"]`
+
+// typecheckCmd type-checks the staged project without emitting anything.
+// Both node scaffolds ship typescript, so --no-install never hits the network.
+const typecheckCmd = "npx --no-install tsc --noEmit --skipLibCheck -p ."
+
+// typecheckStep is the Dockerfile line that fails the build on type errors,
+// or nothing when the gate is off.
+func typecheckStep(on bool) string {
+	if !on {
+		return ""
+	}
+	return "RUN " + typecheckCmd + "\n"
+}
+
+// nodeDockerfile is the per-iteration Dockerfile for the node platforms.
+// With a base image only the sources are copied; without one it falls back
+// to installing dependencies from scratch.
+func nodeDockerfile(base string, port int, env string, typecheck bool) string {
+	if base != "" {
+		return fmt.Sprintf(`FROM %s
+WORKDIR /app
+%sCOPY . .
+%sEXPOSE %d
+%s`, base, env, typecheckStep(typecheck), port, stageAndRun)
+	}
+	return fmt.Sprintf(`FROM node:20-alpine
+WORKDIR /app
+%sCOPY package.json .
+RUN npm install
+COPY . .
+%sEXPOSE %d
+%s`, env, typecheckStep(typecheck), port, stageAndRun)
+}
+
+// staticDockerfile builds the app for production and serves outDir from
+// nginx, so screenshots carry no dev-server overlays or HMR artifacts. The
+// unprivileged nginx image needs no capabilities and only writes to /tmp.
+func staticDockerfile(base string, port int, env, outDir string, typecheck bool) string {
+	install := "COPY package.json .\nRUN npm install\n"
+	if base != "" {
+		install = ""
+	} else {
+		base = "node:20-alpine"
+	}
+	return fmt.Sprintf(`FROM %s AS build
+WORKDIR /app
+%s%sCOPY . .
+%sRUN npm run build
+
+FROM nginxinc/nginx-unprivileged:1.27-alpine
+COPY --from=build /app/%s /usr/share/nginx/html
+COPY nginx.conf /etc/nginx/conf.d/default.conf
+EXPOSE %d`, base, env, install, typecheckStep(typecheck), outDir, port)
+}
+
+// nginxConf serves the exported site on port, falling back to index.html
+// for client-side routes.
+func nginxConf(port int) string {
+	return fmt.Sprintf(`server {
+    listen %d;
+    root /usr/share/nginx/html;
+    location / { try_files $uri $uri.html $uri/ /index.html; }
+}
+`, port)
+}
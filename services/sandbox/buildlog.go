@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxBuildLog caps BuildLog so a runaway npm install doesn't bloat the event.
+const maxBuildLog = 16 << 10
+
+// buildFailure is a docker step that failed with captured output.
+type buildFailure struct {
+	step     string // "build", "run" or "typecheck"
+	out      string // everything captured, partial when timedOut
+	timedOut bool
+}
+
+func (e *buildFailure) Error() string {
+	if e.step == "typecheck" {
+		return fmt.Sprintf("typecheck failed: %s", firstTypeError(e.out))
+	}
+	if e.timedOut {
+		return fmt.Sprintf("docker %s timed out: %s", e.step, lastLine(e.out))
+	}
+	return fmt.Sprintf("docker %s: %s", e.step, lastLine(e.out))
+}
+
+// truncateLog keeps the tail of s — errors are almost always at the end.
+func truncateLog(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return "…\n" + s
+}
+
+// compileExcerpt returns the part of log that reports errors in the
+// generated file, or "" when the failure lies elsewhere (dependency
+// resolution, registry outage, OOM, …). The excerpt starts at the first line
+// naming the file and runs for a handful of lines so the message and code
+// frame both make it back to the model.
+func compileExcerpt(log, filename string) string {
+	if filename == "" {
+		return ""
+	}
+	lines := strings.Split(log, "\n")
+	for i, l := range lines {
+		if !strings.Contains(l, filename) {
+			continue
+		}
+		end := min(i+15, len(lines))
+		return strings.TrimSpace(strings.Join(lines[i:end], "\n"))
+	}
+	return ""
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// firstTypeError picks the first tsc diagnostic out of log; tsc prints a
+// summary line last, which says nothing about what is wrong.
+func firstTypeError(log string) string {
+	for _, l := range strings.Split(log, "\n") {
+		if strings.Contains(l, "error TS") {
+			return strings.TrimSpace(l)
+		}
+	}
+	return lastLine(log)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// A job's sandbox env reaches the generated code three ways: as real env
+// vars on the container, for anything reading process.env at runtime, and
+// inlined by the bundler into the page, which is where components read it.
+// Vite inlines import.meta.env.* through define and Next.js process.env.*
+// through its env config; both take literals, so values need no .env
+// quoting and are never expanded.
+
+// prefixedEnv is env with every name behind events.SandboxEnvPrefix.
+func prefixedEnv(env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(env))
+	for k, v := range env {
+		out[events.SandboxEnvPrefix+k] = v
+	}
+	return out
+}
+
+// viteDefine is the define option inlining env as import.meta.env.*: each
+// value is the source of a JS string literal.
+func viteDefine(env map[string]string) string {
+	define := make(map[string]string, len(env))
+	for k, v := range env {
+		lit, _ := json.Marshal(v)
+		define["import.meta.env."+k] = string(lit)
+	}
+	b, _ := json.Marshal(define)
+	return string(b)
+}
+
+// nextEnv is the env option of next.config.js.
+func nextEnv(env map[string]string) string {
+	b, _ := json.Marshal(env)
+	return string(b)
+}
+
+// envArgs are the docker run flags setting env, in a stable order.
+func envArgs(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+env[k])
+	}
+	return args
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var errNoHealthyHost = errors.New("no healthy docker host")
+
+// Container CLIs the sandbox can drive; see CONTAINER_CLI.
+const (
+	cliDocker = "docker"
+	cliPodman = "podman"
+)
+
+// checkCLI validates CONTAINER_CLI, a CLI name or a path to one, and
+// finds it on the PATH.
+func checkCLI(cli string) error {
+	switch filepath.Base(cli) {
+	case cliDocker, cliPodman:
+	default:
+		return fmt.Errorf("CONTAINER_CLI %q: want %s or %s", cli, cliDocker, cliPodman)
+	}
+	if _, err := exec.LookPath(cli); err != nil {
+		return fmt.Errorf("CONTAINER_CLI %q not found — install it or point CONTAINER_CLI at it: %w", cli, err)
+	}
+	return nil
+}
+
+// dockerHost is one docker endpoint sandboxes are built and run on. Ports
+// and base images are per host; the tracker records which host owns each
+// container.
+type dockerHost struct {
+	cli       string // CONTAINER_CLI
+	endpoint  string // DOCKER_HOST value; empty means the local daemon's defaults
+	advertise string // address consumers reach its published ports on; empty: SANDBOX_HOST
+	ports     *portAllocator
+	bases     map[string]string // platform → prepared base image
+
+	mu       sync.Mutex
+	active   int // builds in flight
+	healthy  bool
+	prepared bool // hostPool.prepare succeeded on it
+}
+
+// command is exec.CommandContext for the container CLI, aimed at this
+// host. Podman reads its endpoint from CONTAINER_HOST, and needs --remote
+// to use it.
+func (h *dockerHost) command(ctx context.Context, args ...string) *exec.Cmd {
+	switch {
+	case h.endpoint == "":
+		return exec.CommandContext(ctx, h.cli, args...)
+	case h.podman():
+		cmd := exec.CommandContext(ctx, h.cli, append([]string{"--remote"}, args...)...)
+		cmd.Env = append(os.Environ(), "CONTAINER_HOST="+h.endpoint)
+		return cmd
+	}
+	cmd := exec.CommandContext(ctx, h.cli, args...)
+	cmd.Env = append(os.Environ(), "DOCKER_HOST="+h.endpoint)
+	return cmd
+}
+
+func (h *dockerHost) podman() bool { return filepath.Base(h.cli) == cliPodman }
+
+// ping checks that the host answers. Podman has no daemon to ask for its
+// version when it runs locally, so it is asked for its host instead.
+func (h *dockerHost) ping(ctx context.Context) error {
+	if h.podman() {
+		return h.command(ctx, "info", "--format", "{{.Host.Arch}}").Run()
+	}
+	return h.command(ctx, "version", "--format", "{{.Server.Version}}").Run()
+}
+
+// imageRef is ref as docker names it. Podman qualifies local images with
+// localhost/.
+func imageRef(ref string) string {
+	return strings.TrimPrefix(ref, "localhost/")
+}
+
+// local reports whether the daemon runs on this machine, where a free
+// port can be checked before handing it to docker.
+func (h *dockerHost) local() bool {
+	return h.endpoint == "" || strings.HasPrefix(h.endpoint, "unix://")
+}
+
+func (h *dockerHost) String() string {
+	if h.endpoint == "" {
+		return "local"
+	}
+	return h.endpoint
+}
+
+func (h *dockerHost) done() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.active--
+}
+
+// parseHosts reads SANDBOX_DOCKER_HOSTS: comma-separated endpoint[=advertise]
+// entries such as "unix:///var/run/docker.sock,tcp://10.0.0.5:2375=10.0.0.5".
+// An empty spec is the single daemon the environment points the CLI at:
+// DOCKER_HOST's, or for podman CONTAINER_HOST's, or else the local one.
+func parseHosts(spec, cli string, portMin, portMax int) ([]*dockerHost, error) {
+	var hosts []*dockerHost
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		endpoint, advertise, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(endpoint, "unix://") && !strings.HasPrefix(endpoint, "tcp://") && !strings.HasPrefix(endpoint, "ssh://") {
+			return nil, fmt.Errorf("SANDBOX_DOCKER_HOSTS entry %q: want unix://, tcp:// or ssh:// endpoint", entry)
+		}
+		if seen[endpoint] {
+			return nil, fmt.Errorf("SANDBOX_DOCKER_HOSTS lists %s twice", endpoint)
+		}
+		seen[endpoint] = true
+		hosts = append(hosts, newDockerHost(cli, endpoint, advertise, portMin, portMax))
+	}
+	if len(hosts) == 0 {
+		endpoint := os.Getenv("DOCKER_HOST")
+		if filepath.Base(cli) == cliPodman && os.Getenv("CONTAINER_HOST") != "" {
+			endpoint = os.Getenv("CONTAINER_HOST")
+		}
+		hosts = append(hosts, newDockerHost(cli, endpoint, "", portMin, portMax))
+	}
+	return hosts, nil
+}
+
+func newDockerHost(cli, endpoint, advertise string, portMin, portMax int) *dockerHost {
+	return &dockerHost{cli: cli, endpoint: endpoint, advertise: advertise, healthy: true,
+		ports: newPortAllocator(portMin, portMax)}
+}
+
+// hostPool schedules builds across the docker hosts.
+type hostPool struct {
+	hosts []*dockerHost
+	// prepare sets a host up to run sandboxes: its network and base
+	// images. A host it fails on is kept out of the pool, and tried again
+	// by the health checks until it succeeds.
+	prepare func(ctx context.Context, h *dockerHost) error
+}
+
+// pick reserves the healthy host with the fewest builds in flight. The
+// caller releases it with done.
+func (p *hostPool) pick() (*dockerHost, error) {
+	var best *dockerHost
+	bestActive := 0
+	for _, h := range p.hosts {
+		h.mu.Lock()
+		ok, active := h.healthy, h.active
+		h.mu.Unlock()
+		if ok && (best == nil || active < bestActive) {
+			best, bestActive = h, active
+		}
+	}
+	if best == nil {
+		return nil, errNoHealthyHost
+	}
+	best.mu.Lock()
+	best.active++
+	best.mu.Unlock()
+	return best, nil
+}
+
+// byEndpoint finds the host a tracked container was started on. Containers
+// recorded before multi-host support carry no endpoint and resolve to the
+// first host.
+func (p *hostPool) byEndpoint(endpoint string) *dockerHost {
+	for _, h := range p.hosts {
+		if h.endpoint == endpoint {
+			return h
+		}
+	}
+	return p.hosts[0]
+}
+
+// healthy lists the hosts currently accepting builds.
+func (p *hostPool) healthy() []*dockerHost {
+	var out []*dockerHost
+	for _, h := range p.hosts {
+		h.mu.Lock()
+		if h.healthy {
+			out = append(out, h)
+		}
+		h.mu.Unlock()
+	}
+	return out
+}
+
+// runHealth checks the hosts each interval; see check.
+func (p *hostPool) runHealth(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		p.check(ctx)
+	}
+}
+
+// check pings every host, ejecting the ones that stop answering and
+// readmitting them once they recover. A host is prepared before it is
+// first admitted. Builds already running on an ejected host fail on their
+// own.
+func (p *hostPool) check(ctx context.Context) {
+	for _, h := range p.hosts {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := h.ping(pingCtx)
+		cancel()
+
+		h.mu.Lock()
+		prepared := h.prepared
+		h.mu.Unlock()
+		if err == nil && !prepared && p.prepare != nil {
+			if err = p.prepare(ctx, h); err == nil {
+				prepared = true
+			}
+		}
+
+		h.mu.Lock()
+		was := h.healthy
+		h.healthy = err == nil
+		h.prepared = prepared
+		h.mu.Unlock()
+		switch {
+		case was && err != nil:
+			log.Warn().Err(err).Stringer("host", h).Msg("docker host unusable — ejected")
+		case !was && err == nil:
+			log.Info().Stringer("host", h).Msg("docker host back — readmitted")
+		}
+	}
+}
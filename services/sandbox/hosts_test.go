@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testHost is a host whose CLI is true(1) or false(1): ping succeeds or
+// fails without a daemon.
+func testHost(endpoint string, up bool) *dockerHost {
+	cli := "false"
+	if up {
+		cli = "true"
+	}
+	return newDockerHost(cli, endpoint, "", 30000, 30010)
+}
+
+func TestCheckEjectsHostItCannotPrepare(t *testing.T) {
+	a, b := testHost("", true), testHost("tcp://10.0.0.5:2375", true)
+	failing := true
+	p := &hostPool{hosts: []*dockerHost{a, b}, prepare: func(_ context.Context, h *dockerHost) error {
+		if h == b && failing {
+			return errors.New("docker network create forge-sandbox: permission denied")
+		}
+		return nil
+	}}
+
+	p.check(context.Background())
+	if got := p.healthy(); len(got) != 1 || got[0] != a {
+		t.Fatalf("healthy %v, want only %v", got, a)
+	}
+	for i := 0; i < 3; i++ {
+		if h, err := p.pick(); err != nil || h != a {
+			t.Fatalf("pick %v, %v; want %v", h, err, a)
+		}
+	}
+
+	// Once the network can be created, the next check admits it.
+	failing = false
+	p.check(context.Background())
+	if got := p.healthy(); len(got) != 2 {
+		t.Fatalf("healthy %v, want both", got)
+	}
+	if h, _ := p.pick(); h != b {
+		t.Errorf("pick %v, want the idle %v", h, b)
+	}
+}
+
+func TestCheckPreparesOnce(t *testing.T) {
+	h := testHost("", true)
+	n := 0
+	p := &hostPool{hosts: []*dockerHost{h}, prepare: func(context.Context, *dockerHost) error {
+		n++
+		return nil
+	}}
+	for i := 0; i < 3; i++ {
+		p.check(context.Background())
+	}
+	if n != 1 {
+		t.Errorf("prepared %d times, want 1", n)
+	}
+
+	// Down and back: the host's network and images are still there.
+	h.cli = "false"
+	p.check(context.Background())
+	if len(p.healthy()) != 0 {
+		t.Fatal("unreachable host still healthy")
+	}
+	h.cli = "true"
+	p.check(context.Background())
+	if len(p.healthy()) != 1 || n != 1 {
+		t.Errorf("healthy %v after %d prepares, want readmitted after 1", p.healthy(), n)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	for _, tc := range []struct {
+		endpoint  string
+		internal  bool
+		probeHost string
+		ok        bool
+	}{
+		{"", true, "", true},
+		{"unix:///var/run/docker.sock", true, "", true},
+		{"tcp://10.0.0.5:2375", false, "", true},
+		{"tcp://10.0.0.5:2375", true, "", false},
+		{"ssh://builder@10.0.0.5", true, "", false},
+		{"tcp://10.0.0.5:2375", true, "10.0.0.5", true},
+	} {
+		err := reachable(testHost(tc.endpoint, true), tc.internal, tc.probeHost)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s internal=%v probe=%q: %v", tc.endpoint, tc.internal, tc.probeHost, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	kmpPackageRe    = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)`)
+	kmpComposableRe = regexp.MustCompile(`@Composable\s+(?:(?:public|internal)\s+)?fun\s+([A-Za-z_]\w*)\s*\(\s*\)`)
+)
+
+// composableName picks the composable the preview renders: the zero-arg
+// @Composable named after the file (codegen is told to use that name), else
+// the first zero-arg one declared, else the file name itself. The result is
+// fully qualified when the code declares a package.
+func composableName(code, filename string) string {
+	want := strings.TrimSuffix(filename, ".kt")
+	name := want
+	if matches := kmpComposableRe.FindAllStringSubmatch(code, -1); len(matches) > 0 {
+		name = matches[0][1]
+		for _, m := range matches {
+			if m[1] == want {
+				name = want
+				break
+			}
+		}
+	}
+	if m := kmpPackageRe.FindStringSubmatch(code); m != nil {
+		return m[1] + "." + name
+	}
+	return name
+}
+
+// kmpMain is the JS entrypoint that renders the generated screen into the
+// full-window canvas declared by kmpIndexHTML.
+func kmpMain(code, filename string) string {
+	return fmt.Sprintf(`import androidx.compose.ui.ExperimentalComposeUiApi
+import androidx.compose.ui.window.CanvasBasedWindow
+import org.jetbrains.skiko.wasm.onWasmReady
+
+@OptIn(ExperimentalComposeUiApi::class)
+fun main() {
+    onWasmReady {
+        CanvasBasedWindow(title = "Forge", canvasElementId = "ComposeTarget") {
+            %s()
+        }
+    }
+}
+`, composableName(code, filename))
+}
+
+const kmpIndexHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Forge</title>
+<style>html,body{margin:0;padding:0;width:100%;height:100%;overflow:hidden}#ComposeTarget{width:100%;height:100%}</style>
+<script src="skiko.js"></script>
+</head>
+<body>
+<canvas id="ComposeTarget"></canvas>
+<script src="forge-preview.js"></script>
+</body>
+</html>
+`
+
+// kmpDevServer points the Kotlin/JS webpack dev server at the sandbox port,
+// reachable from outside the container.
+func kmpDevServer(port int) string {
+	return fmt.Sprintf(`config.devServer = Object.assign({}, config.devServer || {}, {
+  port: %d,
+  host: "0.0.0.0",
+  allowedHosts: "all",
+  open: false
+});
+`, port)
+}
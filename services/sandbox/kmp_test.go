@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const trivialComposable = `import androidx.compose.foundation.layout.fillMaxSize
+import androidx.compose.material3.Text
+import androidx.compose.runtime.Composable
+import androidx.compose.ui.Modifier
+
+@Composable
+private fun Title(text: String) {
+    Text(text)
+}
+
+@Composable
+fun HomeScreen() {
+    Title("Hello")
+}
+`
+
+func TestComposableName(t *testing.T) {
+	for _, tc := range []struct {
+		name, code, filename, want string
+	}{
+		{"named after the file", trivialComposable, "HomeScreen.kt", "HomeScreen"},
+		{"first zero-arg one", "@Composable fun Header(title: String) {}\n@Composable internal fun Page() {}\n@Composable fun Other() {}", "HomeScreen.kt", "Page"},
+		{"file name else", "fun helper() {}", "HomeScreen.kt", "HomeScreen"},
+		{"qualified by package", "package com.forge.ui\n\n@Composable\nfun HomeScreen() {}", "HomeScreen.kt", "com.forge.ui.HomeScreen"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := composableName(tc.code, tc.filename); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScaffoldKMP(t *testing.T) {
+	dir := t.TempDir()
+	if err := scaffoldKMP(dir, trivialComposable, "HomeScreen.kt", 31234, "", false); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		b, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if main := read("src/jsMain/kotlin/Main.kt"); !strings.Contains(main, "HomeScreen()") || !strings.Contains(main, `canvasElementId = "ComposeTarget"`) {
+		t.Errorf("Main.kt doesn't render the screen into the canvas:\n%s", main)
+	}
+	if html := read("src/jsMain/resources/index.html"); !strings.Contains(html, `id="ComposeTarget"`) || !strings.Contains(html, "forge-preview.js") {
+		t.Errorf("index.html has no canvas or bundle:\n%s", html)
+	}
+	if read("src/commonMain/kotlin/HomeScreen.kt") != trivialComposable {
+		t.Error("generated code not written as is")
+	}
+	if ws := read("webpack.config.d/devServer.js"); !strings.Contains(ws, "port: 31234") || !strings.Contains(ws, `"0.0.0.0"`) {
+		t.Errorf("dev server not on the sandbox port:\n%s", ws)
+	}
+	df := read("Dockerfile")
+	for _, want := range []string{"RUN gradle jsBrowserDevelopmentExecutableDistribution", "EXPOSE 31234", "jsBrowserDevelopmentRun"} {
+		if !strings.Contains(df, want) {
+			t.Errorf("Dockerfile has no %q:\n%s", want, df)
+		}
+	}
+}
+
+// TestScaffoldKMPBuilds compiles a scaffolded trivial composable with
+// gradle, as the sandbox image build does. It downloads the Kotlin and
+// Compose toolchains on a cold cache, so it only runs where gradle is on
+// PATH and not in -short mode.
+func TestScaffoldKMPBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow: builds with gradle")
+	}
+	gradle, err := exec.LookPath("gradle")
+	if err != nil {
+		t.Skip("no gradle on PATH")
+	}
+	dir := t.TempDir()
+	if err := scaffoldKMP(dir, trivialComposable, "HomeScreen.kt", 31234, "", false); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, gradle, "jsBrowserDevelopmentExecutableDistribution", "--no-daemon", "--console=plain")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("gradle: %v\n%s", err, truncateLog(string(out), 4000))
+	}
+	dist := filepath.Join(dir, "build", "dist", "js", "developmentExecutable")
+	for _, f := range []string{"index.html", "forge-preview.js", "skiko.wasm"} {
+		if _, err := os.Stat(filepath.Join(dist, f)); err != nil {
+			t.Errorf("distribution has no %s: %v", f, err)
+		}
+	}
+}
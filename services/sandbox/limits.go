@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/svc"
+)
+
+// errReadyTimeout marks a sandbox whose server didn't answer within the
+// platform's ReadyTimeout.
+var errReadyTimeout = errors.New("sandbox not ready in time")
+
+// platformLimits are the resources and time a platform's sandbox gets.
+// Building the image and bringing the server up are timed separately: a
+// slow gradle build shouldn't eat into the readiness wait, or vice versa.
+type platformLimits struct {
+	Memory       string        // docker --memory
+	CPUs         string        // docker --cpus
+	BuildTimeout time.Duration // docker build
+	ReadyTimeout time.Duration // docker run until the server answers
+}
+
+// defaultLimits suit the base images: vite is light, Next compiles the page
+// on first request, and gradle needs several gigabytes to compile Compose.
+func defaultLimits(platform string) platformLimits {
+	switch platform {
+	case events.PlatformNextJS:
+		return platformLimits{Memory: "1g", CPUs: "1", BuildTimeout: 120 * time.Second, ReadyTimeout: 120 * time.Second}
+	case events.PlatformKMP:
+		return platformLimits{Memory: "3g", CPUs: "2", BuildTimeout: 600 * time.Second, ReadyTimeout: 180 * time.Second}
+	default:
+		return platformLimits{Memory: "512m", CPUs: "1", BuildTimeout: 90 * time.Second, ReadyTimeout: 60 * time.Second}
+	}
+}
+
+// parseLimits overlays spec, e.g. "mem=3g,cpus=2,timeout=600s,ready=120s",
+// on def. timeout bounds the build; ready bounds run and readiness.
+func parseLimits(spec string, def platformLimits) (platformLimits, error) {
+	l := def
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok || val == "" {
+			return l, fmt.Errorf("%q: want key=value", field)
+		}
+		switch key {
+		case "mem":
+			l.Memory = val
+		case "cpus":
+			l.CPUs = val
+		case "timeout", "ready":
+			d, err := time.ParseDuration(val)
+			if err != nil || d <= 0 {
+				return l, fmt.Errorf("%s=%q: want a positive duration", key, val)
+			}
+			if key == "timeout" {
+				l.BuildTimeout = d
+			} else {
+				l.ReadyTimeout = d
+			}
+		default:
+			return l, fmt.Errorf("unknown key %q (want mem, cpus, timeout, ready)", key)
+		}
+	}
+	return l, nil
+}
+
+// loadLimits reads SANDBOX_LIMITS_<PLATFORM> for every platform.
+func loadLimits() (map[string]platformLimits, error) {
+	limits := make(map[string]platformLimits)
+	for _, platform := range []string{events.PlatformReact, events.PlatformNextJS, events.PlatformKMP} {
+		key := "SANDBOX_LIMITS_" + strings.ToUpper(platform)
+		l, err := parseLimits(svc.EnvOr(key, ""), defaultLimits(platform))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		limits[platform] = l
+	}
+	return limits, nil
+}
+
+// limitsFor falls back to the defaults for platforms without an entry.
+func (p sandboxPolicy) limitsFor(platform string) platformLimits {
+	if l, ok := p.limits[platform]; ok {
+		return l
+	}
+	return defaultLimits(platform)
+}
+
+// sandboxErrCode classifies a sandbox failure for SandboxFailedPayload.Code.
+func sandboxErrCode(err error) string {
+	var bf *buildFailure
+	switch {
+	case errors.As(err, &bf) && bf.timedOut:
+		return events.SandboxErrBuildTimeout
+	case errors.As(err, &bf) && bf.step == "typecheck":
+		return events.SandboxErrTypecheck
+	case errors.Is(err, errReadyTimeout):
+		return events.SandboxErrReadyTimeout
+	}
+	return ""
+}
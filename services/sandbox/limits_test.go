@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestParseLimits(t *testing.T) {
+	def := defaultLimits(events.PlatformReact)
+	for _, tc := range []struct {
+		spec string
+		want platformLimits
+	}{
+		{"", def},
+		{"mem=3g,cpus=2,timeout=600s", platformLimits{Memory: "3g", CPUs: "2", BuildTimeout: 600 * time.Second, ReadyTimeout: def.ReadyTimeout}},
+		{" ready=2m , ,mem=1g", platformLimits{Memory: "1g", CPUs: def.CPUs, BuildTimeout: def.BuildTimeout, ReadyTimeout: 2 * time.Minute}},
+	} {
+		got, err := parseLimits(tc.spec, def)
+		if err != nil || got != tc.want {
+			t.Errorf("parseLimits(%q) = %+v, %v; want %+v", tc.spec, got, err, tc.want)
+		}
+	}
+	for _, spec := range []string{"mem", "mem=", "timeout=soon", "timeout=-1s", "ready=0s", "gpus=1"} {
+		if _, err := parseLimits(spec, def); err == nil {
+			t.Errorf("parseLimits(%q): no error", spec)
+		}
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	t.Setenv("SANDBOX_LIMITS_KMP", "mem=4g,ready=5m")
+	limits, err := loadLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmp := limits[events.PlatformKMP]
+	if kmp.Memory != "4g" || kmp.ReadyTimeout != 5*time.Minute || kmp.BuildTimeout != defaultLimits(events.PlatformKMP).BuildTimeout {
+		t.Errorf("kmp %+v", kmp)
+	}
+	if limits[events.PlatformReact] != defaultLimits(events.PlatformReact) {
+		t.Errorf("react %+v, want the defaults", limits[events.PlatformReact])
+	}
+
+	t.Setenv("SANDBOX_LIMITS_NEXTJS", "cpus")
+	if _, err := loadLimits(); err == nil || !strings.Contains(err.Error(), "SANDBOX_LIMITS_NEXTJS") {
+		t.Errorf("err %v, want it to name the variable", err)
+	}
+}
+
+func TestSandboxErrCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{&buildFailure{step: "build", out: "#5 RUN npm install", timedOut: true}, events.SandboxErrBuildTimeout},
+		{&buildFailure{step: "build", out: "npm ERR! 404"}, ""},
+		{&buildFailure{step: "typecheck", out: "src/Home.tsx(3,1): error TS2304"}, events.SandboxErrTypecheck},
+		{fmt.Errorf("%w after 1m0s: context deadline exceeded", errReadyTimeout), events.SandboxErrReadyTimeout},
+		{&buildFailure{step: "run", out: "port is already allocated"}, ""},
+		{errors.New("no healthy docker host"), ""},
+	} {
+		if got := sandboxErrCode(tc.err); got != tc.want {
+			t.Errorf("sandboxErrCode(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func newBus(t *testing.T) *mq.Memory {
+	bus := mq.NewMemory()
+	t.Cleanup(bus.Close)
+	return bus
+}
+
+// failure runs a build request for a React screen through handle on sb,
+// publishing to bus, and returns the sandbox.failed it publishes.
+func failure(t *testing.T, sb *sandboxRunner, bus *mq.Memory) *events.SandboxFailedPayload {
+	t.Helper()
+	failed, err := bus.Subscribe("test.failed", events.SandboxFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := events.Wrap(events.SandboxBuildRequested, events.SandboxBuildRequestedPayload{
+		JobID: "job", Platform: events.PlatformReact, Iteration: 1,
+		Code: "export default function Home() { return <div /> }", Filename: "Home.tsx",
+	})
+	if err := handle(context.Background(), amqp.Delivery{RoutingKey: events.SandboxBuildRequested, Body: body}, bus, sb); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-failed:
+		p, err := events.UnwrapChecked[events.SandboxFailedPayload](d.Body, events.SandboxFailed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sandbox.failed")
+		return nil
+	}
+}
+
+func TestBuildTimeoutReportsPartialLog(t *testing.T) {
+	rt := &fakeRuntime{build: func(ctx context.Context, out io.Writer) error {
+		io.WriteString(out, "#5 [2/4] RUN npm install\n#5 added 120 packages\n")
+		<-ctx.Done() // and then hangs
+		return ctx.Err()
+	}}
+	sb := testRunner(t, rt)
+	sb.policy.limits = map[string]platformLimits{
+		events.PlatformReact: {BuildTimeout: 50 * time.Millisecond, ReadyTimeout: time.Minute},
+	}
+
+	p := failure(t, sb, newBus(t))
+	if p.Code != events.SandboxErrBuildTimeout {
+		t.Errorf("code %q, want %q", p.Code, events.SandboxErrBuildTimeout)
+	}
+	if !strings.Contains(p.BuildLog, "added 120 packages") {
+		t.Errorf("build log %q, want what the build wrote before it timed out", p.BuildLog)
+	}
+	if !strings.Contains(p.Error, "timed out") {
+		t.Errorf("error %q", p.Error)
+	}
+}
+
+func TestReadyTimeoutReportsContainerLog(t *testing.T) {
+	rt := &fakeRuntime{
+		healthy: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		logs: "VITE v5.0.0\nError: Cannot find module './Home'",
+	}
+	sb := testRunner(t, rt)
+	sb.policy.limits = map[string]platformLimits{
+		events.PlatformReact: {BuildTimeout: time.Minute, ReadyTimeout: 50 * time.Millisecond},
+	}
+
+	p := failure(t, sb, newBus(t))
+	if p.Code != events.SandboxErrReadyTimeout {
+		t.Errorf("code %q, want %q", p.Code, events.SandboxErrReadyTimeout)
+	}
+	if !strings.Contains(p.BuildLog, "Cannot find module") {
+		t.Errorf("build log %q, want the container's output", p.BuildLog)
+	}
+	if len(rt.kills()) != 1 {
+		t.Errorf("killed %v, want the container that never came up", rt.kills())
+	}
+}
+
+func TestBuildFailureIsNotATimeout(t *testing.T) {
+	rt := &fakeRuntime{build: func(_ context.Context, out io.Writer) error {
+		io.WriteString(out, "npm ERR! 404 Not Found - left-pad\n")
+		return errors.New("exit status 1")
+	}}
+	sb := testRunner(t, rt)
+	sb.policy.limits = map[string]platformLimits{
+		events.PlatformReact: {BuildTimeout: time.Minute, ReadyTimeout: time.Minute},
+	}
+	if p := failure(t, sb, newBus(t)); p.Code != "" || !strings.Contains(p.BuildLog, "left-pad") {
+		t.Errorf("code %q, log %q", p.Code, p.BuildLog)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var errNoFreePort = errors.New("no free sandbox port")
+
+// portAllocator hands out host ports from [min, max] for sandbox containers.
+// It walks the range round-robin so a just-released port isn't immediately
+// reused while its old container may still be shutting down. It only knows
+// its own allocations: this service runs in its own network namespace and
+// can't see what is bound on the docker host, so spin learns of a port held
+// by someone else from docker's bind error and retries on the next one.
+type portAllocator struct {
+	mu       sync.Mutex
+	min, max int
+	next     int
+	used     map[int]bool
+	owner    map[string]int // container ID → port
+}
+
+func newPortAllocator(min, max int) *portAllocator {
+	return &portAllocator{
+		min:   min,
+		max:   max,
+		next:  min,
+		used:  make(map[int]bool),
+		owner: make(map[string]int),
+	}
+}
+
+// acquire reserves the next port not already allocated.
+func (a *portAllocator) acquire() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	size := a.max - a.min + 1
+	for i := 0; i < size; i++ {
+		port := a.next
+		a.next++
+		if a.next > a.max {
+			a.next = a.min
+		}
+		if a.used[port] {
+			continue
+		}
+		a.used[port] = true
+		return port, nil
+	}
+	return 0, fmt.Errorf("%w in %d-%d", errNoFreePort, a.min, a.max)
+}
+
+// bind records which container holds port so kill can release it by ID.
+func (a *portAllocator) bind(port int, containerID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.owner[containerID] = port
+}
+
+func (a *portAllocator) release(port int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.used, port)
+}
+
+func (a *portAllocator) releaseContainer(containerID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if port, ok := a.owner[containerID]; ok {
+		delete(a.owner, containerID)
+		delete(a.used, port)
+	}
+}
+
+// isPortConflict reports whether a docker run failure was a host port or
+// container name clash that a different port would avoid.
+func isPortConflict(err error) bool {
+	var bf *buildFailure
+	if !errors.As(err, &bf) || bf.step != "run" {
+		return false
+	}
+	return strings.Contains(bf.out, "port is already allocated") ||
+		strings.Contains(bf.out, "address already in use") ||
+		strings.Contains(bf.out, "is already in use by container")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func acquire(t *testing.T, a *portAllocator) int {
+	t.Helper()
+	port, err := a.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestPortAllocatorNeverHandsOutAPortTwice(t *testing.T) {
+	a := newPortAllocator(30000, 30002)
+	seen := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		port := acquire(t, a)
+		if seen[port] || port < 30000 || port > 30002 {
+			t.Fatalf("handed out %d, having handed out %v", port, seen)
+		}
+		seen[port] = true
+	}
+	if port, err := a.acquire(); !errors.Is(err, errNoFreePort) {
+		t.Fatalf("acquired %d from a used-up range, err %v", port, err)
+	}
+}
+
+func TestPortAllocatorReleaseGoesRoundRobin(t *testing.T) {
+	a := newPortAllocator(30000, 30002)
+	first := acquire(t, a)
+	a.release(first)
+	// The port just released waits its turn behind the others.
+	if port := acquire(t, a); port == first {
+		t.Errorf("reused %d straight away", port)
+	}
+	acquire(t, a)
+	if port := acquire(t, a); port != first {
+		t.Errorf("acquired %d, want the released %d once the range wrapped", port, first)
+	}
+}
+
+func TestPortAllocatorReleasesByContainer(t *testing.T) {
+	a := newPortAllocator(30000, 30000)
+	port := acquire(t, a)
+	a.bind(port, "c1")
+	a.releaseContainer("unknown") // a container spun before a restart
+	if _, err := a.acquire(); !errors.Is(err, errNoFreePort) {
+		t.Fatal("released a port held by another container")
+	}
+	a.releaseContainer("c1")
+	if got := acquire(t, a); got != port {
+		t.Errorf("acquired %d, want %d back", got, port)
+	}
+	a.releaseContainer("c1") // killed twice: no effect
+	if _, err := a.acquire(); !errors.Is(err, errNoFreePort) {
+		t.Error("a second release freed the port from its new holder")
+	}
+}
+
+func TestPortAllocatorConcurrently(t *testing.T) {
+	a := newPortAllocator(30000, 30099)
+	var mu sync.Mutex
+	seen := map[int]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				port, err := a.acquire()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				seen[port]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for port, n := range seen {
+		if n > 1 {
+			t.Errorf("port %d handed out %d times", port, n)
+		}
+	}
+	if len(seen) != 100 {
+		t.Errorf("%d ports handed out, want 100", len(seen))
+	}
+}
+
+func TestIsPortConflict(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&buildFailure{step: "run", out: "Bind for 0.0.0.0:30001 failed: port is already allocated"}, true},
+		{&buildFailure{step: "run", out: "listen tcp 0.0.0.0:30001: bind: address already in use"}, true},
+		{&buildFailure{step: "run", out: `Conflict. The container name "/forge-30001" is already in use by container "abc"`}, true},
+		{&buildFailure{step: "run", out: "OCI runtime create failed"}, false},
+		{&buildFailure{step: "build", out: "port is already allocated"}, false},
+		{errors.New("port is already allocated"), false},
+	} {
+		if got := isPortConflict(tc.err); got != tc.want {
+			t.Errorf("isPortConflict(%v) = %v", tc.err, got)
+		}
+	}
+}
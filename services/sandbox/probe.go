@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// readyMarker is the fragment the served page must contain before the
+// sandbox counts as up. Vite serves index.html (with the root div) long
+// before the bundle compiles, but a 200 still means the dev server is live.
+func readyMarker(platform string) string {
+	switch platform {
+	case events.PlatformReact:
+		return `id="root"`
+	case events.PlatformNextJS:
+		return "<body"
+	case events.PlatformKMP:
+		return `id="ComposeTarget"`
+	default:
+		return ""
+	}
+}
+
+// waitReady polls url until it answers 200 with marker in the body, or ctx
+// expires. The caller bounds ctx by whatever is left of the build budget.
+func waitReady(ctx context.Context, url, marker string, interval time.Duration) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return poll(ctx, url, interval, func() error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return hasMarker(body, marker)
+	})
+}
+
+// waitReadyInside is waitReady run from inside containerID with its own
+// wget, which every sandbox image ships. A sandbox on the internal network
+// is only reachable from that network, and this service stays off it so
+// generated code can't reach the docker socket it holds.
+func waitReadyInside(ctx context.Context, h *dockerHost, containerID, url, marker string, interval time.Duration) error {
+	return poll(ctx, url, interval, func() error {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		var stderr strings.Builder
+		cmd := h.command(probeCtx, "exec", containerID, "wget", "-q", "-O", "-", url)
+		cmd.Stderr = &stderr
+		body, err := cmd.Output()
+		if err != nil {
+			if msg := lastLine(stderr.String()); msg != "" {
+				return errors.New(msg)
+			}
+			return err
+		}
+		return hasMarker(body, marker)
+	})
+}
+
+// poll runs probe every interval until it succeeds or ctx ends. The error
+// is the last probe's that ran to completion: one cut off by ctx only says
+// it was cut off.
+func poll(ctx context.Context, url string, interval time.Duration, probe func() error) error {
+	var lastErr error
+	for {
+		err := probe()
+		if err == nil {
+			return nil
+		}
+		if lastErr == nil || ctx.Err() == nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("sandbox not ready at %s: %w", url, lastErr)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func hasMarker(body []byte, marker string) error {
+	if marker != "" && !strings.Contains(string(body), marker) {
+		return fmt.Errorf("response missing %q", marker)
+	}
+	return nil
+}
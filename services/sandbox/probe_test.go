@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitReady(t *testing.T) {
+	// A dev server that answers 503 twice, then an index.html without the
+	// bundle's root, then the page.
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch hits.Add(1) {
+		case 1, 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			w.Write([]byte("<html><body></body></html>"))
+		default:
+			w.Write([]byte(`<html><body><div id="root"></div></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	if err := waitReady(context.Background(), srv.URL, `id="root"`, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 4 {
+		t.Errorf("ready after %d probes, want 4", n)
+	}
+}
+
+func TestWaitReadyTimesOut(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"status", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}, "status 502"},
+		{"marker", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html><body></body></html>"))
+		}, `missing "id=\"root\""`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := waitReady(ctx, srv.URL, `id="root"`, 5*time.Millisecond)
+			if err == nil {
+				t.Fatal("ready on a page that never is")
+			}
+			if !strings.Contains(err.Error(), "sandbox not ready at "+srv.URL) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error %q, want the url and %q", err, tc.want)
+			}
+			if d := time.Since(start); d > 2*time.Second {
+				t.Errorf("gave up after %v, well past the deadline", d)
+			}
+		})
+	}
+}
+
+func TestCompileExcerpt(t *testing.T) {
+	vite := "vite v5.4.2 building for production...\n" +
+		"transforming...\n" +
+		"✓ 12 modules transformed.\n" +
+		"[vite:esbuild] Transform failed with 1 error:\n" +
+		"/app/src/Screen.tsx:14:8: ERROR: Expected \">\" but found \"/\"\n" +
+		"12 |    return (\n" +
+		"13 |      <div>\n" +
+		"14 |        </span>\n" +
+		"   |        ^\n"
+	long := "src/Screen.tsx: error\n" + strings.Repeat("frame\n", 30)
+
+	for _, tc := range []struct {
+		name, log, file, want string
+	}{
+		{"vite error", vite, "Screen.tsx",
+			"/app/src/Screen.tsx:14:8: ERROR: Expected \">\" but found \"/\"\n" +
+				"12 |    return (\n13 |      <div>\n14 |        </span>\n   |        ^"},
+		{"failure elsewhere", "npm ERR! code ETIMEDOUT\nnpm ERR! network request failed", "Screen.tsx", ""},
+		{"no filename", vite, "", ""},
+		{"capped", long, "Screen.tsx", "src/Screen.tsx: error" + strings.Repeat("\nframe", 14)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := compileExcerpt(tc.log, tc.file); got != tc.want {
+				t.Errorf("compileExcerpt = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
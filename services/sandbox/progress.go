@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Progress throttling: at most one event per interval, except that a new
+// build stage may go out after a quarter of it, and never more than
+// maxProgressEvents for one build however chatty it is.
+const maxProgressEvents = 60
+
+// buildkitStep matches BuildKit's plain progress header, e.g.
+// "#8 [4/5] RUN npm install", and the legacy builder's "Step 4/5 : RUN ...".
+var buildkitStep = regexp.MustCompile(`^(?:#\d+ \[[^\]]*\d+/\d+\]|Step \d+/\d+ :)\s*(.*)$`)
+
+// buildProgress turns docker build output into throttled progress updates.
+// It is fed one line at a time from a single goroutine.
+type buildProgress struct {
+	publish  func(stage, line string)
+	interval time.Duration
+	now      func() time.Time
+
+	last    time.Time
+	stage   string
+	sent    int
+	pending string // newest line not yet published
+}
+
+func newBuildProgress(interval time.Duration, publish func(stage, line string)) *buildProgress {
+	return &buildProgress{publish: publish, interval: interval, now: time.Now}
+}
+
+func (b *buildProgress) line(l string) {
+	l = strings.TrimSpace(l)
+	if l == "" {
+		return
+	}
+	newStage := false
+	if m := buildkitStep.FindStringSubmatch(l); m != nil && m[1] != b.stage {
+		b.stage, newStage = m[1], true
+	}
+	b.pending = l
+
+	since := b.now().Sub(b.last)
+	if b.sent >= maxProgressEvents || (since < b.interval && !(newStage && since >= b.interval/4)) {
+		return
+	}
+	b.emit()
+}
+
+// flush publishes the last line if it was throttled away.
+func (b *buildProgress) flush() {
+	if b.pending != "" && b.sent < maxProgressEvents {
+		b.emit()
+	}
+}
+
+func (b *buildProgress) emit() {
+	b.publish(b.stage, b.pending)
+	b.last, b.pending = b.now(), ""
+	b.sent++
+}
+
+// stageLabel describes a Dockerfile step in words for the dashboard.
+func stageLabel(stage string) string {
+	switch {
+	case stage == "":
+		return "building"
+	case strings.Contains(stage, "npm install"):
+		return "installing dependencies…"
+	case strings.Contains(stage, "npm run build"), strings.Contains(stage, "gradle"):
+		return "compiling…"
+	case strings.HasPrefix(stage, "COPY"):
+		return "copying sources…"
+	case strings.HasPrefix(stage, "FROM"):
+		return "preparing base image…"
+	}
+	return stage
+}
+
+// lineWriter splits everything written to it into lines for fn. exec calls
+// Write from one goroutine at a time when Stdout and Stderr share it.
+type lineWriter struct {
+	buf []byte
+	fn  func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close hands any unterminated last line to fn.
+func (w *lineWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// clock is a buildProgress's now, moved on by hand.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func testProgress(interval time.Duration) (*buildProgress, *clock, *[]string) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	var sent []string
+	b := newBuildProgress(interval, func(stage, line string) {
+		sent = append(sent, line)
+	})
+	b.now = c.now
+	return b, c, &sent
+}
+
+func TestBuildProgressThrottles(t *testing.T) {
+	b, c, sent := testProgress(2 * time.Second)
+	b.line("#5 [2/4] RUN npm install") // the first line goes out
+	b.line("npm WARN deprecated a")
+	c.advance(time.Second)
+	b.line("npm WARN deprecated b") // throttled
+	c.advance(time.Second)
+	b.line("added 120 packages") // the interval is up
+	c.advance(600 * time.Millisecond)
+	b.line("#6 [3/4] RUN npm run build") // a new stage, past a quarter of it
+	c.advance(100 * time.Millisecond)
+	b.line("#7 [4/4] COPY . .") // a new stage, but too soon
+	b.line("")                  // blank lines don't count
+	b.flush()
+
+	want := []string{"#5 [2/4] RUN npm install", "added 120 packages", "#6 [3/4] RUN npm run build", "#7 [4/4] COPY . ."}
+	if !slices.Equal(*sent, want) {
+		t.Errorf("sent %q\nwant %q", *sent, want)
+	}
+	if b.stage != "COPY . ." {
+		t.Errorf("stage %q", b.stage)
+	}
+}
+
+func TestBuildProgressFlushOnlyPending(t *testing.T) {
+	b, _, sent := testProgress(time.Second)
+	b.line("Step 1/3 : FROM node:20-alpine")
+	b.flush() // already sent
+	if len(*sent) != 1 {
+		t.Errorf("sent %q", *sent)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(l string) { lines = append(lines, l) }}
+	for _, chunk := range []string{"#1 [1/2] FR", "OM node\n#2 do", "ne\n\nlast"} {
+		w.Write([]byte(chunk))
+	}
+	w.Close()
+	if want := []string{"#1 [1/2] FROM node", "#2 done", "", "last"}; !slices.Equal(lines, want) {
+		t.Errorf("lines %q, want %q", lines, want)
+	}
+}
+
+func TestStageLabel(t *testing.T) {
+	for stage, want := range map[string]string{
+		"":                         "building",
+		"RUN npm install":          "installing dependencies…",
+		"RUN npm run build":        "compiling…",
+		"RUN gradle jsBrowserDist": "compiling…",
+		"COPY . .":                 "copying sources…",
+		"FROM node:20-alpine":      "preparing base image…",
+		"EXPOSE 3000":              "EXPOSE 3000",
+	} {
+		if got := stageLabel(stage); got != want {
+			t.Errorf("stageLabel(%q) = %q, want %q", stage, got, want)
+		}
+	}
+}
+
+// chattyCLI writes a container CLI whose build prints 1000 lines across
+// four BuildKit stages and then fails, and returns its path.
+func chattyCLI(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker")
+	script := `#!/bin/sh
+[ "$1" = build ] || exit 0
+i=1
+while [ $i -le 1000 ]; do
+	if [ $((i % 250)) -eq 1 ]; then
+		echo "#$i [$((i / 250 + 1))/4] RUN step $((i / 250 + 1))"
+	else
+		echo "#$i output line $i"
+	fi
+	i=$((i + 1))
+done
+echo "ERROR: failed to solve: exit code 1" >&2
+exit 1
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestChattyBuildEventsAreBounded(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		max      int
+	}{
+		{0, maxProgressEvents},       // unthrottled: only the cap holds
+		{2 * time.Second, 1 + 4 + 1}, // the first line, a stage each at most, and the last
+	} {
+		t.Run(fmt.Sprint(tc.interval), func(t *testing.T) {
+			sb := testRunner(t, &fakeRuntime{})
+			sb.runtime = dockerRuntime{policy: sb.policy}
+			sb.hosts.hosts[0].cli = chattyCLI(t)
+			sb.progressEvery = tc.interval
+
+			bus := newBus(t)
+			logs, err := bus.SubscribePrefetch("test.logs", events.LogEvent, 2000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := failure(t, sb, bus)
+			if !strings.Contains(p.BuildLog, "#1000 output line 1000") || !strings.Contains(p.BuildLog, "failed to solve") {
+				t.Errorf("build log doesn't end with the build's output:\n%s", lastLine(p.BuildLog))
+			}
+
+			n := 0
+			for {
+				select {
+				case d := <-logs:
+					_ = d.Ack(false)
+					n++
+					continue
+				case <-time.After(200 * time.Millisecond):
+				}
+				break
+			}
+			if n == 0 || n > tc.max {
+				t.Errorf("%d log events for 1000 lines, want 1 to %d", n, tc.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/mq"
+	"github.com/rs/zerolog/log"
+)
+
+// untrackedGrace spares containers that docker has started but the service
+// hasn't recorded yet.
+const untrackedGrace = 2 * time.Minute
+
+type trackedContainer struct {
+	Host     string    `json:"host,omitempty"` // docker endpoint; empty is the local daemon
+	JobID    string    `json:"job_id"`
+	Port     int       `json:"port"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// tracker records every container this service launched and hasn't removed,
+// persisted to a state file so a restart still knows what it owns.
+type tracker struct {
+	mu         sync.Mutex
+	path       string
+	containers map[string]trackedContainer // full container ID →
+}
+
+func loadTracker(path string) *tracker {
+	t := &tracker{path: path, containers: make(map[string]trackedContainer)}
+	if b, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &t.containers); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("sandbox state file unreadable — starting empty")
+		}
+	}
+	return t
+}
+
+func (t *tracker) add(containerID, host, jobID string, port int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.containers[containerID] = trackedContainer{Host: host, JobID: jobID, Port: port, LastUsed: time.Now()}
+	t.save()
+}
+
+func (t *tracker) touch(containerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.containers[containerID]; ok {
+		c.LastUsed = time.Now()
+		t.containers[containerID] = c
+		t.save()
+	}
+}
+
+func (t *tracker) remove(containerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.containers[containerID]; ok {
+		delete(t.containers, containerID)
+		t.save()
+	}
+}
+
+// hostOf returns the endpoint of the host that runs containerID.
+func (t *tracker) hostOf(containerID string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.containers[containerID]
+	return c.Host, ok
+}
+
+// lookup matches the short IDs docker ps prints against tracked full IDs.
+func (t *tracker) lookup(shortID string) (string, trackedContainer, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, c := range t.containers {
+		if strings.HasPrefix(id, shortID) {
+			return id, c, true
+		}
+	}
+	return "", trackedContainer{}, false
+}
+
+func (t *tracker) portInUse(host string, port int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.containers {
+		if c.Host == host && c.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the state file atomically. Callers hold t.mu.
+func (t *tracker) save() {
+	b, _ := json.Marshal(t.containers)
+	tmp := t.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		log.Warn().Err(err).Msg("sandbox state dir")
+		return
+	}
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		log.Warn().Err(err).Msg("write sandbox state")
+		return
+	}
+	_ = os.Rename(tmp, t.path)
+}
+
+// runReaper removes forge sandbox containers and images that outlived ttl
+// from every healthy host, once at startup and then every interval.
+func (s *sandboxRunner) runReaper(ctx context.Context, broker mq.Bus, ttl, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, h := range s.hosts.healthy() {
+			containers, images := s.reap(ctx, h, ttl)
+			if containers > 0 || images > 0 {
+				log.Info().Stringer("host", h).Int("containers", containers).Int("images", images).Msg("reaped sandbox leftovers")
+				b, _ := events.Wrap(events.LogEvent, events.LogEventPayload{
+					Level:   "info",
+					Step:    "sandbox_reap",
+					Message: "removed orphaned sandbox containers/images",
+					Data:    map[string]any{"host": h.String(), "containers": containers, "images": images},
+				})
+				_ = broker.Publish(ctx, events.LogEvent, b)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *sandboxRunner) reap(ctx context.Context, h *dockerHost, ttl time.Duration) (containers, images int) {
+	// Containers: tracked ones idle past ttl, untracked ones (a previous
+	// process's, or leaked by a crash) once past the grace period.
+	out, err := h.command(ctx, "ps", "-a",
+		"--filter", "name=^forge-[0-9]+$",
+		"--format", "{{.ID}}\t{{.CreatedAt}}").Output()
+	if err != nil {
+		log.Warn().Err(err).Stringer("host", h).Msg("reaper: docker ps")
+		return 0, 0
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		shortID, created, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if id, c, tracked := s.tracked.lookup(shortID); tracked {
+			if time.Since(c.LastUsed) > ttl {
+				// Kept alive for its unit's next iteration, which must now
+				// rebuild rather than swap into it.
+				s.live.drop(id)
+				s.kill(id)
+				containers++
+			}
+			continue
+		}
+		if age, ok := dockerAge(created); ok && age > untrackedGrace {
+			h.command(ctx, "rm", "-f", shortID).Run()
+			containers++
+		}
+	}
+
+	// Per-port images whose container is gone. Base images live under
+	// forge-sandbox-<platform> and are not matched.
+	out, err = h.command(ctx, "images", "forge-sandbox",
+		"--format", "{{.Repository}}:{{.Tag}}\t{{.CreatedAt}}").Output()
+	if err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			ref, created, ok := strings.Cut(line, "\t")
+			if !ok {
+				continue
+			}
+			ref = imageRef(ref)
+			if port, err := strconv.Atoi(strings.TrimPrefix(ref, "forge-sandbox:")); err == nil && s.tracked.portInUse(h.endpoint, port) {
+				continue
+			}
+			if age, ok := dockerAge(created); ok && age > ttl {
+				if h.command(ctx, "rmi", "-f", ref).Run() == nil {
+					images++
+				}
+			}
+		}
+	}
+
+	// Dangling layers left by rebuilt tags.
+	h.command(ctx, "image", "prune", "-f", "--filter", "until="+ttl.String()).Run()
+	return containers, images
+}
+
+// dockerAge parses docker's CreatedAt column ("2006-01-02 15:04:05 -0700 MST").
+func dockerAge(createdAt string) (time.Duration, bool) {
+	t, err := time.Parse("2006-01-02 15:04:05 -0700 MST", strings.TrimSpace(createdAt))
+	if err != nil {
+		return 0, false
+	}
+	return time.Since(t), true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// fakeCLI writes a container CLI that answers `ps` with psOut and every
+// other command with nothing, and returns its path.
+func fakeCLI(t *testing.T, psOut string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\nif [ \"$1\" = ps ]; then printf '%s' '" + psOut + "'; fi\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReapDropsLiveSandbox(t *testing.T) {
+	rt := &fakeRuntime{}
+	sb := testRunner(t, rt)
+	stale, fresh := "aaaaaaaaaaaa0000", "bbbbbbbbbbbb0000"
+	created := time.Now().Add(-time.Hour).Format("2006-01-02 15:04:05 -0700 MST")
+	h := sb.hosts.hosts[0]
+	h.cli = fakeCLI(t, stale[:12]+"\t"+created+"\n"+fresh[:12]+"\t"+created+"\n")
+
+	staleKey := unitKey{"job", 0, events.PlatformReact}
+	freshKey := unitKey{"job", 1, events.PlatformReact}
+	sb.tracked.add(stale, "", "job", 30001)
+	sb.tracked.add(fresh, "", "job", 30002)
+	sb.tracked.mu.Lock()
+	c := sb.tracked.containers[stale]
+	c.LastUsed = time.Now().Add(-time.Hour)
+	sb.tracked.containers[stale] = c
+	sb.tracked.mu.Unlock()
+	sb.live.put(staleKey, &liveSandbox{containerID: stale, port: 30001, filename: "Home.tsx"})
+	sb.live.put(freshKey, &liveSandbox{containerID: fresh, port: 30002, filename: "Home.tsx"})
+
+	containers, _ := sb.reap(context.Background(), h, 30*time.Minute)
+	if containers != 1 {
+		t.Errorf("reaped %d containers, want 1", containers)
+	}
+	if got := rt.kills(); !reflect.DeepEqual(got, []string{stale}) {
+		t.Errorf("killed %v, want %s", got, stale)
+	}
+	if _, ok := sb.live.take(staleKey); ok {
+		t.Error("reaped container still live: the next iteration would swap into it")
+	}
+	if _, ok := sb.live.take(freshKey); !ok {
+		t.Error("container in use was dropped")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/rs/zerolog/log"
+)
+
+// unitKey identifies the screen×platform a sandbox belongs to. Iterations of
+// the same unit reuse one container.
+type unitKey struct {
+	JobID       string
+	ScreenIndex int
+	Platform    string
+}
+
+type liveSandbox struct {
+	containerID string
+	port        int
+	filename    string
+	lastUsed    time.Time
+}
+
+// registry holds containers kept alive between iterations.
+type registry struct {
+	mu   sync.Mutex
+	live map[unitKey]*liveSandbox
+}
+
+func newRegistry() *registry {
+	return &registry{live: make(map[unitKey]*liveSandbox)}
+}
+
+func (r *registry) put(k unitKey, ls *liveSandbox) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ls.lastUsed = time.Now()
+	r.live[k] = ls
+}
+
+// take removes and returns the sandbox for k; the caller owns it until it
+// puts it back.
+func (r *registry) take(k unitKey) (*liveSandbox, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ls, ok := r.live[k]
+	delete(r.live, k)
+	return ls, ok
+}
+
+// drop forgets containerID, killed by something other than the unit's
+// release, so a later iteration builds afresh instead of swapping into it.
+func (r *registry) drop(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, ls := range r.live {
+		if ls.containerID == containerID {
+			delete(r.live, k)
+		}
+	}
+}
+
+// expire removes and returns sandboxes idle for longer than ttl.
+func (r *registry) expire(ttl time.Duration) []*liveSandbox {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*liveSandbox
+	for k, ls := range r.live {
+		if time.Since(ls.lastUsed) > ttl {
+			out = append(out, ls)
+			delete(r.live, k)
+		}
+	}
+	return out
+}
+
+// runExpiry kills kept-alive containers whose unit was never released —
+// an orchestrator restart or a lost sandbox.release would leak them.
+func (s *sandboxRunner) runExpiry(ctx context.Context, ttl time.Duration) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for _, ls := range s.live.expire(ttl) {
+				log.Info().Str("container", shortID(ls.containerID)).Msg("sandbox idle past TTL — removing")
+				s.kill(ls.containerID)
+			}
+		}
+	}
+}
+
+// sourcePath is where the generated file lives inside a platform's
+// container. Node projects always run from workDir; a KMP project only
+// when staged there for a read-only rootfs.
+func sourcePath(platform, filename string, staged bool) string {
+	switch {
+	case platform == events.PlatformKMP && staged:
+		return workDir + "/src/commonMain/kotlin/" + filename
+	case platform == events.PlatformKMP:
+		return "/app/src/commonMain/kotlin/" + filename
+	case platform == events.PlatformNextJS:
+		return workDir + "/components/" + filename
+	default:
+		return workDir + "/src/" + filename
+	}
+}
+
+// settleDelay gives the dev server's file watcher time to notice the new
+// source before the readiness probe runs. Gradle's continuous build is the
+// slowest to react.
+func settleDelay(platform string) time.Duration {
+	if platform == events.PlatformKMP {
+		return 5 * time.Second
+	}
+	return time.Second
+}
+
+// hotSwap writes new component code into a running sandbox, letting the dev
+// server reload it in place.
+func (s *sandboxRunner) hotSwap(ctx context.Context, ls *liveSandbox, code, platform string) error {
+	h := s.hostOf(ls.containerID)
+	state, err := h.command(ctx, "inspect", "-f", "{{.State.Running}}", ls.containerID).Output()
+	if err != nil || strings.TrimSpace(string(state)) != "true" {
+		return fmt.Errorf("container %s not running", shortID(ls.containerID))
+	}
+
+	// docker cp can't write into a tmpfs mount, so stream the file in
+	// through a shell inside the container instead.
+	swap := h.command(ctx, "exec", "-i", ls.containerID,
+		"sh", "-c", `cat > "$0"`, sourcePath(platform, ls.filename, s.policy.readOnly[platform]))
+	swap.Stdin = strings.NewReader(code)
+	if out, err := swap.CombinedOutput(); err != nil {
+		return fmt.Errorf("docker exec: %s", strings.TrimSpace(string(out)))
+	}
+
+	// Check before the sandbox is reported ready, so a broken swap never
+	// gets screenshotted. The broken file stays until the next iteration
+	// overwrites it.
+	if s.typecheck && platform != events.PlatformKMP {
+		check := h.command(ctx, "exec", "-w", workDir, ls.containerID, "sh", "-c", typecheckCmd)
+		if out, err := check.CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &buildFailure{step: "typecheck", out: string(out)}
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(settleDelay(platform)):
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ContainerRuntime is what the runner does to containers on a host: build
+// an image, start it, wait for it to serve and remove it. dockerRuntime
+// drives the docker or podman CLI; anything else standing in for it lets the
+// scaffolding, port and readiness handling around it run without a
+// daemon.
+type ContainerRuntime interface {
+	// Build builds the context in dir as image tag, writing its output to
+	// out as it comes.
+	Build(ctx context.Context, h *dockerHost, tag, dir string, out io.Writer) error
+	// Run starts c detached and returns its container ID. A container
+	// that won't start is a *buildFailure of step "run".
+	Run(ctx context.Context, h *dockerHost, c containerSpec) (string, error)
+	// Kill removes a container, running or not.
+	Kill(ctx context.Context, h *dockerHost, containerID string) error
+	// WaitHealthy polls url until it answers 200 with marker in the body,
+	// or ctx ends. With a containerID, url is fetched from inside that
+	// container on h rather than from here.
+	WaitHealthy(ctx context.Context, h *dockerHost, containerID, url, marker string) error
+	// Logs returns the last n lines of a container's output.
+	Logs(ctx context.Context, h *dockerHost, containerID string, n int) string
+}
+
+// containerSpec is a sandbox container to start.
+type containerSpec struct {
+	name     string
+	tag      string
+	platform string
+	port     int
+	env      map[string]string
+}
+
+// dockerRuntime runs sandboxes with each host's container CLI, under
+// policy.
+type dockerRuntime struct {
+	policy sandboxPolicy
+}
+
+func (d dockerRuntime) Build(ctx context.Context, h *dockerHost, tag, dir string, out io.Writer) error {
+	build := h.command(ctx, d.policy.buildArgs(tag, dir)...)
+	if build.Env == nil {
+		build.Env = os.Environ()
+	}
+	build.Env = append(build.Env, "BUILDKIT_PROGRESS=plain")
+	build.Stdout = out
+	build.Stderr = out
+	return build.Run()
+}
+
+func (d dockerRuntime) Run(ctx context.Context, h *dockerHost, c containerSpec) (string, error) {
+	out, err := h.command(ctx, d.policy.runArgs(c.name, c.tag, c.platform, c.port, c.env)...).Output()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return "", &buildFailure{step: "run", out: string(ee.Stderr)}
+		}
+		return "", fmt.Errorf("%s run: %w", h.cli, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (d dockerRuntime) Kill(ctx context.Context, h *dockerHost, containerID string) error {
+	return h.command(ctx, "rm", "-f", containerID).Run()
+}
+
+func (d dockerRuntime) WaitHealthy(ctx context.Context, h *dockerHost, containerID, url, marker string) error {
+	if containerID != "" {
+		return waitReadyInside(ctx, h, containerID, url, marker, time.Second)
+	}
+	return waitReady(ctx, url, marker, time.Second)
+}
+
+func (d dockerRuntime) Logs(ctx context.Context, h *dockerHost, containerID string, n int) string {
+	out, _ := h.command(ctx, "logs", "--tail", fmt.Sprint(n), containerID).CombinedOutput()
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/forge-ai/forge/shared/svc"
+	"github.com/rs/zerolog/log"
+)
+
+// sandboxPolicy is the isolation applied to every sandbox container. The code
+// inside is LLM-generated and untrusted: it runs with no capabilities, on a
+// network that can't reach the internal services, from a read-only image and
+// for a bounded time.
+type sandboxPolicy struct {
+	network      string          // dedicated sandbox network, never the services network
+	internal     bool            // network has no egress, so ports can't be published either
+	buildNetwork string          // docker build --network; "none" unless opted out, as builds run generated code
+	pids         map[string]int  // platform → --pids-limit
+	readOnly     map[string]bool // platform → --read-only rootfs with tmpfs scratch space
+	tmpfsSize    string
+	maxLifetime  time.Duration // hard kill after start, whatever the build context does
+	limits       map[string]platformLimits
+}
+
+// loadPolicy reads the policy from env. Every platform builds without a
+// network and runs from a read-only rootfs unless its env opts it out:
+// SANDBOX_BUILD_NETWORK=default for hosts without base images, which install
+// dependencies during the build, and SANDBOX_READ_ONLY_KMP=0 for gradle
+// projects too big to stage onto the tmpfs. Gradle forks far more processes
+// than vite, so KMP gets a higher pids limit.
+func loadPolicy() (sandboxPolicy, error) {
+	limits, err := loadLimits()
+	if err != nil {
+		return sandboxPolicy{}, err
+	}
+	p := sandboxPolicy{
+		network:      svc.EnvOr("SANDBOX_NETWORK", "forge-sandbox"),
+		internal:     svc.EnvOr("SANDBOX_NETWORK_INTERNAL", "1") == "1",
+		buildNetwork: svc.EnvOr("SANDBOX_BUILD_NETWORK", "none"),
+		pids:         make(map[string]int),
+		readOnly:     make(map[string]bool),
+		tmpfsSize:    svc.EnvOr("SANDBOX_TMPFS_SIZE", "256m"),
+		maxLifetime:  svc.EnvDuration("SANDBOX_MAX_LIFETIME", 30*time.Minute),
+		limits:       limits,
+	}
+	for _, platform := range []string{events.PlatformReact, events.PlatformNextJS, events.PlatformKMP} {
+		pids := 256
+		if platform == events.PlatformKMP {
+			pids = 1024
+		}
+		suffix := "_" + strings.ToUpper(platform)
+		p.pids[platform] = svc.EnvInt("SANDBOX_PIDS_LIMIT"+suffix, pids)
+		p.readOnly[platform] = svc.EnvOr("SANDBOX_READ_ONLY"+suffix, "1") != "0"
+	}
+	return p, nil
+}
+
+// runArgs is the full `docker run` argument list for a sandbox container.
+func (p sandboxPolicy) runArgs(name, tag, platform string, port int, env map[string]string) []string {
+	lim := p.limitsFor(platform)
+	args := []string{
+		"run", "--rm", "--detach",
+		"--network", p.network,
+		"--name", name,
+	}
+	if !p.internal {
+		args = append(args, "-p", fmt.Sprintf("%d:%d", port, port))
+	}
+	args = append(args, "-e", fmt.Sprintf("PORT=%d", port))
+	args = append(args, envArgs(env)...)
+	args = append(args,
+		"--memory", lim.Memory,
+		"--cpus", lim.CPUs,
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", strconv.Itoa(p.pids[platform]),
+	)
+	if p.readOnly[platform] {
+		tmpfs := "rw,exec,size=" + p.tmpfsSize
+		args = append(args,
+			"--read-only",
+			"--tmpfs", "/tmp:"+tmpfs,
+			"--tmpfs", workDir+":"+tmpfs,
+		)
+	}
+	return append(args, tag)
+}
+
+// buildArgs is the `docker build` argument list for a sandbox image.
+func (p sandboxPolicy) buildArgs(tag, dir string) []string {
+	args := []string{"build", "-t", tag}
+	if p.buildNetwork != "" {
+		args = append(args, "--network", p.buildNetwork)
+	}
+	return append(args, dir)
+}
+
+// ensureNetwork creates the sandbox network on h if it doesn't exist yet.
+func ensureNetwork(ctx context.Context, h *dockerHost, name string, internal bool) error {
+	if h.command(ctx, "network", "inspect", name).Run() == nil {
+		return nil
+	}
+	args := []string{"network", "create", "--driver", "bridge"}
+	if internal {
+		args = append(args, "--internal")
+	}
+	out, err := h.command(ctx, append(args, name)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker network create %s: %s", name, lastLine(string(out)))
+	}
+	log.Info().Str("network", name).Stringer("host", h).Bool("internal", internal).Msg("sandbox network created")
+	return nil
+}
+
+// shortID is containerID as docker prints it, or all of it when shorter.
+func shortID(containerID string) string {
+	if len(containerID) > 12 {
+		return containerID[:12]
+	}
+	return containerID
+}
+
+// lifetimes holds the hard-kill timer of every running sandbox.
+type lifetimes struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newLifetimes() *lifetimes {
+	return &lifetimes{timers: make(map[string]*time.Timer)}
+}
+
+// start arms kill to fire for containerID after d.
+func (l *lifetimes) start(containerID string, d time.Duration, kill func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timers[containerID] = time.AfterFunc(d, kill)
+}
+
+func (l *lifetimes) stop(containerID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := l.timers[containerID]; ok {
+		t.Stop()
+		delete(l.timers, containerID)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+func TestRunArgs(t *testing.T) {
+	t.Setenv("SANDBOX_NETWORK", "forge-sb")
+	t.Setenv("SANDBOX_TMPFS_SIZE", "128m")
+	p, err := loadPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.runArgs("forge-30001", "forge-sandbox:30001", events.PlatformReact, 30001, map[string]string{"B": "2", "A": "1"})
+	want := []string{
+		"run", "--rm", "--detach",
+		"--network", "forge-sb",
+		"--name", "forge-30001",
+		"-e", "PORT=30001",
+		"-e", "A=1", "-e", "B=2",
+		"--memory", "512m",
+		"--cpus", "1",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", "256",
+		"--read-only",
+		"--tmpfs", "/tmp:rw,exec,size=128m",
+		"--tmpfs", "/work:rw,exec,size=128m",
+		"forge-sandbox:30001",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("react on an internal network:\n got %q\nwant %q", got, want)
+	}
+
+	// KMP forks more, and a network with egress publishes the port.
+	p.internal = false
+	got = p.runArgs("forge-30002", "forge-sandbox:30002", events.PlatformKMP, 30002, nil)
+	want = []string{
+		"run", "--rm", "--detach",
+		"--network", "forge-sb",
+		"--name", "forge-30002",
+		"-p", "30002:30002",
+		"-e", "PORT=30002",
+		"--memory", "3g",
+		"--cpus", "2",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", "1024",
+		"--read-only",
+		"--tmpfs", "/tmp:rw,exec,size=128m",
+		"--tmpfs", "/work:rw,exec,size=128m",
+		"forge-sandbox:30002",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kmp on an open network:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestRunArgsFromEnv(t *testing.T) {
+	t.Setenv("SANDBOX_READ_ONLY_KMP", "0")
+	t.Setenv("SANDBOX_PIDS_LIMIT_NEXTJS", "64")
+	t.Setenv("SANDBOX_READ_ONLY_NEXTJS", "0")
+	t.Setenv("SANDBOX_LIMITS_NEXTJS", "mem=2g,cpus=1.5")
+	p, err := loadPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kmp := strings.Join(p.runArgs("n", "t", events.PlatformKMP, 1, nil), " "); strings.Contains(kmp, "--read-only") {
+		t.Errorf("kmp with SANDBOX_READ_ONLY_KMP=0: %s", kmp)
+	}
+	next := strings.Join(p.runArgs("n", "t", events.PlatformNextJS, 1, nil), " ")
+	for _, want := range []string{"--pids-limit 64", "--memory 2g", "--cpus 1.5"} {
+		if !strings.Contains(next, want) {
+			t.Errorf("nextjs: %s, want %s", next, want)
+		}
+	}
+	if strings.Contains(next, "--read-only") {
+		t.Errorf("nextjs with SANDBOX_READ_ONLY_NEXTJS=0: %s", next)
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	p, err := loadPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.buildArgs("forge-sandbox:30001", "/tmp/ctx"), []string{"build", "-t", "forge-sandbox:30001", "--network", "none", "/tmp/ctx"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default: got %q, want %q", got, want)
+	}
+	p = sandboxPolicy{}
+	if got, want := p.buildArgs("forge-sandbox:30001", "/tmp/ctx"), []string{"build", "-t", "forge-sandbox:30001", "/tmp/ctx"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	p.buildNetwork = "forge-build"
+	if got, want := p.buildArgs("forge-sandbox:30001", "/tmp/ctx"), []string{"build", "-t", "forge-sandbox:30001", "--network", "forge-build", "/tmp/ctx"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestShortID(t *testing.T) {
+	for id, want := range map[string]string{
+		"0123456789abcdef": "0123456789ab",
+		"0123456789ab":     "0123456789ab",
+		"id-3":             "id-3",
+		"":                 "",
+	} {
+		if got := shortID(id); got != want {
+			t.Errorf("shortID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestWaitReadyInside(t *testing.T) {
+	// A docker whose exec fails twice, as wget does while the dev server
+	// starts, then serves the page.
+	dir := t.TempDir()
+	cli := filepath.Join(dir, "docker")
+	script := `#!/bin/sh
+echo "$@" >> ` + dir + `/calls
+n=$(wc -l < ` + dir + `/calls)
+if [ "$n" -lt 3 ]; then echo "wget: can't connect to remote host (127.0.0.1): Connection refused" >&2; exit 1; fi
+echo '<div id="root"></div>'
+`
+	if err := os.WriteFile(cli, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h := testHost("", true)
+	h.cli = cli
+
+	if err := waitReadyInside(context.Background(), h, "abc123", "http://127.0.0.1:30001/", `id="root"`, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	calls, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, _, _ := strings.Cut(string(calls), "\n"); first != "exec abc123 wget -q -O - http://127.0.0.1:30001/" {
+		t.Errorf("probed with %q", first)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = waitReadyInside(ctx, h, "abc123", "http://127.0.0.1:30001/", "ComposeTarget", time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `missing "ComposeTarget"`) {
+		t.Errorf("a page without the marker: %v", err)
+	}
+
+	sb := &sandboxRunner{policy: sandboxPolicy{internal: true}}
+	if !sb.probeInside() {
+		t.Error("an internal network is probed from here")
+	}
+	if sb.probeHost = "10.0.0.7"; sb.probeInside() {
+		t.Error("SANDBOX_PROBE_HOST is ignored")
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	for _, tc := range []struct {
+		platform string
+		staged   bool
+		want     string
+	}{
+		{events.PlatformReact, false, "/work/src/Home.tsx"},
+		{events.PlatformNextJS, false, "/work/components/Home.tsx"},
+		{events.PlatformKMP, false, "/app/src/commonMain/kotlin/Home.kt"},
+		// SANDBOX_READ_ONLY_KMP=1 runs gradle from the tmpfs.
+		{events.PlatformKMP, true, "/work/src/commonMain/kotlin/Home.kt"},
+	} {
+		file := "Home.tsx"
+		if tc.platform == events.PlatformKMP {
+			file = "Home.kt"
+		}
+		if got := sourcePath(tc.platform, file, tc.staged); got != tc.want {
+			t.Errorf("%s staged=%v: %s, want %s", tc.platform, tc.staged, got, tc.want)
+		}
+	}
+}
+
+func TestScaffoldKMPStagesOnReadOnly(t *testing.T) {
+	for _, staged := range []bool{false, true} {
+		dir := t.TempDir()
+		if err := scaffoldKMP(dir, "@Composable fun Home() {}", "Home.kt", 30001, "", staged); err != nil {
+			t.Fatal(err)
+		}
+		df := readFile(t, filepath.Join(dir, "Dockerfile"))
+		if got := strings.Contains(df, "cd "+workDir); got != staged {
+			t.Errorf("staged=%v: Dockerfile runs from %s: %v\n%s", staged, workDir, got, df)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// fakeRuntime stands in for docker: it records the containers killed.
+// build and healthy, when set, are its image builds and readiness waits;
+// logs is every container's output.
+type fakeRuntime struct {
+	mu      sync.Mutex
+	killed  []string
+	build   func(ctx context.Context, out io.Writer) error
+	healthy func(ctx context.Context) error
+	logs    string
+}
+
+func (f *fakeRuntime) Build(ctx context.Context, _ *dockerHost, _, _ string, out io.Writer) error {
+	if f.build != nil {
+		return f.build(ctx, out)
+	}
+	return nil
+}
+
+func (f *fakeRuntime) Run(_ context.Context, _ *dockerHost, c containerSpec) (string, error) {
+	return "id-" + c.name + strings.Repeat("0", 12), nil
+}
+
+func (f *fakeRuntime) Kill(_ context.Context, _ *dockerHost, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.killed = append(f.killed, containerID)
+	return nil
+}
+
+func (f *fakeRuntime) WaitHealthy(ctx context.Context, _ *dockerHost, _, _, _ string) error {
+	if f.healthy != nil {
+		return f.healthy(ctx)
+	}
+	return nil
+}
+
+func (f *fakeRuntime) Logs(context.Context, *dockerHost, string, int) string { return f.logs }
+
+func (f *fakeRuntime) kills() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.killed...)
+}
+
+// testRunner is a sandboxRunner on fakeRuntime with one local host.
+func testRunner(t *testing.T, rt *fakeRuntime) *sandboxRunner {
+	t.Helper()
+	return &sandboxRunner{
+		runtime:   rt,
+		policy:    sandboxPolicy{maxLifetime: time.Hour},
+		hosts:     &hostPool{hosts: []*dockerHost{testHost("", true)}},
+		reuse:     true,
+		live:      newRegistry(),
+		tracked:   loadTracker(filepath.Join(t.TempDir(), "state.json")),
+		lifetimes: newLifetimes(),
+	}
+}
+
+func TestLifetimeEvictsLiveSandbox(t *testing.T) {
+	rt := &fakeRuntime{}
+	sb := testRunner(t, rt)
+	sb.policy.maxLifetime = 10 * time.Millisecond
+	id := "0123456789abcdef"
+	key := unitKey{"job", 0, events.PlatformReact}
+	sb.tracked.add(id, "", "job", 30001)
+	sb.live.put(key, &liveSandbox{containerID: id, port: 30001, filename: "Home.tsx"})
+	other := unitKey{"job", 1, events.PlatformReact}
+	sb.live.put(other, &liveSandbox{containerID: "fedcba9876543210", port: 30002, filename: "Home.tsx"})
+
+	sb.armLifetime(id)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		// Untracking is the last thing kill does.
+		if _, ok := sb.tracked.hostOf(id); !ok {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := rt.kills(); !reflect.DeepEqual(got, []string{id}) {
+		t.Fatalf("killed %v, want %s", got, id)
+	}
+	if _, ok := sb.live.take(key); ok {
+		t.Error("killed container still live: the next iteration would swap into it")
+	}
+	if _, ok := sb.live.take(other); !ok {
+		t.Error("another unit's container was dropped")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+var tokenScreen = events.FigmaScreen{
+	Colors:      map[string]string{"primary": "#6750A4", "secondary": "#FFFFFF", "color-5": "#00000080"},
+	Spacing:     []float64{16, 24},
+	BorderRadii: []float64{8},
+}
+
+func TestScaffoldTailwindConfigHasScreenColors(t *testing.T) {
+	theme := events.TailwindThemeFor(tokenScreen)
+	for _, platform := range []string{events.PlatformReact, events.PlatformNextJS} {
+		for _, static := range []bool{false, true} {
+			dir := t.TempDir()
+			err := scaffold(dir, "export default function Home() { return <div /> }", "Home.tsx", platform, 30001, "", static, false, false, theme, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := readFile(t, filepath.Join(dir, "tailwind.config.js"))
+			for name, hex := range tokenScreen.Colors {
+				if !strings.Contains(config, `"`+name+`":"`+hex+`"`) {
+					t.Errorf("%s (static %v): no %s %s in\n%s", platform, static, name, hex, config)
+				}
+			}
+
+			// Where node is about, load the config as Tailwind would.
+			node, err := exec.LookPath("node")
+			if err != nil {
+				continue
+			}
+			out, err := exec.Command(node, "-e", "console.log(JSON.stringify(require(process.argv[1]).theme.extend))",
+				filepath.Join(dir, "tailwind.config.js")).Output()
+			if err != nil {
+				t.Fatalf("%s: node can't load the config: %v", platform, err)
+			}
+			var got events.TailwindTheme
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, theme) {
+				t.Errorf("%s: theme.extend %+v, want %+v", platform, got, theme)
+			}
+		}
+	}
+}
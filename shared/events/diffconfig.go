@@ -0,0 +1,177 @@
+package events
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// DiffConfig is how a job's screens are compared. Every field is optional;
+// what is left unset uses the differ's defaults.
+type DiffConfig struct {
+	// Weights override the composite score's weight of the metrics named,
+	// one of DiffMetrics each; the rest keep the differ's. They are
+	// relative and normalised after merging.
+	Weights map[string]float64 `json:"weights,omitempty"`
+	// Minimums are scores, 0–100, that a metric must reach on its own for
+	// the screen to pass, whatever the composite: {"color": 80}. Keys are
+	// ones of MinimumMetrics.
+	Minimums map[string]float64 `json:"minimums,omitempty"`
+
+	Tolerance  *DiffTolerance `json:"tolerance,omitempty"`
+	Background string         `json:"background,omitempty"` // #RRGGBB transparent pixels are flattened onto
+	// IgnoreRegions are areas, in Figma units from each screen's top-left,
+	// left out of every diff, on top of the screen's own.
+	IgnoreRegions []Box           `json:"ignore_regions,omitempty"`
+	Resolution    int             `json:"resolution,omitempty"` // see JobSubmittedPayload.DiffResolution
+	Capture       *CaptureOptions `json:"capture,omitempty"`
+	Regions       *RegionOptions  `json:"regions,omitempty"`
+}
+
+// Region strategies: how a diff locates what mismatches.
+const (
+	// RegionsGrid cuts the screen into Cols×Rows cells and reports the
+	// Worst of those below the region threshold.
+	RegionsGrid = "grid"
+	// RegionsQuadrants reports every failing quadrant, by name: coarser,
+	// but "top-left" reads better than a cell in a prompt.
+	RegionsQuadrants = "quadrants"
+	// RegionsBlobs groups the differing pixels into connected areas and
+	// reports the Worst largest, leaving out those of fewer than MinBlob
+	// pixels as noise.
+	RegionsBlobs = "blobs"
+)
+
+var RegionStrategies = []string{RegionsGrid, RegionsQuadrants, RegionsBlobs}
+
+// Bounds on RegionOptions.
+const (
+	MaxRegionGrid  = 16 // cells a side
+	MaxRegionWorst = 32
+	MaxMinBlob     = 1 << 20
+)
+
+// RegionOptions is how a diff locates what mismatches. Each area found is
+// reported by its pixel bounds and score or, where the design names the
+// components in it, by component. Zero fields use the differ's defaults.
+type RegionOptions struct {
+	// Strategy is one of RegionStrategies; a job that sizes the grid
+	// without naming one asks for RegionsGrid.
+	Strategy string `json:"strategy,omitempty"`
+	Cols     int    `json:"cols,omitempty"`
+	Rows     int    `json:"rows,omitempty"`
+	Worst    int    `json:"worst,omitempty"`
+	MinBlob  int    `json:"min_blob,omitempty"` // pixels
+}
+
+// DiffMetrics are the metrics the composite score weighs.
+var DiffMetrics = []string{"ssim", "phash", "rmse", "layout", "typography", "color", "spacing", "layout_rmse", "typography_rmse", "text"}
+
+// MinimumMetrics are the metrics reported on DiffResult, which minimums
+// can be set for.
+var MinimumMetrics = []string{"ssim", "phash", "layout", "typography", "color", "spacing", "layout_rmse", "typography_rmse", "text"}
+
+// MetricScore returns the score r reports for one of MinimumMetrics, or
+// false if it doesn't have one: an unknown name, or text with OCR off.
+func (r *DiffResult) MetricScore(name string) (float64, bool) {
+	switch name {
+	case "ssim":
+		return r.SSIM, true
+	case "phash":
+		return r.PHash, true
+	case "layout":
+		return r.Layout, true
+	case "typography":
+		return r.Typography, true
+	case "color":
+		return r.Color, true
+	case "spacing":
+		return r.Spacing, true
+	case "layout_rmse":
+		return r.LayoutRMSE, true
+	case "typography_rmse":
+		return r.TypographyRMSE, true
+	case "text":
+		if r.TextAccuracy != nil {
+			return *r.TextAccuracy, true
+		}
+	}
+	return 0, false
+}
+
+// DiffConfig is the job's effective comparison config: p.Diff with the
+// top-level fields that predate it filling in what it leaves unset. It
+// is nil when the job sets neither.
+func (p *JobSubmittedPayload) DiffConfig() *DiffConfig {
+	var c DiffConfig
+	if p.Diff != nil {
+		c = *p.Diff
+		c.Weights, c.Minimums = maps.Clone(c.Weights), maps.Clone(c.Minimums)
+	}
+	if c.Tolerance == nil {
+		c.Tolerance = p.Tolerance
+	}
+	if c.Background == "" {
+		c.Background = p.Background
+	}
+	if c.IgnoreRegions == nil {
+		c.IgnoreRegions = p.IgnoreRegions
+	}
+	if c.Resolution == 0 {
+		c.Resolution = p.DiffResolution
+	}
+	if c.Capture == nil {
+		c.Capture = p.Capture
+	}
+	if c.isZero() {
+		return nil
+	}
+	return &c
+}
+
+func (c DiffConfig) isZero() bool {
+	return len(c.Weights) == 0 && len(c.Minimums) == 0 && c.Tolerance == nil && c.Background == "" &&
+		len(c.IgnoreRegions) == 0 && c.Resolution == 0 && c.Capture == nil && c.Regions == nil
+}
+
+// checkDiffConfig adds an error per invalid field of c to errs, keyed
+// "diff.<field>".
+func checkDiffConfig(errs map[string]string, c DiffConfig) {
+	for k := range c.Weights {
+		if !slices.Contains(DiffMetrics, k) {
+			errs["diff.weights."+k] = fmt.Sprintf("unknown metric (want %s)", strings.Join(DiffMetrics, ", "))
+		} else if c.Weights[k] < 0 {
+			errs["diff.weights."+k] = "must be >= 0"
+		}
+	}
+	for k := range c.Minimums {
+		if !slices.Contains(MinimumMetrics, k) {
+			errs["diff.minimums."+k] = fmt.Sprintf("unknown metric (want %s)", strings.Join(MinimumMetrics, ", "))
+		} else if v := c.Minimums[k]; v < 0 || v > 100 {
+			errs["diff.minimums."+k] = "must be 0-100"
+		}
+	}
+	checkTolerance(errs, "diff.tolerance", c.Tolerance)
+	checkBackground(errs, "diff.background", c.Background)
+	checkIgnoreRegions(errs, "diff.ignore_regions", c.IgnoreRegions)
+	checkDiffResolution(errs, "diff.resolution", c.Resolution)
+	checkCapture(errs, "diff.capture", c.Capture)
+	if g := c.Regions; g != nil {
+		if g.Strategy != "" && !slices.Contains(RegionStrategies, g.Strategy) {
+			errs["diff.regions.strategy"] = fmt.Sprintf("unknown value %q (want %s)", g.Strategy, strings.Join(RegionStrategies, ", "))
+		}
+		if g.Cols < 0 || g.Cols > MaxRegionGrid {
+			errs["diff.regions.cols"] = fmt.Sprintf("must be 0-%d", MaxRegionGrid)
+		}
+		if g.Rows < 0 || g.Rows > MaxRegionGrid {
+			errs["diff.regions.rows"] = fmt.Sprintf("must be 0-%d", MaxRegionGrid)
+		}
+		if g.Worst < 0 || g.Worst > MaxRegionWorst {
+			errs["diff.regions.worst"] = fmt.Sprintf("must be 0-%d", MaxRegionWorst)
+		}
+		if g.MinBlob < 0 || g.MinBlob > MaxMinBlob {
+			errs["diff.regions.min_blob"] = fmt.Sprintf("must be 0-%d", MaxMinBlob)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const fullDiffConfig = `{
+	"weights": {"ssim": 2, "color": 0.5},
+	"minimums": {"color": 80},
+	"tolerance": {"anti_alias": true, "shift_px": 2},
+	"background": "#F5F5F5",
+	"ignore_regions": [{"x": 0, "y": 0, "w": 360, "h": 24}],
+	"resolution": 512,
+	"capture": {"wait": "selector", "wait_selector": "#app", "wait_timeout_ms": 5000, "settle_ms": 200, "disable_animations": true},
+	"regions": {"strategy": "blobs", "worst": 4, "min_blob": 64}
+}`
+
+func TestDiffConfigRoundTrip(t *testing.T) {
+	var c DiffConfig
+	if err := json.Unmarshal([]byte(fullDiffConfig), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := DiffConfig{
+		Weights:       map[string]float64{"ssim": 2, "color": 0.5},
+		Minimums:      map[string]float64{"color": 80},
+		Tolerance:     &DiffTolerance{AntiAlias: true, ShiftPx: 2},
+		Background:    "#F5F5F5",
+		IgnoreRegions: []Box{{W: 360, H: 24}},
+		Resolution:    512,
+		Capture:       &CaptureOptions{Wait: CaptureWaitSelector, WaitSelector: "#app", WaitTimeoutMs: 5000, SettleMs: 200, DisableAnimations: true},
+		Regions:       &RegionOptions{Strategy: RegionsBlobs, Worst: 4, MinBlob: 64},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("decoded %+v\nwant %+v", c, want)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again DiffConfig
+	if err := json.Unmarshal(data, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, c) {
+		t.Errorf("round trip through %s gave %+v", data, again)
+	}
+
+	// Unset fields are left out, so the differ's defaults apply.
+	if data, _ := json.Marshal(DiffConfig{Resolution: 512}); string(data) != `{"resolution":512}` {
+		t.Errorf("a sparse config encodes as %s", data)
+	}
+}
+
+func TestJobDiffConfigMergesTopLevelFields(t *testing.T) {
+	var p JobSubmittedPayload
+	body := `{
+		"diff": {"weights": {"ssim": 2}, "background": "#000000"},
+		"background": "#FFFFFF",
+		"diff_resolution": 384,
+		"tolerance": {"shift_px": 1}
+	}`
+	if err := json.Unmarshal([]byte(body), &p); err != nil {
+		t.Fatal(err)
+	}
+	c := p.DiffConfig()
+	if c == nil {
+		t.Fatal("no config")
+	}
+	// diff's own fields win; the top-level ones fill in the rest.
+	if c.Background != "#000000" || c.Resolution != 384 || c.Tolerance == nil || c.Tolerance.ShiftPx != 1 || c.Weights["ssim"] != 2 {
+		t.Errorf("merged %+v", c)
+	}
+	// The merged config doesn't share the job's maps.
+	c.Weights["color"] = 1
+	if _, ok := p.Diff.Weights["color"]; ok {
+		t.Error("the merged weights alias the job's")
+	}
+
+	if c := (&JobSubmittedPayload{}).DiffConfig(); c != nil {
+		t.Errorf("a job without a config has %+v", c)
+	}
+}
+
+func TestCheckDiffConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		diff string
+		want map[string]string
+	}{
+		{"full", fullDiffConfig, nil},
+		{"empty", `{}`, nil},
+		{"unknown weight", `{"weights": {"vibes": 1}}`, map[string]string{
+			"diff.weights.vibes": "unknown metric (want ssim, phash, rmse, layout, typography, color, spacing, layout_rmse, typography_rmse, text)"}},
+		{"negative weight", `{"weights": {"ssim": -1}}`, map[string]string{"diff.weights.ssim": "must be >= 0"}},
+		{"rmse has no minimum", `{"minimums": {"rmse": 50}}`, map[string]string{
+			"diff.minimums.rmse": "unknown metric (want ssim, phash, layout, typography, color, spacing, layout_rmse, typography_rmse, text)"}},
+		{"minimum over 100", `{"minimums": {"color": 101}}`, map[string]string{"diff.minimums.color": "must be 0-100"}},
+		{"shift too far", `{"tolerance": {"shift_px": 4}}`, map[string]string{"diff.tolerance.shift_px": "must be 0-3"}},
+		{"background", `{"background": "white"}`, map[string]string{"diff.background": `"white" is not a #RRGGBB color`}},
+		{"short background", `{"background": "#FFF"}`, nil},
+		{"ignore region", `{"ignore_regions": [{"x": 0, "y": 0, "w": 10, "h": 10}, {"x": -1, "y": 0, "w": 10, "h": 10}]}`, map[string]string{
+			"diff.ignore_regions[1]": "needs x, y >= 0 and w, h > 0"}},
+		{"resolution", `{"resolution": 100}`, map[string]string{"diff.resolution": "must be 0 (full resolution) or at least 256"}},
+		{"selector without one", `{"capture": {"wait": "selector"}}`, map[string]string{"diff.capture.wait_selector": "required when wait is selector"}},
+		{"capture wait", `{"capture": {"wait": "load", "wait_timeout_ms": 60001, "settle_ms": -1}}`, map[string]string{
+			"diff.capture.wait":            "must be timeout, networkidle or selector",
+			"diff.capture.wait_timeout_ms": "must be 0-60000",
+			"diff.capture.settle_ms":       "must be 0-10000",
+		}},
+		{"regions", `{"regions": {"strategy": "rings", "cols": 17, "worst": 33}}`, map[string]string{
+			"diff.regions.strategy": `unknown value "rings" (want grid, quadrants, blobs)`,
+			"diff.regions.cols":     "must be 0-16",
+			"diff.regions.worst":    "must be 0-32",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var c DiffConfig
+			if err := json.Unmarshal([]byte(tc.diff), &c); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			checkDiffConfig(got, c)
+			if tc.want == nil {
+				tc.want = map[string]string{}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("errors %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,10 @@ package events
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,15 +16,18 @@ import (
 // ── Routing keys (RabbitMQ topic exchange: forge.events) ─────────────────────
 const (
 	JobSubmitted          = "job.submitted"
+	JobRetryRequested     = "job.retry.requested"
 	ParseFigmaRequested   = "figma.parse.requested"
 	FigmaParsed           = "figma.parsed"
 	FigmaFailed           = "figma.failed"
 	CodegenRequested      = "codegen.requested"
+	CodegenRPC            = "codegen.rpc" // request/reply: one-off generation, no pipeline
 	CodegenComplete       = "codegen.complete"
 	CodegenFailed         = "codegen.failed"
 	SandboxBuildRequested = "sandbox.build.requested"
 	SandboxReady          = "sandbox.ready"
 	SandboxFailed         = "sandbox.failed"
+	SandboxRelease        = "sandbox.release"
 	DiffRequested         = "diff.requested"
 	DiffComplete          = "diff.complete"
 	DiffFailed            = "diff.failed"
@@ -31,6 +38,34 @@ const (
 	JobFailed             = "job.failed"
 )
 
+// Sandbox serve modes: the dev server (fast, hot-reloadable) or a
+// production build served statically (faithful to real rendering).
+const (
+	SandboxModeDev    = "dev"
+	SandboxModeStatic = "static"
+)
+
+// SandboxEnvPrefix goes before the names of a job's sandbox env vars, so
+// they can't clobber the sandbox's own, PORT among them, and the bundlers
+// expose them to the page: API_URL is import.meta.env.FORGE_API_URL under
+// Vite and process.env.FORGE_API_URL under Next.js.
+const SandboxEnvPrefix = "FORGE_"
+
+// MaxPresetCodeLen bounds each screen's JobSubmittedPayload.PresetCode.
+const MaxPresetCodeLen = 256 << 10
+
+// Bounds on a reference-only job's screens, JobSubmittedPayload.References.
+const (
+	MaxReferences    = 50
+	MaxReferenceSize = 8192 // px, either side
+)
+
+// Bounds on a job's sandbox env.
+const (
+	MaxSandboxEnvVars  = 32
+	MaxSandboxEnvValue = 2048
+)
+
 const (
 	PlatformReact   = "react"
 	PlatformNextJS  = "nextjs"
@@ -38,6 +73,15 @@ const (
 	PlatformFlutter = "flutter"
 )
 
+// SupportedPlatforms lists the platforms the pipeline can generate, build
+// and diff end to end. PlatformFlutter is reserved but not wired up yet.
+var SupportedPlatforms = []string{PlatformReact, PlatformNextJS, PlatformKMP}
+
+const StylingTailwind = "tailwind"
+
+// SupportedStyling lists the styling systems codegen prompts for.
+var SupportedStyling = []string{StylingTailwind}
+
 // ── Envelope wraps every message ─────────────────────────────────────────────
 
 type Envelope struct {
@@ -74,6 +118,50 @@ func UnwrapEnvelope(raw []byte) (*Envelope, error) {
 	return &env, json.Unmarshal(raw, &env)
 }
 
+// payloadTypes maps each routing key to the payload its envelopes carry.
+var payloadTypes = map[string]reflect.Type{
+	JobSubmitted:          reflect.TypeFor[JobSubmittedPayload](),
+	JobRetryRequested:     reflect.TypeFor[JobRetryRequestedPayload](),
+	ParseFigmaRequested:   reflect.TypeFor[ParseFigmaRequestedPayload](),
+	FigmaParsed:           reflect.TypeFor[FigmaParsedPayload](),
+	FigmaFailed:           reflect.TypeFor[FigmaFailedPayload](),
+	CodegenRequested:      reflect.TypeFor[CodegenRequestedPayload](),
+	CodegenRPC:            reflect.TypeFor[CodegenRequestedPayload](),
+	CodegenComplete:       reflect.TypeFor[CodegenCompletePayload](),
+	CodegenFailed:         reflect.TypeFor[CodegenFailedPayload](),
+	SandboxBuildRequested: reflect.TypeFor[SandboxBuildRequestedPayload](),
+	SandboxReady:          reflect.TypeFor[SandboxReadyPayload](),
+	SandboxFailed:         reflect.TypeFor[SandboxFailedPayload](),
+	SandboxRelease:        reflect.TypeFor[SandboxReleasePayload](),
+	DiffRequested:         reflect.TypeFor[DiffRequestedPayload](),
+	DiffComplete:          reflect.TypeFor[DiffCompletePayload](),
+	DiffFailed:            reflect.TypeFor[DiffFailedPayload](),
+	NotifyRequested:       reflect.TypeFor[NotifyRequestedPayload](),
+	LogEvent:              reflect.TypeFor[LogEventPayload](),
+	ScreenDone:            reflect.TypeFor[ScreenDonePayload](),
+	JobDone:               reflect.TypeFor[JobDonePayload](),
+	JobFailed:             reflect.TypeFor[JobFailedPayload](),
+}
+
+// UnwrapChecked is Unwrap for a handler of expectedKey: it fails if the
+// envelope was published under another routing key, or if T isn't the
+// payload expectedKey carries, rather than decoding whatever fields happen
+// to match into T.
+func UnwrapChecked[T any](raw []byte, expectedKey string) (*T, error) {
+	if want, ok := payloadTypes[expectedKey]; ok && want != reflect.TypeFor[T]() {
+		return nil, fmt.Errorf("%s carries %s, not %s", expectedKey, want, reflect.TypeFor[T]())
+	}
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, err
+	}
+	if env.RoutingKey != expectedKey {
+		return nil, fmt.Errorf("envelope %s is %q, handler expects %q", env.ID, env.RoutingKey, expectedKey)
+	}
+	var t T
+	return &t, json.Unmarshal(env.Payload, &t)
+}
+
 // ── Payload types ─────────────────────────────────────────────────────────────
 
 type JobSubmittedPayload struct {
@@ -83,6 +171,136 @@ type JobSubmittedPayload struct {
 	Platforms []string `json:"platforms"`
 	Styling   string   `json:"styling"`
 	Threshold int      `json:"threshold"`
+	// SandboxMode is SandboxModeDev or SandboxModeStatic; empty uses the
+	// sandbox service default.
+	SandboxMode string `json:"sandbox_mode,omitempty"`
+	// SandboxEnv are env vars the generated code can read, named without
+	// SandboxEnvPrefix. They end up in the page, so they are for config
+	// and feature flags, not secrets.
+	SandboxEnv map[string]string `json:"sandbox_env,omitempty"`
+	// PresetCode is code the user already has, by screen index. Those
+	// screens start from it instead of a generated first iteration, and
+	// codegen is only asked to refine it if it falls short. Code is for
+	// one platform, so a job with preset code has exactly one.
+	PresetCode map[int]string `json:"preset_code,omitempty"`
+	// PromptPrefix is prepended to every codegen prompt for the job;
+	// SystemOverride is added to the system message. Both are checked with
+	// CheckPromptOverride and can't displace the output-format rules.
+	PromptPrefix   string `json:"prompt_prefix,omitempty"`
+	SystemOverride string `json:"system_override,omitempty"`
+	// Tolerance overrides the differ's defaults for this job.
+	Tolerance *DiffTolerance `json:"tolerance,omitempty"`
+	// Background is the #RRGGBB both images are flattened onto before
+	// diffing; empty uses the differ's default.
+	Background string `json:"background,omitempty"`
+	// ExportScale is the scale Figma renders the reference screens at;
+	// 0 uses the parser's default. Higher catches finer detail at the cost
+	// of larger exports and slower diffs.
+	ExportScale float64 `json:"export_scale,omitempty"`
+	// References make the job reference-only: its screens are these
+	// images, mockups that aren't in Figma, and FigmaURL is left empty.
+	References []ReferenceScreen `json:"references,omitempty"`
+	// ReferenceImages replace Figma's export of screens, by index, with
+	// images of the user's own. Such a screen is diffed at its frame's
+	// size only, even if it has breakpoints.
+	ReferenceImages map[int]string `json:"reference_images,omitempty"`
+	// IgnoreRegions are areas, in Figma units from each screen's top-left,
+	// left out of every diff of the job.
+	IgnoreRegions []Box `json:"ignore_regions,omitempty"`
+	// DiffResolution is the width, in pixels, the differ shrinks both
+	// images to before comparing them; 0 uses the differ's default. Lower
+	// is faster but blurs away hairline and 1px differences.
+	DiffResolution int `json:"diff_resolution,omitempty"`
+	// Capture controls how the differ waits for the page before
+	// screenshotting it; nil uses the differ's defaults.
+	Capture *CaptureOptions `json:"capture,omitempty"`
+	// Diff holds every comparison setting in one place, metric weights
+	// and minimums included. Where it and the fields above both set
+	// something, Diff wins; see DiffConfig.
+	Diff *DiffConfig `json:"diff,omitempty"`
+	// Notifications routes the job's notifications to its own channels;
+	// nil sends them to the notifier's defaults.
+	Notifications *NotifyConfig `json:"notifications,omitempty"`
+	// Priority orders the job's work in the service queues, 0 to
+	// MaxPriority: PriorityInteractive for someone waiting on the result,
+	// PriorityBatch, the default, for the rest.
+	Priority int `json:"priority,omitempty"`
+}
+
+// ReferenceOnly reports whether the job diffs against its References
+// instead of a Figma file, which is then never parsed.
+func (p *JobSubmittedPayload) ReferenceOnly() bool { return len(p.References) > 0 }
+
+// JobRetryRequestedPayload resumes a failed job: screen×platforms that
+// already passed are kept and only the rest are generated again.
+type JobRetryRequestedPayload struct {
+	JobID string `json:"job_id"`
+}
+
+// Job priorities. The service queues order by up to MaxPriority, their
+// x-max-priority.
+const (
+	PriorityBatch       = 0
+	PriorityInteractive = 5
+	MaxPriority         = 9
+)
+
+// Figma's images endpoint accepts export scales in this range.
+const (
+	MinExportScale = 0.01
+	MaxExportScale = 4
+)
+
+// MinDiffResolution is the narrowest DiffResolution accepted; below it
+// text is unreadable and most scores meaningless.
+const MinDiffResolution = 256
+
+// MaxShiftPx bounds DiffTolerance.ShiftPx: beyond a few pixels a shift is a
+// layout error, not rasterizer noise.
+const MaxShiftPx = 3
+
+// DiffTolerance relaxes the pixel comparison for differences between
+// Figma's rasterizer and Chromium's that no code change can fix.
+type DiffTolerance struct {
+	// AntiAlias ignores pixels that look like anti-aliased edges in either
+	// image.
+	AntiAlias bool `json:"anti_alias"`
+	// ShiftPx counts a pixel as matching when one within this many pixels
+	// in the other image matches it; 0 compares pixels in place.
+	ShiftPx int `json:"shift_px"`
+}
+
+// Capture wait strategies: a fixed delay, until the network goes quiet, or
+// until an element is visible.
+const (
+	CaptureWaitTimeout     = "timeout"
+	CaptureWaitNetworkIdle = "networkidle"
+	CaptureWaitSelector    = "selector"
+)
+
+// Bounds on CaptureOptions durations, in milliseconds.
+const (
+	MaxCaptureWaitMs   = 60000
+	MaxCaptureSettleMs = 10000
+)
+
+// CaptureOptions tunes when the differ takes its screenshot. Pages with
+// web fonts and remote images need longer than simple ones; waiting for a
+// selector that renders last is the most reliable.
+type CaptureOptions struct {
+	// Wait is one of CaptureWait*; empty uses the capture backend's
+	// default.
+	Wait string `json:"wait,omitempty"`
+	// WaitSelector is the CSS selector CaptureWaitSelector waits for.
+	WaitSelector string `json:"wait_selector,omitempty"`
+	// WaitTimeoutMs is the delay for CaptureWaitTimeout and the most the
+	// other strategies wait; 0 uses the default.
+	WaitTimeoutMs int `json:"wait_timeout_ms,omitempty"`
+	// SettleMs is an extra delay after the wait, before the screenshot.
+	SettleMs int `json:"settle_ms,omitempty"`
+	// DisableAnimations injects a style tag turning off CSS animations
+	// and transitions, so the page is captured in its final state.
+	DisableAnimations bool `json:"disable_animations,omitempty"`
 }
 
 type TextStyle struct {
@@ -97,20 +315,91 @@ type ComponentNode struct {
 	Type     string          `json:"type"`
 	Name     string          `json:"name"`
 	Props    map[string]any  `json:"props"`
+	Box      *Box            `json:"box,omitempty"` // position within the screen's frame
 	Children []ComponentNode `json:"children,omitempty"`
 }
 
+// Box is a rectangle in Figma units relative to the screen's top-left.
+type Box struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
+}
+
 type FigmaScreen struct {
 	NodeID        string               `json:"node_id"`
 	Name          string               `json:"name"`
+	ComponentName string               `json:"component_name"`
 	Width         float64              `json:"width"`
 	Height        float64              `json:"height"`
-	Colors        map[string]string    `json:"colors"`
+	Colors        map[string]string    `json:"colors"`      // palette token → hex, deduplicated
+	NodeColors    map[string]string    `json:"node_colors"` // node name → palette token
 	Typography    map[string]TextStyle `json:"typography"`
 	Spacing       []float64            `json:"spacing"`
 	BorderRadii   []float64            `json:"border_radii"`
 	ComponentTree ComponentNode        `json:"component_tree"`
 	ExportURL     string               `json:"export_url"`
+	// Viewports are the screen's responsive variants, narrowest first; empty
+	// for a screen designed at a single size.
+	Viewports []Viewport `json:"viewports,omitempty"`
+	// IgnoreRegions are the boxes of nodes named with IgnoreMarker, which
+	// the differ leaves out of the comparison.
+	IgnoreRegions []Box `json:"ignore_regions,omitempty"`
+	// FixedHeight marks a device-sized frame whose content scrolls inside
+	// it: the export shows one viewport, so the capture must too, rather
+	// than the full page.
+	FixedHeight bool `json:"fixed_height,omitempty"`
+}
+
+// ReferenceScreen is one screen of a reference-only job.
+type ReferenceScreen struct {
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"` // PNG or JPEG, fetched by the differ
+	// Width and Height are the screen's size in CSS pixels, which the
+	// sandbox is captured at; the image may be a multiple of it.
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// Colors is an optional palette, token → #RRGGBB, for codegen to use
+	// in place of the colors the parser would have read.
+	Colors map[string]string `json:"colors,omitempty"`
+}
+
+// ReferenceScreens builds the screens of a reference-only job in place of
+// the parser. With no nodes to read, their component tree is the frame
+// alone and their tokens are only the palette given.
+func ReferenceScreens(refs []ReferenceScreen) []FigmaScreen {
+	screens := make([]FigmaScreen, len(refs))
+	for i, r := range refs {
+		screens[i] = FigmaScreen{
+			Name:          r.Name,
+			Width:         r.Width,
+			Height:        r.Height,
+			Colors:        r.Colors,
+			ComponentTree: ComponentNode{Type: "FRAME", Name: r.Name},
+			ExportURL:     r.ImageURL,
+		}
+	}
+	UniqueComponentNames(screens)
+	return screens
+}
+
+// IgnoreMarker in a Figma node's name marks content that changes between
+// captures (carousels, timestamps, skeleton loaders) and can't be diffed.
+const IgnoreMarker = "#ignore"
+
+// Viewport is one breakpoint of a responsive screen, backed by its own
+// Figma frame.
+type Viewport struct {
+	Name      string  `json:"name"` // breakpoint label from the frame name, e.g. "mobile"
+	NodeID    string  `json:"node_id"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	ExportURL string  `json:"export_url"`
+	// FixedHeight and IgnoreRegions are this variant's own; see
+	// FigmaScreen.
+	FixedHeight   bool  `json:"fixed_height,omitempty"`
+	IgnoreRegions []Box `json:"ignore_regions,omitempty"`
 }
 
 type FigmaParsedPayload struct {
@@ -120,34 +409,146 @@ type FigmaParsedPayload struct {
 	ScreenCount int           `json:"screen_count"`
 }
 
+// Figma failure codes, so clients can show an actionable message.
+const (
+	FigmaErrAuth        = "auth"
+	FigmaErrNotFound    = "not_found"
+	FigmaErrRateLimited = "rate_limited"
+)
+
 type FigmaFailedPayload struct {
 	JobID string `json:"job_id"`
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // one of FigmaErr*; empty when unclassified
+	// Retryable hints that the same request may succeed later (rate limit,
+	// Figma 5xx, network) as opposed to auth or not-found failures.
+	Retryable  bool `json:"retryable"`
+	RetryAfter int  `json:"retry_after,omitempty"` // seconds, from Figma's Retry-After
 }
 
 type ParseFigmaRequestedPayload struct {
-	JobID    string `json:"job_id"`
-	FigmaURL string `json:"figma_url"`
+	JobID       string  `json:"job_id"`
+	FigmaURL    string  `json:"figma_url"`
+	ExportScale float64 `json:"export_scale,omitempty"`
 }
 
 type MismatchRegion struct {
 	Property string `json:"property"`
 	Actual   string `json:"actual"`
 	Expected string `json:"expected"`
+	Viewport string `json:"viewport,omitempty"` // breakpoint the region was found at, if several were diffed
 	X        int    `json:"x"`
 	Y        int    `json:"y"`
 	W        int    `json:"w"`
 	H        int    `json:"h"`
 }
 
+// PersistentIssue is a mismatch region that has failed on several
+// consecutive iterations of the same screen.
+type PersistentIssue struct {
+	Region   MismatchRegion `json:"region"`
+	Failures int            `json:"failures"`
+}
+
 type DiffResult struct {
-	Score        float64          `json:"score"`
-	Layout       float64          `json:"layout"`
-	Typography   float64          `json:"typography"`
-	Spacing      float64          `json:"spacing"`
-	Color        float64          `json:"color"`
+	Score      float64 `json:"score"`
+	Layout     float64 `json:"layout"`
+	Typography float64 `json:"typography"`
+	Spacing    float64 `json:"spacing"`
+	Color      float64 `json:"color"`
+	SSIM       float64 `json:"ssim"`  // structural similarity, 0–100
+	PHash      float64 `json:"phash"` // perceptual-hash similarity, 0–100
+	// TextAccuracy is the share of the reference's words the capture shows,
+	// 0–100, read by OCR; nil when OCR is off or the screen has no text.
+	TextAccuracy *float64 `json:"text_accuracy,omitempty"`
+	// LayoutRMSE and TypographyRMSE are the pixel-band scores Layout and
+	// Typography were computed as before they moved to edge structure.
+	LayoutRMSE     float64 `json:"layout_rmse"`
+	TypographyRMSE float64 `json:"typography_rmse"`
+	// GeneratedWidth and GeneratedHeight are the capture's size in pixels.
+	// AspectRatioDelta is how much taller, relative to its width, the
+	// capture is than the reference: 0.1 is 10% taller, negative shorter.
+	GeneratedWidth   int     `json:"generated_width,omitempty"`
+	GeneratedHeight  int     `json:"generated_height,omitempty"`
+	AspectRatioDelta float64 `json:"aspect_ratio_delta"`
+	// OffsetX and OffsetY are how far, in Figma units, the capture's
+	// content was found shifted right and down of the design; it is moved
+	// back before scoring. Both are 0 when there was no clear offset.
+	OffsetX      int              `json:"offset_x,omitempty"`
+	OffsetY      int              `json:"offset_y,omitempty"`
 	Regions      []MismatchRegion `json:"regions"`
 	DiffImageURL string           `json:"diff_image_url,omitempty"`
+	// GeneratedImageURL is the capture that was compared, ReferenceImageURL
+	// the Figma export; both empty if they couldn't be stored.
+	GeneratedImageURL string `json:"generated_image_url,omitempty"`
+	ReferenceImageURL string `json:"reference_image_url,omitempty"`
+	// NoReference is set when there was no Figma export to diff against;
+	// Score is then 0 and meaningless rather than a real comparison.
+	NoReference bool `json:"no_reference,omitempty"`
+	// BelowMinimum names the metrics that missed the job's minimum for
+	// them (see DiffConfig.Minimums); the screen fails while any do.
+	BelowMinimum []string `json:"below_minimum,omitempty"`
+	// Viewports holds the per-breakpoint scores of a responsive diff; Score
+	// and the category scores above are their mean.
+	Viewports []ViewportScore `json:"viewports,omitempty"`
+	// Palette pairs each dominant reference color with the closest one in
+	// the capture, most prominent first.
+	Palette []PaletteMatch `json:"palette,omitempty"`
+}
+
+// PaletteMatch is one dominant reference color and its nearest counterpart
+// in the generated screen.
+type PaletteMatch struct {
+	Expected string  `json:"expected"`         // reference hex
+	Actual   string  `json:"actual,omitempty"` // closest generated hex
+	Coverage float64 `json:"coverage"`         // share of the reference it covers, 0–1
+	DeltaE   float64 `json:"delta_e"`          // CIEDE2000 distance between the two
+	Matched  bool    `json:"matched"`          // DeltaE within tolerance
+}
+
+// DiffDelta is how an iteration's scores moved from the previous
+// iteration's, in points: positive improved.
+type DiffDelta struct {
+	Score      float64 `json:"score"`
+	Layout     float64 `json:"layout"`
+	Typography float64 `json:"typography"`
+	Spacing    float64 `json:"spacing"`
+	Color      float64 `json:"color"`
+}
+
+// Delta is how r's scores moved from prev's.
+func (r DiffResult) Delta(prev DiffResult) DiffDelta {
+	return DiffDelta{
+		Score:      r.Score - prev.Score,
+		Layout:     r.Layout - prev.Layout,
+		Typography: r.Typography - prev.Typography,
+		Spacing:    r.Spacing - prev.Spacing,
+		Color:      r.Color - prev.Color,
+	}
+}
+
+// String lists the scores that moved, to a tenth of a point:
+// "score +1.4, layout +3.2, color -1.1".
+func (d DiffDelta) String() string {
+	var parts []string
+	for _, m := range []struct {
+		name string
+		v    float64
+	}{{"score", d.Score}, {"layout", d.Layout}, {"typo", d.Typography}, {"spacing", d.Spacing}, {"color", d.Color}} {
+		if math.Abs(m.v) >= 0.05 {
+			parts = append(parts, fmt.Sprintf("%s %+.1f", m.name, m.v))
+		}
+	}
+	if parts == nil {
+		return "no change"
+	}
+	return strings.Join(parts, ", ")
+}
+
+type ViewportScore struct {
+	Name  string  `json:"name"`
+	Width float64 `json:"width"`
+	Score float64 `json:"score"`
 }
 
 type CodegenRequestedPayload struct {
@@ -158,8 +559,18 @@ type CodegenRequestedPayload struct {
 	Styling     string      `json:"styling"`
 	RepoContext string      `json:"repo_context,omitempty"`
 	PrevDiff    *DiffResult `json:"prev_diff,omitempty"`
-	Iteration   int         `json:"iteration"`
-	Threshold   int         `json:"threshold"`
+	// PersistentIssues are PrevDiff regions that were also wrong in the
+	// iterations before it, most-repeated first.
+	PersistentIssues []PersistentIssue `json:"persistent_issues,omitempty"`
+	BuildError       string            `json:"build_error,omitempty"`
+	Iteration        int               `json:"iteration"`
+	Threshold        int               `json:"threshold"`
+
+	PromptPrefix   string `json:"prompt_prefix,omitempty"`
+	SystemOverride string `json:"system_override,omitempty"`
+
+	// Warnings are the previous iteration's CodegenComplete.Warnings.
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type CodegenCompletePayload struct {
@@ -171,13 +582,24 @@ type CodegenCompletePayload struct {
 	Filename    string      `json:"filename"`
 	Threshold   int         `json:"threshold"`
 	Screen      FigmaScreen `json:"screen"`
+	Provider    string      `json:"provider,omitempty"` // "kind:model" that served the request
+	// Usage is every provider's bill for the generation, failed attempts
+	// included.
+	Usage []TokenUsage `json:"usage,omitempty"`
+	// Warnings are what codegen's checks doubted about Code without
+	// rejecting it, such as unbalanced brackets.
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type CodegenFailedPayload struct {
-	JobID       string `json:"job_id"`
-	ScreenIndex int    `json:"screen_index"`
-	Platform    string `json:"platform"`
-	Error       string `json:"error"`
+	JobID       string       `json:"job_id"`
+	ScreenIndex int          `json:"screen_index"`
+	Platform    string       `json:"platform"`
+	Error       string       `json:"error"`
+	Usage       []TokenUsage `json:"usage,omitempty"` // of the attempts that got an answer
+	// Truncated is set when the answer was cut off at the LLM's
+	// max_tokens, which only a higher LLM_MAX_TOKENS can fix.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type SandboxBuildRequestedPayload struct {
@@ -189,6 +611,9 @@ type SandboxBuildRequestedPayload struct {
 	Filename    string      `json:"filename"`
 	Threshold   int         `json:"threshold"`
 	Screen      FigmaScreen `json:"screen"`
+	Mode        string      `json:"mode,omitempty"` // SandboxMode*
+	// Env is the job's SandboxEnv, names not yet prefixed.
+	Env map[string]string `json:"env,omitempty"`
 }
 
 type SandboxReadyPayload struct {
@@ -201,14 +626,39 @@ type SandboxReadyPayload struct {
 	URL         string      `json:"url"`
 	Threshold   int         `json:"threshold"`
 	Screen      FigmaScreen `json:"screen"`
+	StartupMs   int64       `json:"startup_ms,omitempty"`
+	Reused      bool        `json:"reused,omitempty"` // hot-swapped into the previous iteration's container
 }
 
+// Sandbox failure codes, carried in SandboxFailedPayload.Code.
+const (
+	SandboxErrBuildTimeout = "build_timeout" // docker build ran past its limit
+	SandboxErrReadyTimeout = "ready_timeout" // server never answered in time
+	SandboxErrTypecheck    = "typecheck"     // generated code failed tsc before it was served
+)
+
 type SandboxFailedPayload struct {
 	JobID       string `json:"job_id"`
 	ScreenIndex int    `json:"screen_index"`
 	Platform    string `json:"platform"`
+	Iteration   int    `json:"iteration"`
 	Error       string `json:"error"`
+	Code        string `json:"code,omitempty"` // one of SandboxErr*; empty otherwise
 	BuildLog    string `json:"build_log"`
+	// CompileError is the excerpt of BuildLog pointing at the generated
+	// file; empty when the failure was environmental.
+	CompileError string      `json:"compile_error,omitempty"`
+	Threshold    int         `json:"threshold"`
+	Screen       FigmaScreen `json:"screen"`
+}
+
+// SandboxReleasePayload tells the sandbox service a screen×platform unit is
+// finished and its container can go.
+type SandboxReleasePayload struct {
+	JobID       string `json:"job_id"`
+	ScreenIndex int    `json:"screen_index"`
+	Platform    string `json:"platform"`
+	ContainerID string `json:"container_id"`
 }
 
 type DiffRequestedPayload struct {
@@ -221,6 +671,12 @@ type DiffRequestedPayload struct {
 	FigmaExportURL string      `json:"figma_export_url"`
 	Screen         FigmaScreen `json:"screen"`
 	Threshold      int         `json:"threshold"`
+	// Viewports, when set, replaces the single capture at the screen's size
+	// with one capture and comparison per breakpoint.
+	Viewports []Viewport `json:"viewports,omitempty"`
+	// Config is the job's comparison settings; nil uses the differ's
+	// defaults throughout.
+	Config *DiffConfig `json:"config,omitempty"`
 }
 
 type DiffCompletePayload struct {
@@ -239,9 +695,21 @@ type DiffFailedPayload struct {
 	JobID       string `json:"job_id"`
 	ScreenIndex int    `json:"screen_index"`
 	Platform    string `json:"platform"`
+	Iteration   int    `json:"iteration"`
 	Error       string `json:"error"`
+	Code        string `json:"code,omitempty"` // one of the DiffErr codes; empty otherwise
 }
 
+// DiffFailedPayload codes.
+const (
+	// DiffErrSandboxUnreachable is a sandbox that stopped answering: the
+	// diff can't run until it is rebuilt.
+	DiffErrSandboxUnreachable = "sandbox_unreachable"
+	// DiffErrScreenshotTimeout is a diff that ran past the differ's
+	// DIFF_TIMEOUT, in practice a capture that hung, and was abandoned.
+	DiffErrScreenshotTimeout = "screenshot_timeout"
+)
+
 type NotifyRequestedPayload struct {
 	JobID        string  `json:"job_id"`
 	ScreenName   string  `json:"screen_name"`
@@ -249,6 +717,26 @@ type NotifyRequestedPayload struct {
 	Score        float64 `json:"score"`
 	Iterations   int     `json:"iterations"`
 	DiffImageURL string  `json:"diff_image_url"`
+	// ReferenceImageURL and GeneratedImageURL, when set, are shown next to
+	// the diff.
+	ReferenceImageURL string `json:"reference_image_url,omitempty"`
+	GeneratedImageURL string `json:"generated_image_url,omitempty"`
+
+	// Event is one of NotifyEvents; empty is NotifyScreenPassed. Job-level
+	// events leave the screen fields empty, and for NotifyJobDone Score is
+	// the average and Iterations the total across the job.
+	Event    string `json:"event,omitempty"`
+	FileName string `json:"file_name,omitempty"` // Figma file name, when known
+	// Channels are where to send it, each wanting Event; none is the
+	// notifier's defaults.
+	Channels    []NotifyChannel `json:"channels,omitempty"`
+	Digest      *NotifyDigest   `json:"digest,omitempty"`       // the job's NotifyConfig.Digest
+	Screens     int             `json:"screens,omitempty"`      // NotifyJobDone
+	ManifestURL string          `json:"manifest_url,omitempty"` // NotifyJobDone
+	// Results are the job's screen×platforms, for NotifyJobDone.
+	Results []ManifestScreen `json:"results,omitempty"`
+	Error   string           `json:"error,omitempty"` // NotifyJobFailed
+	Cost    *JobCost         `json:"cost,omitempty"`  // NotifyJobDone
 }
 
 type LogEventPayload struct {
@@ -259,21 +747,57 @@ type LogEventPayload struct {
 	Data    map[string]any `json:"data,omitempty"`
 }
 
+// ScreenDonePayload is the result of a finished screen×platform, as the
+// orchestrator stores it in screen_results.
 type ScreenDonePayload struct {
 	JobID       string  `json:"job_id"`
 	ScreenIndex int     `json:"screen_index"`
 	ScreenName  string  `json:"screen_name"`
 	Platform    string  `json:"platform"`
-	Score       float64 `json:"score"`
+	Score       float64 `json:"score"` // of the iteration it ended with
 	Iterations  int     `json:"iterations"`
+	// Status is how it ended, one of the ScreenStatus values.
+	Status        string  `json:"status,omitempty"`
+	BestScore     float64 `json:"best_score"`
+	BestIteration int     `json:"best_iteration,omitempty"` // 0 if none was diffed
+	// CodeURL and DiffImageURL are BestIteration's; empty if it has none
+	// or they weren't uploaded.
+	CodeURL      string `json:"code_url,omitempty"`
+	DiffImageURL string `json:"diff_image_url,omitempty"`
+	// DurationMS is from its first code generation to the end.
+	DurationMS int64 `json:"duration_ms"`
 }
 
+// ScreenDonePayload statuses.
+const (
+	ScreenStatusPassed        = "passed"
+	ScreenStatusMaxIterations = "max_iterations"
+	ScreenStatusStuck         = "stuck"   // generated the same code twice
+	ScreenStatusSkipped       = "skipped" // no Figma reference to diff against
+	ScreenStatusFailed        = "failed"  // codegen, build or diff failed
+)
+
 type JobDonePayload struct {
 	JobID     string   `json:"job_id"`
 	Screens   int      `json:"screens"`
 	Platforms []string `json:"platforms"`
 	AvgScore  float64  `json:"avg_score"`
 	TotalIter int      `json:"total_iterations"`
+	// ManifestURL links the job's JobManifest; empty if it couldn't be
+	// stored.
+	ManifestURL string `json:"manifest_url,omitempty"`
+	// Cost is what the job's generations cost, in USD, as far as the
+	// orchestrator's pricing knows their models.
+	Cost JobCost `json:"cost"`
+}
+
+// JobCost totals a job's LLM usage. Tokens of models without a price
+// count towards the tokens but not USD; Unpriced names those models.
+type JobCost struct {
+	USD          float64  `json:"usd"`
+	InputTokens  int      `json:"input_tokens"`
+	OutputTokens int      `json:"output_tokens"`
+	Unpriced     []string `json:"unpriced,omitempty"`
 }
 
 type JobFailedPayload struct {
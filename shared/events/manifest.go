@@ -0,0 +1,65 @@
+package events
+
+import "time"
+
+// JobManifest is the one artifact describing everything a finished job
+// produced. The orchestrator stores it as JSON next to the diff images and
+// links it from JobDonePayload.ManifestURL.
+type JobManifest struct {
+	JobID       string           `json:"job_id"`
+	FigmaURL    string           `json:"figma_url"`
+	FileName    string           `json:"file_name"`
+	Platforms   []string         `json:"platforms"`
+	Threshold   int              `json:"threshold"`
+	AvgScore    float64          `json:"avg_score"`
+	TotalIter   int              `json:"total_iterations"`
+	Cost        JobCost          `json:"cost"`
+	Tokens      TokenSummary     `json:"tokens"`
+	Screens     []ManifestScreen `json:"screens"`
+	CompletedAt time.Time        `json:"completed_at"`
+}
+
+// ManifestScreen is one screen×platform unit of a job.
+type ManifestScreen struct {
+	Index         int     `json:"index"`
+	Name          string  `json:"name"`
+	ComponentName string  `json:"component_name"`
+	Platform      string  `json:"platform"`
+	Filename      string  `json:"filename,omitempty"` // of the last generated code
+	BestScore     float64 `json:"best_score"`
+	Iterations    int     `json:"iterations"`
+	Passed        bool    `json:"passed"`
+	DiffImageURL  string  `json:"diff_image_url,omitempty"` // of the best-scoring iteration
+}
+
+// TokenSummary counts the distinct design tokens across a file's screens.
+type TokenSummary struct {
+	Colors      int `json:"colors"`
+	TextStyles  int `json:"text_styles"`
+	Spacing     int `json:"spacing"`
+	BorderRadii int `json:"border_radii"`
+}
+
+// SummarizeTokens counts the distinct tokens of screens. Colors are
+// counted by value, since palette token names are per screen.
+func SummarizeTokens(screens []FigmaScreen) TokenSummary {
+	colors := make(map[string]bool)
+	styles := make(map[TextStyle]bool)
+	spacing := make(map[float64]bool)
+	radii := make(map[float64]bool)
+	for _, s := range screens {
+		for _, hex := range s.Colors {
+			colors[hex] = true
+		}
+		for _, ts := range s.Typography {
+			styles[ts] = true
+		}
+		for _, v := range s.Spacing {
+			spacing[v] = true
+		}
+		for _, v := range s.BorderRadii {
+			radii[v] = true
+		}
+	}
+	return TokenSummary{Colors: len(colors), TextStyles: len(styles), Spacing: len(spacing), BorderRadii: len(radii)}
+}
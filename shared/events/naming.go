@@ -0,0 +1,116 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// reservedIdentifiers are names a generated component must never take:
+// JS/TS keywords, globals, and symbols the sandbox scaffolds import.
+var reservedIdentifiers = map[string]bool{
+	"React": true, "ReactDOM": true, "Component": true, "Fragment": true,
+	"Default": true, "New": true, "Class": true, "Function": true,
+	"Object": true, "String": true, "Number": true, "Boolean": true,
+	"Array": true, "Promise": true, "Error": true, "Map": true, "Set": true,
+	"Date": true, "Symbol": true, "Window": true, "Document": true,
+	"Image": true, "Link": true, "Head": true, "App": true, "Main": true,
+	"Text": true, "Box": true, "Row": true, "Column": true, "Surface": true,
+	"Modifier": true, "Composable": true, "Preview": true, "Unit": true,
+}
+
+// latinFold transliterates common accented Latin letters to ASCII.
+var latinFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i",
+	'î': "i", 'ï': "i", 'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o",
+	'õ': "o", 'ö': "o", 'ø': "o", 'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+	'ý': "y", 'ÿ': "y", 'þ': "th", 'ß': "ss", 'œ': "oe", 'ł': "l", 'ś': "s",
+	'ź': "z", 'ż': "z", 'ć': "c", 'ń': "n", 'ę': "e", 'ą': "a", 'č': "c",
+	'š': "s", 'ž': "z", 'ř': "r", 'ě': "e", 'ů': "u", 'ğ': "g", 'ı': "i",
+	'ş': "s",
+}
+
+// ComponentName turns an arbitrary Figma frame name into a PascalCase
+// identifier that is safe as both a file name and a component name.
+// Names with no usable characters fall back to Screen<index+1>.
+func ComponentName(frameName string, index int) string {
+	var words []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			words = append(words, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range frameName {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			cur.WriteRune(r)
+			continue
+		}
+		if t, ok := latinFold[unicode.ToLower(r)]; ok {
+			if unicode.IsUpper(r) {
+				t = strings.ToUpper(t[:1]) + t[1:]
+			}
+			cur.WriteString(t)
+			continue
+		}
+		flush()
+	}
+	flush()
+
+	var sb strings.Builder
+	for _, w := range words {
+		sb.WriteString(strings.ToUpper(w[:1]))
+		// Keep camel humps ("signUp" → "SignUp") but normalise SHOUTING words.
+		if strings.ToUpper(w) == w {
+			sb.WriteString(strings.ToLower(w[1:]))
+		} else {
+			sb.WriteString(w[1:])
+		}
+	}
+	name := sb.String()
+
+	if name == "" {
+		return fmt.Sprintf("Screen%d", index+1)
+	}
+	if unicode.IsDigit(rune(name[0])) {
+		name = "Screen" + name
+	}
+	if reservedIdentifiers[name] {
+		name += "Screen"
+	}
+	return name
+}
+
+// UniqueComponentNames assigns a ComponentName to every screen,
+// appending an index when two frames collapse to the same identifier.
+func UniqueComponentNames(screens []FigmaScreen) {
+	seen := make(map[string]int, len(screens))
+	for i := range screens {
+		name := ComponentName(screens[i].Name, i)
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			candidate := fmt.Sprintf("%s%d", name, n)
+			for seen[candidate] > 0 {
+				n++
+				candidate = fmt.Sprintf("%s%d", name, n)
+			}
+			seen[name] = n
+			seen[candidate]++
+			name = candidate
+		}
+		screens[i].ComponentName = name
+	}
+}
+
+// ComponentFilename is the file a screen's component is written to on
+// platform, named after its ComponentName.
+func ComponentFilename(name, platform string) string {
+	switch platform {
+	case PlatformKMP:
+		return name + "Screen.kt"
+	default:
+		return name + ".tsx"
+	}
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestComponentName(t *testing.T) {
+	for _, tc := range []struct {
+		frame string
+		index int
+		want  string
+	}{
+		{"Sign Up", 0, "SignUp"},
+		{"signUp flow", 0, "SignUpFlow"},
+		{"LOGIN SCREEN", 0, "LoginScreen"},
+		{"checkout/step-1 (v2)", 0, "CheckoutStep1V2"},
+		{"Café Menü", 0, "CafeMenu"},
+		{"Über uns", 0, "UberUns"},
+		{"Straße", 0, "Strasse"},
+		{"日本語 Home", 0, "Home"},
+		{"404 page", 0, "Screen404Page"},
+		{"app", 0, "AppScreen"},
+		{"Image", 0, "ImageScreen"},
+		{"🚀🚀", 2, "Screen3"},
+		{"", 0, "Screen1"},
+		{"---", 4, "Screen5"},
+	} {
+		if got := ComponentName(tc.frame, tc.index); got != tc.want {
+			t.Errorf("ComponentName(%q, %d) = %q, want %q", tc.frame, tc.index, got, tc.want)
+		}
+	}
+}
+
+func TestUniqueComponentNames(t *testing.T) {
+	screens := []FigmaScreen{{Name: "Home"}, {Name: "home"}, {Name: "Home 2"}, {Name: "HOME"}, {Name: ""}}
+	UniqueComponentNames(screens)
+	var got []string
+	for _, s := range screens {
+		got = append(got, s.ComponentName)
+	}
+	want := []string{"Home", "Home2", "Home22", "Home3", "Screen5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestComponentFilename(t *testing.T) {
+	for platform, want := range map[string]string{
+		PlatformReact:  "Checkout.tsx",
+		PlatformNextJS: "Checkout.tsx",
+		PlatformKMP:    "CheckoutScreen.kt",
+	} {
+		if got := ComponentFilename("Checkout", platform); got != want {
+			t.Errorf("%s: %q, want %q", platform, got, want)
+		}
+	}
+}
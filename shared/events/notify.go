@@ -0,0 +1,149 @@
+package events
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Notification events, which a channel's Events filter picks from.
+const (
+	NotifyScreenPassed = "screen_passed"
+	NotifyJobDone      = "job_done"
+	NotifyJobFailed    = "job_failed"
+	NotifyMaxIter      = "max_iter"
+)
+
+var NotifyEvents = []string{NotifyScreenPassed, NotifyJobDone, NotifyJobFailed, NotifyMaxIter}
+
+// Notification sinks a channel can name.
+const (
+	SinkTelegram = "telegram"
+	SinkSlack    = "slack"
+	SinkDiscord  = "discord"
+	SinkEmail    = "email"
+	SinkWebhook  = "webhook"
+)
+
+var NotifySinks = []string{SinkTelegram, SinkSlack, SinkDiscord, SinkEmail, SinkWebhook}
+
+// NotifyConfig routes a job's notifications. A job without one, or
+// without channels, notifies the notifier's default sinks.
+type NotifyConfig struct {
+	Channels []NotifyChannel `json:"channels,omitempty"`
+	// Digest overrides whether the notifier batches the job's screen
+	// notifications; nil leaves it to the notifier's default.
+	Digest *NotifyDigest `json:"digest,omitempty"`
+}
+
+// Bounds on NotifyDigest.
+const (
+	MaxDigestIntervalMin = 24 * 60
+	MaxDigestScreens     = 500
+)
+
+// NotifyDigest batches a job's screen_passed and max_iter notifications
+// into one message every IntervalMin minutes or Screens screens, whichever
+// comes first. The job's own end is sent at once, with whatever is still
+// batched.
+type NotifyDigest struct {
+	Enabled     bool `json:"enabled"`
+	IntervalMin int  `json:"interval_min,omitempty"` // 0 uses the notifier's
+	Screens     int  `json:"screens,omitempty"`      // 0 uses the notifier's
+}
+
+// NotifyChannel is one destination of a job's notifications. Secrets never
+// travel in it: Credentials names a set the notifier reads from its own
+// env, and Target is only where within the sink to post.
+type NotifyChannel struct {
+	// Sink is one of NotifySinks.
+	Sink string `json:"sink"`
+	// Credentials names the notifier's NOTIFY_<NAME>_* env vars, which
+	// stand in for the sink's usual ones: NOTIFY_DESIGN_TELEGRAM_BOT_TOKEN
+	// for "design" on Telegram. Empty uses the sink's usual env vars.
+	Credentials string `json:"credentials,omitempty"`
+	// Target is the Telegram chat ID or Slack channel ID to post to, or
+	// the comma-separated addresses to mail; empty uses the credentials'
+	// own, as does a target not on their allowlist. Webhooks post where
+	// they were made for, so Discord and webhook channels take none.
+	Target string `json:"target,omitempty"`
+	// Events are the NotifyEvents sent here; empty is all of them.
+	Events []string `json:"events,omitempty"`
+}
+
+// Wants reports whether event is sent to c.
+func (c NotifyChannel) Wants(event string) bool {
+	return len(c.Events) == 0 || slices.Contains(c.Events, event)
+}
+
+// ChannelsFor returns the channels of c that want event.
+func (c *NotifyConfig) ChannelsFor(event string) []NotifyChannel {
+	var out []NotifyChannel
+	for _, ch := range c.Channels {
+		if ch.Wants(event) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// credentialsRe is what a credentials name may be, as it becomes part of
+// an env var name.
+var credentialsRe = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+
+// CredentialsEnv returns the env var holding key for the named credentials,
+// or key itself for none: ("design", "SLACK_BOT_TOKEN") is
+// NOTIFY_DESIGN_SLACK_BOT_TOKEN.
+func CredentialsEnv(name, key string) string {
+	if name == "" {
+		return key
+	}
+	return "NOTIFY_" + strings.ToUpper(name) + "_" + key
+}
+
+func checkNotifications(errs map[string]string, c *NotifyConfig) {
+	if c == nil {
+		return
+	}
+	if len(c.Channels) == 0 && c.Digest == nil {
+		errs["notifications.channels"] = "at least one channel is required"
+	}
+	if d := c.Digest; d != nil {
+		if d.IntervalMin < 0 || d.IntervalMin > MaxDigestIntervalMin {
+			errs["notifications.digest.interval_min"] = fmt.Sprintf("must be 0-%d", MaxDigestIntervalMin)
+		}
+		if d.Screens < 0 || d.Screens > MaxDigestScreens {
+			errs["notifications.digest.screens"] = fmt.Sprintf("must be 0-%d", MaxDigestScreens)
+		}
+	}
+	for i, ch := range c.Channels {
+		key := fmt.Sprintf("notifications.channels[%d]", i)
+		if !slices.Contains(NotifySinks, ch.Sink) {
+			errs[key+".sink"] = fmt.Sprintf("unknown value %q (want %s)", ch.Sink, strings.Join(NotifySinks, ", "))
+		}
+		if ch.Credentials != "" && !credentialsRe.MatchString(ch.Credentials) {
+			errs[key+".credentials"] = "must be up to 32 letters, digits and underscores"
+		}
+		switch {
+		case ch.Target == "":
+		case ch.Sink == SinkDiscord:
+			errs[key+".target"] = "discord posts to its webhook's channel; name the webhook's credentials instead"
+		case ch.Sink == SinkWebhook:
+			errs[key+".target"] = "webhook URLs are credentials; name them in credentials instead"
+		case ch.Sink == SinkEmail:
+			if _, err := mail.ParseAddressList(ch.Target); err != nil {
+				errs[key+".target"] = "must be email addresses, comma-separated"
+			}
+		case strings.Contains(ch.Target, "://"):
+			errs[key+".target"] = "must be a chat or channel ID; webhooks are credentials, named in credentials"
+		}
+		for _, e := range ch.Events {
+			if !slices.Contains(NotifyEvents, e) {
+				errs[key+".events"] = fmt.Sprintf("unknown value %q (want %s)", e, strings.Join(NotifyEvents, ", "))
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Per-job prompt customisation limits. The prefix and system override are
+// free text from the job submitter, so they are capped well below anything
+// that would crowd the design data out of the context window.
+const (
+	MaxPromptPrefixLen   = 4000
+	MaxSystemOverrideLen = 2000
+)
+
+// outputRuleOverride matches instructions that try to undo the output
+// contract codegen depends on: raw code only, no fences, no prose. Only
+// phrasings that ask for something are matched, so a convention that
+// merely mentions markdown or code fences passes.
+var outputRuleOverride = regexp.MustCompile(`(?i)` + strings.Join([]string{
+	`\b(ignore|disregard|forget|override)\s+(all\s+|any\s+|the\s+)?(previous|prior|above|earlier|system|output)`,
+	`\b(output|respond|reply|answer|return|format|write)\b[^.\n]{0,40}?\b(in|as|with|using)\s+(a\s+)?(markdown|code\s*fences?|fenced\s+code)`,
+	`\b(wrap|put|enclose|surround)\b[^.\n]{0,40}?\b(in|with|inside)\s+(a\s+|an\s+)?(markdown|code\s*fences?|fenced\s+code|code\s+blocks?|(triple\s+)?backticks)`,
+	`\buse\s+(markdown|code\s*fences?|fenced\s+code\s+blocks?)\b`,
+	`\bexplain\s+(the|your)\s+code`,
+	`\binclude\s+(an\s+)?explanation`,
+}, "|"))
+
+// CheckPromptOverride validates a job's prompt prefix or system override.
+// field names the offending field in the returned error. max is in bytes,
+// as ClampPrompt cuts.
+func CheckPromptOverride(field, text string, max int) error {
+	if len(text) > max {
+		return fmt.Errorf("%s exceeds %d bytes", field, max)
+	}
+	if m := outputRuleOverride.FindString(text); m != "" {
+		return fmt.Errorf("%s may not change the output format rules (found %q)", field, m)
+	}
+	return nil
+}
+
+// ClampPrompt trims text and cuts it to at most max bytes on a rune
+// boundary, for consumers that can't reject a request outright.
+func ClampPrompt(text string, max int) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= max {
+		return text
+	}
+	text = text[:max]
+	for !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
@@ -0,0 +1,41 @@
+package events
+
+import "strconv"
+
+// TailwindTheme is the theme.extend block the sandbox writes into a
+// screen's tailwind.config.js. Codegen advertises the same keys in its
+// prompt, so both must come from TailwindThemeFor: a class the model is told
+// about but the config lacks renders unstyled without any error.
+type TailwindTheme struct {
+	Colors       map[string]string `json:"colors,omitempty"`       // palette token → hex: bg-primary, text-color-5
+	Spacing      map[string]string `json:"spacing,omitempty"`      // fig-16 → 16px: p-fig-16, gap-fig-16
+	BorderRadius map[string]string `json:"borderRadius,omitempty"` // fig-8 → 8px: rounded-fig-8
+}
+
+// tailwindScalePrefix keeps design spacing and radii apart from Tailwind's
+// own numeric scale, where p-4 means 1rem rather than 4px.
+const tailwindScalePrefix = "fig-"
+
+// TailwindThemeFor maps a screen's design tokens onto Tailwind theme keys.
+func TailwindThemeFor(s FigmaScreen) TailwindTheme {
+	return TailwindTheme{
+		Colors:       s.Colors,
+		Spacing:      pxScale(s.Spacing),
+		BorderRadius: pxScale(s.BorderRadii),
+	}
+}
+
+func pxScale(values []float64) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	scale := make(map[string]string, len(values))
+	for _, v := range values {
+		if v <= 0 {
+			continue
+		}
+		px := strconv.FormatFloat(v, 'f', -1, 64)
+		scale[tailwindScalePrefix+px] = px + "px"
+	}
+	return scale
+}
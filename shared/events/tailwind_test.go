@@ -0,0 +1,25 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTailwindThemeFor(t *testing.T) {
+	s := FigmaScreen{
+		Colors:      map[string]string{"primary": "#6750A4", "color-5": "#00000080"},
+		Spacing:     []float64{16, 4.5, 0},
+		BorderRadii: []float64{8},
+	}
+	want := TailwindTheme{
+		Colors:       map[string]string{"primary": "#6750A4", "color-5": "#00000080"},
+		Spacing:      map[string]string{"fig-16": "16px", "fig-4.5": "4.5px"},
+		BorderRadius: map[string]string{"fig-8": "8px"},
+	}
+	if got := TailwindThemeFor(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if got := TailwindThemeFor(FigmaScreen{}); !reflect.DeepEqual(got, TailwindTheme{}) {
+		t.Errorf("a screen without tokens: %+v", got)
+	}
+}
@@ -0,0 +1,23 @@
+package events
+
+// TokenUsage is what one LLM provider billed towards a generation. A
+// generation retried or handed to a fallback is billed by each provider
+// that answered, so usage comes as a list, one entry per provider.
+type TokenUsage struct {
+	Provider     string `json:"provider"` // "kind:model"
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+// AddUsage adds u to usage, into the entry of the same provider if there
+// is one.
+func AddUsage(usage []TokenUsage, u TokenUsage) []TokenUsage {
+	for i := range usage {
+		if usage[i].Provider == u.Provider {
+			usage[i].InputTokens += u.InputTokens
+			usage[i].OutputTokens += u.OutputTokens
+			return usage
+		}
+	}
+	return append(usage, u)
+}
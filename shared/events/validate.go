@@ -0,0 +1,245 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/forge-ai/forge/shared/httpx"
+)
+
+// figmaKeyRe pulls the file key out of a Figma file or design URL.
+var figmaKeyRe = regexp.MustCompile(`figma\.com/(?:file|design)/([A-Za-z0-9]+)`)
+
+// FigmaFileKey returns the file key of a Figma URL, or false if url isn't one.
+func FigmaFileKey(url string) (string, bool) {
+	m := figmaKeyRe.FindStringSubmatch(url)
+	if len(m) < 2 {
+		return "", false
+	}
+	return m[1], true
+}
+
+// ValidateJob checks a job submission after defaults are applied and
+// returns one message per offending field, keyed by its JSON name, or nil.
+func ValidateJob(p JobSubmittedPayload) map[string]string {
+	errs := make(map[string]string)
+	if p.ReferenceOnly() {
+		if p.FigmaURL != "" {
+			errs["figma_url"] = "must be empty when references are given"
+		}
+		if len(p.ReferenceImages) > 0 {
+			errs["reference_images"] = "replace a Figma file's exports; without one, give the images as references"
+		}
+		checkReferences(errs, "references", p.References)
+	} else if _, ok := FigmaFileKey(p.FigmaURL); !ok {
+		errs["figma_url"] = "required and must be a figma.com file or design URL, unless references are given"
+	}
+	for i, u := range p.ReferenceImages {
+		key := fmt.Sprintf("reference_images.%d", i)
+		if i < 0 {
+			errs[key] = "screen index must be >= 0"
+		} else if msg := checkImageURL(u); msg != "" {
+			errs[key] = msg
+		}
+	}
+	if len(p.Platforms) == 0 {
+		errs["platforms"] = "at least one platform is required"
+	}
+	for _, pl := range p.Platforms {
+		if !slices.Contains(SupportedPlatforms, pl) {
+			errs["platforms"] = fmt.Sprintf("unknown value %q (want %s)", pl, strings.Join(SupportedPlatforms, ", "))
+			break
+		}
+	}
+	if !slices.Contains(SupportedStyling, p.Styling) {
+		errs["styling"] = fmt.Sprintf("unknown value %q (want %s)", p.Styling, strings.Join(SupportedStyling, ", "))
+	}
+	if p.Threshold < 1 || p.Threshold > 100 {
+		errs["threshold"] = "must be 1-100"
+	}
+	if p.SandboxMode != "" && p.SandboxMode != SandboxModeDev && p.SandboxMode != SandboxModeStatic {
+		errs["sandbox_mode"] = fmt.Sprintf("must be %s or %s", SandboxModeDev, SandboxModeStatic)
+	}
+	checkSandboxEnv(errs, "sandbox_env", p.SandboxEnv)
+	if len(p.PresetCode) > 0 && len(p.Platforms) != 1 {
+		errs["preset_code"] = "needs a job with exactly one platform, which the code is for"
+	}
+	for i, code := range p.PresetCode {
+		key := fmt.Sprintf("preset_code.%d", i)
+		switch {
+		case i < 0:
+			errs[key] = "screen index must be >= 0"
+		case strings.TrimSpace(code) == "":
+			errs[key] = "must not be empty"
+		case len(code) > MaxPresetCodeLen:
+			errs[key] = fmt.Sprintf("at most %d bytes", MaxPresetCodeLen)
+		}
+	}
+	if err := CheckPromptOverride("prompt_prefix", p.PromptPrefix, MaxPromptPrefixLen); err != nil {
+		errs["prompt_prefix"] = strings.TrimPrefix(err.Error(), "prompt_prefix ")
+	}
+	if err := CheckPromptOverride("system_override", p.SystemOverride, MaxSystemOverrideLen); err != nil {
+		errs["system_override"] = strings.TrimPrefix(err.Error(), "system_override ")
+	}
+	if p.ExportScale != 0 && (p.ExportScale < MinExportScale || p.ExportScale > MaxExportScale) {
+		errs["export_scale"] = fmt.Sprintf("must be %g-%g", MinExportScale, float64(MaxExportScale))
+	}
+	if p.Priority < 0 || p.Priority > MaxPriority {
+		errs["priority"] = fmt.Sprintf("must be 0-%d", MaxPriority)
+	}
+	checkTolerance(errs, "tolerance", p.Tolerance)
+	checkBackground(errs, "background", p.Background)
+	checkIgnoreRegions(errs, "ignore_regions", p.IgnoreRegions)
+	checkDiffResolution(errs, "diff_resolution", p.DiffResolution)
+	checkCapture(errs, "capture", p.Capture)
+	if p.Diff != nil {
+		checkDiffConfig(errs, *p.Diff)
+	}
+	checkNotifications(errs, p.Notifications)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// DecodeErrors reports a job submission that didn't decode as JSON the way
+// ValidateJob reports one that did: keyed by the field of the wrong type,
+// or by "body" when the body isn't a JSON object at all.
+func DecodeErrors(err error) map[string]string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return map[string]string{typeErr.Field: "must be " + jsonKind(typeErr.Type.Kind())}
+	}
+	return map[string]string{"body": "must be a JSON object (" + err.Error() + ")"}
+}
+
+// jsonKind names what JSON value decodes into a Go kind.
+func jsonKind(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+	return "an object"
+}
+
+// sandboxEnvKeyRe is what a sandbox env var may be named.
+var sandboxEnvKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func checkSandboxEnv(errs map[string]string, key string, env map[string]string) {
+	if len(env) > MaxSandboxEnvVars {
+		errs[key] = fmt.Sprintf("at most %d variables", MaxSandboxEnvVars)
+	}
+	for k, v := range env {
+		switch {
+		case !sandboxEnvKeyRe.MatchString(k):
+			errs[key+"."+k] = "name must be letters, digits and underscores, not starting with a digit"
+		case len(v) > MaxSandboxEnvValue:
+			errs[key+"."+k] = fmt.Sprintf("at most %d bytes", MaxSandboxEnvValue)
+		case strings.ContainsAny(v, "\r\n\x00"):
+			errs[key+"."+k] = "must be a single line"
+		}
+	}
+}
+
+func checkReferences(errs map[string]string, key string, refs []ReferenceScreen) {
+	if len(refs) > MaxReferences {
+		errs[key] = fmt.Sprintf("at most %d screens", MaxReferences)
+	}
+	for i, r := range refs {
+		k := fmt.Sprintf("%s[%d]", key, i)
+		if strings.TrimSpace(r.Name) == "" {
+			errs[k+".name"] = "required"
+		}
+		if msg := checkImageURL(r.ImageURL); msg != "" {
+			errs[k+".image_url"] = msg
+		}
+		if r.Width < 1 || r.Width > MaxReferenceSize || r.Height < 1 || r.Height > MaxReferenceSize {
+			errs[k] = fmt.Sprintf("needs width and height of 1-%d", MaxReferenceSize)
+		}
+		for token, hex := range r.Colors {
+			if _, err := ParseHexColor(hex); err != nil {
+				errs[k+".colors."+token] = err.Error()
+			}
+		}
+	}
+}
+
+// checkImageURL returns what is wrong with a reference image URL, or "".
+// The differ downloads it from inside the deployment, so it has to name a
+// public host; the differ checks the address it resolves to again.
+func checkImageURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "must be an http(s) URL"
+	}
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil && !httpx.PublicIP(ip) || httpx.InternalHost(host) {
+		return "must be on a public host"
+	}
+	return ""
+}
+
+func checkTolerance(errs map[string]string, key string, t *DiffTolerance) {
+	if t != nil && (t.ShiftPx < 0 || t.ShiftPx > MaxShiftPx) {
+		errs[key+".shift_px"] = fmt.Sprintf("must be 0-%d", MaxShiftPx)
+	}
+}
+
+func checkBackground(errs map[string]string, key, bg string) {
+	if bg != "" {
+		if _, err := ParseHexColor(bg); err != nil {
+			errs[key] = err.Error()
+		}
+	}
+}
+
+func checkIgnoreRegions(errs map[string]string, key string, boxes []Box) {
+	for i, b := range boxes {
+		if b.X < 0 || b.Y < 0 || b.W <= 0 || b.H <= 0 {
+			errs[fmt.Sprintf("%s[%d]", key, i)] = "needs x, y >= 0 and w, h > 0"
+		}
+	}
+}
+
+func checkDiffResolution(errs map[string]string, key string, res int) {
+	if res != 0 && res < MinDiffResolution {
+		errs[key] = fmt.Sprintf("must be 0 (full resolution) or at least %d", MinDiffResolution)
+	}
+}
+
+func checkCapture(errs map[string]string, key string, c *CaptureOptions) {
+	if c == nil {
+		return
+	}
+	switch c.Wait {
+	case "", CaptureWaitTimeout, CaptureWaitNetworkIdle:
+	case CaptureWaitSelector:
+		if strings.TrimSpace(c.WaitSelector) == "" {
+			errs[key+".wait_selector"] = "required when wait is " + CaptureWaitSelector
+		}
+	default:
+		errs[key+".wait"] = fmt.Sprintf("must be %s, %s or %s", CaptureWaitTimeout, CaptureWaitNetworkIdle, CaptureWaitSelector)
+	}
+	if c.WaitTimeoutMs < 0 || c.WaitTimeoutMs > MaxCaptureWaitMs {
+		errs[key+".wait_timeout_ms"] = fmt.Sprintf("must be 0-%d", MaxCaptureWaitMs)
+	}
+	if c.SettleMs < 0 || c.SettleMs > MaxCaptureSettleMs {
+		errs[key+".settle_ms"] = fmt.Sprintf("must be 0-%d", MaxCaptureSettleMs)
+	}
+}
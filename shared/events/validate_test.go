@@ -0,0 +1,71 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		want map[string]string
+	}{
+		{`{"threshold": "95"}`, map[string]string{"threshold": "must be a whole number"}},
+		{`{"platforms": "react"}`, map[string]string{"platforms": "must be a list"}},
+		{`{"capture": {"wait_timeout_ms": 1.5}}`, map[string]string{"capture.wait_timeout_ms": "must be a whole number"}},
+		{`{"export_scale": "2x"}`, map[string]string{"export_scale": "must be a number"}},
+		{`{"figma_url": 42}`, map[string]string{"figma_url": "must be a string"}},
+	} {
+		var p JobSubmittedPayload
+		err := json.Unmarshal([]byte(tc.body), &p)
+		if err == nil {
+			t.Fatalf("%s decoded", tc.body)
+		}
+		if got := DecodeErrors(err); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.body, got, tc.want)
+		}
+	}
+
+	for _, body := range []string{`{"figma_url":`, `[1, 2]`, `not json`} {
+		var p JobSubmittedPayload
+		err := json.Unmarshal([]byte(body), &p)
+		if err == nil {
+			t.Fatalf("%s decoded", body)
+		}
+		if got := DecodeErrors(err); len(got) != 1 || got["body"] == "" {
+			t.Errorf("%s: %v, want a body error", body, got)
+		}
+	}
+}
+
+func TestCheckImageURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://s3-alpha.figma.com/img/ab/cd":         "",
+		"http://93.184.216.34/ref.png":                 "",
+		"https://[2606:4700::1111]/ref.png":            "",
+		"ftp://example.com/ref.png":                    "must be an http(s) URL",
+		"https:///ref.png":                             "must be an http(s) URL",
+		"http://localhost:8000/ref.png":                "must be on a public host",
+		"http://app.localhost/ref.png":                 "must be on a public host",
+		"http://127.0.0.1/ref.png":                     "must be on a public host",
+		"http://[::1]/ref.png":                         "must be on a public host",
+		"http://10.0.0.7/ref.png":                      "must be on a public host",
+		"http://192.168.1.1/ref.png":                   "must be on a public host",
+		"http://172.20.0.3/ref.png":                    "must be on a public host",
+		"http://169.254.169.254/latest/meta-data/":     "must be on a public host",
+		"http://[fe80::1]/ref.png":                     "must be on a public host",
+		"http://[::ffff:127.0.0.1]/ref.png":            "must be on a public host",
+		"http://100.64.0.1/ref.png":                    "must be on a public host",
+		"http://0.0.0.0:9102/metrics":                  "must be on a public host",
+		"http://supabase:8000/storage/v1/object/x.png": "must be on a public host",
+		"http://rabbitmq:15672/":                       "must be on a public host",
+		"http://metadata.google.internal/":             "must be on a public host",
+		"http://printer.local/ref.png":                 "must be on a public host",
+		"http://LOCALHOST./ref.png":                    "must be on a public host",
+	} {
+		if got := checkImageURL(raw); got != want {
+			t.Errorf("checkImageURL(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublic is a connection refused because its address isn't on the
+// public internet.
+var ErrNotPublic = errors.New("address is not public")
+
+// reserved are the ranges PublicIP excludes beyond what netip classifies:
+// "this network", carrier-grade NAT, IETF protocol assignments and
+// benchmarking.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// PublicIP reports whether ip is a public unicast address: not loopback,
+// private, link-local (cloud metadata endpoints among them), multicast or
+// reserved.
+func PublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// InternalHost reports whether host names a machine that can only be
+// internal: localhost, a single-label name such as a compose service, or a
+// .local, .internal or .localhost one. IP literals are left to PublicIP.
+func InternalHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, err := netip.ParseAddr(host); err == nil {
+		return false
+	}
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPublicOnly refuses connections to anything but public addresses,
+// checked on the address dialed after DNS resolution, so a name that
+// resolves, or is rebound, to an internal one is refused too. Proxies are
+// bypassed: the check has to see the final address.
+func WithPublicOnly() Option {
+	return func(t *Transport) {
+		base := t.ownBase()
+		base.Proxy = nil
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip, err := netip.ParseAddr(host); err != nil || !PublicIP(ip) {
+					return fmt.Errorf("%w: %s", ErrNotPublic, host)
+				}
+				return nil
+			},
+		}
+		base.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+}
+
+// ownBase returns t.Base as an *http.Transport t alone uses, cloning the
+// default one the first time an option configures it.
+func (t *Transport) ownBase() *http.Transport {
+	if b, ok := t.Base.(*http.Transport); ok && b != http.DefaultTransport {
+		return b
+	}
+	b := http.DefaultTransport.(*http.Transport).Clone()
+	t.Base = b
+	return b
+}
@@ -0,0 +1,169 @@
+// Package httpx provides the outbound HTTP client used by Forge services:
+// a RoundTripper that retries transient failures with jittered backoff.
+package httpx
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Transport retries requests that failed transiently.
+//
+// Idempotent requests (GET, HEAD, OPTIONS, PUT, DELETE, or any request
+// carrying an Idempotency-Key header) are retried on connection errors,
+// 429 and 5xx. Other requests — POSTs to an LLM, a chat message — are only
+// retried where the server provably did nothing: the connection was never
+// established, or it answered 429. WithNonIdempotent opts them into the
+// full policy.
+type Transport struct {
+	Base          http.RoundTripper
+	MaxRetries    int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration // also the longest Retry-After honoured
+	NonIdempotent bool
+}
+
+// Option configures a Transport.
+type Option func(*Transport)
+
+// WithRetries sets how many times a request is retried after the first try.
+func WithRetries(n int) Option { return func(t *Transport) { t.MaxRetries = n } }
+
+// WithBackoff sets the base and maximum delay between attempts.
+func WithBackoff(base, max time.Duration) Option {
+	return func(t *Transport) { t.BaseDelay, t.MaxDelay = base, max }
+}
+
+// WithNonIdempotent retries every method on connection errors and 5xx.
+func WithNonIdempotent() Option { return func(t *Transport) { t.NonIdempotent = true } }
+
+// WithResponseHeaderTimeout bounds the wait for response headers on each
+// attempt without limiting how long the body may take to read — the right
+// bound for streamed responses, where a whole-request timeout would cut
+// off a long but healthy stream.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(t *Transport) { t.ownBase().ResponseHeaderTimeout = d }
+}
+
+// NewTransport wraps http.DefaultTransport with the retry policy.
+func NewTransport(opts ...Option) *Transport {
+	t := &Transport{
+		Base:       http.DefaultTransport,
+		MaxRetries: 3,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	return t
+}
+
+// NewClient returns a client using a retrying Transport. timeout bounds the
+// whole exchange including retries; zero means no limit.
+func NewClient(timeout time.Duration, opts ...Option) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: NewTransport(opts...)}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := t.NonIdempotent || isIdempotent(req)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, errors.New("httpx: cannot retry request with unreplayable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.Base.RoundTrip(req)
+		if attempt >= t.MaxRetries || !t.shouldRetry(req, resp, err, idempotent) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp); ok {
+				if ra > t.MaxDelay {
+					return resp, nil // server wants a longer pause than we'll wait inline
+				}
+				delay = ra
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (t *Transport) shouldRetry(req *http.Request, resp *http.Response, err error, idempotent bool) bool {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false // cancelled or timed out by the caller
+		}
+		if errors.Is(err, ErrNotPublic) {
+			return false // the address won't become public
+		}
+		return idempotent || isDialError(err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 500:
+		return idempotent && resp.StatusCode != http.StatusNotImplemented
+	}
+	return false
+}
+
+// backoff is full-jitter exponential: a random delay up to base·2^attempt.
+func (t *Transport) backoff(attempt int) time.Duration {
+	ceil := t.BaseDelay << attempt
+	if ceil <= 0 || ceil > t.MaxDelay {
+		ceil = t.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceil) + 1))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// isDialError reports a failure to connect at all, which is safe to retry
+// for any method since nothing reached the server.
+func isDialError(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// retryAfter parses Retry-After as delta-seconds or an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
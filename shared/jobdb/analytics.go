@@ -0,0 +1,316 @@
+package jobdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+)
+
+// Bounds on what Analyze reads.
+const (
+	analyticsPage    = 1000  // rows per request, Supabase's default cap
+	analyticsJobPage = 100   // jobs whose iterations are read together
+	MaxAnalyticsJobs = 20000 // read per window, running ones included; later jobs are left out
+)
+
+// Columns Analyze reads.
+var (
+	analyticsJobCols       = []string{"id", "created_at", "figma_url", "platforms", "threshold", "status", "failed_step"}
+	analyticsIterationCols = []string{"job_id", "screen_index", "screen_name", "platform", "iteration", "score"}
+)
+
+// AnalyticsQuery is what Analyze sums up: the jobs created in [From, To),
+// by platform and, with ByFile, by Figma file.
+type AnalyticsQuery struct {
+	From, To time.Time
+	ByFile   bool
+}
+
+// Analytics sums up the finished jobs of a window. A unit is one
+// screen×platform of a job; it passed if an iteration scored the job's
+// threshold.
+type Analytics struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Jobs int       `json:"jobs"`
+	// Truncated is set when the window has more than MaxAnalyticsJobs
+	// jobs; only the oldest are counted.
+	Truncated bool             `json:"truncated,omitempty"`
+	Groups    []AnalyticsGroup `json:"groups"`
+}
+
+// AnalyticsGroup is the jobs of a platform, and of a Figma file with
+// ByFile, overall and week by week.
+type AnalyticsGroup struct {
+	Platform string `json:"platform"`
+	FileKey  string `json:"file_key,omitempty"` // empty for reference-only jobs
+	AnalyticsStats
+	Weeks []AnalyticsWeek `json:"weeks"` // oldest first
+}
+
+// AnalyticsWeek is a group's jobs created in the week starting Week, a
+// Monday, in UTC.
+type AnalyticsWeek struct {
+	Week string `json:"week"`
+	AnalyticsStats
+}
+
+// AnalyticsStats are the figures of some jobs.
+type AnalyticsStats struct {
+	Jobs       int `json:"jobs"`
+	FailedJobs int `json:"failed_jobs"`
+	// FailureSteps counts the failed jobs by the step they failed at;
+	// "unknown" for those failed before it was recorded.
+	FailureSteps        map[string]int `json:"failure_steps,omitempty"`
+	Units               int            `json:"units"`
+	PassRate            float64        `json:"pass_rate"` // 0-1
+	AvgFinalScore       float64        `json:"avg_final_score"`
+	AvgIterationsToPass float64        `json:"avg_iterations_to_pass"` // of the units that passed
+
+	passed     int
+	passIters  int
+	finalScore float64
+}
+
+// Analyze reads the jobs of q's window and their iterations from r, a page
+// at a time, and sums them up. Jobs still running are left out: their
+// scores aren't final.
+func Analyze(ctx context.Context, r Reader, q AnalyticsQuery) (*Analytics, error) {
+	a := &Analytics{From: q.From.UTC(), To: q.To.UTC()}
+	var jobs []analyticsJob
+	read := 0
+	for offset := 0; ; offset += analyticsPage {
+		rows, err := r.JobsCreated(ctx, q.From, q.To, analyticsJobCols, offset, analyticsPage)
+		if err != nil {
+			return nil, fmt.Errorf("read jobs: %w", err)
+		}
+		for _, row := range rows {
+			if read == MaxAnalyticsJobs {
+				a.Truncated = true
+				break
+			}
+			read++
+			if j, ok := parseAnalyticsJob(row); ok {
+				jobs = append(jobs, j)
+			}
+		}
+		if a.Truncated || len(rows) < analyticsPage {
+			break
+		}
+	}
+
+	byID := make(map[string]*analyticsJob, len(jobs))
+	for i := range jobs {
+		byID[jobs[i].id] = &jobs[i]
+	}
+	for start := 0; start < len(jobs); start += analyticsJobPage {
+		page := jobs[start:min(start+analyticsJobPage, len(jobs))]
+		ids := make([]string, len(page))
+		for i, j := range page {
+			ids[i] = j.id
+		}
+		for offset := 0; ; offset += analyticsPage {
+			rows, err := r.IterationsOf(ctx, ids, analyticsIterationCols, offset, analyticsPage)
+			if err != nil {
+				return nil, fmt.Errorf("read iterations: %w", err)
+			}
+			for _, row := range rows {
+				if j := byID[str(row["job_id"])]; j != nil {
+					j.add(row)
+				}
+			}
+			if len(rows) < analyticsPage {
+				break
+			}
+		}
+	}
+
+	a.Jobs = len(jobs)
+	a.Groups = summarize(jobs, q.ByFile)
+	return a, nil
+}
+
+// analyticsJob is a finished job and its units, as Analyze reads them.
+type analyticsJob struct {
+	id         string
+	week       string
+	fileKey    string
+	platforms  []string
+	threshold  float64
+	failed     bool
+	failedStep string
+	units      map[analyticsUnitKey]*analyticsUnit
+}
+
+type analyticsUnitKey struct {
+	screen   string // index, or name on rows stored without one
+	platform string
+}
+
+type analyticsUnit struct {
+	last      int     // iteration
+	lastScore float64 // of last
+	passedAt  int     // the first iteration to score the threshold; 0 if none did
+}
+
+func parseAnalyticsJob(row Row) (analyticsJob, bool) {
+	status := str(row["status"])
+	if status != "done" && status != "failed" {
+		return analyticsJob{}, false
+	}
+	created, err := time.Parse(time.RFC3339Nano, str(row["created_at"]))
+	if err != nil {
+		return analyticsJob{}, false
+	}
+	j := analyticsJob{
+		id:        str(row["id"]),
+		week:      weekOf(created),
+		threshold: num(row["threshold"]),
+		failed:    status == "failed",
+		units:     make(map[analyticsUnitKey]*analyticsUnit),
+	}
+	j.fileKey, _ = events.FigmaFileKey(str(row["figma_url"]))
+	if j.failed {
+		j.failedStep = str(row["failed_step"])
+		if j.failedStep == "" {
+			j.failedStep = "unknown"
+		}
+	}
+	platforms, _ := row["platforms"].([]any)
+	for _, p := range platforms {
+		j.platforms = append(j.platforms, str(p))
+	}
+	return j, true
+}
+
+// add counts an iteration row towards its unit.
+func (j *analyticsJob) add(row Row) {
+	key := analyticsUnitKey{screen: str(row["screen_name"]), platform: str(row["platform"])}
+	if idx, ok := row["screen_index"].(float64); ok {
+		key.screen = fmt.Sprint(idx)
+	}
+	u := j.units[key]
+	if u == nil {
+		u = &analyticsUnit{}
+		j.units[key] = u
+	}
+	iter, score := int(num(row["iteration"])), num(row["score"])
+	if iter >= u.last {
+		u.last, u.lastScore = iter, score
+	}
+	if score >= j.threshold && (u.passedAt == 0 || iter < u.passedAt) {
+		u.passedAt = iter
+	}
+}
+
+// summarize groups jobs by platform, and file with byFile, and by week
+// within those.
+func summarize(jobs []analyticsJob, byFile bool) []AnalyticsGroup {
+	type groupKey struct{ platform, file string }
+	groups := make(map[groupKey]*AnalyticsGroup)
+	weeks := make(map[groupKey]map[string]*AnalyticsWeek)
+	stats := func(platform, file, week string) (*AnalyticsStats, *AnalyticsStats) {
+		k := groupKey{platform, file}
+		g := groups[k]
+		if g == nil {
+			g = &AnalyticsGroup{Platform: platform, FileKey: file}
+			groups[k] = g
+			weeks[k] = make(map[string]*AnalyticsWeek)
+		}
+		w := weeks[k][week]
+		if w == nil {
+			w = &AnalyticsWeek{Week: week}
+			weeks[k][week] = w
+		}
+		return &g.AnalyticsStats, &w.AnalyticsStats
+	}
+
+	for _, j := range jobs {
+		file := ""
+		if byFile {
+			file = j.fileKey
+		}
+		for _, platform := range j.platforms {
+			for _, s := range pair(stats(platform, file, j.week)) {
+				s.addJob(j)
+			}
+		}
+		for key, u := range j.units {
+			for _, s := range pair(stats(key.platform, file, j.week)) {
+				s.addUnit(u)
+			}
+		}
+	}
+
+	out := make([]AnalyticsGroup, 0, len(groups))
+	for k, g := range groups {
+		g.finish()
+		for _, w := range weeks[k] {
+			w.finish()
+			g.Weeks = append(g.Weeks, *w)
+		}
+		sort.Slice(g.Weeks, func(a, b int) bool { return g.Weeks[a].Week < g.Weeks[b].Week })
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Platform != out[b].Platform {
+			return out[a].Platform < out[b].Platform
+		}
+		return out[a].FileKey < out[b].FileKey
+	})
+	return out
+}
+
+func pair(a, b *AnalyticsStats) [2]*AnalyticsStats { return [2]*AnalyticsStats{a, b} }
+
+func (s *AnalyticsStats) addJob(j analyticsJob) {
+	s.Jobs++
+	if !j.failed {
+		return
+	}
+	s.FailedJobs++
+	if s.FailureSteps == nil {
+		s.FailureSteps = make(map[string]int)
+	}
+	s.FailureSteps[j.failedStep]++
+}
+
+func (s *AnalyticsStats) addUnit(u *analyticsUnit) {
+	s.Units++
+	s.finalScore += u.lastScore
+	if u.passedAt > 0 {
+		s.passed++
+		s.passIters += u.passedAt
+	}
+}
+
+// finish works out the averages.
+func (s *AnalyticsStats) finish() {
+	if s.Units > 0 {
+		s.PassRate = float64(s.passed) / float64(s.Units)
+		s.AvgFinalScore = s.finalScore / float64(s.Units)
+	}
+	if s.passed > 0 {
+		s.AvgIterationsToPass = float64(s.passIters) / float64(s.passed)
+	}
+}
+
+// weekOf is the Monday of t's week in UTC, as 2006-01-02.
+func weekOf(t time.Time) string {
+	t = t.UTC()
+	days := (int(t.Weekday()) + 6) % 7 // since Monday
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func num(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
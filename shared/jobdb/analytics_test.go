@@ -0,0 +1,172 @@
+package jobdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// memReader serves jobs and iterations from memory, paging as Supabase
+// does. Only what Analyze calls is implemented.
+type memReader struct {
+	Reader
+	jobs       []Row // oldest first
+	iterations []Row
+	pages      int // IterationsOf calls
+}
+
+func (m *memReader) JobsCreated(_ context.Context, from, to time.Time, _ []string, offset, limit int) ([]Row, error) {
+	var in []Row
+	for _, j := range m.jobs {
+		created, _ := time.Parse(time.RFC3339Nano, j["created_at"].(string))
+		if !created.Before(from) && created.Before(to) {
+			in = append(in, j)
+		}
+	}
+	return in[min(offset, len(in)):min(offset+limit, len(in))], nil
+}
+
+func (m *memReader) IterationsOf(_ context.Context, jobIDs, _ []string, offset, limit int) ([]Row, error) {
+	m.pages++
+	var of []Row
+	for _, it := range m.iterations {
+		if slices.Contains(jobIDs, it["job_id"].(string)) {
+			of = append(of, it)
+		}
+	}
+	return of[min(offset, len(of)):min(offset+limit, len(of))], nil
+}
+
+func job(id, created, file, status, failedStep string, platforms ...string) Row {
+	ps := make([]any, len(platforms))
+	for i, p := range platforms {
+		ps[i] = p
+	}
+	return Row{
+		"id": id, "created_at": created, "figma_url": "https://www.figma.com/design/" + file + "/App",
+		"platforms": ps, "threshold": 90.0, "status": status, "failed_step": failedStep,
+	}
+}
+
+func iteration(jobID string, screen int, platform string, iter int, score float64) Row {
+	return Row{"job_id": jobID, "screen_index": float64(screen), "screen_name": fmt.Sprint("Screen ", screen),
+		"platform": platform, "iteration": float64(iter), "score": score}
+}
+
+func analyticsFixture() *memReader {
+	return &memReader{
+		jobs: []Row{
+			// The week of Monday 5 January 2026.
+			job("a", "2026-01-05T09:00:00Z", "KEY1", "done", "", "react"),
+			job("b", "2026-01-07T23:59:59.5Z", "KEY2", "failed", "codegen", "react", "kmp"),
+			// The next week.
+			job("c", "2026-01-12T00:00:00Z", "KEY1", "failed", "", "react"),
+			// Still running: left out.
+			job("d", "2026-01-13T10:00:00Z", "KEY1", "running", "", "react"),
+		},
+		iterations: []Row{
+			// a's screen 0 passes at its second iteration, its screen 1
+			// never does. Rows come in no order.
+			iteration("a", 0, "react", 2, 92),
+			iteration("a", 0, "react", 1, 80),
+			iteration("a", 1, "react", 3, 88),
+			iteration("a", 1, "react", 1, 70),
+			iteration("a", 1, "react", 2, 85),
+			// b's react screen passes at once; kmp never got that far.
+			iteration("b", 0, "react", 1, 95),
+			iteration("d", 0, "react", 1, 99),
+		},
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	from, to := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	a, err := Analyze(context.Background(), analyticsFixture(), AnalyticsQuery{From: from, To: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Jobs != 3 || a.Truncated || len(a.Groups) != 2 {
+		t.Fatalf("%d jobs in %d groups: %+v", a.Jobs, len(a.Groups), a.Groups)
+	}
+
+	kmp, react := a.Groups[0], a.Groups[1]
+	if kmp.Platform != "kmp" || kmp.Jobs != 1 || kmp.FailedJobs != 1 || kmp.Units != 0 || kmp.PassRate != 0 {
+		t.Errorf("kmp %+v", kmp)
+	}
+	if react.Platform != "react" || react.Jobs != 3 || react.FailedJobs != 2 || react.Units != 3 {
+		t.Errorf("react %+v", react.AnalyticsStats)
+	}
+	if s := react.FailureSteps; len(s) != 2 || s["codegen"] != 1 || s["unknown"] != 1 {
+		t.Errorf("failure steps %v", s)
+	}
+	// Two of three units passed, at iterations 2 and 1; the final scores
+	// are each unit's last iteration's.
+	approx := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	if !approx(react.PassRate, 2.0/3) || !approx(react.AvgIterationsToPass, 1.5) || !approx(react.AvgFinalScore, (92+88+95)/3.0) {
+		t.Errorf("pass rate %.3f, iterations to pass %.2f, final score %.2f", react.PassRate, react.AvgIterationsToPass, react.AvgFinalScore)
+	}
+
+	if len(react.Weeks) != 2 {
+		t.Fatalf("weeks %+v", react.Weeks)
+	}
+	if w := react.Weeks[0]; w.Week != "2026-01-05" || w.Jobs != 2 || w.Units != 3 || w.FailedJobs != 1 {
+		t.Errorf("first week %+v", w)
+	}
+	if w := react.Weeks[1]; w.Week != "2026-01-12" || w.Jobs != 1 || w.Units != 0 || w.FailedJobs != 1 {
+		t.Errorf("second week %+v", w)
+	}
+}
+
+func TestAnalyzeByFile(t *testing.T) {
+	from, to := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	a, err := Analyze(context.Background(), analyticsFixture(), AnalyticsQuery{From: from, To: to, ByFile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range a.Groups {
+		got = append(got, fmt.Sprintf("%s/%s: %d jobs, %d units", g.Platform, g.FileKey, g.Jobs, g.Units))
+	}
+	want := []string{"kmp/KEY2: 1 jobs, 0 units", "react/KEY1: 2 jobs, 2 units", "react/KEY2: 1 jobs, 1 units"}
+	if !slices.Equal(got, want) {
+		t.Errorf("groups %q, want %q", got, want)
+	}
+}
+
+func TestAnalyzePages(t *testing.T) {
+	r := &memReader{}
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	const n = analyticsPage + 50
+	for i := range n {
+		id := fmt.Sprint("job-", i)
+		r.jobs = append(r.jobs, job(id, start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), "KEY", "done", "", "react"))
+		r.iterations = append(r.iterations, iteration(id, 0, "react", 1, 90))
+	}
+	a, err := Analyze(context.Background(), r, AnalyticsQuery{From: start, To: start.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Jobs != n || len(a.Groups) != 1 || a.Groups[0].Units != n || a.Groups[0].PassRate != 1 {
+		t.Errorf("%d jobs: %+v", a.Jobs, a.Groups)
+	}
+	if want := (n + analyticsJobPage - 1) / analyticsJobPage; r.pages != want {
+		t.Errorf("iterations read in %d requests, want %d", r.pages, want)
+	}
+}
+
+func TestWeekOf(t *testing.T) {
+	for in, want := range map[string]string{
+		"2026-01-05T00:00:00Z":      "2026-01-05", // a Monday
+		"2026-01-11T23:59:59Z":      "2026-01-05", // the Sunday after
+		"2026-01-12T01:00:00+03:00": "2026-01-05", // still Sunday in UTC
+		"2026-03-01T12:00:00Z":      "2026-02-23", // across a month
+	} {
+		ts, _ := time.Parse(time.RFC3339, in)
+		if got := weekOf(ts); got != want {
+			t.Errorf("weekOf(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
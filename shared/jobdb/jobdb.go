@@ -0,0 +1,32 @@
+// Package jobdb reads Forge's jobs and their iterations where they are
+// stored: through Supabase's REST API, or straight from its Postgres when
+// SUPABASE_DB_URL is set.
+package jobdb
+
+import (
+	"context"
+	"time"
+)
+
+// Row is a job or iteration row, column by column, as its JSON would be.
+type Row = map[string]any
+
+// Reader reads jobs and their iterations.
+type Reader interface {
+	// RecentJobs returns up to limit jobs, newest first.
+	RecentJobs(ctx context.Context, limit int) ([]Row, error)
+	// Job returns the job with id, or nil if there is none. An id that
+	// isn't a UUID is an error wrapping ErrInvalidID, as with Iterations.
+	Job(ctx context.Context, id string) (Row, error)
+	// Iterations returns a job's iterations, oldest first.
+	Iterations(ctx context.Context, jobID string) ([]Row, error)
+	// ScreenResults returns the results of a job's finished
+	// screen×platforms, by screen index and platform.
+	ScreenResults(ctx context.Context, jobID string) ([]Row, error)
+	// JobsCreated pages through the jobs created in [from, to), oldest
+	// first: up to limit of them after the first offset, with only cols.
+	JobsCreated(ctx context.Context, from, to time.Time, cols []string, offset, limit int) ([]Row, error)
+	// IterationsOf pages through the iterations of jobIDs, in no order
+	// but the same on every page, with only cols.
+	IterationsOf(ctx context.Context, jobIDs, cols []string, offset, limit int) ([]Row, error)
+}
@@ -0,0 +1,61 @@
+-- The tables Forge's services read and write, for a Postgres that is not
+-- Supabase's: the same columns as supabase/migrations, without Supabase's
+-- roles and policies. Every statement is a no-op where the table or column
+-- is already there, so this also runs against Supabase's own database.
+create extension if not exists "uuid-ossp";
+
+create table if not exists public.jobs (
+  id            uuid primary key default uuid_generate_v4(),
+  figma_url     text not null,
+  repo_url      text,
+  platforms     text[]  not null default '{react,kmp}',
+  styling       text    not null default 'tailwind',
+  threshold     int     not null default 95,
+  screen_count  int,
+  status        text    not null default 'pending',
+  error         text,
+  avg_score     float8,
+  total_iter    int,
+  created_at    timestamptz default now(),
+  updated_at    timestamptz default now()
+);
+create index if not exists jobs_status_idx on public.jobs (status);
+create index if not exists jobs_created_at_idx on public.jobs (created_at desc);
+alter table public.jobs add column if not exists request jsonb;
+alter table public.jobs add column if not exists input_tokens int;
+alter table public.jobs add column if not exists output_tokens int;
+alter table public.jobs add column if not exists cost_usd float8;
+
+create table if not exists public.iterations (
+  id              uuid primary key default uuid_generate_v4(),
+  job_id          uuid not null references public.jobs(id) on delete cascade,
+  screen_name     text not null,
+  platform        text not null,
+  iteration       int  not null,
+  score           float8 not null,
+  layout_score    float8,
+  typo_score      float8,
+  spacing_score   float8,
+  color_score     float8,
+  code            text not null,
+  screenshot_url  text,
+  diff_url        text,
+  mismatch_regions jsonb,
+  created_at      timestamptz default now()
+);
+create index if not exists iterations_job_id_screen_name_platform_idx on public.iterations (job_id, screen_name, platform);
+alter table public.iterations add column if not exists reference_url text;
+alter table public.iterations add column if not exists input_tokens int;
+alter table public.iterations add column if not exists output_tokens int;
+alter table public.iterations add column if not exists cost_usd float8;
+
+create table if not exists public.events (
+  id          bigserial primary key,
+  job_id      uuid references public.jobs(id),
+  routing_key text not null,
+  payload     jsonb,
+  created_at  timestamptz default now()
+);
+create index if not exists events_job_id_idx on public.events (job_id);
+create index if not exists events_routing_key_idx on public.events (routing_key);
+create index if not exists events_created_at_idx on public.events (created_at desc);
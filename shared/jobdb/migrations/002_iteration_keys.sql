@@ -0,0 +1,5 @@
+-- supabase/migrations/005_iteration_keys.sql: iterations are unique per
+-- screen×platform, by screen index.
+alter table public.iterations add column if not exists screen_index int;
+create unique index if not exists iterations_unit_iteration_key
+  on public.iterations (job_id, screen_index, platform, iteration);
@@ -0,0 +1,2 @@
+-- supabase/migrations/006_iteration_code_url.sql
+alter table public.iterations add column if not exists code_url text;
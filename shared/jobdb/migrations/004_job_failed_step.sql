@@ -0,0 +1,3 @@
+-- supabase/migrations/007_job_failed_step.sql
+alter table public.jobs add column if not exists failed_step text;
+create index if not exists jobs_created_at_asc_idx on public.jobs (created_at, id);
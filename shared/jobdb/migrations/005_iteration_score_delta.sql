@@ -0,0 +1,2 @@
+-- supabase/migrations/008_iteration_score_delta.sql
+alter table public.iterations add column if not exists score_delta jsonb;
@@ -0,0 +1,18 @@
+-- supabase/migrations/009_screen_results.sql: one row per finished
+-- screen×platform of a job.
+create table if not exists public.screen_results (
+  job_id          uuid not null references public.jobs(id) on delete cascade,
+  screen_index    int  not null,
+  screen_name     text not null,
+  platform        text not null,
+  status          text not null,
+  score           float8 not null,
+  best_score      float8 not null,
+  best_iteration  int  not null default 0,
+  iterations      int  not null default 0,
+  code_url        text,
+  diff_image_url  text,
+  duration_ms     bigint not null default 0,
+  completed_at    timestamptz default now(),
+  primary key (job_id, screen_index, platform)
+);
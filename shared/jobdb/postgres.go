@@ -0,0 +1,162 @@
+package jobdb
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Connect opens a pool on the Postgres at url and brings its schema up to
+// date.
+func Connect(ctx context.Context, url string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return pool, nil
+}
+
+// Migrate applies the embedded migrations the database has not had yet,
+// in order, recording each in forge_migrations. Services starting together
+// take turns: the first applies them, the rest find them applied.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	// Any constant will do, as long as it is Forge's alone.
+	if _, err := tx.Exec(ctx, `select pg_advisory_xact_lock(7340651)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `create table if not exists public.forge_migrations (
+		version    text primary key,
+		applied_at timestamptz not null default now()
+	)`); err != nil {
+		return err
+	}
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		var applied bool
+		err := tx.QueryRow(ctx, `select exists(select 1 from public.forge_migrations where version = $1)`, version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+		sql, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("%s: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, `insert into public.forge_migrations (version) values ($1)`, version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// PostgresReader reads straight from Postgres. Rows come out as
+// to_jsonb makes them, the shape Supabase's REST API gives them.
+type PostgresReader struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresReader(pool *pgxpool.Pool) *PostgresReader {
+	return &PostgresReader{pool: pool}
+}
+
+func (r *PostgresReader) RecentJobs(ctx context.Context, limit int) ([]Row, error) {
+	return r.query(ctx, `select to_jsonb(j) from public.jobs j order by created_at desc limit $1`, limit)
+}
+
+func (r *PostgresReader) Job(ctx context.Context, id string) (Row, error) {
+	if !ValidID(id) {
+		return nil, fmt.Errorf("id %q: %w", id, ErrInvalidID)
+	}
+	rows, err := r.query(ctx, `select to_jsonb(j) from public.jobs j where id = $1::uuid`, id)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+func (r *PostgresReader) Iterations(ctx context.Context, jobID string) ([]Row, error) {
+	if !ValidID(jobID) {
+		return nil, fmt.Errorf("job_id %q: %w", jobID, ErrInvalidID)
+	}
+	return r.query(ctx, `select to_jsonb(i) from public.iterations i where job_id = $1::uuid order by created_at`, jobID)
+}
+
+func (r *PostgresReader) ScreenResults(ctx context.Context, jobID string) ([]Row, error) {
+	if !ValidID(jobID) {
+		return nil, fmt.Errorf("job_id %q: %w", jobID, ErrInvalidID)
+	}
+	return r.query(ctx, `select to_jsonb(s) from public.screen_results s where job_id = $1::uuid
+		order by screen_index, platform`, jobID)
+}
+
+func (r *PostgresReader) JobsCreated(ctx context.Context, from, to time.Time, cols []string, offset, limit int) ([]Row, error) {
+	return r.query(ctx, `select to_jsonb(j) from (select `+columns(cols)+` from public.jobs
+		where created_at >= $1 and created_at < $2 order by created_at, id offset $3 limit $4) j`,
+		from, to, offset, limit)
+}
+
+func (r *PostgresReader) IterationsOf(ctx context.Context, jobIDs, cols []string, offset, limit int) ([]Row, error) {
+	for _, id := range jobIDs {
+		if !ValidID(id) {
+			return nil, fmt.Errorf("job_id %q: %w", id, ErrInvalidID)
+		}
+	}
+	return r.query(ctx, `select to_jsonb(i) from (select `+columns(cols)+` from public.iterations
+		where job_id = any($1::uuid[]) order by id offset $2 limit $3) i`,
+		jobIDs, offset, limit)
+}
+
+// columns is cols as a select list.
+func columns(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (r *PostgresReader) query(ctx context.Context, sql string, args ...any) ([]Row, error) {
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Row, error) {
+		var raw json.RawMessage
+		if err := row.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var out Row
+		return out, json.Unmarshal(raw, &out)
+	})
+}
@@ -0,0 +1,142 @@
+package jobdb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidID is the error for a job ID that is not a UUID, as every job's
+// is: no row can have it, and it must not reach a query.
+var ErrInvalidID = errors.New("not a UUID")
+
+// ValidID reports whether id is a UUID in its canonical form.
+func ValidID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+// Query builds a PostgREST query of a table from typed parts, so that no
+// value can add a filter or option of its own: IDs are checked to be
+// UUIDs and every value is URL-encoded. Columns are the caller's own,
+// never input. The first invalid part is the error of Path.
+type Query struct {
+	table  string
+	params url.Values
+	err    error
+}
+
+// From starts a query of table.
+func From(table string) *Query {
+	return &Query{table: table, params: url.Values{}}
+}
+
+// Table is the table queried.
+func (q *Query) Table() string { return q.table }
+
+// EqUUID keeps the rows whose col is id, which must be a UUID.
+func (q *Query) EqUUID(col, id string) *Query {
+	if !ValidID(id) {
+		if q.err == nil {
+			q.err = fmt.Errorf("%s %q: %w", col, id, ErrInvalidID)
+		}
+		return q
+	}
+	q.params.Add(col, "eq."+id)
+	return q
+}
+
+// InUUIDs keeps the rows whose col is one of ids, which must be UUIDs.
+func (q *Query) InUUIDs(col string, ids []string) *Query {
+	for _, id := range ids {
+		if !ValidID(id) {
+			if q.err == nil {
+				q.err = fmt.Errorf("%s %q: %w", col, id, ErrInvalidID)
+			}
+			return q
+		}
+	}
+	q.params.Add(col, "in.("+strings.Join(ids, ",")+")")
+	return q
+}
+
+// Since keeps the rows whose col, a timestamp, is t or later.
+func (q *Query) Since(col string, t time.Time) *Query {
+	q.params.Add(col, "gte."+t.UTC().Format(time.RFC3339Nano))
+	return q
+}
+
+// Before keeps the rows whose col, a timestamp, is before t.
+func (q *Query) Before(col string, t time.Time) *Query {
+	q.params.Add(col, "lt."+t.UTC().Format(time.RFC3339Nano))
+	return q
+}
+
+// Select returns only cols.
+func (q *Query) Select(cols ...string) *Query {
+	q.params.Set("select", strings.Join(cols, ","))
+	return q
+}
+
+// OrderBy sorts by col, after any earlier OrderBy.
+func (q *Query) OrderBy(col string, desc bool) *Query {
+	order := col + ".asc"
+	if desc {
+		order = col + ".desc"
+	}
+	if prev := q.params.Get("order"); prev != "" {
+		order = prev + "," + order
+	}
+	q.params.Set("order", order)
+	return q
+}
+
+// Limit returns at most n rows.
+func (q *Query) Limit(n int) *Query {
+	if n < 0 {
+		if q.err == nil {
+			q.err = fmt.Errorf("limit %d: must be >= 0", n)
+		}
+		return q
+	}
+	q.params.Set("limit", strconv.Itoa(n))
+	return q
+}
+
+// Offset skips the first n rows.
+func (q *Query) Offset(n int) *Query {
+	if n < 0 {
+		if q.err == nil {
+			q.err = fmt.Errorf("offset %d: must be >= 0", n)
+		}
+		return q
+	}
+	q.params.Set("offset", strconv.Itoa(n))
+	return q
+}
+
+// OnConflict has an insert merge the rows whose cols are already there,
+// with the Prefer: resolution=merge-duplicates header.
+func (q *Query) OnConflict(cols ...string) *Query {
+	q.params.Set("on_conflict", strings.Join(cols, ","))
+	return q
+}
+
+// Path is the query as a path under /rest/v1/.
+func (q *Query) Path() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	if len(q.params) == 0 {
+		return url.PathEscape(q.table), nil
+	}
+	return url.PathEscape(q.table) + "?" + q.params.Encode(), nil
+}
@@ -0,0 +1,134 @@
+package jobdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testID = "0b8e5b1e-3c4d-4f6a-9b2c-1d2e3f4a5b6c"
+
+func TestValidID(t *testing.T) {
+	for _, id := range []string{testID, "0B8E5B1E-3C4D-4F6A-9B2C-1D2E3F4A5B6C"} {
+		if !ValidID(id) {
+			t.Errorf("%q rejected", id)
+		}
+	}
+}
+
+// malicious are job IDs as an attacker might put them in a URL path, each
+// trying to add a filter or option to the query, or to break it.
+var malicious = []string{
+	"",
+	"1",
+	"not-a-uuid",
+	testID + "&status=eq.failed",
+	testID + ",id.neq.0",
+	testID + ")",
+	"in.(" + testID + ")",
+	"eq." + testID,
+	testID + "&select=*",
+	testID + "%26limit=1",
+	testID[:35] + "&",
+	testID[:35] + ",",
+	testID[:35] + ")",
+	"{" + testID + "}",
+	"urn:uuid:" + testID,
+	testID + " ",
+	"0b8e5b1e3c4d4f6a9b2c1d2e3f4a5b6c", // unhyphenated
+	"0b8e5b1e-3c4d-4f6a-9b2c-1d2e3f4a5b6g",
+}
+
+func TestEqUUIDRejectsMaliciousIDs(t *testing.T) {
+	for _, id := range malicious {
+		path, err := From("jobs").EqUUID("id", id).Limit(1).Path()
+		if !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%q: path %q, err %v; want %v", id, path, err, ErrInvalidID)
+		}
+	}
+}
+
+func TestInUUIDsRejectsMaliciousIDs(t *testing.T) {
+	for _, id := range malicious {
+		if _, err := From("screen_results").InUUIDs("job_id", []string{testID, id}).Path(); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%q among valid IDs: err %v", id, err)
+		}
+	}
+}
+
+func TestQueryPath(t *testing.T) {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	path, err := From("jobs").
+		EqUUID("id", testID).
+		Since("created_at", since).
+		Select("id", "status").
+		OrderBy("created_at", true).
+		OrderBy("id", false).
+		Limit(50).
+		Offset(10).
+		Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "jobs?created_at=gte.2026-01-02T02%3A04%3A05Z&id=eq." + testID +
+		"&limit=50&offset=10&order=created_at.desc%2Cid.asc&select=id%2Cstatus"
+	if path != want {
+		t.Errorf("\n got %s\nwant %s", path, want)
+	}
+
+	// Every parameter decodes to exactly what was built: no value adds one.
+	q, _ := url.ParseQuery(path[len("jobs?"):])
+	if len(q) != 6 || q.Get("id") != "eq."+testID {
+		t.Errorf("parameters %v", q)
+	}
+}
+
+func TestQueryKeepsFirstError(t *testing.T) {
+	_, err := From("jobs").EqUUID("id", "x").Limit(-1).Path()
+	if !errors.Is(err, ErrInvalidID) {
+		t.Errorf("err %v, want the invalid ID's", err)
+	}
+	if _, err := From("jobs").Limit(-1).Path(); err == nil {
+		t.Error("negative limit accepted")
+	}
+	if _, err := From("jobs").Offset(-1).Path(); err == nil {
+		t.Error("negative offset accepted")
+	}
+}
+
+func TestRESTReaderSendsNoMaliciousID(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	rr := NewRESTReader(srv.URL, "key", srv.Client())
+	ctx := context.Background()
+
+	for _, id := range malicious {
+		if _, err := rr.Job(ctx, id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Job(%q): %v", id, err)
+		}
+		if _, err := rr.Iterations(ctx, id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Iterations(%q): %v", id, err)
+		}
+		if _, err := rr.ScreenResults(ctx, id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ScreenResults(%q): %v", id, err)
+		}
+	}
+	if len(requests) > 0 {
+		t.Errorf("requested %v", requests)
+	}
+
+	if _, err := rr.Job(ctx, testID); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/rest/v1/jobs?id=eq." + testID; len(requests) != 1 || requests[0] != want {
+		t.Errorf("requested %v, want %s", requests, want)
+	}
+}
@@ -0,0 +1,76 @@
+package jobdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RESTReader reads through Supabase's REST API.
+type RESTReader struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+func NewRESTReader(url, key string, client *http.Client) *RESTReader {
+	return &RESTReader{url: url, key: key, client: client}
+}
+
+func (r *RESTReader) RecentJobs(ctx context.Context, limit int) ([]Row, error) {
+	return r.get(ctx, From("jobs").OrderBy("created_at", true).Limit(limit))
+}
+
+func (r *RESTReader) Job(ctx context.Context, id string) (Row, error) {
+	rows, err := r.get(ctx, From("jobs").EqUUID("id", id))
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+func (r *RESTReader) Iterations(ctx context.Context, jobID string) ([]Row, error) {
+	return r.get(ctx, From("iterations").EqUUID("job_id", jobID).OrderBy("created_at", false))
+}
+
+func (r *RESTReader) ScreenResults(ctx context.Context, jobID string) ([]Row, error) {
+	return r.get(ctx, From("screen_results").EqUUID("job_id", jobID).
+		OrderBy("screen_index", false).OrderBy("platform", false))
+}
+
+func (r *RESTReader) JobsCreated(ctx context.Context, from, to time.Time, cols []string, offset, limit int) ([]Row, error) {
+	return r.get(ctx, From("jobs").Since("created_at", from).Before("created_at", to).Select(cols...).
+		OrderBy("created_at", false).OrderBy("id", false).Offset(offset).Limit(limit))
+}
+
+func (r *RESTReader) IterationsOf(ctx context.Context, jobIDs, cols []string, offset, limit int) ([]Row, error) {
+	return r.get(ctx, From("iterations").InUUIDs("job_id", jobIDs).Select(cols...).
+		OrderBy("id", false).Offset(offset).Limit(limit))
+}
+
+func (r *RESTReader) get(ctx context.Context, q *Query) ([]Row, error) {
+	path, err := q.Path()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", r.url+"/rest/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("apikey", r.key)
+	req.Header.Set("Authorization", "Bearer "+r.key)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, fmt.Errorf("supabase %d: %s", resp.StatusCode, raw)
+	}
+	var rows []Row
+	return rows, json.NewDecoder(resp.Body).Decode(&rows)
+}
@@ -0,0 +1,108 @@
+package jobdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ScreenRunning is the status of a screen×platform Screens finds no result
+// for: it hasn't finished, or finished before results were stored.
+const ScreenRunning = "running"
+
+// Screens returns one record per screen×platform of a job: its
+// screen_results row, with its iterations, oldest first, under "history".
+// A unit without a result gets one made from its iterations, of status
+// ScreenRunning.
+func Screens(ctx context.Context, r Reader, jobID string) ([]Row, error) {
+	results, err := r.ScreenResults(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("read screen results: %w", err)
+	}
+	iters, err := r.Iterations(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("read iterations: %w", err)
+	}
+
+	history := make(map[screenUnit][]Row)
+	var order []screenUnit // of the units first seen in iters
+	for _, it := range iters {
+		u := unitOf(it)
+		if history[u] == nil {
+			order = append(order, u)
+		}
+		history[u] = append(history[u], it)
+	}
+
+	out := make([]Row, 0, len(results)+len(order))
+	seen := make(map[screenUnit]bool, len(results))
+	for _, res := range results {
+		u := unitOf(res)
+		seen[u] = true
+		res["history"] = orEmpty(history[u])
+		out = append(out, res)
+	}
+	var running []Row
+	for _, u := range order {
+		if !seen[u] {
+			running = append(running, runningScreen(history[u]))
+		}
+	}
+	sort.SliceStable(running, func(a, b int) bool {
+		ia, ib := num(running[a]["screen_index"]), num(running[b]["screen_index"])
+		if ia != ib {
+			return ia < ib
+		}
+		return str(running[a]["platform"]) < str(running[b]["platform"])
+	})
+	return append(out, running...), nil
+}
+
+// screenUnit is a screen×platform as its rows name it: by screen index,
+// or by name on iterations stored without one.
+type screenUnit struct {
+	screen   string
+	platform string
+}
+
+func unitOf(row Row) screenUnit {
+	u := screenUnit{screen: str(row["screen_name"]), platform: str(row["platform"])}
+	if idx, ok := row["screen_index"].(float64); ok {
+		u.screen = fmt.Sprint(idx)
+	}
+	return u
+}
+
+// runningScreen is the record of an unfinished unit, from its iterations,
+// oldest first: as far as it got and its best iteration so far.
+func runningScreen(iters []Row) Row {
+	last := iters[len(iters)-1]
+	rec := Row{
+		"job_id":       last["job_id"],
+		"screen_index": last["screen_index"],
+		"screen_name":  last["screen_name"],
+		"platform":     last["platform"],
+		"status":       ScreenRunning,
+		"score":        last["score"],
+		"iterations":   last["iteration"],
+		"history":      iters,
+	}
+	var best Row
+	for _, it := range iters {
+		if best == nil || num(it["score"]) > num(best["score"]) {
+			best = it
+		}
+	}
+	rec["best_score"] = best["score"]
+	rec["best_iteration"] = best["iteration"]
+	rec["code_url"] = best["code_url"]
+	rec["diff_image_url"] = best["diff_url"]
+	return rec
+}
+
+func orEmpty(rows []Row) []Row {
+	if rows == nil {
+		return []Row{}
+	}
+	return rows
+}
@@ -0,0 +1,23 @@
+// Package logging configures the global zerolog logger for Forge services.
+package logging
+
+import (
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Setup points the global logger at stderr in the format chosen by
+// LOG_FORMAT: "console" (default, colored human-readable lines) or "json"
+// (one object per line with level, time and message fields, for log
+// aggregators). Call it after loading .env so the variable is honoured.
+func Setup() {
+	if os.Getenv("LOG_FORMAT") == "json" {
+		zerolog.TimeFieldFormat = time.RFC3339Nano
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+		return
+	}
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "15:04:05"})
+}
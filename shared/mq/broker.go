@@ -4,7 +4,9 @@ package mq
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -16,11 +18,21 @@ const (
 	ExchangeType = "topic"
 )
 
+// MaxPriority is the highest message priority the service queues order
+// by, their x-max-priority. Higher priorities go first; messages of equal
+// priority stay FIFO.
+const MaxPriority = 9
+
 // Broker wraps an AMQP connection with auto-reconnect.
 type Broker struct {
 	url  string
 	conn *amqp.Connection
 	ch   *amqp.Channel
+
+	// RPC state, initialised lazily by the first Call.
+	rpcMu      sync.Mutex
+	replyQueue string
+	pending    map[string]chan []byte
 }
 
 // New connects to RabbitMQ and declares the exchange.
@@ -65,6 +77,13 @@ func (b *Broker) connect() error {
 
 // Publish sends a message to the topic exchange with the given routing key.
 func (b *Broker) Publish(ctx context.Context, routingKey string, body []byte) error {
+	return b.PublishWithPriority(ctx, routingKey, body, 0)
+}
+
+// PublishWithPriority is Publish for a message that overtakes those of
+// lower priority waiting in the queues it lands in. priority is capped at
+// MaxPriority.
+func (b *Broker) PublishWithPriority(ctx context.Context, routingKey string, body []byte, priority uint8) error {
 	return b.ch.PublishWithContext(ctx,
 		Exchange,
 		routingKey,
@@ -73,6 +92,7 @@ func (b *Broker) Publish(ctx context.Context, routingKey string, body []byte) er
 		amqp.Publishing{
 			ContentType:  "application/json",
 			DeliveryMode: amqp.Persistent,
+			Priority:     min(priority, MaxPriority),
 			Timestamp:    time.Now(),
 			Body:         body,
 		},
@@ -82,35 +102,72 @@ func (b *Broker) Publish(ctx context.Context, routingKey string, body []byte) er
 // Subscribe binds a named queue to the exchange using a routing key pattern.
 // Pattern examples: "job.*", "figma.#", "diff.complete"
 func (b *Broker) Subscribe(queueName, pattern string) (<-chan amqp.Delivery, error) {
-	q, err := b.ch.QueueDeclare(
-		queueName,
-		true,  // durable
-		false, // auto-delete
-		false, // exclusive
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("declare queue %s: %w", queueName, err)
+	return b.SubscribePrefetch(queueName, pattern, 1)
+}
+
+// SubscribePrefetch is Subscribe for a consumer that handles up to
+// prefetch deliveries at once: that many are sent to it unacknowledged.
+func (b *Broker) SubscribePrefetch(queueName, pattern string, prefetch int) (<-chan amqp.Delivery, error) {
+	if err := b.declareQueue(queueName); err != nil {
+		return nil, err
 	}
 
-	if err := b.ch.QueueBind(q.Name, pattern, Exchange, false, nil); err != nil {
+	if err := b.ch.QueueBind(queueName, pattern, Exchange, false, nil); err != nil {
 		return nil, fmt.Errorf("bind queue %s to %s: %w", queueName, pattern, err)
 	}
 
-	// Prefetch 1 — process one message at a time per worker
-	if err := b.ch.Qos(1, 0, false); err != nil {
+	if err := b.ch.Qos(max(prefetch, 1), 0, false); err != nil {
 		return nil, fmt.Errorf("set qos: %w", err)
 	}
 
 	return b.ch.Consume(
-		q.Name,
+		queueName,
 		"",    // consumer tag — auto-generated
 		false, // auto-ack — we ack manually after processing
 		false, false, false, nil,
 	)
 }
 
+// declareQueue declares a durable service queue with MaxPriority. A queue
+// declared before it had priorities keeps working without them: RabbitMQ
+// can't add x-max-priority to a queue, and refuses the declaration, so it
+// is tried on a channel of its own that the refusal closes. Delete the
+// queue to have it declared again with them.
+func (b *Broker) declareQueue(name string) error {
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open channel: %w", err)
+	}
+	defer ch.Close()
+	_, err = ch.QueueDeclare(
+		name,
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{"x-max-priority": int32(MaxPriority)},
+	)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		log.Warn().Str("queue", name).Msg("queue was declared without x-max-priority — messages stay FIFO until it is deleted")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("declare queue %s: %w", name, err)
+	}
+	return nil
+}
+
+// QueueDepth is the number of messages ready in a queue declared by
+// Subscribe, not counting those delivered and awaiting acknowledgement.
+func (b *Broker) QueueDepth(queueName string) (int, error) {
+	q, err := b.ch.QueueDeclarePassive(queueName, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("inspect queue %s: %w", queueName, err)
+	}
+	return q.Messages, nil
+}
+
 // Close shuts down channel and connection.
 func (b *Broker) Close() {
 	if b.ch != nil {
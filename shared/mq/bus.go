@@ -0,0 +1,51 @@
+package mq
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher sends messages to the topic exchange.
+type Publisher interface {
+	Publish(ctx context.Context, routingKey string, body []byte) error
+	PublishWithPriority(ctx context.Context, routingKey string, body []byte, priority uint8) error
+}
+
+// Subscriber binds queues to the topic exchange and consumes them. Each
+// delivery must be acked or nacked.
+type Subscriber interface {
+	Subscribe(queueName, pattern string) (<-chan amqp.Delivery, error)
+	SubscribePrefetch(queueName, pattern string, prefetch int) (<-chan amqp.Delivery, error)
+	QueueDepth(queueName string) (int, error)
+}
+
+// Bus is what a service needs of the broker: *Broker over RabbitMQ, or
+// *Memory within a process.
+type Bus interface {
+	Publisher
+	Subscriber
+	Close()
+}
+
+// Caller makes RPC requests over the exchange and waits for their reply.
+type Caller interface {
+	Call(ctx context.Context, routingKey string, body []byte) ([]byte, error)
+}
+
+// Replier answers the requests made with Call.
+type Replier interface {
+	Reply(ctx context.Context, d amqp.Delivery, body []byte) error
+}
+
+// RPCBus is a Bus that can also make and answer RPC requests.
+type RPCBus interface {
+	Bus
+	Caller
+	Replier
+}
+
+var (
+	_ RPCBus = (*Broker)(nil)
+	_ RPCBus = (*Memory)(nil)
+)
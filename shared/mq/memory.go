@@ -0,0 +1,376 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrClosed is the error of a Memory used after Close.
+var ErrClosed = errors.New("mq: broker closed")
+
+// Memory is a Bus within a process, for running services together without
+// RabbitMQ. It routes like the topic exchange — "*" matches one word of a
+// routing key, "#" any number — and its queues keep to priority order,
+// prefetch and redelivery on nack with requeue. Messages are lost with the
+// process, and none reach a queue published to before it was subscribed.
+type Memory struct {
+	mu     sync.Mutex
+	queues map[string]*memQueue
+	done   chan struct{}
+	closed bool
+
+	// RPC state, initialised lazily by the first Call.
+	rpcMu      sync.Mutex
+	replyQueue string
+	pending    map[string]chan []byte
+}
+
+// NewMemory returns an empty in-process broker.
+func NewMemory() *Memory {
+	return &Memory{queues: make(map[string]*memQueue), done: make(chan struct{})}
+}
+
+// memQueue is a queue of a Memory; all of its fields but out and wake are
+// guarded by the Memory's mu.
+type memQueue struct {
+	m        *Memory
+	patterns []string
+	ready    []amqp.Delivery // by priority, highest first
+	unacked  map[uint64]amqp.Delivery
+	prefetch int
+	tag      uint64
+	out      chan amqp.Delivery
+	wake     chan struct{} // signalled when ready or unacked change
+}
+
+func (m *Memory) Publish(ctx context.Context, routingKey string, body []byte) error {
+	return m.PublishWithPriority(ctx, routingKey, body, 0)
+}
+
+func (m *Memory) PublishWithPriority(ctx context.Context, routingKey string, body []byte, priority uint8) error {
+	return m.publish(ctx, amqp.Delivery{
+		DeliveryMode: amqp.Persistent,
+		Priority:     min(priority, MaxPriority),
+		RoutingKey:   routingKey,
+		Body:         body,
+	})
+}
+
+// publish queues a copy of d on every queue bound to its routing key.
+func (m *Memory) publish(ctx context.Context, d amqp.Delivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	d.ContentType = "application/json"
+	d.Timestamp = time.Now()
+	d.Exchange = Exchange
+	body := d.Body
+	for _, q := range m.queues {
+		if !q.routes(d.RoutingKey) {
+			continue
+		}
+		d.Body = append([]byte(nil), body...)
+		q.push(d, false)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(queueName, pattern string) (<-chan amqp.Delivery, error) {
+	return m.SubscribePrefetch(queueName, pattern, 1)
+}
+
+// SubscribePrefetch binds queueName to pattern, declaring it on first use.
+// Consumers of the same queue share its deliveries and the largest
+// prefetch asked for.
+func (m *Memory) SubscribePrefetch(queueName, pattern string, prefetch int) (<-chan amqp.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	q := m.declare(queueName)
+	q.prefetch = max(q.prefetch, prefetch, 1)
+	if !q.routesPattern(pattern) {
+		q.patterns = append(q.patterns, pattern)
+	}
+	q.signal()
+	return q.out, nil
+}
+
+// declare returns the queue called name, declaring it on first use. The
+// caller holds m.mu.
+func (m *Memory) declare(name string) *memQueue {
+	q := m.queues[name]
+	if q == nil {
+		q = &memQueue{
+			m:       m,
+			unacked: make(map[uint64]amqp.Delivery),
+			out:     make(chan amqp.Delivery),
+			wake:    make(chan struct{}, 1),
+		}
+		m.queues[name] = q
+		go q.pump()
+	}
+	return q
+}
+
+// Call publishes body as an RPC request and blocks until the responder
+// replies or ctx is done, as Broker.Call does. Replies arrive on a private
+// queue, bound to no routing key, declared on first use.
+func (m *Memory) Call(ctx context.Context, routingKey string, body []byte) ([]byte, error) {
+	replyTo, err := m.ensureReplyQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	corrID := uuid.New().String()
+	replyCh := make(chan []byte, 1)
+	m.rpcMu.Lock()
+	m.pending[corrID] = replyCh
+	m.rpcMu.Unlock()
+	defer func() {
+		m.rpcMu.Lock()
+		delete(m.pending, corrID)
+		m.rpcMu.Unlock()
+	}()
+
+	if err := m.publish(ctx, amqp.Delivery{
+		RoutingKey:    routingKey,
+		ReplyTo:       replyTo,
+		CorrelationId: corrID,
+		Body:          body,
+	}); err != nil {
+		return nil, fmt.Errorf("publish %s: %w", routingKey, err)
+	}
+
+	select {
+	case reply := <-replyCh:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("call %s: %w", routingKey, ctx.Err())
+	}
+}
+
+// ensureReplyQueue declares the reply queue once and starts the goroutine
+// that routes replies to waiting callers.
+func (m *Memory) ensureReplyQueue() (string, error) {
+	m.rpcMu.Lock()
+	defer m.rpcMu.Unlock()
+	if m.replyQueue != "" {
+		return m.replyQueue, nil
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return "", ErrClosed
+	}
+	name := "amq.gen-" + uuid.New().String()
+	q := m.declare(name)
+	q.prefetch = 1
+	m.mu.Unlock()
+
+	m.replyQueue = name
+	m.pending = make(map[string]chan []byte)
+	go func() {
+		for d := range q.out {
+			_ = d.Ack(false)
+			m.rpcMu.Lock()
+			ch, ok := m.pending[d.CorrelationId]
+			m.rpcMu.Unlock()
+			if ok {
+				ch <- d.Body // buffered; a late duplicate is dropped with the entry
+			}
+		}
+	}()
+	return m.replyQueue, nil
+}
+
+// Reply answers a request delivery by queueing body straight on its
+// ReplyTo queue, as the default exchange does.
+func (m *Memory) Reply(ctx context.Context, d amqp.Delivery, body []byte) error {
+	if d.ReplyTo == "" {
+		return fmt.Errorf("delivery has no reply-to queue")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	q := m.queues[d.ReplyTo]
+	if q == nil {
+		return fmt.Errorf("reply queue %s: not declared", d.ReplyTo)
+	}
+	q.push(amqp.Delivery{
+		ContentType:   "application/json",
+		Timestamp:     time.Now(),
+		RoutingKey:    d.ReplyTo,
+		CorrelationId: d.CorrelationId,
+		Body:          append([]byte(nil), body...),
+	}, false)
+	return nil
+}
+
+func (m *Memory) QueueDepth(queueName string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.queues[queueName]
+	if q == nil {
+		return 0, fmt.Errorf("inspect queue %s: not declared", queueName)
+	}
+	return len(q.ready), nil
+}
+
+// Close stops deliveries and closes the consumers' channels; messages not
+// yet acked are dropped.
+func (m *Memory) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+}
+
+// pump hands q's ready messages to its consumers, up to prefetch
+// unacknowledged, until the Memory is closed.
+func (q *memQueue) pump() {
+	defer close(q.out)
+	for {
+		q.m.mu.Lock()
+		var d amqp.Delivery
+		ok := len(q.ready) > 0 && len(q.unacked) < q.prefetch
+		if ok {
+			d = q.ready[0]
+			q.ready = q.ready[1:]
+			q.tag++
+			d.DeliveryTag = q.tag
+			d.Acknowledger = q
+			q.unacked[d.DeliveryTag] = d
+		}
+		q.m.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.m.done:
+				return
+			}
+		}
+		select {
+		case q.out <- d:
+		case <-q.m.done:
+			return
+		}
+	}
+}
+
+// push queues d after those of its priority or higher; a redelivery goes
+// before them instead, as RabbitMQ puts it back where it was.
+func (q *memQueue) push(d amqp.Delivery, redelivered bool) {
+	i := 0
+	for i < len(q.ready) && (q.ready[i].Priority > d.Priority || !redelivered && q.ready[i].Priority == d.Priority) {
+		i++
+	}
+	q.ready = append(q.ready, amqp.Delivery{})
+	copy(q.ready[i+1:], q.ready[i:])
+	q.ready[i] = d
+	q.signal()
+}
+
+func (q *memQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Ack, Nack and Reject make memQueue the amqp.Acknowledger of its
+// deliveries.
+func (q *memQueue) Ack(tag uint64, multiple bool) error {
+	return q.settle(tag, multiple, false)
+}
+
+func (q *memQueue) Nack(tag uint64, multiple, requeue bool) error {
+	return q.settle(tag, multiple, requeue)
+}
+
+func (q *memQueue) Reject(tag uint64, requeue bool) error {
+	return q.settle(tag, false, requeue)
+}
+
+func (q *memQueue) settle(tag uint64, multiple, requeue bool) error {
+	q.m.mu.Lock()
+	defer q.m.mu.Unlock()
+	if q.m.closed {
+		return ErrClosed
+	}
+	if _, ok := q.unacked[tag]; !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	for t, d := range q.unacked {
+		if t != tag && !(multiple && t < tag) {
+			continue
+		}
+		delete(q.unacked, t)
+		if requeue {
+			d.Redelivered = true
+			d.DeliveryTag, d.Acknowledger = 0, nil
+			q.push(d, true)
+		}
+	}
+	q.signal()
+	return nil
+}
+
+func (q *memQueue) routes(routingKey string) bool {
+	for _, p := range q.patterns {
+		if topicMatch(strings.Split(p, "."), strings.Split(routingKey, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *memQueue) routesPattern(pattern string) bool {
+	for _, p := range q.patterns {
+		if p == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// topicMatch reports whether a routing key's words match a binding
+// pattern's, as the topic exchange matches them.
+func topicMatch(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if topicMatch(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && topicMatch(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && key[0] == pattern[0] && topicMatch(pattern[1:], key[1:])
+	}
+}
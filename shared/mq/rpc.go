@@ -0,0 +1,114 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Call publishes body on the exchange as an RPC request and blocks until the
+// responder replies or ctx is done. Replies arrive on a private, exclusive
+// queue declared on first use and are matched back by correlation id.
+func (b *Broker) Call(ctx context.Context, routingKey string, body []byte) ([]byte, error) {
+	replyTo, err := b.ensureReplyQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	corrID := uuid.New().String()
+	replyCh := make(chan []byte, 1)
+	b.rpcMu.Lock()
+	b.pending[corrID] = replyCh
+	b.rpcMu.Unlock()
+	defer func() {
+		b.rpcMu.Lock()
+		delete(b.pending, corrID)
+		b.rpcMu.Unlock()
+	}()
+
+	err = b.ch.PublishWithContext(ctx,
+		Exchange,
+		routingKey,
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			Timestamp:     time.Now(),
+			ReplyTo:       replyTo,
+			CorrelationId: corrID,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("publish %s: %w", routingKey, err)
+	}
+
+	select {
+	case reply := <-replyCh:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("call %s: %w", routingKey, ctx.Err())
+	}
+}
+
+// Reply answers a request delivery by publishing body straight to its
+// ReplyTo queue (via the default exchange) with the same correlation id.
+func (b *Broker) Reply(ctx context.Context, d amqp.Delivery, body []byte) error {
+	if d.ReplyTo == "" {
+		return fmt.Errorf("delivery has no reply-to queue")
+	}
+	return b.ch.PublishWithContext(ctx,
+		"", // default exchange routes by queue name
+		d.ReplyTo,
+		false, false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			Timestamp:     time.Now(),
+			CorrelationId: d.CorrelationId,
+			Body:          body,
+		},
+	)
+}
+
+// ensureReplyQueue declares the server-named reply queue once and starts the
+// goroutine that routes replies to waiting callers.
+func (b *Broker) ensureReplyQueue() (string, error) {
+	b.rpcMu.Lock()
+	defer b.rpcMu.Unlock()
+	if b.replyQueue != "" {
+		return b.replyQueue, nil
+	}
+
+	q, err := b.ch.QueueDeclare(
+		"",    // server-generated name
+		false, // durable
+		true,  // auto-delete
+		true,  // exclusive
+		false, // no-wait
+		nil,
+	)
+	if err != nil {
+		return "", fmt.Errorf("declare reply queue: %w", err)
+	}
+	deliveries, err := b.ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return "", fmt.Errorf("consume reply queue: %w", err)
+	}
+
+	b.replyQueue = q.Name
+	b.pending = make(map[string]chan []byte)
+	go func() {
+		for d := range deliveries {
+			b.rpcMu.Lock()
+			ch, ok := b.pending[d.CorrelationId]
+			b.rpcMu.Unlock()
+			if ok {
+				ch <- d.Body // buffered; a late duplicate is dropped with the entry
+			}
+		}
+	}()
+	return b.replyQueue, nil
+}
@@ -0,0 +1,150 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// respond answers the requests on key, through bus, with their body upper
+// cased, holding each one for delay first.
+func respond(t *testing.T, bus RPCBus, queue, key string, delay func(body []byte) time.Duration) {
+	t.Helper()
+	requests, err := bus.SubscribePrefetch(queue, key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for d := range requests {
+			go func() {
+				time.Sleep(delay(d.Body))
+				if err := bus.Reply(context.Background(), d, bytes.ToUpper(d.Body)); err != nil {
+					t.Errorf("reply: %v", err)
+				}
+				_ = d.Ack(false)
+			}()
+		}
+	}()
+}
+
+func noDelay([]byte) time.Duration { return 0 }
+
+// roundTrips makes n concurrent calls on bus, answered by respond in
+// reverse order, and checks each gets its own reply.
+func roundTrips(t *testing.T, bus RPCBus, n int) {
+	t.Helper()
+	respond(t, bus, "test.rpc", "test.call", func(body []byte) time.Duration {
+		var i int
+		fmt.Sscanf(string(body), "call %d", &i)
+		return time.Duration(n-i) * 10 * time.Millisecond
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := bus.(Caller).Call(ctx, "test.call", []byte(fmt.Sprintf("call %d", i)))
+			if err != nil {
+				t.Errorf("call %d: %v", i, err)
+				return
+			}
+			if want := fmt.Sprintf("CALL %d", i); string(reply) != want {
+				t.Errorf("call %d got %q", i, reply)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMemoryCallRoundTrip(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	roundTrips(t, bus, 10)
+}
+
+func TestMemoryCallTimesOut(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	respond(t, bus, "test.rpc", "test.call", func([]byte) time.Duration { return time.Second })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := bus.Call(ctx, "test.call", []byte("late")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err %v, want the deadline", err)
+	}
+	// The late reply finds no caller, and the next call still gets its own.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := bus.Call(ctx, "test.call", []byte("next"))
+	if err != nil || string(reply) != "NEXT" {
+		t.Errorf("got %q, %v", reply, err)
+	}
+}
+
+func TestMemoryCallsAreNotEvents(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	respond(t, bus, "test.rpc", "test.call", noDelay)
+	// A subscriber to everything sees the request, but not the reply,
+	// which goes to the caller's queue alone.
+	all, err := bus.Subscribe("test.all", "#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.Call(context.Background(), "test.call", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	d := <-all
+	_ = d.Ack(false)
+	if d.RoutingKey != "test.call" || d.ReplyTo == "" || d.CorrelationId == "" {
+		t.Errorf("request %+v", d)
+	}
+	select {
+	case d := <-all:
+		t.Errorf("reply published on the exchange: %s %q", d.RoutingKey, d.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryReply(t *testing.T) {
+	bus := NewMemory()
+	defer bus.Close()
+	if err := bus.Reply(context.Background(), amqp.Delivery{CorrelationId: "c"}, nil); err == nil {
+		t.Error("replied to a delivery with no reply-to queue")
+	}
+	if err := bus.Reply(context.Background(), amqp.Delivery{ReplyTo: "amq.gen-gone", CorrelationId: "c"}, nil); err == nil {
+		t.Error("replied to an undeclared queue")
+	}
+}
+
+func TestMemoryCallAfterClose(t *testing.T) {
+	bus := NewMemory()
+	bus.Close()
+	if _, err := bus.Call(context.Background(), "test.call", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("err %v, want %v", err, ErrClosed)
+	}
+}
+
+// TestBrokerCallRoundTrip runs against the RabbitMQ at FORGE_TEST_AMQP_URL.
+func TestBrokerCallRoundTrip(t *testing.T) {
+	url := os.Getenv("FORGE_TEST_AMQP_URL")
+	if url == "" {
+		t.Skip("no RabbitMQ: set FORGE_TEST_AMQP_URL to run")
+	}
+	b, err := New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	roundTrips(t, b, 10)
+}
@@ -0,0 +1,200 @@
+package svc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/forge-ai/forge/shared/mq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+)
+
+// Subscription is a queue a Runner consumes and what handles its
+// deliveries.
+type Subscription struct {
+	Queue   string
+	Pattern string
+	Handler func(ctx context.Context, d amqp.Delivery) error
+	// Workers handle deliveries at once, each with one unacknowledged;
+	// 0 is 1.
+	Workers int
+	// Requeue decides whether a delivery Handler failed goes back on the
+	// queue, given the context it was handled with; nil drops them all.
+	Requeue func(ctx context.Context, d amqp.Delivery, err error) bool
+}
+
+// Runner consumes a service's queues: a delivery is acked when its handler
+// succeeds and nacked when it fails or panics, a panic failing that
+// delivery alone. At shutdown workers stop taking deliveries and Run waits
+// for those in flight.
+type Runner struct {
+	Name   string // for metrics, e.g. "differ"
+	Broker mq.Bus
+	// AdminAddr serves GET /healthz and /metrics, with the routes of
+	// Admin; empty serves nothing.
+	AdminAddr string
+	Admin     *http.ServeMux
+	// Metrics writes the service's own to /metrics, after the runner's.
+	Metrics func(w io.Writer)
+	// Drain is how long handlers in flight at shutdown may run on; 0
+	// cancels their context with Run's.
+	Drain time.Duration
+
+	subs []*subscription
+}
+
+// subscription is a Subscription as it runs.
+type subscription struct {
+	Subscription
+	deliveries <-chan amqp.Delivery
+	busy       atomic.Int64 // workers running Handler
+	failed     atomic.Int64
+	panics     atomic.Int64
+}
+
+// Run subscribes to subs and handles their deliveries until ctx is done,
+// then waits for the handlers in flight.
+func (r *Runner) Run(ctx context.Context, subs ...Subscription) error {
+	for _, s := range subs {
+		s.Workers = max(s.Workers, 1)
+		deliveries, err := r.Broker.SubscribePrefetch(s.Queue, s.Pattern, s.Workers)
+		if err != nil {
+			return err
+		}
+		r.subs = append(r.subs, &subscription{Subscription: s, deliveries: deliveries})
+	}
+
+	hctx := ctx
+	if r.Drain > 0 {
+		var cancel context.CancelFunc
+		hctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		stop := context.AfterFunc(ctx, func() { time.AfterFunc(r.Drain, cancel) })
+		defer stop()
+	}
+
+	if r.AdminAddr != "" {
+		go func() {
+			if err := r.serveAdmin(ctx); err != nil {
+				log.Error().Err(err).Msg("admin server")
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range r.subs {
+		for i := 0; i < s.Workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.work(ctx, hctx, s)
+			}()
+		}
+	}
+	wg.Wait()
+	return nil
+}
+
+// work handles s's deliveries with hctx until ctx is done or they stop.
+func (r *Runner) work(ctx, hctx context.Context, s *subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-s.deliveries:
+			if !ok {
+				return
+			}
+			s.busy.Add(1)
+			err := s.handle(hctx, d)
+			s.busy.Add(-1)
+			if err == nil {
+				d.Ack(false)
+				continue
+			}
+			s.failed.Add(1)
+			requeue := s.Requeue != nil && s.Requeue(hctx, d, err)
+			log.Error().Err(err).Str("queue", s.Queue).Bool("requeue", requeue).Msg("delivery failed")
+			d.Nack(false, requeue)
+		}
+	}
+}
+
+// handle runs Handler, turning a panic into an error.
+func (s *subscription) handle(ctx context.Context, d amqp.Delivery) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.panics.Add(1)
+			log.Error().Str("queue", s.Queue).Interface("panic", v).Bytes("stack", debug.Stack()).Msg("handler panicked")
+			err = fmt.Errorf("handler panic: %v", v)
+		}
+	}()
+	return s.Handler(ctx, d)
+}
+
+// serveAdmin serves the admin routes on AdminAddr until ctx is done.
+func (r *Runner) serveAdmin(ctx context.Context) error {
+	mux := r.Admin
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) { io.WriteString(w, "ok\n") })
+	mux.HandleFunc("GET /metrics", r.metrics)
+
+	srv := &http.Server{
+		Addr:         r.AdminAddr,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// metrics writes the workers' gauges and counters in the Prometheus text
+// format, then the service's own.
+func (r *Runner) metrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	prefix := "forge_" + strings.ReplaceAll(r.Name, "-", "_") + "_"
+	var workers, busy, failed, panics int64
+	for _, s := range r.subs {
+		workers += int64(s.Workers)
+		busy += s.busy.Load()
+		failed += s.failed.Load()
+		panics += s.panics.Load()
+	}
+	metric := func(name, kind, help string, v int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", prefix+name, help, prefix+name, kind, prefix+name, v)
+	}
+	metric("workers", "gauge", "Workers handling deliveries.", workers)
+	metric("workers_busy", "gauge", "Workers running a handler.", busy)
+	metric("deliveries_failed_total", "counter", "Deliveries a handler failed, panics included.", failed)
+	metric("handler_panics_total", "counter", "Deliveries a handler panicked on.", panics)
+	// Left out when the broker can't be asked, rather than reported as 0.
+	fmt.Fprintf(w, "# HELP %squeue_depth Deliveries waiting for a worker.\n# TYPE %squeue_depth gauge\n", prefix, prefix)
+	for _, s := range r.subs {
+		if depth, err := r.Broker.QueueDepth(s.Queue); err == nil {
+			fmt.Fprintf(w, "%squeue_depth{queue=%q} %d\n", prefix, s.Queue, depth)
+		}
+	}
+	if r.Metrics != nil {
+		r.Metrics(w)
+	}
+}
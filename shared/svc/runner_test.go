@@ -0,0 +1,188 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forge-ai/forge/shared/mq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// startRunner runs r over sub on an mq.Memory until the returned cancel,
+// waiting for the queue to be subscribed. done is closed when Run returns.
+func startRunner(t *testing.T, r *Runner, sub Subscription) (bus *mq.Memory, cancel context.CancelFunc, done <-chan struct{}) {
+	t.Helper()
+	bus = mq.NewMemory()
+	t.Cleanup(bus.Close)
+	r.Broker = bus
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		if err := r.Run(ctx, sub); err != nil {
+			t.Errorf("run: %v", err)
+		}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := bus.QueueDepth(sub.Queue); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queue never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return bus, cancel, ran
+}
+
+func publish(t *testing.T, bus *mq.Memory, key, body string) {
+	t.Helper()
+	if err := bus.Publish(context.Background(), key, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		var zero T
+		return zero
+	}
+}
+
+func TestRunnerRecoversFromPanic(t *testing.T) {
+	handled := make(chan string, 4)
+	var requeued atomic.Int32
+	sub := Subscription{
+		Queue:   "test.work",
+		Pattern: "work.#",
+		Handler: func(_ context.Context, d amqp.Delivery) error {
+			if string(d.Body) == "boom" && !d.Redelivered {
+				panic("boom")
+			}
+			handled <- string(d.Body)
+			return nil
+		},
+		Requeue: func(_ context.Context, d amqp.Delivery, err error) bool {
+			requeued.Add(1)
+			return !d.Redelivered
+		},
+	}
+	r := &Runner{Name: "test"}
+	bus, _, _ := startRunner(t, r, sub)
+
+	publish(t, bus, "work.a", "boom")
+	// The panic is nacked and requeued, and the one worker lives on to
+	// handle the redelivery and what follows.
+	if got := waitFor(t, handled, "redelivery"); got != "boom" {
+		t.Errorf("handled %q, want the redelivered boom", got)
+	}
+	publish(t, bus, "work.b", "next")
+	if got := waitFor(t, handled, "next delivery"); got != "next" {
+		t.Errorf("handled %q, want next", got)
+	}
+
+	s := r.subs[0]
+	if s.panics.Load() != 1 || s.failed.Load() != 1 || requeued.Load() != 1 {
+		t.Errorf("panics %d, failed %d, requeue asked %d; want 1 each", s.panics.Load(), s.failed.Load(), requeued.Load())
+	}
+	if depth, _ := bus.QueueDepth(sub.Queue); depth != 0 {
+		t.Errorf("%d deliveries left", depth)
+	}
+}
+
+func TestRunnerDropsFailedWithoutRequeue(t *testing.T) {
+	calls := make(chan bool, 4)
+	sub := Subscription{
+		Queue:   "test.work",
+		Pattern: "work.#",
+		Handler: func(_ context.Context, d amqp.Delivery) error {
+			calls <- d.Redelivered
+			return errors.New("bad payload")
+		},
+	}
+	bus, _, _ := startRunner(t, &Runner{Name: "test"}, sub)
+	publish(t, bus, "work.a", "x")
+	waitFor(t, calls, "delivery")
+	select {
+	case <-calls:
+		t.Error("failed delivery redelivered with Requeue nil")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunnerDrainsInFlightHandlers(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan error, 1)
+	sub := Subscription{
+		Queue:   "test.work",
+		Pattern: "work.#",
+		Handler: func(ctx context.Context, _ amqp.Delivery) error {
+			close(started)
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			finished <- ctx.Err()
+			return nil
+		},
+	}
+	bus, cancel, done := startRunner(t, &Runner{Name: "test", Drain: 5 * time.Second}, sub)
+	publish(t, bus, "work.a", "x")
+	waitFor(t, started, "handler")
+
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("Run returned with a handler in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := waitFor(t, finished, "handler"); err != nil {
+		t.Errorf("handler context ended within the drain: %v", err)
+	}
+	waitFor(t, done, "Run to return")
+	if depth, _ := bus.QueueDepth(sub.Queue); depth != 0 {
+		t.Errorf("drained delivery not acked: depth %d", depth)
+	}
+}
+
+func TestRunnerCancelsHandlersPastDrain(t *testing.T) {
+	for _, drain := range []time.Duration{0, 50 * time.Millisecond} {
+		started := make(chan struct{})
+		finished := make(chan error, 1)
+		sub := Subscription{
+			Queue:   "test.work",
+			Pattern: "work.#",
+			Handler: func(ctx context.Context, _ amqp.Delivery) error {
+				close(started)
+				<-ctx.Done()
+				finished <- ctx.Err()
+				return ctx.Err()
+			},
+		}
+		bus, cancel, done := startRunner(t, &Runner{Name: "test", Drain: drain}, sub)
+		publish(t, bus, "work.a", "x")
+		waitFor(t, started, "handler")
+
+		start := time.Now()
+		cancel()
+		if err := waitFor(t, finished, "handler"); !errors.Is(err, context.Canceled) {
+			t.Errorf("drain %s: handler context ended with %v", drain, err)
+		}
+		if took := time.Since(start); took < drain {
+			t.Errorf("drain %s: handler cancelled after %s", drain, took)
+		}
+		waitFor(t, done, "Run to return")
+	}
+}
@@ -0,0 +1,94 @@
+// Package svc holds the startup boilerplate shared by every Forge service:
+// .env loading, logger configuration, signal handling and env helpers, and
+// the Runner that consumes a service's queues.
+package svc
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/forge-ai/forge/shared/logging"
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Bootstrap loads .env, configures the global logger (LOG_FORMAT, DEBUG=1
+// for debug level) and returns a context cancelled on SIGINT/SIGTERM.
+func Bootstrap() (context.Context, context.CancelFunc) {
+	_ = godotenv.Load()
+	logging.Setup()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if os.Getenv("DEBUG") == "1" {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// EnvOr returns the value of k, or def when unset or empty.
+func EnvOr(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
+
+// MustEnv returns the value of k and exits when it is missing.
+func MustEnv(k string) string {
+	v := os.Getenv(k)
+	if v == "" {
+		log.Fatal().Str("key", k).Msg("required env var missing")
+	}
+	return v
+}
+
+// EnvInt parses k as a positive integer — a pool size, a limit, a number of
+// attempts — falling back to def when it is unset or invalid. Zero is
+// invalid: none of these settings work with it.
+func EnvInt(k string, def int) int {
+	return envInt(k, def, 1)
+}
+
+// EnvCount is EnvInt for settings where zero means none or off, such as
+// retries on top of the first attempt.
+func EnvCount(k string, def int) int {
+	return envInt(k, def, 0)
+}
+
+func envInt(k string, def, least int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= least {
+			return n
+		}
+		log.Warn().Str("key", k).Str("value", v).Int("min", least).Msg("invalid integer — using default")
+	}
+	return def
+}
+
+// EnvFloat parses k as a non-negative number, falling back to def when it
+// is unset or invalid.
+func EnvFloat(k string, def float64) float64 {
+	if v := os.Getenv(k); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			return f
+		}
+		log.Warn().Str("key", k).Str("value", v).Msg("invalid number — using default")
+	}
+	return def
+}
+
+// EnvDuration parses k as a Go duration ("90s", "2m"), falling back to def
+// when it is unset or invalid.
+func EnvDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+		log.Warn().Str("key", k).Str("value", v).Msg("invalid duration — using default")
+	}
+	return def
+}
@@ -0,0 +1,25 @@
+package svc
+
+import "testing"
+
+func TestEnvInt(t *testing.T) {
+	for _, tc := range []struct {
+		value      string
+		int, count int
+	}{
+		{"", 7, 7},
+		{"12", 12, 12},
+		{"0", 7, 0},
+		{"-3", 7, 7},
+		{"ten", 7, 7},
+		{"1.5", 7, 7},
+	} {
+		t.Setenv("SVC_TEST_INT", tc.value)
+		if got := EnvInt("SVC_TEST_INT", 7); got != tc.int {
+			t.Errorf("EnvInt with %q = %d, want %d", tc.value, got, tc.int)
+		}
+		if got := EnvCount("SVC_TEST_INT", 7); got != tc.count {
+			t.Errorf("EnvCount with %q = %d, want %d", tc.value, got, tc.count)
+		}
+	}
+}
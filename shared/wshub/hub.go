@@ -0,0 +1,374 @@
+// Package wshub relays event envelopes to browser WebSocket clients. It
+// backs the live job feed of both the gateway and the orchestrator.
+//
+// A client that can't keep up is disconnected rather than silently skipped:
+// once its send buffer is full it gets what is already queued, then a close
+// frame. It reconnects with ?job=<id>&since=<envelope id> to be sent the
+// job's envelopes it missed, from a short per-job history, before the live
+// feed resumes; ?last=N instead, or as well, replays at most the job's N
+// latest. A job's history is dropped shortly after it is done or failed.
+package wshub
+
+import (
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/forge-ai/forge/shared/events"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// dedupWindow is how long the hub remembers the id of an envelope it
+	// broadcast, dropping the same envelope if it shows up again meanwhile.
+	dedupWindow = time.Minute
+	// sendBuffer is how many messages may queue for one client before it
+	// counts as too slow.
+	sendBuffer = 64
+	// historySize is how many envelopes are kept per job for replay, and
+	// maxHistoryJobs how many jobs have a history; the job that has been
+	// quiet longest is forgotten first.
+	historySize    = 200
+	maxHistoryJobs = 100
+	// endedRetention is how long a finished job's history is kept, for the
+	// clients that reconnect just as it ends.
+	endedRetention = 2 * time.Minute
+
+	// writeWait bounds one message's write, compressing it included; it is
+	// set afresh before each.
+	writeWait = 10 * time.Second
+	pongWait  = 60 * time.Second
+	pingEvery = 30 * time.Second
+)
+
+// Envelopes are verbose JSON. Browsers that offer permessage-deflate get
+// them compressed, at the fastest level since each message is compressed
+// once per client, and on its own: a log line shrinks by a quarter or so,
+// diff metadata with its regions and component tree far more. Messages
+// under compressMin aren't worth the CPU and go out as they are.
+const compressMin = 256
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin:       func(r *http.Request) bool { return true },
+	ReadBufferSize:    1024,
+	WriteBufferSize:   4096,
+	EnableCompression: true,
+}
+
+// Hub fans broadcast envelopes out to every connected client.
+type Hub struct {
+	bc chan []byte
+
+	// mu guards clients and history. Run holds it while it records and
+	// fans out a message, so a connecting client's replay and its live
+	// feed neither overlap nor leave a gap.
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	history map[string]*ring // job id → its latest envelopes
+
+	seen    map[string]time.Time // envelope id → when broadcast; Run's alone
+	dropped atomic.Int64         // messages not delivered to slow clients
+}
+
+type client struct {
+	conn    *websocket.Conn
+	send    chan []byte // closed once the client is unregistered
+	backlog [][]byte    // replayed before send
+	sent    int         // Run's alone
+	slow    bool        // unregistered for falling behind; set before send is closed
+}
+
+func New() *Hub {
+	return &Hub{
+		bc:      make(chan []byte, 512),
+		clients: make(map[*client]struct{}),
+		history: make(map[string]*ring),
+		seen:    make(map[string]time.Time),
+	}
+}
+
+// Run delivers broadcasts until ctx is done.
+func (h *Hub) Run(ctx context.Context) error {
+	prune := time.NewTicker(dedupWindow)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-prune.C:
+			for id, at := range h.seen {
+				if now.Sub(at) > dedupWindow {
+					delete(h.seen, id)
+				}
+			}
+			h.forgetEnded(now)
+		case msg := <-h.bc:
+			env := readEnvelope(msg)
+			if h.duplicate(env.ID) {
+				continue
+			}
+			h.mu.Lock()
+			h.record(env, msg)
+			for c := range h.clients {
+				select {
+				case c.send <- msg:
+					c.sent++
+				default:
+					h.dropped.Add(1)
+					c.slow = true
+					delete(h.clients, c)
+					close(c.send)
+					log.Warn().Int("sent", c.sent).Str("remote", c.conn.RemoteAddr().String()).
+						Msg("WS client too slow — disconnecting")
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// Broadcast queues an envelope for every client. If the hub itself is that
+// far behind, the envelope is dropped and counted.
+func (h *Hub) Broadcast(msg []byte) {
+	select {
+	case h.bc <- msg:
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+// Clients is the number of connected clients.
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Dropped is the number of envelopes that didn't reach a client since
+// startup.
+func (h *Hub) Dropped() int64 { return h.dropped.Load() }
+
+// envelope is the part of a broadcast envelope the hub reads.
+type envelope struct {
+	ID         string `json:"id"`
+	RoutingKey string `json:"routing_key"`
+	Payload    struct {
+		JobID string `json:"job_id"`
+	} `json:"payload"`
+}
+
+// readEnvelope reads what it can of msg; the fields it lacks are empty.
+func readEnvelope(msg []byte) envelope {
+	var env envelope
+	if json.Unmarshal(msg, &env) != nil {
+		return envelope{}
+	}
+	return env
+}
+
+// duplicate reports whether id was already broadcast within dedupWindow,
+// and remembers it otherwise. Messages without an id always go out.
+func (h *Hub) duplicate(id string) bool {
+	if id == "" {
+		return false
+	}
+	now := time.Now()
+	if at, ok := h.seen[id]; ok && now.Sub(at) <= dedupWindow {
+		return true
+	}
+	h.seen[id] = now
+	return false
+}
+
+// record adds msg to its job's history. Call with h.mu held.
+func (h *Hub) record(env envelope, msg []byte) {
+	jobID := env.Payload.JobID
+	if jobID == "" || env.ID == "" {
+		return
+	}
+	r := h.history[jobID]
+	if r == nil {
+		if len(h.history) >= maxHistoryJobs {
+			h.forgetQuietest()
+		}
+		r = &ring{}
+		h.history[jobID] = r
+	}
+	r.add(env.ID, msg)
+	// A retried job starts over, so anything after the end revives it.
+	r.ended = env.RoutingKey == events.JobDone || env.RoutingKey == events.JobFailed
+}
+
+// forgetEnded drops the histories of jobs that ended over endedRetention
+// ago.
+func (h *Hub) forgetEnded(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for job, r := range h.history {
+		if r.ended && now.Sub(r.touched) > endedRetention {
+			delete(h.history, job)
+		}
+	}
+}
+
+func (h *Hub) forgetQuietest() {
+	var quietest string
+	var at time.Time
+	for job, r := range h.history {
+		if quietest == "" || r.touched.Before(at) {
+			quietest, at = job, r.touched
+		}
+	}
+	delete(h.history, quietest)
+}
+
+// ServeWS upgrades the request and streams broadcasts to it. With ?job and
+// ?since, the job's envelopes after the one with id since are sent first,
+// or all that are kept if that one is too old; ?last=N sends at most the N
+// latest of those, or of all the job's kept envelopes without since.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	job, since := q.Get("job"), q.Get("since")
+	last := -1
+	if v := q.Get("last"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "last must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		last = n
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("WS upgrade failed")
+		return
+	}
+	conn.SetCompressionLevel(flate.BestSpeed)
+	c := &client{conn: conn, send: make(chan []byte, sendBuffer)}
+	h.mu.Lock()
+	if hist := h.history[job]; hist != nil && (since != "" || last >= 0) {
+		c.backlog = hist.after(since)
+		if last >= 0 && len(c.backlog) > last {
+			c.backlog = c.backlog[len(c.backlog)-last:]
+		}
+	}
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	log.Debug().Str("remote", r.RemoteAddr).Int("replayed", len(c.backlog)).Msg("WS connected")
+	go h.writePump(c)
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			h.remove(c)
+			return
+		}
+	}
+}
+
+// writePump is the connection's only writer: the replay, then broadcasts
+// and keepalive pings.
+func (h *Hub) writePump(c *client) {
+	defer func() {
+		c.conn.Close()
+		h.remove(c)
+	}()
+	for _, msg := range c.backlog {
+		if c.write(msg) != nil {
+			return
+		}
+	}
+	c.backlog = nil
+
+	ping := time.NewTicker(pingEvery)
+	defer ping.Stop()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				if c.slow {
+					// Tell the browser to reconnect and catch up.
+					c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+					c.conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect with since"))
+				}
+				return
+			}
+			if c.write(msg) != nil {
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if c.conn.WriteMessage(websocket.PingMessage, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends one envelope, compressed if it is long enough and the client
+// accepts compression.
+func (c *client) write(msg []byte) error {
+	c.conn.EnableWriteCompression(len(msg) >= compressMin)
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// remove unregisters c if Run hasn't already.
+func (h *Hub) remove(c *client) {
+	h.mu.Lock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	h.mu.Unlock()
+}
+
+// ring holds a job's latest envelopes, oldest first from start.
+type ring struct {
+	ids     [historySize]string
+	msgs    [historySize][]byte
+	start   int
+	n       int
+	touched time.Time
+	ended   bool // the latest envelope ended the job
+}
+
+func (r *ring) add(id string, msg []byte) {
+	i := (r.start + r.n) % historySize
+	if r.n == historySize {
+		r.start = (r.start + 1) % historySize
+	} else {
+		r.n++
+	}
+	r.ids[i], r.msgs[i] = id, msg
+	r.touched = time.Now()
+}
+
+// after returns the envelopes that followed the one with id since, or all
+// of them if it isn't kept or since is empty.
+func (r *ring) after(since string) [][]byte {
+	from := 0
+	for k := 0; k < r.n; k++ {
+		if r.ids[(r.start+k)%historySize] == since {
+			from = k + 1
+			break
+		}
+	}
+	out := make([][]byte, 0, r.n-from)
+	for k := from; k < r.n; k++ {
+		out = append(out, r.msgs[(r.start+k)%historySize])
+	}
+	return out
+}
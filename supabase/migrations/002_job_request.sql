@@ -0,0 +1,3 @@
+-- The submitted job as received, so a failed job can be retried with the
+-- same options (tolerance, prompt overrides, ignore regions…).
+alter table public.jobs add column request jsonb;
@@ -0,0 +1,3 @@
+-- The Figma export each iteration was compared against; screenshot_url
+-- holds the capture and diff_url the overlay.
+alter table public.iterations add column reference_url text;
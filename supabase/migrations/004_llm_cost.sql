@@ -0,0 +1,9 @@
+-- What each iteration's code cost to generate, and each finished job in
+-- all, at the orchestrator's LLM prices. Tokens of unpriced models count
+-- towards the tokens but not cost_usd.
+alter table public.iterations add column input_tokens int;
+alter table public.iterations add column output_tokens int;
+alter table public.iterations add column cost_usd float8;
+alter table public.jobs add column input_tokens int;
+alter table public.jobs add column output_tokens int;
+alter table public.jobs add column cost_usd float8;
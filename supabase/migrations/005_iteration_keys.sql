@@ -0,0 +1,7 @@
+-- Iterations are unique per screen×platform, so the orchestrator can
+-- upsert them and a redelivered diff doesn't record an iteration twice.
+-- Screens are told apart by index: two may share a name. Rows from before
+-- have no screen_index, and Postgres never counts nulls as duplicates.
+alter table public.iterations add column screen_index int;
+create unique index iterations_unit_iteration_key
+  on public.iterations (job_id, screen_index, platform, iteration);
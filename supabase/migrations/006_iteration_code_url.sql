@@ -0,0 +1,3 @@
+-- Where each iteration's code is kept in the forge-assets bucket, under
+-- code/<job>/<screen index>/<platform>/iter-<n>/.
+alter table public.iterations add column code_url text;
@@ -0,0 +1,4 @@
+-- The pipeline step a failed job failed at, as on job.failed, for the
+-- failure breakdown of /api/analytics.
+alter table public.jobs add column failed_step text;
+create index jobs_created_at_asc_idx on public.jobs (created_at, id);
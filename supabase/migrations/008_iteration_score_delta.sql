@@ -0,0 +1,4 @@
+-- How each iteration's scores moved from the previous iteration's, for
+-- charting a screen's convergence: {"score": 1.4, "layout": 3.2, ...}.
+-- Null on a first iteration.
+alter table public.iterations add column score_delta jsonb;
@@ -0,0 +1,22 @@
+-- One row per screen×platform of a job, written when it finishes: how it
+-- ended and its best iteration, for GET /api/jobs/{id}/screens. The
+-- iterations keep the history.
+create table public.screen_results (
+  job_id          uuid not null references public.jobs(id) on delete cascade,
+  screen_index    int  not null,
+  screen_name     text not null,
+  platform        text not null,
+  status          text not null, -- passed | max_iterations | stuck | skipped | failed
+  score           float8 not null, -- of the iteration it ended with
+  best_score      float8 not null,
+  best_iteration  int  not null default 0, -- 0 if none was diffed
+  iterations      int  not null default 0,
+  code_url        text,
+  diff_image_url  text,
+  duration_ms     bigint not null default 0,
+  completed_at    timestamptz default now(),
+  primary key (job_id, screen_index, platform)
+);
+
+alter table public.screen_results enable row level security;
+create policy "service_all" on public.screen_results for all to service_role using (true);
@@ -23,8 +23,13 @@ async function createJob(body) {
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(body),
     });
-    if (!r.ok)
-        throw new Error(await r.text());
+    if (!r.ok) {
+        const err = await r.json().catch(() => null);
+        if (err?.errors) {
+            throw new Error(Object.entries(err.errors).map(([field, msg]) => `${field}: ${msg}`).join('\n'));
+        }
+        throw new Error(err?.error ?? r.statusText);
+    }
     return r.json();
 }
 // ── App ───────────────────────────────────────────────────────────────────────
@@ -55,16 +60,24 @@ export default function App() {
     const logRef = useRef(null);
     const lineID = useRef(0);
     const wsRef = useRef(null);
+    // Last envelope seen and its job, so a reconnect can replay what was missed
+    const lastSeen = useRef(null);
     // ── WebSocket ──────────────────────────────────────────────────────────────
     const connectWS = useCallback(() => {
         if (wsRef.current?.readyState === WebSocket.OPEN)
             return;
-        const ws = new WebSocket(WS);
+        const seen = lastSeen.current;
+        const ws = new WebSocket(seen
+            ? `${WS}?job=${encodeURIComponent(seen.job)}&since=${encodeURIComponent(seen.id)}`
+            : WS);
         wsRef.current = ws;
         ws.onopen = () => { setConnected(true); console.log('[forge] WS connected'); };
         ws.onmessage = (e) => {
             try {
                 const ev = JSON.parse(e.data);
+                const job = ev.payload?.job_id;
+                if (ev.id && typeof job === 'string' && job)
+                    lastSeen.current = { job, id: ev.id };
                 handleEvent(ev);
             }
             catch { }